@@ -1,14 +1,23 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"net"
+	"os"
 
 	"github.com/polyakovaa/grpcproxy/auth_service/config"
 	"github.com/polyakovaa/grpcproxy/auth_service/internal/handler"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/keys"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/mail"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/oidc"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/password"
 	"github.com/polyakovaa/grpcproxy/auth_service/internal/repository"
 	"github.com/polyakovaa/grpcproxy/auth_service/internal/service"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/throttle"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/validation"
 	"github.com/polyakovaa/grpcproxy/gen/auth"
+	"github.com/polyakovaa/grpcproxy/svcauth"
 	"google.golang.org/grpc"
 )
 
@@ -24,14 +33,105 @@ func main() {
 	}
 	defer db.Close()
 
+	opts := []service.Option{
+		service.WithTokenClaims(cfg.JWT.Issuer, cfg.JWT.Audience, cfg.JWT.Leeway),
+		service.WithLegacyClaims(cfg.JWT.AcceptLegacyClaims),
+	}
+	if len(cfg.JWT.Keys) > 0 {
+		keySet, err := loadKeySet(cfg.JWT)
+		if err != nil {
+			log.Fatalf("Failed to load signing keys: %v", err)
+		}
+		opts = append(opts,
+			service.WithSigningKeys(keySet),
+			service.WithSharedSecretUntil(cfg.JWT.SecretAcceptedUntil),
+		)
+	}
+	if cfg.JWT.ImpersonationTTL > 0 {
+		opts = append(opts, service.WithImpersonationTTL(cfg.JWT.ImpersonationTTL))
+	}
+	if cfg.OAuth.Enabled {
+		// ID tokens are verified by clients against the published JWKS, so
+		// they cannot be signed with the shared secret.
+		if len(cfg.JWT.Keys) == 0 {
+			log.Fatalf("OAuth requires asymmetric signing keys, configure jwt.keys")
+		}
+		opts = append(opts, service.WithOAuth(repository.NewOAuthRepository(db), cfg.OAuth.IssuerURL, cfg.OAuth.CodeTTL))
+	}
+	if len(cfg.Federation.Providers) > 0 {
+		providers, err := identityProviders(cfg.Federation.Providers)
+		if err != nil {
+			log.Fatalf("Invalid federation config: %v", err)
+		}
+		opts = append(opts, service.WithFederation(repository.NewIdentityRepository(db), cfg.Federation.StateTTL, providers...))
+	}
+
+	hasher, err := password.NewHasher(cfg.PasswordHashing.Algorithm, password.Argon2Params{
+		Memory:      cfg.PasswordHashing.Argon2.Memory,
+		Iterations:  cfg.PasswordHashing.Argon2.Iterations,
+		Parallelism: cfg.PasswordHashing.Argon2.Parallelism,
+		SaltLength:  cfg.PasswordHashing.Argon2.SaltLength,
+		KeyLength:   cfg.PasswordHashing.Argon2.KeyLength,
+	}, cfg.PasswordHashing.BcryptCost)
+	if err != nil {
+		log.Fatalf("Failed to set up password hashing: %v", err)
+	}
+	opts = append(opts, service.WithPasswordHasher(hasher))
+
+	policy, err := validationPolicy(cfg.Validation)
+	if err != nil {
+		log.Fatalf("Failed to set up validation policy: %v", err)
+	}
+	opts = append(opts, service.WithValidationPolicy(policy))
+
+	mailer, err := newMailer(cfg.Mail)
+	if err != nil {
+		log.Fatalf("Failed to set up mailer: %v", err)
+	}
+	opts = append(opts,
+		service.WithMailer(mailer),
+		service.WithPasswordReset(cfg.PasswordReset.TokenTTL, cfg.PasswordReset.URL),
+		service.WithEmailVerification(cfg.EmailVerification.TokenTTL, cfg.EmailVerification.URL, cfg.EmailVerification.ResendCooldown),
+		service.WithMagicLink(cfg.MagicLink.TokenTTL, cfg.MagicLink.URL),
+	)
+
+	if cfg.LoginThrottle.Enabled {
+		var store throttle.Store
+		switch cfg.LoginThrottle.Store {
+		case "postgres":
+			store = repository.NewThrottleRepository(db)
+		case "memory", "":
+			store = throttle.NewMemoryStore()
+		default:
+			log.Fatalf("Unknown login throttle store %q", cfg.LoginThrottle.Store)
+		}
+		opts = append(opts, service.WithLoginThrottle(
+			throttle.NewLimiter("account", store, throttlePolicy(cfg.LoginThrottle.Account)),
+			throttle.NewLimiter("ip", store, throttlePolicy(cfg.LoginThrottle.IP)),
+		))
+	}
+	if cfg.LoginThrottle.Enabled && cfg.ServiceAuth.Secret == "" {
+		log.Printf("service_auth.secret is not set; logins are not throttled per client IP")
+	}
+
 	userRepo := repository.NewUserRepository(db)
 	tokenRepo := repository.NewTokenRepository(db)
+	auditRepo := repository.NewAuditRepository(db)
+	actionRepo := repository.NewActionTokenRepository(db)
+	mfaRepo := repository.NewMFARepository(db)
+	personalTokenRepo := repository.NewPersonalTokenRepository(db)
 	authService := service.NewAuthService(
 		userRepo,
 		tokenRepo,
 		cfg.JWT.Secret,
 		cfg.JWT.AccessTTL,
 		cfg.JWT.RefreshTTL,
+		append(opts,
+			service.WithAuditRepo(auditRepo),
+			service.WithActionTokenRepo(actionRepo),
+			service.WithMFA(mfaRepo, cfg.MFA.Issuer, cfg.MFA.ChallengeTTL),
+			service.WithPersonalAccessTokens(personalTokenRepo),
+		)...,
 	)
 	authHandler := handler.NewAuthHandler(authService)
 
@@ -40,7 +140,12 @@ func main() {
 		log.Fatalf("Failed to listen: %v", err)
 	}
 
-	grpcServer := grpc.NewServer()
+	if cfg.ServiceAuth.Enforce && cfg.ServiceAuth.Secret == "" {
+		log.Fatalf("service_auth.enforce requires service_auth.secret")
+	}
+	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(
+		svcauth.UnaryServerInterceptor([]byte(cfg.ServiceAuth.Secret), cfg.ServiceAuth.Enforce),
+	))
 
 	auth.RegisterAuthServiceServer(grpcServer, authHandler)
 
@@ -49,3 +154,89 @@ func main() {
 		log.Fatalf("Failed to serve: %v", err)
 	}
 }
+
+func loadKeySet(cfg config.JWTConfig) (*keys.KeySet, error) {
+	loaded := make([]*keys.Key, 0, len(cfg.Keys))
+	for _, k := range cfg.Keys {
+		key, err := keys.LoadKey(k.ID, k.Algorithm, k.PrivateKeyFile, k.PublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		loaded = append(loaded, key)
+	}
+	return keys.NewKeySet(cfg.ActiveKeyID, loaded...)
+}
+
+func newMailer(cfg config.MailConfig) (mail.Mailer, error) {
+	switch cfg.Driver {
+	case "smtp":
+		return mail.NewSMTPMailer(cfg.SMTP.Host, cfg.SMTP.Port, cfg.SMTP.Username, cfg.SMTP.Password, cfg.From), nil
+	case "file":
+		return mail.NewFileMailer(cfg.FilePath, cfg.From)
+	case "stdout", "":
+		return mail.NewWriterMailer(os.Stdout, cfg.From), nil
+	}
+	return nil, fmt.Errorf("unknown mail driver %q", cfg.Driver)
+}
+
+func throttlePolicy(cfg config.ThrottlePolicyConfig) throttle.Policy {
+	return throttle.Policy{
+		FreeAttempts:    cfg.FreeAttempts,
+		BaseDelay:       cfg.BaseDelay,
+		MaxDelay:        cfg.MaxDelay,
+		LockoutAfter:    cfg.LockoutAfter,
+		LockoutDuration: cfg.LockoutDuration,
+		Window:          cfg.Window,
+	}
+}
+
+func validationPolicy(cfg config.ValidationConfig) (*validation.Policy, error) {
+	policy := &validation.Policy{
+		PasswordMinLength:  cfg.Password.MinLength,
+		PasswordMaxLength:  cfg.Password.MaxLength,
+		PasswordMinClasses: cfg.Password.MinClasses,
+		UsernameMinLength:  cfg.Username.MinLength,
+		UsernameMaxLength:  cfg.Username.MaxLength,
+
+		DisplayNameMaxLength: cfg.Profile.DisplayNameMaxLength,
+		BioMaxLength:         cfg.Profile.BioMaxLength,
+	}
+	if cfg.Password.BreachedListFile != "" {
+		list, err := validation.LoadBreachedList(cfg.Password.BreachedListFile)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Loaded %d breached passwords", list.Len())
+		policy.Breached = list
+	}
+	return policy, nil
+}
+
+func identityProviders(cfgs []config.IdentityProviderConfig) ([]*oidc.Provider, error) {
+	seen := map[string]bool{}
+	providers := make([]*oidc.Provider, 0, len(cfgs))
+	for _, c := range cfgs {
+		if c.ID == "" || c.IssuerURL == "" || c.ClientID == "" || c.RedirectURL == "" {
+			return nil, fmt.Errorf("provider %q needs id, issuer_url, client_id and redirect_url", c.ID)
+		}
+		if seen[c.ID] {
+			return nil, fmt.Errorf("duplicate provider id %q", c.ID)
+		}
+		seen[c.ID] = true
+
+		name := c.Name
+		if name == "" {
+			name = c.ID
+		}
+		providers = append(providers, oidc.New(oidc.Config{
+			ID:           c.ID,
+			Name:         name,
+			IssuerURL:    c.IssuerURL,
+			ClientID:     c.ClientID,
+			ClientSecret: c.ClientSecret,
+			RedirectURL:  c.RedirectURL,
+			Scopes:       c.Scopes,
+		}, nil))
+	}
+	return providers, nil
+}
@@ -13,6 +13,18 @@ type AuthServiceConfig struct {
 	Database DBConfig      `yaml:"database"`
 	Logging  LoggingConfig `yaml:"logging"`
 	JWT      JWTConfig     `yaml:"jwt"`
+
+	Mail              MailConfig              `yaml:"mail"`
+	PasswordReset     PasswordResetConfig     `yaml:"password_reset"`
+	EmailVerification EmailVerificationConfig `yaml:"email_verification"`
+	MagicLink         MagicLinkConfig         `yaml:"magic_link"`
+	LoginThrottle     LoginThrottleConfig     `yaml:"login_throttle"`
+	MFA               MFAConfig               `yaml:"mfa"`
+	PasswordHashing   PasswordHashingConfig   `yaml:"password_hashing"`
+	Validation        ValidationConfig        `yaml:"validation"`
+	OAuth             OAuthConfig             `yaml:"oauth"`
+	Federation        FederationConfig        `yaml:"federation"`
+	ServiceAuth       ServiceAuthConfig       `yaml:"service_auth"`
 }
 
 type ServerConfig struct {
@@ -38,9 +50,161 @@ type DBConfig struct {
 }
 
 type JWTConfig struct {
-	Secret     string        `yaml:"secret"`
-	AccessTTL  time.Duration `yaml:"access_ttl"`
-	RefreshTTL time.Duration `yaml:"refresh_ttl"`
+	Secret             string             `yaml:"secret"`
+	AccessTTL          time.Duration      `yaml:"access_ttl"`
+	RefreshTTL         time.Duration      `yaml:"refresh_ttl"`
+	ImpersonationTTL   time.Duration      `yaml:"impersonation_ttl"`
+	Issuer             string             `yaml:"issuer"`
+	Audience           string             `yaml:"audience"`
+	Leeway             time.Duration      `yaml:"leeway"`
+	AcceptLegacyClaims bool               `yaml:"accept_legacy_claims"`
+	ActiveKeyID        string             `yaml:"active_key_id"`
+	Keys               []SigningKeyConfig `yaml:"keys"`
+	// SecretAcceptedUntil keeps tokens signed with Secret valid until then
+	// once Keys are configured. Afterwards only the keys are trusted.
+	SecretAcceptedUntil time.Time `yaml:"secret_accepted_until"`
+}
+
+type SigningKeyConfig struct {
+	ID             string `yaml:"id"`
+	Algorithm      string `yaml:"algorithm"`
+	PrivateKeyFile string `yaml:"private_key_file"`
+	PublicKeyFile  string `yaml:"public_key_file"`
+}
+
+type MailConfig struct {
+	// Driver is one of smtp, file or stdout.
+	Driver   string     `yaml:"driver"`
+	From     string     `yaml:"from"`
+	FilePath string     `yaml:"file_path"`
+	SMTP     SMTPConfig `yaml:"smtp"`
+}
+
+type SMTPConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+type PasswordResetConfig struct {
+	TokenTTL time.Duration `yaml:"token_ttl"`
+	URL      string        `yaml:"url"`
+}
+
+type EmailVerificationConfig struct {
+	TokenTTL       time.Duration `yaml:"token_ttl"`
+	URL            string        `yaml:"url"`
+	ResendCooldown time.Duration `yaml:"resend_cooldown"`
+}
+
+// MagicLinkConfig configures passwordless login links. They are disabled
+// while URL is empty.
+type MagicLinkConfig struct {
+	TokenTTL time.Duration `yaml:"token_ttl"`
+	URL      string        `yaml:"url"`
+}
+
+type LoginThrottleConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Store is memory or postgres. Use postgres when running more than one
+	// replica so that all of them see the same counters.
+	Store   string               `yaml:"store"`
+	Account ThrottlePolicyConfig `yaml:"account"`
+	IP      ThrottlePolicyConfig `yaml:"ip"`
+}
+
+type ThrottlePolicyConfig struct {
+	FreeAttempts    int           `yaml:"free_attempts"`
+	BaseDelay       time.Duration `yaml:"base_delay"`
+	MaxDelay        time.Duration `yaml:"max_delay"`
+	LockoutAfter    int           `yaml:"lockout_after"`
+	LockoutDuration time.Duration `yaml:"lockout_duration"`
+	Window          time.Duration `yaml:"window"`
+}
+
+type MFAConfig struct {
+	// Issuer is the name authenticator apps show next to the account.
+	Issuer       string        `yaml:"issuer"`
+	ChallengeTTL time.Duration `yaml:"challenge_ttl"`
+}
+
+type PasswordHashingConfig struct {
+	// Algorithm is argon2id or bcrypt. Hashes of the other algorithm are
+	// still accepted and replaced on the next successful login.
+	Algorithm  string       `yaml:"algorithm"`
+	Argon2     Argon2Config `yaml:"argon2"`
+	BcryptCost int          `yaml:"bcrypt_cost"`
+}
+
+type Argon2Config struct {
+	// Memory is in KiB.
+	Memory      uint32 `yaml:"memory"`
+	Iterations  uint32 `yaml:"iterations"`
+	Parallelism uint8  `yaml:"parallelism"`
+	SaltLength  uint32 `yaml:"salt_length"`
+	KeyLength   uint32 `yaml:"key_length"`
+}
+
+type ValidationConfig struct {
+	Password PasswordPolicyConfig `yaml:"password"`
+	Username UsernamePolicyConfig `yaml:"username"`
+	Profile  ProfilePolicyConfig  `yaml:"profile"`
+}
+
+type PasswordPolicyConfig struct {
+	MinLength  int `yaml:"min_length"`
+	MaxLength  int `yaml:"max_length"`
+	MinClasses int `yaml:"min_classes"`
+	// BreachedListFile holds one known-breached password per line.
+	BreachedListFile string `yaml:"breached_list_file"`
+}
+
+type UsernamePolicyConfig struct {
+	MinLength int `yaml:"min_length"`
+	MaxLength int `yaml:"max_length"`
+}
+
+type ProfilePolicyConfig struct {
+	DisplayNameMaxLength int `yaml:"display_name_max_length"`
+	BioMaxLength         int `yaml:"bio_max_length"`
+}
+
+type OAuthConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// IssuerURL is the public URL of the gateway. Clients find the
+	// endpoints below it and check it against the iss claim of ID tokens.
+	IssuerURL string        `yaml:"issuer_url"`
+	CodeTTL   time.Duration `yaml:"code_ttl"`
+}
+
+// FederationConfig lists the upstream OpenID Connect providers users can
+// sign in with. StateTTL is how long a user may take at the provider.
+type FederationConfig struct {
+	StateTTL  time.Duration            `yaml:"state_ttl"`
+	Providers []IdentityProviderConfig `yaml:"providers"`
+}
+
+type IdentityProviderConfig struct {
+	// ID appears in the callback URL and identifies linked accounts, so it
+	// must not change once users signed in with the provider.
+	ID           string `yaml:"id"`
+	Name         string `yaml:"name"`
+	IssuerURL    string `yaml:"issuer_url"`
+	ClientID     string `yaml:"client_id"`
+	ClientSecret string `yaml:"client_secret"`
+	// RedirectURL is the gateway callback registered with the provider,
+	// e.g. https://club.example.com/auth/oidc/google/callback.
+	RedirectURL string   `yaml:"redirect_url"`
+	Scopes      []string `yaml:"scopes"`
+}
+
+// ServiceAuthConfig holds the secret the gateway signs caller identities
+// with. Enforce rejects calls without a valid signature; leave it off until
+// the gateway is configured with the same secret.
+type ServiceAuthConfig struct {
+	Secret  string `yaml:"secret"`
+	Enforce bool   `yaml:"enforce"`
 }
 
 func LoadConfig(path string) (*AuthServiceConfig, error) {
@@ -56,6 +220,46 @@ func LoadConfig(path string) (*AuthServiceConfig, error) {
 		return nil, fmt.Errorf("failed to decode YAML: %w", err)
 	}
 
+	if cfg.PasswordReset.TokenTTL == 0 {
+		cfg.PasswordReset.TokenTTL = time.Hour
+	}
+	if cfg.EmailVerification.TokenTTL == 0 {
+		cfg.EmailVerification.TokenTTL = 24 * time.Hour
+	}
+	if cfg.EmailVerification.ResendCooldown == 0 {
+		cfg.EmailVerification.ResendCooldown = time.Minute
+	}
+	if cfg.MagicLink.TokenTTL == 0 {
+		cfg.MagicLink.TokenTTL = 15 * time.Minute
+	}
+	if cfg.MFA.ChallengeTTL == 0 {
+		cfg.MFA.ChallengeTTL = 5 * time.Minute
+	}
+	if cfg.Validation.Password.MinLength == 0 {
+		cfg.Validation.Password.MinLength = 8
+	}
+	if cfg.Validation.Password.MaxLength == 0 {
+		cfg.Validation.Password.MaxLength = 128
+	}
+	if cfg.Validation.Username.MinLength == 0 {
+		cfg.Validation.Username.MinLength = 3
+	}
+	if cfg.Validation.Username.MaxLength == 0 {
+		cfg.Validation.Username.MaxLength = 32
+	}
+	if cfg.Validation.Profile.DisplayNameMaxLength == 0 {
+		cfg.Validation.Profile.DisplayNameMaxLength = 64
+	}
+	if cfg.Validation.Profile.BioMaxLength == 0 {
+		cfg.Validation.Profile.BioMaxLength = 1000
+	}
+	if cfg.OAuth.CodeTTL == 0 {
+		cfg.OAuth.CodeTTL = time.Minute
+	}
+	if cfg.Federation.StateTTL == 0 {
+		cfg.Federation.StateTTL = 10 * time.Minute
+	}
+
 	
 
 	return &cfg, nil
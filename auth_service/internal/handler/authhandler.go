@@ -3,8 +3,10 @@ package handler
 import (
 	"context"
 	"log"
+	"strings"
 	"time"
 
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/model"
 	"github.com/polyakovaa/grpcproxy/auth_service/internal/service"
 	"github.com/polyakovaa/grpcproxy/gen/auth"
 	"google.golang.org/protobuf/types/known/timestamppb"
@@ -22,13 +24,13 @@ func NewAuthHandler(authtService *service.AuthService) *AuthHandler {
 }
 
 func (h *AuthHandler) Register(ctx context.Context, req *auth.RegisterRequest) (*auth.AuthResponse, error) {
-	user, err := h.authService.RegisterUser(req.UserName, req.Email, req.Password)
+	user, err := h.authService.RegisterUser(req.UserName, req.Email, req.Password, clientInfo(ctx))
 	if err != nil {
 		log.Printf("Failed to register user %v", err)
 		return nil, err
 	}
 
-	token, err := h.authService.GenerateTokens(user.ID)
+	token, err := h.authService.GenerateTokens(user.ID, clientInfo(ctx))
 	if err != nil {
 		log.Printf("Failed to generate tokens for user %v", err)
 		return nil, err
@@ -43,7 +45,11 @@ func (h *AuthHandler) Register(ctx context.Context, req *auth.RegisterRequest) (
 }
 
 func (h *AuthHandler) ValidateToken(ctx context.Context, req *auth.ValidateTokenRequest) (*auth.UserResponse, error) {
-	user, exp, valid := h.authService.ValidateAccessToken(req.Token)
+	if service.IsPersonalToken(req.Token) {
+		return h.validatePersonalToken(req.Token), nil
+	}
+
+	user, info, valid := h.authService.InspectAccessToken(req.Token)
 	if !valid {
 		return &auth.UserResponse{Valid: false}, nil
 	}
@@ -52,18 +58,65 @@ func (h *AuthHandler) ValidateToken(ctx context.Context, req *auth.ValidateToken
 		UserId:         user.ID,
 		Email:          user.Email,
 		UserName:       user.UserName,
-		TokenExpiresAt: timestamppb.New(exp),
+		TokenExpiresAt: timestamppb.New(info.ExpiresAt),
+		Roles:          user.Roles,
+		EmailVerified:  user.EmailVerified,
+		Scopes:         info.Scopes,
+		ClientId:       info.ClientID,
+		ActorId:        info.ActorID,
 	}, nil
 
 }
 
+func (h *AuthHandler) validatePersonalToken(token string) *auth.UserResponse {
+	user, pat, err := h.authService.ValidatePersonalToken(token)
+	if err != nil {
+		return &auth.UserResponse{Valid: false}
+	}
+
+	resp := &auth.UserResponse{
+		Valid:         true,
+		UserId:        user.ID,
+		Email:         user.Email,
+		UserName:      user.UserName,
+		Roles:         user.Roles,
+		EmailVerified: user.EmailVerified,
+		PersonalToken: true,
+		Scopes:        pat.Scopes,
+	}
+	if pat.ExpiresAt != nil {
+		resp.TokenExpiresAt = timestamppb.New(*pat.ExpiresAt)
+	}
+	return resp
+}
+
 func (h *AuthHandler) Login(ctx context.Context, req *auth.LoginRequest) (*auth.AuthResponse, error) {
-	user, err := h.authService.Login(req.Email, req.Password)
+	user, err := h.authService.Login(req.Email, req.Password, clientInfo(ctx))
 	if err != nil {
 		log.Printf("Failed login for %s: %v", req.Email, err)
 		return nil, err
 	}
-	token, err := h.authService.GenerateTokens(user.ID)
+
+	return h.signIn(ctx, user)
+}
+
+// signIn answers a successful first factor with an MFA challenge if the
+// user enabled MFA and with a new token pair otherwise.
+func (h *AuthHandler) signIn(ctx context.Context, user *model.User) (*auth.AuthResponse, error) {
+	if user.MFAEnabled {
+		challenge, err := h.authService.CreateMFAChallenge(user.ID)
+		if err != nil {
+			log.Printf("Failed to create mfa challenge for user %s: %v", user.ID, err)
+			return nil, err
+		}
+		return &auth.AuthResponse{
+			UserId:      user.ID,
+			MfaRequired: true,
+			MfaToken:    challenge,
+		}, nil
+	}
+
+	token, err := h.authService.GenerateTokens(user.ID, clientInfo(ctx))
 	if err != nil {
 		log.Printf("Failed to generate tokens for user %v", err)
 		return nil, err
@@ -75,10 +128,10 @@ func (h *AuthHandler) Login(ctx context.Context, req *auth.LoginRequest) (*auth.
 		ExpiresAt:    timestamppb.New(time.Now().Add(h.authService.AccessTTL())),
 		UserId:       user.ID,
 	}, nil
-
 }
+
 func (h *AuthHandler) RefreshToken(ctx context.Context, req *auth.RefreshTokenRequest) (*auth.AuthResponse, error) {
-	newTokens, err := h.authService.RefreshToken(req.RefreshToken)
+	newTokens, err := h.authService.RefreshToken(req.RefreshToken, clientInfo(ctx))
 	if err != nil {
 		log.Printf("Failed to refresh token: %v", err)
 		return nil, err
@@ -90,3 +143,692 @@ func (h *AuthHandler) RefreshToken(ctx context.Context, req *auth.RefreshTokenRe
 		ExpiresAt:    timestamppb.New(time.Now().Add(h.authService.AccessTTL())),
 	}, nil
 }
+
+func (h *AuthHandler) Logout(ctx context.Context, req *auth.LogoutRequest) (*auth.LogoutResponse, error) {
+	if err := h.authService.Logout(req.RefreshToken, req.AccessToken); err != nil {
+		log.Printf("Failed to logout: %v", err)
+		return nil, err
+	}
+
+	return &auth.LogoutResponse{Success: true}, nil
+}
+
+func (h *AuthHandler) LogoutAll(ctx context.Context, req *auth.LogoutAllRequest) (*auth.LogoutResponse, error) {
+	if err := h.authService.LogoutAll(req.AccessToken); err != nil {
+		log.Printf("Failed to logout all sessions: %v", err)
+		return nil, err
+	}
+
+	return &auth.LogoutResponse{Success: true}, nil
+}
+
+func (h *AuthHandler) GetJWKS(ctx context.Context, req *auth.GetJWKSRequest) (*auth.JWKSResponse, error) {
+	jwks := h.authService.JWKS()
+
+	resp := &auth.JWKSResponse{Keys: make([]*auth.JWK, 0, len(jwks))}
+	for _, k := range jwks {
+		resp.Keys = append(resp.Keys, &auth.JWK{
+			Kty: k.Kty,
+			Kid: k.Kid,
+			Use: k.Use,
+			Alg: k.Alg,
+			N:   k.N,
+			E:   k.E,
+			Crv: k.Crv,
+			X:   k.X,
+		})
+	}
+
+	return resp, nil
+}
+
+func (h *AuthHandler) GrantRole(ctx context.Context, req *auth.RoleRequest) (*auth.RolesResponse, error) {
+	user, err := h.authService.GrantRole(req.AccessToken, req.UserId, req.Role)
+	if err != nil {
+		log.Printf("Failed to grant role %s to user %s: %v", req.Role, req.UserId, err)
+		return nil, err
+	}
+
+	return &auth.RolesResponse{UserId: user.ID, Roles: user.Roles}, nil
+}
+
+func (h *AuthHandler) RevokeRole(ctx context.Context, req *auth.RoleRequest) (*auth.RolesResponse, error) {
+	user, err := h.authService.RevokeRole(req.AccessToken, req.UserId, req.Role)
+	if err != nil {
+		log.Printf("Failed to revoke role %s from user %s: %v", req.Role, req.UserId, err)
+		return nil, err
+	}
+
+	return &auth.RolesResponse{UserId: user.ID, Roles: user.Roles}, nil
+}
+
+func (h *AuthHandler) RequestPasswordReset(ctx context.Context, req *auth.RequestPasswordResetRequest) (*auth.PasswordResetResponse, error) {
+	if err := h.authService.RequestPasswordReset(req.Email); err != nil {
+		log.Printf("Failed to request password reset: %v", err)
+		return nil, err
+	}
+
+	return &auth.PasswordResetResponse{Success: true}, nil
+}
+
+func (h *AuthHandler) ResetPassword(ctx context.Context, req *auth.ResetPasswordRequest) (*auth.PasswordResetResponse, error) {
+	if err := h.authService.ResetPassword(req.Token, req.NewPassword); err != nil {
+		log.Printf("Failed to reset password: %v", err)
+		return nil, err
+	}
+
+	return &auth.PasswordResetResponse{Success: true}, nil
+}
+
+func (h *AuthHandler) RequestMagicLink(ctx context.Context, req *auth.RequestMagicLinkRequest) (*auth.MagicLinkResponse, error) {
+	if err := h.authService.RequestMagicLink(req.Email); err != nil {
+		log.Printf("Failed to request magic link: %v", err)
+		return nil, err
+	}
+
+	return &auth.MagicLinkResponse{Success: true}, nil
+}
+
+func (h *AuthHandler) ConsumeMagicLink(ctx context.Context, req *auth.ConsumeMagicLinkRequest) (*auth.AuthResponse, error) {
+	user, err := h.authService.ConsumeMagicLink(req.Token, clientInfo(ctx))
+	if err != nil {
+		log.Printf("Failed magic link login: %v", err)
+		return nil, err
+	}
+
+	return h.signIn(ctx, user)
+}
+
+func (h *AuthHandler) VerifyEmail(ctx context.Context, req *auth.VerifyEmailRequest) (*auth.EmailVerificationResponse, error) {
+	user, err := h.authService.VerifyEmail(req.Token)
+	if err != nil {
+		log.Printf("Failed to verify email: %v", err)
+		return nil, err
+	}
+
+	return &auth.EmailVerificationResponse{Success: true, UserId: user.ID}, nil
+}
+
+func (h *AuthHandler) ResendVerificationEmail(ctx context.Context, req *auth.ResendVerificationEmailRequest) (*auth.EmailVerificationResponse, error) {
+	if err := h.authService.ResendVerificationEmail(req.AccessToken); err != nil {
+		log.Printf("Failed to resend verification email: %v", err)
+		return nil, err
+	}
+
+	return &auth.EmailVerificationResponse{Success: true}, nil
+}
+
+func (h *AuthHandler) EnrollTOTP(ctx context.Context, req *auth.EnrollTOTPRequest) (*auth.EnrollTOTPResponse, error) {
+	secret, uri, err := h.authService.EnrollTOTP(req.AccessToken)
+	if err != nil {
+		log.Printf("Failed to enroll totp: %v", err)
+		return nil, err
+	}
+
+	return &auth.EnrollTOTPResponse{Secret: secret, OtpauthUri: uri}, nil
+}
+
+func (h *AuthHandler) ConfirmTOTP(ctx context.Context, req *auth.TOTPCodeRequest) (*auth.RecoveryCodesResponse, error) {
+	codes, err := h.authService.ConfirmTOTP(req.AccessToken, req.Code)
+	if err != nil {
+		log.Printf("Failed to confirm totp: %v", err)
+		return nil, err
+	}
+
+	return &auth.RecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+func (h *AuthHandler) DisableTOTP(ctx context.Context, req *auth.TOTPCodeRequest) (*auth.MFAStatusResponse, error) {
+	if err := h.authService.DisableTOTP(req.AccessToken, req.Code); err != nil {
+		log.Printf("Failed to disable totp: %v", err)
+		return nil, err
+	}
+
+	return &auth.MFAStatusResponse{Enabled: false}, nil
+}
+
+func (h *AuthHandler) VerifySecondFactor(ctx context.Context, req *auth.VerifySecondFactorRequest) (*auth.AuthResponse, error) {
+	user, err := h.authService.VerifySecondFactor(req.MfaToken, req.Code, clientInfo(ctx))
+	if err != nil {
+		log.Printf("Failed second factor: %v", err)
+		return nil, err
+	}
+
+	token, err := h.authService.GenerateTokens(user.ID, clientInfo(ctx))
+	if err != nil {
+		log.Printf("Failed to generate tokens for user %v", err)
+		return nil, err
+	}
+
+	return &auth.AuthResponse{
+		AccessToken:  token.AccessToken,
+		RefreshToken: token.RefreshToken,
+		ExpiresAt:    timestamppb.New(time.Now().Add(h.authService.AccessTTL())),
+		UserId:       user.ID,
+	}, nil
+}
+
+func userProfile(user *model.User) *auth.UserProfile {
+	profile := &auth.UserProfile{
+		UserId:        user.ID,
+		UserName:      user.UserName,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		DisplayName:   user.DisplayName,
+		Bio:           user.Bio,
+		Roles:         user.Roles,
+		MfaEnabled:    user.MFAEnabled,
+		CreatedAt:     timestamppb.New(user.CreatedAt),
+	}
+	if user.SuspendedAt != nil {
+		profile.SuspendedAt = timestamppb.New(*user.SuspendedAt)
+	}
+	return profile
+}
+
+func (h *AuthHandler) GetUser(ctx context.Context, req *auth.GetUserRequest) (*auth.UserProfile, error) {
+	user, err := h.authService.GetUser(req.AccessToken)
+	if err != nil {
+		log.Printf("Failed to get user: %v", err)
+		return nil, err
+	}
+
+	return userProfile(user), nil
+}
+
+func (h *AuthHandler) UpdateProfile(ctx context.Context, req *auth.UpdateProfileRequest) (*auth.UserProfile, error) {
+	user, err := h.authService.UpdateProfile(req.AccessToken, model.ProfileUpdate{
+		UserName:    req.UserName,
+		DisplayName: req.DisplayName,
+		Bio:         req.Bio,
+	})
+	if err != nil {
+		log.Printf("Failed to update profile: %v", err)
+		return nil, err
+	}
+
+	return userProfile(user), nil
+}
+
+func (h *AuthHandler) ChangeEmail(ctx context.Context, req *auth.ChangeEmailRequest) (*auth.UserProfile, error) {
+	user, err := h.authService.ChangeEmail(req.AccessToken, req.CurrentPassword, req.NewEmail)
+	if err != nil {
+		log.Printf("Failed to change email: %v", err)
+		return nil, err
+	}
+
+	return userProfile(user), nil
+}
+
+func (h *AuthHandler) ChangePassword(ctx context.Context, req *auth.ChangePasswordRequest) (*auth.AuthResponse, error) {
+	user, token, err := h.authService.ChangePassword(req.AccessToken, req.CurrentPassword, req.NewPassword, clientInfo(ctx))
+	if err != nil {
+		log.Printf("Failed to change password: %v", err)
+		return nil, err
+	}
+
+	return &auth.AuthResponse{
+		AccessToken:  token.AccessToken,
+		RefreshToken: token.RefreshToken,
+		ExpiresAt:    timestamppb.New(time.Now().Add(h.authService.AccessTTL())),
+		UserId:       user.ID,
+	}, nil
+}
+
+func (h *AuthHandler) DeleteAccount(ctx context.Context, req *auth.DeleteAccountRequest) (*auth.DeleteAccountResponse, error) {
+	if err := h.authService.DeleteAccount(req.AccessToken, req.Password); err != nil {
+		log.Printf("Failed to delete account: %v", err)
+		return nil, err
+	}
+
+	return &auth.DeleteAccountResponse{Success: true}, nil
+}
+
+func (h *AuthHandler) ListSessions(ctx context.Context, req *auth.ListSessionsRequest) (*auth.SessionsResponse, error) {
+	sessions, err := h.authService.ListSessions(req.AccessToken)
+	if err != nil {
+		log.Printf("Failed to list sessions: %v", err)
+		return nil, err
+	}
+
+	resp := &auth.SessionsResponse{}
+	for _, s := range sessions {
+		session := &auth.Session{
+			SessionId: s.ID,
+			CreatedAt: timestamppb.New(s.CreatedAt),
+			ExpiresAt: timestamppb.New(s.ExpiresAt),
+			UserAgent: s.UserAgent,
+			Ip:        s.IP,
+			Current:   s.Current,
+		}
+		if s.LastUsedAt != nil {
+			session.LastUsedAt = timestamppb.New(*s.LastUsedAt)
+		}
+		resp.Sessions = append(resp.Sessions, session)
+	}
+	return resp, nil
+}
+
+func (h *AuthHandler) RevokeSession(ctx context.Context, req *auth.RevokeSessionRequest) (*auth.RevokeSessionResponse, error) {
+	if err := h.authService.RevokeSession(req.AccessToken, req.SessionId); err != nil {
+		log.Printf("Failed to revoke session: %v", err)
+		return nil, err
+	}
+
+	return &auth.RevokeSessionResponse{Success: true}, nil
+}
+
+func personalToken(t *model.PersonalAccessToken) *auth.PersonalToken {
+	pt := &auth.PersonalToken{
+		Id:        t.ID,
+		Name:      t.Name,
+		Scopes:    t.Scopes,
+		CreatedAt: timestamppb.New(t.CreatedAt),
+	}
+	if t.ExpiresAt != nil {
+		pt.ExpiresAt = timestamppb.New(*t.ExpiresAt)
+	}
+	if t.LastUsedAt != nil {
+		pt.LastUsedAt = timestamppb.New(*t.LastUsedAt)
+	}
+	return pt
+}
+
+func (h *AuthHandler) CreatePersonalToken(ctx context.Context, req *auth.CreatePersonalTokenRequest) (*auth.CreatePersonalTokenResponse, error) {
+	var expiresAt *time.Time
+	if req.ExpiresAt != nil {
+		t := req.ExpiresAt.AsTime()
+		expiresAt = &t
+	}
+
+	token, pat, err := h.authService.CreatePersonalToken(req.AccessToken, req.Name, req.Scopes, expiresAt)
+	if err != nil {
+		log.Printf("Failed to create personal access token: %v", err)
+		return nil, err
+	}
+
+	return &auth.CreatePersonalTokenResponse{
+		Token:         token,
+		PersonalToken: personalToken(pat),
+	}, nil
+}
+
+func (h *AuthHandler) ListPersonalTokens(ctx context.Context, req *auth.ListPersonalTokensRequest) (*auth.PersonalTokensResponse, error) {
+	tokens, err := h.authService.ListPersonalTokens(req.AccessToken)
+	if err != nil {
+		log.Printf("Failed to list personal access tokens: %v", err)
+		return nil, err
+	}
+
+	resp := &auth.PersonalTokensResponse{}
+	for _, t := range tokens {
+		resp.PersonalTokens = append(resp.PersonalTokens, personalToken(t))
+	}
+	return resp, nil
+}
+
+func (h *AuthHandler) RevokePersonalToken(ctx context.Context, req *auth.RevokePersonalTokenRequest) (*auth.RevokePersonalTokenResponse, error) {
+	if err := h.authService.RevokePersonalToken(req.AccessToken, req.TokenId); err != nil {
+		log.Printf("Failed to revoke personal access token: %v", err)
+		return nil, err
+	}
+
+	return &auth.RevokePersonalTokenResponse{Success: true}, nil
+}
+
+func (h *AuthHandler) GetOpenIDConfiguration(ctx context.Context, req *auth.GetOpenIDConfigurationRequest) (*auth.OpenIDConfiguration, error) {
+	cfg, err := h.authService.OpenIDConfiguration()
+	if err != nil {
+		return nil, err
+	}
+
+	return &auth.OpenIDConfiguration{
+		Issuer:                            cfg.Issuer,
+		AuthorizationEndpoint:             cfg.AuthorizationEndpoint,
+		TokenEndpoint:                     cfg.TokenEndpoint,
+		UserinfoEndpoint:                  cfg.UserinfoEndpoint,
+		JwksUri:                           cfg.JWKSURI,
+		ScopesSupported:                   cfg.ScopesSupported,
+		ResponseTypesSupported:            cfg.ResponseTypesSupported,
+		GrantTypesSupported:               cfg.GrantTypesSupported,
+		SubjectTypesSupported:             cfg.SubjectTypesSupported,
+		IdTokenSigningAlgValuesSupported:  cfg.IDTokenSigningAlgValuesSupported,
+		TokenEndpointAuthMethodsSupported: cfg.TokenEndpointAuthMethodsSupported,
+		CodeChallengeMethodsSupported:     cfg.CodeChallengeMethodsSupported,
+		ClaimsSupported:                   cfg.ClaimsSupported,
+		IntrospectionEndpoint:             cfg.IntrospectionEndpoint,
+		RevocationEndpoint:                cfg.RevocationEndpoint,
+	}, nil
+}
+
+func authorizeRequest(req *auth.AuthorizationRequest) service.AuthorizeRequest {
+	return service.AuthorizeRequest{
+		ResponseType:        req.ResponseType,
+		ClientID:            req.ClientId,
+		RedirectURI:         req.RedirectUri,
+		Scope:               req.Scope,
+		State:               req.State,
+		Nonce:               req.Nonce,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+	}
+}
+
+func oauthClient(c *model.OAuthClient) *auth.OAuthClient {
+	return &auth.OAuthClient{
+		ClientId:     c.ID,
+		Name:         c.Name,
+		RedirectUris: c.RedirectURIs,
+		Scopes:       c.Scopes,
+		Public:       c.Public(),
+		CreatedAt:    timestamppb.New(c.CreatedAt),
+	}
+}
+
+func (h *AuthHandler) GetAuthorization(ctx context.Context, req *auth.AuthorizationRequest) (*auth.AuthorizationInfo, error) {
+	info, err := h.authService.GetAuthorization(req.AccessToken, authorizeRequest(req))
+	if err != nil {
+		log.Printf("Failed to check authorization request: %v", err)
+		return nil, err
+	}
+
+	return &auth.AuthorizationInfo{
+		Client:       oauthClient(info.Client),
+		RedirectUri:  info.RedirectURI,
+		Scopes:       info.Scopes,
+		ConsentGiven: info.ConsentGiven,
+	}, nil
+}
+
+func (h *AuthHandler) Authorize(ctx context.Context, req *auth.AuthorizationRequest) (*auth.AuthorizeResponse, error) {
+	redirectTo, err := h.authService.Authorize(req.AccessToken, authorizeRequest(req), req.Approve)
+	if err != nil {
+		log.Printf("Failed to authorize: %v", err)
+		return nil, err
+	}
+
+	return &auth.AuthorizeResponse{RedirectTo: redirectTo}, nil
+}
+
+func (h *AuthHandler) ExchangeToken(ctx context.Context, req *auth.OAuthTokenRequest) (*auth.OAuthTokenResponse, error) {
+	tokens, err := h.authService.ExchangeAuthorizationCode(service.TokenRequest{
+		GrantType:    req.GrantType,
+		Code:         req.Code,
+		RedirectURI:  req.RedirectUri,
+		ClientID:     req.ClientId,
+		ClientSecret: req.ClientSecret,
+		CodeVerifier: req.CodeVerifier,
+	})
+	if err != nil {
+		log.Printf("Failed to exchange token: %v", err)
+		return nil, err
+	}
+
+	return &auth.OAuthTokenResponse{
+		AccessToken: tokens.AccessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(tokens.ExpiresIn.Seconds()),
+		IdToken:     tokens.IDToken,
+		Scope:       strings.Join(tokens.Scopes, " "),
+	}, nil
+}
+
+func (h *AuthHandler) IntrospectToken(ctx context.Context, req *auth.IntrospectTokenRequest) (*auth.IntrospectTokenResponse, error) {
+	info, err := h.authService.IntrospectToken(req.ClientId, req.ClientSecret, req.Token)
+	if err != nil {
+		log.Printf("Failed to introspect token: %v", err)
+		return nil, err
+	}
+
+	resp := &auth.IntrospectTokenResponse{
+		Active:    info.Active,
+		Sub:       info.Subject,
+		Username:  info.Username,
+		ClientId:  info.ClientID,
+		Scopes:    info.Scopes,
+		TokenType: info.TokenType,
+		ActorId:   info.ActorID,
+	}
+	if info.ExpiresAt != nil {
+		resp.ExpiresAt = timestamppb.New(*info.ExpiresAt)
+	}
+	return resp, nil
+}
+
+func (h *AuthHandler) RevokeToken(ctx context.Context, req *auth.RevokeTokenRequest) (*auth.RevokeTokenResponse, error) {
+	if err := h.authService.RevokeToken(req.ClientId, req.ClientSecret, req.Token); err != nil {
+		log.Printf("Failed to revoke token: %v", err)
+		return nil, err
+	}
+
+	return &auth.RevokeTokenResponse{}, nil
+}
+
+func (h *AuthHandler) GetUserInfo(ctx context.Context, req *auth.GetUserInfoRequest) (*auth.UserInfoResponse, error) {
+	info, err := h.authService.UserInfo(req.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	return &auth.UserInfoResponse{
+		Sub:               info.Subject,
+		Name:              info.Name,
+		PreferredUsername: info.PreferredUsername,
+		Email:             info.Email,
+		EmailVerified:     info.EmailVerified,
+	}, nil
+}
+
+func (h *AuthHandler) RegisterOAuthClient(ctx context.Context, req *auth.RegisterOAuthClientRequest) (*auth.RegisterOAuthClientResponse, error) {
+	client, secret, err := h.authService.RegisterOAuthClient(req.AccessToken, req.Name, req.RedirectUris, req.Scopes, req.Public)
+	if err != nil {
+		log.Printf("Failed to register oauth client: %v", err)
+		return nil, err
+	}
+
+	return &auth.RegisterOAuthClientResponse{
+		Client:       oauthClient(client),
+		ClientSecret: secret,
+	}, nil
+}
+
+func (h *AuthHandler) ListOAuthClients(ctx context.Context, req *auth.ListOAuthClientsRequest) (*auth.OAuthClientsResponse, error) {
+	clients, err := h.authService.ListOAuthClients(req.AccessToken)
+	if err != nil {
+		log.Printf("Failed to list oauth clients: %v", err)
+		return nil, err
+	}
+
+	resp := &auth.OAuthClientsResponse{}
+	for _, c := range clients {
+		resp.Clients = append(resp.Clients, oauthClient(c))
+	}
+	return resp, nil
+}
+
+func (h *AuthHandler) DeleteOAuthClient(ctx context.Context, req *auth.DeleteOAuthClientRequest) (*auth.DeleteOAuthClientResponse, error) {
+	if err := h.authService.DeleteOAuthClient(req.AccessToken, req.ClientId); err != nil {
+		log.Printf("Failed to delete oauth client: %v", err)
+		return nil, err
+	}
+
+	return &auth.DeleteOAuthClientResponse{Success: true}, nil
+}
+
+func (h *AuthHandler) ListOAuthConsents(ctx context.Context, req *auth.ListOAuthConsentsRequest) (*auth.OAuthConsentsResponse, error) {
+	consents, err := h.authService.ListOAuthConsents(req.AccessToken)
+	if err != nil {
+		log.Printf("Failed to list consents: %v", err)
+		return nil, err
+	}
+
+	resp := &auth.OAuthConsentsResponse{}
+	for _, c := range consents {
+		resp.Consents = append(resp.Consents, &auth.OAuthConsent{
+			ClientId:   c.ClientID,
+			ClientName: c.ClientName,
+			Scopes:     c.Scopes,
+			GrantedAt:  timestamppb.New(c.GrantedAt),
+		})
+	}
+	return resp, nil
+}
+
+func (h *AuthHandler) RevokeOAuthConsent(ctx context.Context, req *auth.RevokeOAuthConsentRequest) (*auth.RevokeOAuthConsentResponse, error) {
+	if err := h.authService.RevokeOAuthConsent(req.AccessToken, req.ClientId); err != nil {
+		log.Printf("Failed to revoke consent: %v", err)
+		return nil, err
+	}
+
+	return &auth.RevokeOAuthConsentResponse{Success: true}, nil
+}
+
+func (h *AuthHandler) ListIdentityProviders(ctx context.Context, req *auth.ListIdentityProvidersRequest) (*auth.IdentityProvidersResponse, error) {
+	resp := &auth.IdentityProvidersResponse{}
+	for _, p := range h.authService.IdentityProviders() {
+		resp.Providers = append(resp.Providers, &auth.IdentityProvider{Id: p.ID(), Name: p.Name()})
+	}
+	return resp, nil
+}
+
+func (h *AuthHandler) StartFederatedLogin(ctx context.Context, req *auth.StartFederatedLoginRequest) (*auth.StartFederatedLoginResponse, error) {
+	authURL, state, err := h.authService.StartFederatedLogin(ctx, req.Provider)
+	if err != nil {
+		log.Printf("Failed to start login with %s: %v", req.Provider, err)
+		return nil, err
+	}
+
+	return &auth.StartFederatedLoginResponse{AuthorizationUrl: authURL, State: state}, nil
+}
+
+func (h *AuthHandler) CompleteFederatedLogin(ctx context.Context, req *auth.CompleteFederatedLoginRequest) (*auth.AuthResponse, error) {
+	user, err := h.authService.CompleteFederatedLogin(ctx, req.Provider, req.State, req.Code)
+	if err != nil {
+		log.Printf("Failed login with %s: %v", req.Provider, err)
+		return nil, err
+	}
+
+	return h.signIn(ctx, user)
+}
+
+func auditEvent(e *model.AuditEvent) *auth.AuditEvent {
+	return &auth.AuditEvent{
+		Id:        e.ID,
+		UserId:    e.UserID,
+		ActorId:   e.ActorID,
+		EventType: e.EventType,
+		Outcome:   e.Outcome,
+		Ip:        e.IP,
+		UserAgent: e.UserAgent,
+		Details:   e.Details,
+		CreatedAt: timestamppb.New(e.CreatedAt),
+	}
+}
+
+func (h *AuthHandler) ListAuditEvents(ctx context.Context, req *auth.ListAuditEventsRequest) (*auth.AuditEventsResponse, error) {
+	q := service.AuditQuery{
+		UserID:    req.UserId,
+		EventType: req.EventType,
+		Cursor:    req.Cursor,
+		Limit:     int(req.Limit),
+	}
+	if req.Since != nil {
+		q.Since = req.Since.AsTime()
+	}
+	if req.Until != nil {
+		q.Until = req.Until.AsTime()
+	}
+
+	page, err := h.authService.ListAuditEvents(req.AccessToken, q)
+	if err != nil {
+		log.Printf("Failed to list audit events: %v", err)
+		return nil, err
+	}
+
+	resp := &auth.AuditEventsResponse{NextCursor: page.NextCursor}
+	for _, e := range page.Events {
+		resp.Events = append(resp.Events, auditEvent(e))
+	}
+	return resp, nil
+}
+
+func (h *AuthHandler) ListUsers(ctx context.Context, req *auth.ListUsersRequest) (*auth.UsersResponse, error) {
+	users, total, err := h.authService.ListUsers(req.AccessToken, service.UserQuery{
+		Query:  req.Query,
+		Limit:  int(req.Limit),
+		Offset: int(req.Offset),
+	})
+	if err != nil {
+		log.Printf("Failed to list users: %v", err)
+		return nil, err
+	}
+
+	resp := &auth.UsersResponse{TotalCount: int32(total)}
+	for _, user := range users {
+		resp.Users = append(resp.Users, userProfile(user))
+	}
+	return resp, nil
+}
+
+func (h *AuthHandler) AdminGetUser(ctx context.Context, req *auth.AdminUserRequest) (*auth.UserProfile, error) {
+	user, err := h.authService.AdminGetUser(req.AccessToken, req.UserId)
+	if err != nil {
+		log.Printf("Failed to get user %s: %v", req.UserId, err)
+		return nil, err
+	}
+
+	return userProfile(user), nil
+}
+
+func (h *AuthHandler) SuspendUser(ctx context.Context, req *auth.AdminUserRequest) (*auth.UserProfile, error) {
+	user, err := h.authService.SuspendUser(req.AccessToken, req.UserId)
+	if err != nil {
+		log.Printf("Failed to suspend user %s: %v", req.UserId, err)
+		return nil, err
+	}
+
+	return userProfile(user), nil
+}
+
+func (h *AuthHandler) UnsuspendUser(ctx context.Context, req *auth.AdminUserRequest) (*auth.UserProfile, error) {
+	user, err := h.authService.UnsuspendUser(req.AccessToken, req.UserId)
+	if err != nil {
+		log.Printf("Failed to unsuspend user %s: %v", req.UserId, err)
+		return nil, err
+	}
+
+	return userProfile(user), nil
+}
+
+func (h *AuthHandler) ForcePasswordReset(ctx context.Context, req *auth.AdminUserRequest) (*auth.AdminUserActionResponse, error) {
+	if err := h.authService.ForcePasswordReset(req.AccessToken, req.UserId); err != nil {
+		log.Printf("Failed to force password reset of user %s: %v", req.UserId, err)
+		return nil, err
+	}
+
+	return &auth.AdminUserActionResponse{Success: true}, nil
+}
+
+func (h *AuthHandler) AdminRevokeSessions(ctx context.Context, req *auth.AdminUserRequest) (*auth.AdminUserActionResponse, error) {
+	if err := h.authService.AdminRevokeSessions(req.AccessToken, req.UserId); err != nil {
+		log.Printf("Failed to revoke sessions of user %s: %v", req.UserId, err)
+		return nil, err
+	}
+
+	return &auth.AdminUserActionResponse{Success: true}, nil
+}
+
+func (h *AuthHandler) Impersonate(ctx context.Context, req *auth.ImpersonateRequest) (*auth.ImpersonateResponse, error) {
+	imp, err := h.authService.Impersonate(req.AccessToken, req.UserId, req.Reason, clientInfo(ctx))
+	if err != nil {
+		log.Printf("Failed to impersonate user %s: %v", req.UserId, err)
+		return nil, err
+	}
+
+	return &auth.ImpersonateResponse{
+		AccessToken: imp.AccessToken,
+		ExpiresAt:   timestamppb.New(imp.ExpiresAt),
+		UserId:      imp.UserID,
+		ActorId:     imp.ActorID,
+	}, nil
+}
@@ -0,0 +1,19 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/model"
+	"github.com/polyakovaa/grpcproxy/svcauth"
+)
+
+// clientInfo reads the client the gateway signed into the call. Unverified
+// calls get an empty client: anything the caller claims is ignored, and the
+// peer address is the gateway itself in a normal deployment, so charging it
+// to the per-IP login limiter would lock out everyone at once.
+func clientInfo(ctx context.Context) model.ClientInfo {
+	if c, ok := svcauth.ClientFromContext(ctx); ok {
+		return model.ClientInfo{IP: c.IP, UserAgent: c.UserAgent}
+	}
+	return model.ClientInfo{}
+}
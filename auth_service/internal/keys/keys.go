@@ -0,0 +1,229 @@
+package keys
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// Key is a JWT signing key identified by its kid. Retired keys only carry the
+// public part and are kept to verify tokens issued before a rotation.
+type Key struct {
+	ID        string
+	Algorithm string
+	Private   crypto.Signer
+	Public    crypto.PublicKey
+}
+
+func (k *Key) SigningMethod() jwt.SigningMethod {
+	switch k.Algorithm {
+	case AlgRS256:
+		return jwt.SigningMethodRS256
+	case AlgEdDSA:
+		return jwt.SigningMethodEdDSA
+	}
+	return nil
+}
+
+// NewKey builds a key from a private key and checks that it fits the algorithm.
+func NewKey(id, algorithm string, private crypto.Signer) (*Key, error) {
+	k := &Key{ID: id, Algorithm: algorithm, Private: private, Public: private.Public()}
+	if err := k.validate(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// LoadKey reads a PEM encoded private key or, for retired keys, a public key.
+func LoadKey(id, algorithm, privateKeyFile, publicKeyFile string) (*Key, error) {
+	k := &Key{ID: id, Algorithm: algorithm}
+
+	switch {
+	case privateKeyFile != "":
+		block, err := readPEM(privateKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		private, err := parsePrivateKey(block)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", id, err)
+		}
+		k.Private = private
+		k.Public = private.Public()
+	case publicKeyFile != "":
+		block, err := readPEM(publicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		public, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: failed to parse public key: %w", id, err)
+		}
+		k.Public = public
+	default:
+		return nil, fmt.Errorf("key %s: private_key_file or public_key_file is required", id)
+	}
+
+	if err := k.validate(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+func (k *Key) validate() error {
+	if k.ID == "" {
+		return errors.New("key id is required")
+	}
+
+	switch k.Algorithm {
+	case AlgRS256:
+		if _, ok := k.Public.(*rsa.PublicKey); !ok {
+			return fmt.Errorf("key %s: %s requires an RSA key", k.ID, k.Algorithm)
+		}
+	case AlgEdDSA:
+		if _, ok := k.Public.(ed25519.PublicKey); !ok {
+			return fmt.Errorf("key %s: %s requires an Ed25519 key", k.ID, k.Algorithm)
+		}
+	default:
+		return fmt.Errorf("key %s: unsupported algorithm %q", k.ID, k.Algorithm)
+	}
+	return nil
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", path)
+	}
+	return block, nil
+}
+
+func parsePrivateKey(block *pem.Block) (crypto.Signer, error) {
+	if block.Type == "RSA PRIVATE KEY" {
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("unsupported private key type")
+	}
+	return signer, nil
+}
+
+// KeySet holds every key that is accepted for verification and the one that
+// is currently used for signing.
+type KeySet struct {
+	active *Key
+	keys   map[string]*Key
+}
+
+func NewKeySet(activeID string, keys ...*Key) (*KeySet, error) {
+	ks := &KeySet{keys: make(map[string]*Key, len(keys))}
+	for _, k := range keys {
+		if _, exists := ks.keys[k.ID]; exists {
+			return nil, fmt.Errorf("duplicate key id %s", k.ID)
+		}
+		ks.keys[k.ID] = k
+	}
+
+	active, ok := ks.keys[activeID]
+	if !ok {
+		return nil, fmt.Errorf("active key %q is not configured", activeID)
+	}
+	if active.Private == nil {
+		return nil, fmt.Errorf("active key %q has no private key", activeID)
+	}
+	ks.active = active
+
+	return ks, nil
+}
+
+func (ks *KeySet) Active() *Key {
+	return ks.active
+}
+
+func (ks *KeySet) Get(id string) (*Key, bool) {
+	k, ok := ks.keys[id]
+	return k, ok
+}
+
+// Algorithms lists the distinct algorithms of the keys in the set.
+func (ks *KeySet) Algorithms() []string {
+	seen := map[string]bool{}
+	var algs []string
+	for _, k := range ks.keys {
+		if !seen[k.Algorithm] {
+			seen[k.Algorithm] = true
+			algs = append(algs, k.Algorithm)
+		}
+	}
+	sort.Strings(algs)
+	return algs
+}
+
+// JWK is the public part of a key in RFC 7517 form.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+func (k *Key) JWK() JWK {
+	jwk := JWK{Kid: k.ID, Use: "sig", Alg: k.Algorithm}
+
+	switch pub := k.Public.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+	}
+
+	return jwk
+}
+
+// JWKS returns the public keys ordered by kid.
+func (ks *KeySet) JWKS() []JWK {
+	ids := make([]string, 0, len(ks.keys))
+	for id := range ks.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	jwks := make([]JWK, 0, len(ids))
+	for _, id := range ids {
+		jwks = append(jwks, ks.keys[id].JWK())
+	}
+	return jwks
+}
@@ -0,0 +1,101 @@
+package keys_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/keys"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writePEM(t *testing.T, dir, name, typ string, der []byte) string {
+	path := filepath.Join(dir, name)
+	err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0o600)
+	require.NoError(t, err)
+	return path
+}
+
+func TestLoadKey(t *testing.T) {
+	dir := t.TempDir()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	rsaDER, err := x509.MarshalPKCS8PrivateKey(rsaKey)
+	require.NoError(t, err)
+	rsaPath := writePEM(t, dir, "rsa.pem", "PRIVATE KEY", rsaDER)
+
+	edPub, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	edPubDER, err := x509.MarshalPKIXPublicKey(edPub)
+	require.NoError(t, err)
+	edPubPath := writePEM(t, dir, "ed.pub.pem", "PUBLIC KEY", edPubDER)
+	edDER, err := x509.MarshalPKCS8PrivateKey(edPriv)
+	require.NoError(t, err)
+	edPath := writePEM(t, dir, "ed.pem", "PRIVATE KEY", edDER)
+
+	t.Run("RSA private key", func(t *testing.T) {
+		k, err := keys.LoadKey("rsa-1", keys.AlgRS256, rsaPath, "")
+		require.NoError(t, err)
+		assert.NotNil(t, k.Private)
+
+		jwk := k.JWK()
+		assert.Equal(t, "RSA", jwk.Kty)
+		assert.Equal(t, "rsa-1", jwk.Kid)
+		assert.Equal(t, "AQAB", jwk.E)
+		assert.NotEmpty(t, jwk.N)
+	})
+
+	t.Run("Ed25519 public key only", func(t *testing.T) {
+		k, err := keys.LoadKey("ed-1", keys.AlgEdDSA, "", edPubPath)
+		require.NoError(t, err)
+		assert.Nil(t, k.Private)
+
+		jwk := k.JWK()
+		assert.Equal(t, "OKP", jwk.Kty)
+		assert.Equal(t, "Ed25519", jwk.Crv)
+		assert.NotEmpty(t, jwk.X)
+	})
+
+	t.Run("algorithm mismatch", func(t *testing.T) {
+		_, err := keys.LoadKey("ed-2", keys.AlgRS256, edPath, "")
+		assert.Error(t, err)
+	})
+
+	t.Run("no key file", func(t *testing.T) {
+		_, err := keys.LoadKey("empty", keys.AlgEdDSA, "", "")
+		assert.Error(t, err)
+	})
+}
+
+func TestNewKeySet(t *testing.T) {
+	_, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	active, err := keys.NewKey("new", keys.AlgEdDSA, edPriv)
+	require.NoError(t, err)
+
+	retiredPub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	retired := &keys.Key{ID: "old", Algorithm: keys.AlgEdDSA, Public: retiredPub}
+
+	ks, err := keys.NewKeySet("new", active, retired)
+	require.NoError(t, err)
+	assert.Equal(t, "new", ks.Active().ID)
+
+	jwks := ks.JWKS()
+	require.Len(t, jwks, 2)
+	assert.Equal(t, "new", jwks[0].Kid)
+	assert.Equal(t, "old", jwks[1].Kid)
+
+	_, err = keys.NewKeySet("old", active, retired)
+	assert.Error(t, err, "retired key cannot sign")
+
+	_, err = keys.NewKeySet("missing", active)
+	assert.Error(t, err)
+}
@@ -0,0 +1,91 @@
+package mail
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(msg Message) error
+}
+
+type SMTPMailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+func NewSMTPMailer(host string, port int, username, password, from string) *SMTPMailer {
+	m := &SMTPMailer{
+		addr: net.JoinHostPort(host, strconv.Itoa(port)),
+		from: from,
+	}
+	if username != "" {
+		m.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return m
+}
+
+func (m *SMTPMailer) Send(msg Message) error {
+	if err := smtp.SendMail(m.addr, m.auth, m.from, []string{msg.To}, format(m.from, msg)); err != nil {
+		return fmt.Errorf("failed to send mail to %s: %w", msg.To, err)
+	}
+	return nil
+}
+
+// WriterMailer writes every message to w instead of delivering it, which
+// makes the mail based flows usable without an SMTP server.
+type WriterMailer struct {
+	mu   sync.Mutex
+	w    io.Writer
+	from string
+}
+
+func NewWriterMailer(w io.Writer, from string) *WriterMailer {
+	return &WriterMailer{w: w, from: from}
+}
+
+// NewFileMailer appends messages to the file at path.
+func NewFileMailer(path, from string) (*WriterMailer, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open mail file: %w", err)
+	}
+	return NewWriterMailer(f, from), nil
+}
+
+func (m *WriterMailer) Send(msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := fmt.Fprintf(m.w, "%s\r\n.\r\n", format(m.from, msg)); err != nil {
+		return fmt.Errorf("failed to write mail to %s: %w", msg.To, err)
+	}
+	return nil
+}
+
+func format(from string, msg Message) []byte {
+	var b strings.Builder
+	b.WriteString("From: " + from + "\r\n")
+	b.WriteString("To: " + msg.To + "\r\n")
+	b.WriteString("Subject: " + msg.Subject + "\r\n")
+	b.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
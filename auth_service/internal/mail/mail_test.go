@@ -0,0 +1,40 @@
+package mail_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/mail"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriterMailer(t *testing.T) {
+	var buf bytes.Buffer
+	m := mail.NewWriterMailer(&buf, "noreply@example.com")
+
+	err := m.Send(mail.Message{To: "user@example.com", Subject: "Hello", Body: "line 1\nline 2"})
+	require.NoError(t, err)
+
+	out := buf.String()
+	assert.Contains(t, out, "From: noreply@example.com\r\n")
+	assert.Contains(t, out, "To: user@example.com\r\n")
+	assert.Contains(t, out, "Subject: Hello\r\n")
+	assert.Contains(t, out, "line 1\r\nline 2")
+}
+
+func TestFileMailer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mail.log")
+	m, err := mail.NewFileMailer(path, "noreply@example.com")
+	require.NoError(t, err)
+
+	require.NoError(t, m.Send(mail.Message{To: "a@example.com", Subject: "First", Body: "one"}))
+	require.NoError(t, m.Send(mail.Message{To: "b@example.com", Subject: "Second", Body: "two"}))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "Subject: First")
+	assert.Contains(t, string(data), "Subject: Second")
+}
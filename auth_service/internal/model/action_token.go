@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+const (
+	ActionPasswordReset     = "password_reset"
+	ActionEmailVerification = "email_verification"
+	ActionMFAChallenge      = "mfa_challenge"
+	ActionMagicLink         = "magic_link"
+)
+
+// ActionToken is a single-use token mailed to a user to confirm an action.
+// Like refresh tokens it is split into a selector and a verifier of which only
+// the hash is stored.
+type ActionToken struct {
+	ID        string     `json:"id" db:"id"`
+	UserID    string     `json:"user_id" db:"user_id"`
+	Purpose   string     `json:"purpose" db:"purpose"`
+	Selector  string     `json:"-" db:"selector"`
+	TokenHash string     `json:"-" db:"token_hash"`
+	ExpiresAt time.Time  `json:"expires_at" db:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty" db:"used_at"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+}
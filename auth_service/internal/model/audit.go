@@ -0,0 +1,75 @@
+package model
+
+import "time"
+
+const (
+	AuditRefreshTokenReuse     = "refresh_token_reuse"
+	AuditRoleGranted           = "role_granted"
+	AuditRoleRevoked           = "role_revoked"
+	AuditPasswordReset         = "password_reset"
+	AuditEmailVerified         = "email_verified"
+	AuditAccountLocked         = "account_locked"
+	AuditMFAEnabled            = "mfa_enabled"
+	AuditMFADisabled           = "mfa_disabled"
+	AuditRecoveryCodeUsed      = "recovery_code_used"
+	AuditProfileUpdated        = "profile_updated"
+	AuditEmailChanged          = "email_changed"
+	AuditPasswordChanged       = "password_changed"
+	AuditAccountDeleted        = "account_deleted"
+	AuditSessionRevoked        = "session_revoked"
+	AuditPersonalTokenCreated  = "personal_token_created"
+	AuditPersonalTokenRevoked  = "personal_token_revoked"
+	AuditOAuthClientRegistered = "oauth_client_registered"
+	AuditOAuthClientDeleted    = "oauth_client_deleted"
+	AuditOAuthConsentGranted   = "oauth_consent_granted"
+	AuditOAuthConsentRevoked   = "oauth_consent_revoked"
+	AuditIdentityLinked        = "identity_linked"
+	AuditFederatedLogin        = "federated_login"
+	AuditUserRegistered        = "user_registered"
+	AuditLoginSucceeded        = "login_succeeded"
+	AuditLoginFailed           = "login_failed"
+	AuditTokenRefreshed        = "token_refreshed"
+	AuditUserSuspended         = "user_suspended"
+	AuditUserUnsuspended       = "user_unsuspended"
+	AuditPasswordResetForced   = "password_reset_forced"
+	AuditSessionsRevoked       = "sessions_revoked"
+	AuditImpersonationStarted  = "impersonation_started"
+	AuditImpersonationRefused  = "impersonation_refused"
+)
+
+const (
+	AuditOutcomeSuccess = "success"
+	AuditOutcomeFailure = "failure"
+)
+
+// AuditEvent is an entry of the append-only audit log. UserID is the account
+// the event is about and ActorID the user who caused it; both are empty when
+// unknown, e.g. for logins with an unregistered email.
+type AuditEvent struct {
+	ID        string    `json:"id" db:"id"`
+	UserID    string    `json:"user_id" db:"user_id"`
+	ActorID   string    `json:"actor_id" db:"actor_id"`
+	EventType string    `json:"event_type" db:"event_type"`
+	Outcome   string    `json:"outcome" db:"outcome"`
+	IP        string    `json:"ip" db:"ip"`
+	UserAgent string    `json:"user_agent" db:"user_agent"`
+	Details   string    `json:"details" db:"details"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// AuditFilter selects audit events. Zero fields do not filter. Events are
+// listed newest first; After continues a listing behind the given event.
+type AuditFilter struct {
+	UserID    string
+	EventType string
+	Since     time.Time
+	Until     time.Time
+	After     *AuditPosition
+	Limit     int
+}
+
+// AuditPosition is the place of an event in the listing order.
+type AuditPosition struct {
+	CreatedAt time.Time
+	ID        string
+}
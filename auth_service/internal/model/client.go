@@ -0,0 +1,8 @@
+package model
+
+// ClientInfo describes the end user client behind a request, as reported by
+// the gateway.
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+}
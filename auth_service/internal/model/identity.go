@@ -0,0 +1,33 @@
+package model
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrIdentityNotFound = errors.New("identity not found")
+
+// Identity links an account at an upstream OpenID Connect provider to a
+// user. Subject is the provider's stable id of the account; the email is
+// only kept for display, as it may change upstream.
+type Identity struct {
+	Provider    string     `json:"provider" db:"provider"`
+	Subject     string     `json:"-" db:"subject"`
+	UserID      string     `json:"user_id" db:"user_id"`
+	Email       string     `json:"email" db:"email"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty" db:"last_login_at"`
+}
+
+// FederatedLoginState remembers a login redirected to an upstream provider
+// until it comes back. The state parameter is split into a selector and a
+// verifier like the other single-use tokens; Nonce and CodeVerifier have to
+// be kept in the clear to complete the login.
+type FederatedLoginState struct {
+	Selector     string    `db:"selector"`
+	StateHash    string    `db:"state_hash"`
+	Provider     string    `db:"provider"`
+	Nonce        string    `db:"nonce"`
+	CodeVerifier string    `db:"code_verifier"`
+	ExpiresAt    time.Time `db:"expires_at"`
+}
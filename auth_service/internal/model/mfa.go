@@ -0,0 +1,12 @@
+package model
+
+import "time"
+
+// TOTP is the authenticator app secret of a user. It only protects logins
+// once ConfirmedAt is set, i.e. after the user proved they can produce codes.
+type TOTP struct {
+	UserID       string     `db:"user_id"`
+	Secret       string     `db:"secret"`
+	ConfirmedAt  *time.Time `db:"confirmed_at"`
+	LastUsedStep int64      `db:"last_used_step"`
+}
@@ -0,0 +1,66 @@
+package model
+
+import (
+	"errors"
+	"time"
+)
+
+// OpenID Connect scopes. Clients may also be granted the scopes of personal
+// access tokens to call the API on behalf of the user.
+const (
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+)
+
+// OAuthScopes lists the scopes OAuth clients can be registered for.
+var OAuthScopes = []string{ScopeOpenID, ScopeProfile, ScopeEmail, ScopeEventsRead, ScopeEventsWrite}
+
+var (
+	ErrOAuthClientNotFound = errors.New("oauth client not found")
+	ErrConsentNotFound     = errors.New("consent not found")
+)
+
+// OAuthClient is an application that signs users in with their Reading Club
+// account. Public clients such as single page and mobile apps cannot keep a
+// secret and have an empty SecretHash; every client has to use PKCE.
+type OAuthClient struct {
+	ID           string    `json:"client_id" db:"id"`
+	Name         string    `json:"name" db:"name"`
+	SecretHash   string    `json:"-" db:"secret_hash"`
+	RedirectURIs []string  `json:"redirect_uris" db:"redirect_uris"`
+	Scopes       []string  `json:"scopes" db:"scopes"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+}
+
+func (c *OAuthClient) Public() bool {
+	return c.SecretHash == ""
+}
+
+// OAuthConsent records the scopes a user allowed a client to access.
+type OAuthConsent struct {
+	UserID     string    `json:"user_id" db:"user_id"`
+	ClientID   string    `json:"client_id" db:"client_id"`
+	ClientName string    `json:"client_name" db:"-"`
+	Scopes     []string  `json:"scopes" db:"scopes"`
+	GrantedAt  time.Time `json:"granted_at" db:"granted_at"`
+}
+
+// AuthorizationCode is the single-use code a client exchanges for tokens.
+// CodeChallenge is the S256 PKCE challenge the client sent with the
+// authorization request, AccessTokenID the jti of the token the code was
+// exchanged for.
+type AuthorizationCode struct {
+	ID            string     `db:"id"`
+	UserID        string     `db:"user_id"`
+	ClientID      string     `db:"client_id"`
+	Selector      string     `db:"selector"`
+	CodeHash      string     `db:"code_hash"`
+	RedirectURI   string     `db:"redirect_uri"`
+	Scopes        []string   `db:"scopes"`
+	CodeChallenge string     `db:"code_challenge"`
+	Nonce         string     `db:"nonce"`
+	ExpiresAt     time.Time  `db:"expires_at"`
+	UsedAt        *time.Time `db:"used_at"`
+	AccessTokenID string     `db:"access_token_id"`
+}
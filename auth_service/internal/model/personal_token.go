@@ -0,0 +1,39 @@
+package model
+
+import "time"
+
+// Scopes a personal access token can be limited to. Session tokens are not
+// limited by scopes.
+const (
+	ScopeEventsRead  = "events:read"
+	ScopeEventsWrite = "events:write"
+)
+
+// PersonalTokenScopes lists the scopes a personal access token may be
+// created with.
+var PersonalTokenScopes = []string{ScopeEventsRead, ScopeEventsWrite}
+
+// PersonalAccessToken is a long-lived token a user creates for scripts and
+// integrations. Like refresh tokens it is split into a selector and a
+// verifier of which only the hash is stored.
+type PersonalAccessToken struct {
+	ID         string     `json:"id" db:"id"`
+	UserID     string     `json:"user_id" db:"user_id"`
+	Name       string     `json:"name" db:"name"`
+	Scopes     []string   `json:"scopes" db:"scopes"`
+	Selector   string     `json:"-" db:"selector"`
+	TokenHash  string     `json:"-" db:"token_hash"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty" db:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+}
+
+// HasScope reports whether the token was granted scope.
+func (t *PersonalAccessToken) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
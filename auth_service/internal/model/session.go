@@ -0,0 +1,17 @@
+package model
+
+import "time"
+
+// Session is a login on one device: the live refresh token of a rotation
+// family. CreatedAt is when the user logged in, LastUsedAt the last refresh.
+type Session struct {
+	ID            string     `json:"id" db:"id"`
+	UserID        string     `json:"user_id" db:"user_id"`
+	AccessTokenID string     `json:"-" db:"access_token_id"`
+	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
+	LastUsedAt    *time.Time `json:"last_used_at" db:"last_used_at"`
+	ExpiresAt     time.Time  `json:"expires_at" db:"expires_at"`
+	UserAgent     string     `json:"user_agent" db:"user_agent"`
+	IP            string     `json:"ip" db:"ip"`
+	Current       bool       `json:"current" db:"-"`
+}
@@ -8,9 +8,16 @@ type Token struct {
 }
 
 type RefreshToken struct {
-	ID            string    `json:"id" db:"id"`
-	UserID        string    `json:"user_id" db:"user_id"`
-	TokenHash     string    `json:"token_hash" db:"token_hash"`
-	AccessTokenID string    `json:"access_token_id" db:"access_token_id"`
-	ExpiresAt     time.Time `json:"expires_at" db:"expires_at"`
+	ID            string     `json:"id" db:"id"`
+	UserID        string     `json:"user_id" db:"user_id"`
+	FamilyID      string     `json:"family_id" db:"family_id"`
+	Selector      string     `json:"selector" db:"selector"`
+	TokenHash     string     `json:"token_hash" db:"token_hash"`
+	AccessTokenID string     `json:"access_token_id" db:"access_token_id"`
+	ExpiresAt     time.Time  `json:"expires_at" db:"expires_at"`
+	RotatedAt     *time.Time `json:"rotated_at" db:"rotated_at"`
+	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
+	LastUsedAt    *time.Time `json:"last_used_at" db:"last_used_at"`
+	UserAgent     string     `json:"user_agent" db:"user_agent"`
+	IP            string     `json:"ip" db:"ip"`
 }
@@ -1,11 +1,74 @@
 package model
 
-import "time"
+import (
+	"errors"
+	"time"
+)
+
+const (
+	RoleMember    = "member"
+	RoleOrganizer = "organizer"
+	RoleAdmin     = "admin"
+)
+
+var (
+	ErrUserNameTaken = errors.New("user name is already taken")
+	ErrEmailTaken    = errors.New("email is already registered")
+)
+
+func IsValidRole(role string) bool {
+	switch role {
+	case RoleMember, RoleOrganizer, RoleAdmin:
+		return true
+	}
+	return false
+}
 
 type User struct {
-	ID           string    `db:"id"`
-	UserName     string    `db:"user_name"`
-	Email        string    `db:"email"`
-	PasswordHash string    `db:"password_hash"`
-	CreatedAt    time.Time `db:"created_at"`
+	ID            string     `db:"id"`
+	UserName      string     `db:"user_name"`
+	Email         string     `db:"email"`
+	PasswordHash  string     `db:"password_hash"`
+	DisplayName   string     `db:"display_name"`
+	Bio           string     `db:"bio"`
+	EmailVerified bool       `db:"email_verified"`
+	MFAEnabled    bool       `db:"mfa_enabled"`
+	CreatedAt     time.Time  `db:"created_at"`
+	SuspendedAt   *time.Time `db:"suspended_at"`
+	Roles         []string   `db:"roles"`
+
+	// ImpersonatorID is the admin acting as the user when the user was
+	// authenticated with an impersonation token. It is not stored.
+	ImpersonatorID string `db:"-"`
+}
+
+// Suspended reports whether an admin suspended the user. Suspended users
+// cannot sign in or use their tokens.
+func (u *User) Suspended() bool {
+	return u.SuspendedAt != nil
+}
+
+func (u *User) HasRole(role string) bool {
+	for _, r := range u.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// UserFilter selects users for admins. Query matches user names and emails
+// by substring; an empty Query matches everyone.
+type UserFilter struct {
+	Query  string
+	Limit  int
+	Offset int
+}
+
+// ProfileUpdate holds the profile fields to change. Nil fields are left as
+// they are.
+type ProfileUpdate struct {
+	UserName    *string
+	DisplayName *string
+	Bio         *string
 }
@@ -0,0 +1,371 @@
+// Package oidc signs users in with an upstream OpenID Connect provider such
+// as Google or GitLab, using the authorization code flow with PKCE.
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// minKeyRefreshInterval limits how often an unknown kid can trigger a
+// refetch of the provider keys.
+const minKeyRefreshInterval = 10 * time.Second
+
+// maxResponseSize caps the documents read from a provider.
+const maxResponseSize = 1 << 20
+
+var signingAlgorithms = []string{"RS256", "RS384", "RS512", "ES256", "ES384", "EdDSA"}
+
+type Config struct {
+	// ID names the provider in URLs and in the identities table, e.g.
+	// "google". It must not change once users signed in with it.
+	ID           string
+	Name         string
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the callback of the gateway registered with the
+	// provider.
+	RedirectURL string
+	// Scopes are requested in addition to openid.
+	Scopes []string
+}
+
+// Claims are the facts about a user the provider vouched for in the ID
+// token.
+type Claims struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	PreferredUsername string
+}
+
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider is an upstream OpenID Connect provider. Its discovery document
+// and keys are fetched on first use and cached.
+type Provider struct {
+	cfg    Config
+	client *http.Client
+
+	mu            sync.Mutex
+	meta          *metadata
+	keys          map[string]crypto.PublicKey
+	keysFetchedAt time.Time
+}
+
+// New returns a provider for cfg. A nil client uses a client with a ten
+// second timeout.
+func New(cfg Config, client *http.Client) *Provider {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	cfg.IssuerURL = strings.TrimRight(cfg.IssuerURL, "/")
+	return &Provider{cfg: cfg, client: client}
+}
+
+func (p *Provider) ID() string {
+	return p.cfg.ID
+}
+
+func (p *Provider) Name() string {
+	return p.cfg.Name
+}
+
+// AuthCodeURL returns the URL to send the user agent to. codeChallenge is
+// the S256 PKCE challenge of the verifier later passed to Exchange.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(meta.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid authorization endpoint: %w", err)
+	}
+	query := u.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.cfg.ClientID)
+	query.Set("redirect_uri", p.cfg.RedirectURL)
+	query.Set("scope", strings.Join(append([]string{"openid"}, p.cfg.Scopes...), " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
+
+// Exchange redeems an authorization code and returns the claims of the
+// verified ID token. nonce must be the one passed to AuthCodeURL.
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*Claims, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"code_verifier": {codeVerifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+
+	var tokens struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := p.do(req, &tokens); err != nil {
+		if tokens.Error != "" {
+			return nil, fmt.Errorf("token request rejected: %s: %s", tokens.Error, tokens.ErrorDescription)
+		}
+		return nil, err
+	}
+	if tokens.IDToken == "" {
+		return nil, errors.New("token response has no id_token")
+	}
+
+	return p.verifyIDToken(ctx, meta, tokens.IDToken, nonce)
+}
+
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	AuthorizedParty   string `json:"azp"`
+	Nonce             string `json:"nonce"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	Name              string `json:"name"`
+	PreferredUsername string `json:"preferred_username"`
+}
+
+func (p *Provider) verifyIDToken(ctx context.Context, meta *metadata, raw, nonce string) (*Claims, error) {
+	claims := &idTokenClaims{}
+	_, err := jwt.NewParser(
+		jwt.WithValidMethods(signingAlgorithms),
+		jwt.WithIssuer(meta.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(time.Minute),
+	).ParseWithClaims(raw, claims, func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, meta, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid id token: %w", err)
+	}
+
+	if claims.Subject == "" {
+		return nil, errors.New("id token has no subject")
+	}
+	if claims.Nonce != nonce {
+		return nil, errors.New("id token nonce does not match")
+	}
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != p.cfg.ClientID {
+		return nil, errors.New("id token was issued to another party")
+	}
+
+	return &Claims{
+		Subject:           claims.Subject,
+		Email:             claims.Email,
+		EmailVerified:     claims.EmailVerified,
+		Name:              claims.Name,
+		PreferredUsername: claims.PreferredUsername,
+	}, nil
+}
+
+func (p *Provider) metadata(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	meta := p.meta
+	p.mu.Unlock()
+	if meta != nil {
+		return meta, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.cfg.IssuerURL+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	meta = &metadata{}
+	if err := p.do(req, meta); err != nil {
+		return nil, fmt.Errorf("discovery of %s failed: %w", p.cfg.ID, err)
+	}
+	// OpenID Connect Discovery section 4.3: the document must be about the
+	// issuer it was fetched from.
+	if strings.TrimRight(meta.Issuer, "/") != p.cfg.IssuerURL {
+		return nil, fmt.Errorf("discovery of %s returned issuer %q", p.cfg.ID, meta.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, fmt.Errorf("discovery document of %s is incomplete", p.cfg.ID)
+	}
+
+	p.mu.Lock()
+	p.meta = meta
+	p.mu.Unlock()
+	return meta, nil
+}
+
+// key returns the public key kid of the provider. Keys are refetched when
+// an unknown kid shows up, as providers rotate them without notice.
+func (p *Provider) key(ctx context.Context, meta *metadata, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	key, ok := p.keys[kid]
+	fetched := p.keys != nil
+	age := time.Since(p.keysFetchedAt)
+	p.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+	if fetched && age < minKeyRefreshInterval {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, meta.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := p.do(req, &set); err != nil {
+		return nil, fmt.Errorf("failed to fetch keys of %s: %w", p.cfg.ID, err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		public, err := k.publicKey()
+		if err != nil {
+			// Providers may publish key types we do not use; skip them
+			// instead of failing every login.
+			continue
+		}
+		keys[k.Kid] = public
+	}
+
+	p.mu.Lock()
+	p.keys = keys
+	p.keysFetchedAt = time.Now()
+	p.mu.Unlock()
+
+	key, ok = keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	return key, nil
+}
+
+// do sends req and decodes the JSON response into v. v is also filled for
+// error responses, which carry OAuth error codes.
+func (p *Provider) do(req *http.Request, v any) error {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return err
+	}
+	decodeErr := json.Unmarshal(body, v)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s: unexpected status %d", req.Method, req.URL.Redacted(), resp.StatusCode)
+	}
+	if decodeErr != nil {
+		return fmt.Errorf("%s %s: invalid response: %w", req.Method, req.URL.Redacted(), decodeErr)
+	}
+	return nil
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	decode := base64.RawURLEncoding.DecodeString
+
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: invalid modulus: %w", k.Kid, err)
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: invalid exponent: %w", k.Kid, err)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("key %s: unsupported curve %q", k.Kid, k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: invalid x: %w", k.Kid, err)
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: invalid y: %w", k.Kid, err)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("key %s: unsupported curve %q", k.Kid, k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("key %s: invalid Ed25519 key", k.Kid)
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("key %s: unsupported key type %q", k.Kid, k.Kty)
+}
@@ -0,0 +1,107 @@
+package oidc_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/oidc"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/oidc/oidctest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const redirectURL = "https://club.example.com/auth/oidc/test/callback"
+
+func newProvider(idp *oidctest.Server) *oidc.Provider {
+	return oidc.New(oidc.Config{
+		ID:           "test",
+		Name:         "Test IdP",
+		IssuerURL:    idp.URL,
+		ClientID:     oidctest.ClientID,
+		ClientSecret: oidctest.ClientSecret,
+		RedirectURL:  redirectURL,
+		Scopes:       []string{"email", "profile"},
+	}, idp.Client())
+}
+
+func challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+const verifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+
+func TestProvider_Exchange(t *testing.T) {
+	idp := oidctest.NewServer(t)
+	idp.SetUser(oidctest.User{Subject: "42", Email: "reader@example.com", EmailVerified: true, PreferredUsername: "reader"})
+	p := newProvider(idp)
+	ctx := context.Background()
+
+	authURL, err := p.AuthCodeURL(ctx, "state-1", "nonce-1", challenge(verifier))
+	require.NoError(t, err)
+	assert.Contains(t, authURL, "scope=openid+email+profile")
+
+	code, state := idp.Authorize(t, authURL)
+	assert.Equal(t, "state-1", state)
+
+	t.Run("wrong verifier", func(t *testing.T) {
+		_, err := p.Exchange(ctx, code, "x"+verifier[1:], "nonce-1")
+		assert.Error(t, err)
+	})
+
+	code, _ = idp.Authorize(t, authURL)
+	claims, err := p.Exchange(ctx, code, verifier, "nonce-1")
+	require.NoError(t, err)
+	assert.Equal(t, &oidc.Claims{Subject: "42", Email: "reader@example.com", EmailVerified: true, PreferredUsername: "reader"}, claims)
+
+	t.Run("code is single use", func(t *testing.T) {
+		_, err := p.Exchange(ctx, code, verifier, "nonce-1")
+		assert.Error(t, err)
+	})
+}
+
+func TestProvider_RejectsIDTokens(t *testing.T) {
+	tests := []struct {
+		name   string
+		nonce  string
+		mutate func(jwt.MapClaims)
+	}{
+		{"wrong nonce", "other-nonce", nil},
+		{"wrong audience", "nonce-1", func(c jwt.MapClaims) { c["aud"] = "another-client" }},
+		{"wrong issuer", "nonce-1", func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }},
+		{"expired", "nonce-1", func(c jwt.MapClaims) { c["exp"] = 1 }},
+		{"no subject", "nonce-1", func(c jwt.MapClaims) { delete(c, "sub") }},
+		{"other authorized party", "nonce-1", func(c jwt.MapClaims) {
+			c["aud"] = []string{oidctest.ClientID, "another-client"}
+			c["azp"] = "another-client"
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp := oidctest.NewServer(t)
+			idp.SetUser(oidctest.User{Subject: "42"})
+			idp.MutateIDToken(tt.mutate)
+			p := newProvider(idp)
+			ctx := context.Background()
+
+			authURL, err := p.AuthCodeURL(ctx, "state-1", "nonce-1", challenge(verifier))
+			require.NoError(t, err)
+			code, _ := idp.Authorize(t, authURL)
+
+			_, err = p.Exchange(ctx, code, verifier, tt.nonce)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestProvider_DiscoveryFailure(t *testing.T) {
+	idp := oidctest.NewServer(t)
+	p := oidc.New(oidc.Config{ID: "test", IssuerURL: idp.URL + "/tenant", ClientID: oidctest.ClientID}, idp.Client())
+
+	_, err := p.AuthCodeURL(context.Background(), "state", "nonce", challenge(verifier))
+	assert.Error(t, err)
+}
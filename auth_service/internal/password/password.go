@@ -0,0 +1,190 @@
+// Package password hashes user passwords with argon2id or bcrypt and tells
+// callers when a stored hash should be replaced by one with the current
+// algorithm and parameters.
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	AlgArgon2id = "argon2id"
+	AlgBcrypt   = "bcrypt"
+)
+
+// ErrUnknownHash is returned for stored hashes in a format this package does
+// not recognise.
+var ErrUnknownHash = errors.New("unknown password hash format")
+
+// Argon2Params are the argon2id cost parameters. Memory is in KiB.
+type Argon2Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2Params follow the second recommended option of RFC 9106.
+var DefaultArgon2Params = Argon2Params{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 4,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// Hasher creates hashes with one algorithm and verifies hashes of either
+// algorithm, so users registered before a switch can still log in.
+type Hasher struct {
+	algorithm  string
+	argon2     Argon2Params
+	bcryptCost int
+}
+
+// NewHasher returns a hasher that creates hashes with algorithm. Zero fields
+// of params fall back to DefaultArgon2Params and a zero bcryptCost to
+// bcrypt.DefaultCost.
+func NewHasher(algorithm string, params Argon2Params, bcryptCost int) (*Hasher, error) {
+	switch algorithm {
+	case "":
+		algorithm = AlgArgon2id
+	case AlgArgon2id, AlgBcrypt:
+	default:
+		return nil, fmt.Errorf("unsupported password hash algorithm %q", algorithm)
+	}
+
+	if params.Memory == 0 {
+		params.Memory = DefaultArgon2Params.Memory
+	}
+	if params.Iterations == 0 {
+		params.Iterations = DefaultArgon2Params.Iterations
+	}
+	if params.Parallelism == 0 {
+		params.Parallelism = DefaultArgon2Params.Parallelism
+	}
+	if params.SaltLength == 0 {
+		params.SaltLength = DefaultArgon2Params.SaltLength
+	}
+	if params.KeyLength == 0 {
+		params.KeyLength = DefaultArgon2Params.KeyLength
+	}
+
+	if bcryptCost == 0 {
+		bcryptCost = bcrypt.DefaultCost
+	}
+	if bcryptCost < bcrypt.MinCost || bcryptCost > bcrypt.MaxCost {
+		return nil, fmt.Errorf("bcrypt cost %d out of range", bcryptCost)
+	}
+
+	return &Hasher{algorithm: algorithm, argon2: params, bcryptCost: bcryptCost}, nil
+}
+
+// DefaultHasher creates argon2id hashes with DefaultArgon2Params.
+func DefaultHasher() *Hasher {
+	return &Hasher{algorithm: AlgArgon2id, argon2: DefaultArgon2Params, bcryptCost: bcrypt.DefaultCost}
+}
+
+// Hash returns the encoded hash of password.
+func (h *Hasher) Hash(password string) (string, error) {
+	if h.algorithm == AlgBcrypt {
+		hashed, err := bcrypt.GenerateFromPassword([]byte(password), h.bcryptCost)
+		if err != nil {
+			return "", fmt.Errorf("bcrypt: %w", err)
+		}
+		return string(hashed), nil
+	}
+
+	salt := make([]byte, h.argon2.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to read random bytes: %w", err)
+	}
+	return encodeArgon2(h.argon2, salt, argon2Key(password, salt, h.argon2)), nil
+}
+
+// Verify checks password against encoded. needsRehash reports a match whose
+// hash was created with another algorithm or other parameters than h uses.
+func (h *Hasher) Verify(password, encoded string) (ok, needsRehash bool, err error) {
+	switch {
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		params, salt, key, err := decodeArgon2(encoded)
+		if err != nil {
+			return false, false, err
+		}
+		if subtle.ConstantTimeCompare(argon2Key(password, salt, params), key) != 1 {
+			return false, false, nil
+		}
+		return true, h.algorithm != AlgArgon2id || params != h.argon2, nil
+
+	case strings.HasPrefix(encoded, "$2"):
+		err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, false, nil
+		}
+		if err != nil {
+			return false, false, fmt.Errorf("bcrypt: %w", err)
+		}
+		if h.algorithm != AlgBcrypt {
+			return true, true, nil
+		}
+		cost, err := bcrypt.Cost([]byte(encoded))
+		return true, err != nil || cost != h.bcryptCost, nil
+	}
+
+	return false, false, ErrUnknownHash
+}
+
+func argon2Key(password string, salt []byte, p Argon2Params) []byte {
+	return argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+}
+
+// encodeArgon2 uses the PHC string format also produced by the reference
+// implementation: $argon2id$v=19$m=65536,t=3,p=4$<salt>$<key>.
+func encodeArgon2(p Argon2Params, salt, key []byte) string {
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.Memory, p.Iterations, p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
+}
+
+func decodeArgon2(encoded string) (Argon2Params, []byte, []byte, error) {
+	var p Argon2Params
+
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return p, nil, nil, ErrUnknownHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return p, nil, nil, fmt.Errorf("argon2id: invalid version: %w", err)
+	}
+	if version != argon2.Version {
+		return p, nil, nil, fmt.Errorf("argon2id: unsupported version %d", version)
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil {
+		return p, nil, nil, fmt.Errorf("argon2id: invalid parameters: %w", err)
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, fmt.Errorf("argon2id: invalid salt: %w", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return p, nil, nil, fmt.Errorf("argon2id: invalid key: %w", err)
+	}
+	p.SaltLength = uint32(len(salt))
+	p.KeyLength = uint32(len(key))
+
+	return p, salt, key, nil
+}
@@ -0,0 +1,116 @@
+package password_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/password"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// cheap keeps the argon2id tests fast.
+var cheap = password.Argon2Params{Memory: 1024, Iterations: 1, Parallelism: 1}
+
+func TestArgon2id(t *testing.T) {
+	h, err := password.NewHasher(password.AlgArgon2id, cheap, 0)
+	require.NoError(t, err)
+
+	hash, err := h.Hash("correct horse battery staple")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$"), hash)
+
+	other, err := h.Hash("correct horse battery staple")
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, other, "salt is random")
+
+	ok, rehash, err := h.Verify("correct horse battery staple", hash)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.False(t, rehash)
+
+	ok, _, err = h.Verify("wrong", hash)
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestArgon2id_LongPasswords(t *testing.T) {
+	h, err := password.NewHasher(password.AlgArgon2id, cheap, 0)
+	require.NoError(t, err)
+
+	long := strings.Repeat("a", 72)
+	hash, err := h.Hash(long + "1")
+	require.NoError(t, err)
+
+	ok, _, err := h.Verify(long+"2", hash)
+	require.NoError(t, err)
+	assert.False(t, ok, "bytes after the 72nd must count")
+}
+
+func TestVerify_LegacyBcrypt(t *testing.T) {
+	h, err := password.NewHasher(password.AlgArgon2id, cheap, 0)
+	require.NoError(t, err)
+
+	legacy, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	ok, rehash, err := h.Verify("secret", string(legacy))
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, rehash)
+
+	ok, rehash, err = h.Verify("wrong", string(legacy))
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.False(t, rehash)
+}
+
+func TestVerify_OutdatedParameters(t *testing.T) {
+	old, err := password.NewHasher(password.AlgArgon2id, cheap, 0)
+	require.NoError(t, err)
+	hash, err := old.Hash("secret")
+	require.NoError(t, err)
+
+	stronger := cheap
+	stronger.Iterations = 2
+	h, err := password.NewHasher(password.AlgArgon2id, stronger, 0)
+	require.NoError(t, err)
+
+	ok, rehash, err := h.Verify("secret", hash)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, rehash)
+}
+
+func TestBcrypt(t *testing.T) {
+	h, err := password.NewHasher(password.AlgBcrypt, password.Argon2Params{}, bcrypt.MinCost)
+	require.NoError(t, err)
+
+	hash, err := h.Hash("secret")
+	require.NoError(t, err)
+
+	ok, rehash, err := h.Verify("secret", hash)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.False(t, rehash)
+
+	higher, err := password.NewHasher(password.AlgBcrypt, password.Argon2Params{}, bcrypt.MinCost+1)
+	require.NoError(t, err)
+	_, rehash, err = higher.Verify("secret", hash)
+	require.NoError(t, err)
+	assert.True(t, rehash)
+}
+
+func TestVerify_UnknownFormat(t *testing.T) {
+	h, err := password.NewHasher("", password.Argon2Params{}, 0)
+	require.NoError(t, err)
+
+	_, _, err = h.Verify("secret", "plaintext")
+	assert.ErrorIs(t, err, password.ErrUnknownHash)
+}
+
+func TestNewHasher_UnsupportedAlgorithm(t *testing.T) {
+	_, err := password.NewHasher("md5", password.Argon2Params{}, 0)
+	assert.Error(t, err)
+}
@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/model"
+)
+
+type ActionTokenRepository struct {
+	db *sql.DB
+}
+
+func NewActionTokenRepository(db *sql.DB) *ActionTokenRepository {
+	return &ActionTokenRepository{
+		db: db,
+	}
+}
+
+func (r *ActionTokenRepository) CreateActionToken(t *model.ActionToken) error {
+	query := `INSERT INTO action_tokens (user_id, purpose, selector, token_hash, expires_at) VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at`
+
+	return r.db.QueryRow(
+		query,
+		t.UserID,
+		t.Purpose,
+		t.Selector,
+		t.TokenHash,
+		t.ExpiresAt,
+	).Scan(&t.ID, &t.CreatedAt)
+}
+
+// FindActionToken returns the unused, unexpired token of purpose with selector.
+func (r *ActionTokenRepository) FindActionToken(purpose, selector string) (*model.ActionToken, error) {
+	t := &model.ActionToken{}
+	query := `SELECT id, user_id, purpose, selector, token_hash, expires_at, used_at, created_at FROM action_tokens
+		WHERE purpose = $1 AND selector = $2 AND used_at IS NULL AND expires_at > NOW()`
+	if err := r.db.QueryRow(query, purpose, selector).Scan(
+		&t.ID,
+		&t.UserID,
+		&t.Purpose,
+		&t.Selector,
+		&t.TokenHash,
+		&t.ExpiresAt,
+		&t.UsedAt,
+		&t.CreatedAt,
+	); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("invalid action token")
+		}
+		return nil, err
+	}
+	return t, nil
+}
+
+// MarkActionTokenUsed consumes the token. It reports false when the token was
+// already used, e.g. by a concurrent request with the same token.
+func (r *ActionTokenRepository) MarkActionTokenUsed(id string) (bool, error) {
+	res, err := r.db.Exec(`UPDATE action_tokens SET used_at = NOW() WHERE id = $1 AND used_at IS NULL`, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// ReleaseActionToken makes a token consumed by MarkActionTokenUsed usable
+// again.
+func (r *ActionTokenRepository) ReleaseActionToken(id string) error {
+	_, err := r.db.Exec(`UPDATE action_tokens SET used_at = NULL WHERE id = $1`, id)
+	return err
+}
+
+// DeleteActionTokens removes the user's tokens of purpose, so that requesting
+// a new token invalidates the ones mailed before.
+func (r *ActionTokenRepository) DeleteActionTokens(userID, purpose string) error {
+	query := `DELETE FROM action_tokens WHERE user_id = $1 AND purpose = $2`
+	_, err := r.db.Exec(query, userID, purpose)
+	return err
+}
+
+// LastActionTokenAt returns when the user was last issued a token of purpose,
+// or the zero time if there is none.
+func (r *ActionTokenRepository) LastActionTokenAt(userID, purpose string) (time.Time, error) {
+	var last sql.NullTime
+	query := `SELECT MAX(created_at) FROM action_tokens WHERE user_id = $1 AND purpose = $2`
+	if err := r.db.QueryRow(query, userID, purpose).Scan(&last); err != nil {
+		return time.Time{}, err
+	}
+	return last.Time, nil
+}
@@ -0,0 +1,95 @@
+package repository_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/model"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestActionTokenRepo(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating mock db: %v", err)
+	}
+	defer db.Close()
+
+	repo := repository.NewActionTokenRepository(db)
+
+	id := uuid.NewString()
+	userId := uuid.NewString()
+	exp := time.Now().Add(time.Hour)
+
+	t.Run("CreateActionToken success", func(t *testing.T) {
+		token := &model.ActionToken{
+			UserID:    userId,
+			Purpose:   model.ActionPasswordReset,
+			Selector:  "selector123",
+			TokenHash: "123hash",
+			ExpiresAt: exp,
+		}
+
+		mock.ExpectQuery(`INSERT INTO action_tokens`).
+			WithArgs(userId, model.ActionPasswordReset, "selector123", "123hash", exp).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(id, time.Now()))
+
+		err := repo.CreateActionToken(token)
+		assert.NoError(t, err)
+		assert.Equal(t, id, token.ID)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("FindActionToken success", func(t *testing.T) {
+		rows := sqlmock.NewRows([]string{"id", "user_id", "purpose", "selector", "token_hash", "expires_at", "used_at", "created_at"}).
+			AddRow(id, userId, model.ActionPasswordReset, "selector123", "123hash", exp, nil, time.Now())
+		mock.ExpectQuery(`SELECT id, user_id, purpose, selector, token_hash, expires_at, used_at, created_at FROM action_tokens`).
+			WithArgs(model.ActionPasswordReset, "selector123").
+			WillReturnRows(rows)
+
+		token, err := repo.FindActionToken(model.ActionPasswordReset, "selector123")
+		assert.NoError(t, err)
+		assert.Equal(t, userId, token.UserID)
+		assert.Nil(t, token.UsedAt)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("FindActionToken not found", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT id, user_id, purpose, selector, token_hash, expires_at, used_at, created_at FROM action_tokens`).
+			WithArgs(model.ActionPasswordReset, "missing").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+		token, err := repo.FindActionToken(model.ActionPasswordReset, "missing")
+		assert.Error(t, err)
+		assert.Nil(t, token)
+	})
+
+	t.Run("LastActionTokenAt without tokens", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT MAX\(created_at\) FROM action_tokens WHERE user_id = \$1 AND purpose = \$2`).
+			WithArgs(userId, model.ActionEmailVerification).
+			WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(nil))
+
+		last, err := repo.LastActionTokenAt(userId, model.ActionEmailVerification)
+		assert.NoError(t, err)
+		assert.True(t, last.IsZero())
+	})
+
+	t.Run("MarkActionTokenUsed only once", func(t *testing.T) {
+		mock.ExpectExec(`UPDATE action_tokens SET used_at = NOW\(\) WHERE id = \$1 AND used_at IS NULL`).
+			WithArgs(id).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`UPDATE action_tokens SET used_at = NOW\(\) WHERE id = \$1 AND used_at IS NULL`).
+			WithArgs(id).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		used, err := repo.MarkActionTokenUsed(id)
+		assert.NoError(t, err)
+		assert.True(t, used)
+
+		used, err = repo.MarkActionTokenUsed(id)
+		assert.NoError(t, err)
+		assert.False(t, used)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
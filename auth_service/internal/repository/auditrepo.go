@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/model"
+)
+
+type AuditRepository struct {
+	db *sql.DB
+}
+
+func NewAuditRepository(db *sql.DB) *AuditRepository {
+	return &AuditRepository{
+		db: db,
+	}
+}
+
+func (r *AuditRepository) CreateAuditEvent(e *model.AuditEvent) error {
+	query := `
+		INSERT INTO auth_audit (user_id, actor_id, event_type, outcome, ip, user_agent, details)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at`
+
+	return r.db.QueryRow(
+		query,
+		nullString(e.UserID),
+		nullString(e.ActorID),
+		e.EventType,
+		e.Outcome,
+		nullString(e.IP),
+		nullString(e.UserAgent),
+		e.Details,
+	).Scan(&e.ID, &e.CreatedAt)
+}
+
+// ListAuditEvents returns the events matching f, newest first. Events with
+// the same creation time are ordered by id so that f.After is unambiguous.
+func (r *AuditRepository) ListAuditEvents(f model.AuditFilter) ([]*model.AuditEvent, error) {
+	var conds []string
+	var args []any
+	where := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+
+	if f.UserID != "" {
+		where("user_id = $%d", f.UserID)
+	}
+	if f.EventType != "" {
+		where("event_type = $%d", f.EventType)
+	}
+	if !f.Since.IsZero() {
+		where("created_at >= $%d", f.Since)
+	}
+	if !f.Until.IsZero() {
+		where("created_at < $%d", f.Until)
+	}
+	if f.After != nil {
+		args = append(args, f.After.CreatedAt, f.After.ID)
+		conds = append(conds, fmt.Sprintf("(created_at, id) < ($%d, $%d)", len(args)-1, len(args)))
+	}
+
+	query := `
+		SELECT id, user_id, actor_id, event_type, outcome, ip, user_agent, details, created_at
+		FROM auth_audit`
+	if len(conds) > 0 {
+		query += "\n\t\tWHERE " + strings.Join(conds, " AND ")
+	}
+	args = append(args, f.Limit)
+	query += fmt.Sprintf("\n\t\tORDER BY created_at DESC, id DESC\n\t\tLIMIT $%d", len(args))
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []*model.AuditEvent
+	for rows.Next() {
+		var e model.AuditEvent
+		var userID, actorID, ip, userAgent, details sql.NullString
+		err := rows.Scan(&e.ID, &userID, &actorID, &e.EventType, &e.Outcome, &ip, &userAgent, &details, &e.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan audit event: %w", err)
+		}
+		e.UserID = userID.String
+		e.ActorID = actorID.String
+		e.IP = ip.String
+		e.UserAgent = userAgent.String
+		e.Details = details.String
+		events = append(events, &e)
+	}
+
+	return events, rows.Err()
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
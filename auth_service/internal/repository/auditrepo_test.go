@@ -0,0 +1,79 @@
+package repository_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/model"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditRepo(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating mock db: %v", err)
+	}
+	defer db.Close()
+
+	repo := repository.NewAuditRepository(db)
+	userId := uuid.NewString()
+	columns := []string{"id", "user_id", "actor_id", "event_type", "outcome", "ip", "user_agent", "details", "created_at"}
+
+	t.Run("CreateAuditEvent", func(t *testing.T) {
+		now := time.Now()
+		mock.ExpectQuery(`INSERT INTO auth_audit \(user_id, actor_id, event_type, outcome, ip, user_agent, details\)`).
+			WithArgs(nil, nil, model.AuditLoginFailed, model.AuditOutcomeFailure, "203.0.113.7", "curl/8.0", "reason=unknown_email").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow("audit-1", now))
+
+		e := &model.AuditEvent{
+			EventType: model.AuditLoginFailed,
+			Outcome:   model.AuditOutcomeFailure,
+			IP:        "203.0.113.7",
+			UserAgent: "curl/8.0",
+			Details:   "reason=unknown_email",
+		}
+		assert.NoError(t, repo.CreateAuditEvent(e))
+		assert.Equal(t, "audit-1", e.ID)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("ListAuditEvents without filter", func(t *testing.T) {
+		rows := sqlmock.NewRows(columns).
+			AddRow("audit-2", nil, nil, model.AuditLoginFailed, model.AuditOutcomeFailure, nil, nil, nil, time.Now())
+		mock.ExpectQuery(`FROM auth_audit\s+ORDER BY created_at DESC, id DESC\s+LIMIT \$1`).
+			WithArgs(50).WillReturnRows(rows)
+
+		events, err := repo.ListAuditEvents(model.AuditFilter{Limit: 50})
+		assert.NoError(t, err)
+		assert.Len(t, events, 1)
+		assert.Empty(t, events[0].UserID)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("ListAuditEvents with filter", func(t *testing.T) {
+		since := time.Now().Add(-24 * time.Hour)
+		until := time.Now()
+		after := &model.AuditPosition{CreatedAt: until.Add(-time.Hour), ID: "audit-9"}
+		rows := sqlmock.NewRows(columns).
+			AddRow("audit-3", userId, userId, model.AuditPasswordChanged, model.AuditOutcomeSuccess, "203.0.113.7", "curl/8.0", "", since)
+		mock.ExpectQuery(`WHERE user_id = \$1 AND event_type = \$2 AND created_at >= \$3 AND created_at < \$4 AND \(created_at, id\) < \(\$5, \$6\)\s+ORDER BY created_at DESC, id DESC\s+LIMIT \$7`).
+			WithArgs(userId, model.AuditPasswordChanged, since, until, after.CreatedAt, after.ID, 10).
+			WillReturnRows(rows)
+
+		events, err := repo.ListAuditEvents(model.AuditFilter{
+			UserID:    userId,
+			EventType: model.AuditPasswordChanged,
+			Since:     since,
+			Until:     until,
+			After:     after,
+			Limit:     10,
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, userId, events[0].ActorID)
+		assert.Equal(t, "curl/8.0", events[0].UserAgent)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/model"
+)
+
+type IdentityRepository struct {
+	db *sql.DB
+}
+
+func NewIdentityRepository(db *sql.DB) *IdentityRepository {
+	return &IdentityRepository{
+		db: db,
+	}
+}
+
+func (r *IdentityRepository) FindIdentity(provider, subject string) (*model.Identity, error) {
+	i := &model.Identity{}
+	query := `SELECT provider, subject, user_id, email, created_at, last_login_at
+		FROM user_identities WHERE provider = $1 AND subject = $2`
+	if err := r.db.QueryRow(query, provider, subject).Scan(
+		&i.Provider,
+		&i.Subject,
+		&i.UserID,
+		&i.Email,
+		&i.CreatedAt,
+		&i.LastLoginAt,
+	); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, model.ErrIdentityNotFound
+		}
+		return nil, err
+	}
+	return i, nil
+}
+
+func (r *IdentityRepository) CreateIdentity(i *model.Identity) error {
+	query := `INSERT INTO user_identities (provider, subject, user_id, email, last_login_at)
+		VALUES ($1, $2, $3, $4, NOW()) RETURNING created_at, last_login_at`
+	return r.db.QueryRow(query, i.Provider, i.Subject, i.UserID, i.Email).Scan(&i.CreatedAt, &i.LastLoginAt)
+}
+
+// TouchIdentity records a login through the identity and the email the
+// provider currently reports for it.
+func (r *IdentityRepository) TouchIdentity(provider, subject, email string) error {
+	_, err := r.db.Exec(`UPDATE user_identities SET last_login_at = NOW(), email = $3 WHERE provider = $1 AND subject = $2`,
+		provider, subject, email)
+	return err
+}
+
+// CreateLoginState stores a pending login and drops the expired ones of
+// logins that never came back.
+func (r *IdentityRepository) CreateLoginState(s *model.FederatedLoginState) error {
+	if _, err := r.db.Exec(`DELETE FROM federated_login_states WHERE expires_at < NOW()`); err != nil {
+		return err
+	}
+
+	query := `INSERT INTO federated_login_states (selector, state_hash, provider, nonce, code_verifier, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`
+	_, err := r.db.Exec(query, s.Selector, s.StateHash, s.Provider, s.Nonce, s.CodeVerifier, s.ExpiresAt)
+	return err
+}
+
+// ConsumeLoginState deletes the unexpired pending login with selector and
+// returns it, so every state can complete at most one login.
+func (r *IdentityRepository) ConsumeLoginState(selector string) (*model.FederatedLoginState, error) {
+	s := &model.FederatedLoginState{}
+	query := `DELETE FROM federated_login_states WHERE selector = $1 AND expires_at > NOW()
+		RETURNING selector, state_hash, provider, nonce, code_verifier, expires_at`
+	if err := r.db.QueryRow(query, selector).Scan(
+		&s.Selector,
+		&s.StateHash,
+		&s.Provider,
+		&s.Nonce,
+		&s.CodeVerifier,
+		&s.ExpiresAt,
+	); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("invalid login state")
+		}
+		return nil, err
+	}
+	return s, nil
+}
@@ -0,0 +1,85 @@
+package repository_test
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/model"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdentityRepo(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating mock db: %v", err)
+	}
+	defer db.Close()
+
+	repo := repository.NewIdentityRepository(db)
+	userId := uuid.NewString()
+
+	t.Run("FindIdentity", func(t *testing.T) {
+		rows := sqlmock.NewRows([]string{"provider", "subject", "user_id", "email", "created_at", "last_login_at"}).
+			AddRow("google", "1234", userId, "reader@example.com", time.Now(), nil)
+		mock.ExpectQuery(`SELECT (.+) FROM user_identities WHERE provider = \$1 AND subject = \$2`).
+			WithArgs("google", "1234").WillReturnRows(rows)
+
+		identity, err := repo.FindIdentity("google", "1234")
+		assert.NoError(t, err)
+		assert.Equal(t, userId, identity.UserID)
+		assert.Nil(t, identity.LastLoginAt)
+
+		mock.ExpectQuery(`SELECT (.+) FROM user_identities`).WithArgs("google", "missing").WillReturnError(sql.ErrNoRows)
+		_, err = repo.FindIdentity("google", "missing")
+		assert.ErrorIs(t, err, model.ErrIdentityNotFound)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("CreateIdentity", func(t *testing.T) {
+		now := time.Now()
+		mock.ExpectQuery(`INSERT INTO user_identities \(provider, subject, user_id, email, last_login_at\)`).
+			WithArgs("gitlab", "77", userId, "reader@example.com").
+			WillReturnRows(sqlmock.NewRows([]string{"created_at", "last_login_at"}).AddRow(now, now))
+
+		identity := &model.Identity{Provider: "gitlab", Subject: "77", UserID: userId, Email: "reader@example.com"}
+		assert.NoError(t, repo.CreateIdentity(identity))
+		assert.Equal(t, now, identity.CreatedAt)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("CreateLoginState purges expired states", func(t *testing.T) {
+		expires := time.Now().Add(10 * time.Minute)
+		mock.ExpectExec(`DELETE FROM federated_login_states WHERE expires_at < NOW\(\)`).
+			WillReturnResult(sqlmock.NewResult(0, 3))
+		mock.ExpectExec(`INSERT INTO federated_login_states`).
+			WithArgs("sel", "hash", "google", "nonce", "verifier", expires).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		err := repo.CreateLoginState(&model.FederatedLoginState{
+			Selector: "sel", StateHash: "hash", Provider: "google", Nonce: "nonce", CodeVerifier: "verifier", ExpiresAt: expires,
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("ConsumeLoginState is single use", func(t *testing.T) {
+		expires := time.Now().Add(10 * time.Minute)
+		rows := sqlmock.NewRows([]string{"selector", "state_hash", "provider", "nonce", "code_verifier", "expires_at"}).
+			AddRow("sel", "hash", "google", "nonce", "verifier", expires)
+		mock.ExpectQuery(`DELETE FROM federated_login_states WHERE selector = \$1 AND expires_at > NOW\(\) RETURNING`).
+			WithArgs("sel").WillReturnRows(rows)
+		mock.ExpectQuery(`DELETE FROM federated_login_states`).WithArgs("sel").WillReturnError(sql.ErrNoRows)
+
+		state, err := repo.ConsumeLoginState("sel")
+		assert.NoError(t, err)
+		assert.Equal(t, "verifier", state.CodeVerifier)
+
+		_, err = repo.ConsumeLoginState("sel")
+		assert.Error(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
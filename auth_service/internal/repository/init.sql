@@ -5,13 +5,185 @@ CREATE TABLE IF NOT EXISTS users(
     user_name  TEXT NOT NULL UNIQUE,
     email  TEXT NOT NULL UNIQUE,
     password_hash  TEXT NOT NULL,
-    created_at TIMESTAMP DEFAULT NOW()
+    display_name TEXT NOT NULL DEFAULT '',
+    bio TEXT NOT NULL DEFAULT '',
+    email_verified BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT NOW(),
+    suspended_at TIMESTAMP
 );
 
+-- Upgrade databases created before these columns existed.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS display_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS bio TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS suspended_at TIMESTAMP;
+
 CREATE TABLE IF NOT EXISTS refresh_tokens(
     id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
     user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    family_id UUID,
+    selector TEXT UNIQUE,
     token_hash TEXT NOT NULL,
     access_token_id TEXT NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    rotated_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    last_used_at TIMESTAMP,
+    user_agent TEXT NOT NULL DEFAULT '',
+    ip TEXT NOT NULL DEFAULT ''
+);
+
+-- Upgrade databases created before these columns existed.
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS selector TEXT UNIQUE;
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS family_id UUID;
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS rotated_at TIMESTAMP;
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS created_at TIMESTAMP NOT NULL DEFAULT NOW();
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS last_used_at TIMESTAMP;
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS user_agent TEXT NOT NULL DEFAULT '';
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS ip TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS refresh_tokens_user_id_idx ON refresh_tokens(user_id);
+
+CREATE INDEX IF NOT EXISTS refresh_tokens_family_id_idx ON refresh_tokens(family_id);
+
+CREATE TABLE IF NOT EXISTS revoked_access_tokens(
+    token_id TEXT PRIMARY KEY,
     expires_at TIMESTAMP NOT NULL
-);
\ No newline at end of file
+);
+
+CREATE INDEX IF NOT EXISTS revoked_access_tokens_expires_at_idx ON revoked_access_tokens(expires_at);
+
+CREATE TABLE IF NOT EXISTS auth_audit(
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID,
+    actor_id UUID,
+    event_type TEXT NOT NULL,
+    outcome TEXT NOT NULL DEFAULT 'success' CHECK (outcome IN ('success', 'failure')),
+    ip TEXT,
+    user_agent TEXT,
+    details TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Upgrade databases created before these columns existed.
+ALTER TABLE auth_audit ADD COLUMN IF NOT EXISTS actor_id UUID;
+ALTER TABLE auth_audit ADD COLUMN IF NOT EXISTS outcome TEXT NOT NULL DEFAULT 'success' CHECK (outcome IN ('success', 'failure'));
+ALTER TABLE auth_audit ADD COLUMN IF NOT EXISTS ip TEXT;
+ALTER TABLE auth_audit ADD COLUMN IF NOT EXISTS user_agent TEXT;
+
+CREATE TABLE IF NOT EXISTS user_roles(
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role TEXT NOT NULL CHECK (role IN ('member', 'organizer', 'admin')),
+    granted_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, role)
+);
+
+CREATE TABLE IF NOT EXISTS action_tokens(
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    purpose TEXT NOT NULL,
+    selector TEXT NOT NULL UNIQUE,
+    token_hash TEXT NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS action_tokens_user_id_purpose_idx ON action_tokens(user_id, purpose);
+
+CREATE TABLE IF NOT EXISTS login_failures(
+    key TEXT PRIMARY KEY,
+    failures INTEGER NOT NULL,
+    last_failure TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS user_totp(
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    secret TEXT NOT NULL,
+    confirmed_at TIMESTAMP,
+    last_used_step BIGINT,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes(
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash TEXT NOT NULL,
+    used_at TIMESTAMP,
+    UNIQUE (user_id, code_hash)
+);
+
+CREATE TABLE IF NOT EXISTS personal_access_tokens(
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    scopes TEXT[] NOT NULL,
+    selector TEXT UNIQUE NOT NULL,
+    token_hash TEXT NOT NULL,
+    expires_at TIMESTAMP,
+    last_used_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS personal_access_tokens_user_id_idx ON personal_access_tokens(user_id);
+
+CREATE TABLE IF NOT EXISTS oauth_clients(
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    secret_hash TEXT NOT NULL DEFAULT '',
+    redirect_uris TEXT[] NOT NULL,
+    scopes TEXT[] NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS oauth_consents(
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    client_id TEXT NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    scopes TEXT[] NOT NULL,
+    granted_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, client_id)
+);
+
+CREATE TABLE IF NOT EXISTS oauth_authorization_codes(
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    client_id TEXT NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    selector TEXT UNIQUE NOT NULL,
+    code_hash TEXT NOT NULL,
+    redirect_uri TEXT NOT NULL,
+    scopes TEXT[] NOT NULL,
+    code_challenge TEXT NOT NULL,
+    nonce TEXT NOT NULL DEFAULT '',
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    access_token_id TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS user_identities(
+    provider TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    email TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    last_login_at TIMESTAMP,
+    PRIMARY KEY (provider, subject)
+);
+
+CREATE INDEX IF NOT EXISTS user_identities_user_id_idx ON user_identities(user_id);
+
+CREATE TABLE IF NOT EXISTS federated_login_states(
+    selector TEXT PRIMARY KEY,
+    state_hash TEXT NOT NULL,
+    provider TEXT NOT NULL,
+    nonce TEXT NOT NULL,
+    code_verifier TEXT NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS auth_audit_created_at_idx ON auth_audit(created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS auth_audit_user_id_idx ON auth_audit(user_id, created_at DESC);
+
+-- The audit log is append-only.
+CREATE OR REPLACE RULE auth_audit_no_update AS ON UPDATE TO auth_audit DO INSTEAD NOTHING;
+CREATE OR REPLACE RULE auth_audit_no_delete AS ON DELETE TO auth_audit DO INSTEAD NOTHING;
\ No newline at end of file
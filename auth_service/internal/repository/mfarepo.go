@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/model"
+)
+
+type MFARepository struct {
+	db *sql.DB
+}
+
+func NewMFARepository(db *sql.DB) *MFARepository {
+	return &MFARepository{
+		db: db,
+	}
+}
+
+// SaveTOTPSecret stores a new, unconfirmed secret for the user. A confirmed
+// secret is never replaced.
+func (r *MFARepository) SaveTOTPSecret(userID, secret string) error {
+	query := `INSERT INTO user_totp (user_id, secret) VALUES ($1, $2)
+	ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, created_at = NOW()
+	WHERE user_totp.confirmed_at IS NULL`
+
+	res, err := r.db.Exec(query, userID, secret)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errors.New("two-factor authentication is already enabled")
+	}
+	return nil
+}
+
+func (r *MFARepository) FindTOTP(userID string) (*model.TOTP, error) {
+	t := &model.TOTP{}
+	var lastUsedStep sql.NullInt64
+	query := `SELECT user_id, secret, confirmed_at, last_used_step FROM user_totp WHERE user_id = $1`
+	if err := r.db.QueryRow(query, userID).Scan(
+		&t.UserID,
+		&t.Secret,
+		&t.ConfirmedAt,
+		&lastUsedStep,
+	); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("two-factor authentication is not set up")
+		}
+		return nil, err
+	}
+	t.LastUsedStep = lastUsedStep.Int64
+	return t, nil
+}
+
+// ConfirmTOTP enables the secret and replaces the recovery codes of the user
+// in one transaction.
+func (r *MFARepository) ConfirmTOTP(userID string, step int64, recoveryCodeHashes []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`UPDATE user_totp SET confirmed_at = NOW(), last_used_step = $2 WHERE user_id = $1 AND confirmed_at IS NULL`, userID, step)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errors.New("no pending two-factor enrollment")
+	}
+
+	if _, err := tx.Exec(`DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(
+		`INSERT INTO mfa_recovery_codes (user_id, code_hash) SELECT $1, unnest($2::text[])`,
+		userID,
+		pq.Array(recoveryCodeHashes),
+	); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UseTOTPStep records that the code of step was used. It reports false when
+// that step or a later one was used before, so every code works only once.
+func (r *MFARepository) UseTOTPStep(userID string, step int64) (bool, error) {
+	res, err := r.db.Exec(
+		`UPDATE user_totp SET last_used_step = $2 WHERE user_id = $1 AND (last_used_step IS NULL OR last_used_step < $2)`,
+		userID,
+		step,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// UseRecoveryCode consumes the unused recovery code with codeHash.
+func (r *MFARepository) UseRecoveryCode(userID, codeHash string) (bool, error) {
+	res, err := r.db.Exec(
+		`UPDATE mfa_recovery_codes SET used_at = NOW() WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`,
+		userID,
+		codeHash,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// DeleteMFA removes the secret and the recovery codes of the user.
+func (r *MFARepository) DeleteMFA(userID string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM user_totp WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
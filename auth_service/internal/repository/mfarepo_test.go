@@ -0,0 +1,62 @@
+package repository_test
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMFARepo(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating mock db: %v", err)
+	}
+	defer db.Close()
+
+	repo := repository.NewMFARepository(db)
+	userId := uuid.NewString()
+
+	t.Run("SaveTOTPSecret does not replace a confirmed secret", func(t *testing.T) {
+		mock.ExpectExec(`INSERT INTO user_totp`).WithArgs(userId, "SECRET").WillReturnResult(sqlmock.NewResult(0, 0))
+
+		err := repo.SaveTOTPSecret(userId, "SECRET")
+		assert.Error(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("ConfirmTOTP replaces recovery codes", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(`UPDATE user_totp SET confirmed_at = NOW\(\), last_used_step = \$2 WHERE user_id = \$1 AND confirmed_at IS NULL`).
+			WithArgs(userId, int64(42)).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`DELETE FROM mfa_recovery_codes WHERE user_id = \$1`).WithArgs(userId).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(`INSERT INTO mfa_recovery_codes`).WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectCommit()
+
+		err := repo.ConfirmTOTP(userId, 42, []string{"hash1", "hash2"})
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("ConfirmTOTP without pending enrollment", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(`UPDATE user_totp`).WithArgs(userId, int64(42)).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		err := repo.ConfirmTOTP(userId, 42, []string{"hash1"})
+		assert.Error(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("UseTOTPStep refuses old steps", func(t *testing.T) {
+		mock.ExpectExec(`UPDATE user_totp SET last_used_step = \$2 WHERE user_id = \$1 AND \(last_used_step IS NULL OR last_used_step < \$2\)`).
+			WithArgs(userId, int64(42)).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		fresh, err := repo.UseTOTPStep(userId, 42)
+		assert.NoError(t, err)
+		assert.False(t, fresh)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,225 @@
+package repository
+
+import (
+	"database/sql"
+
+	"github.com/lib/pq"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/model"
+)
+
+type OAuthRepository struct {
+	db *sql.DB
+}
+
+func NewOAuthRepository(db *sql.DB) *OAuthRepository {
+	return &OAuthRepository{
+		db: db,
+	}
+}
+
+const oauthClientColumns = `id, name, secret_hash, redirect_uris, scopes, created_at`
+
+func scanOAuthClient(row rowScanner) (*model.OAuthClient, error) {
+	c := &model.OAuthClient{}
+	if err := row.Scan(
+		&c.ID,
+		&c.Name,
+		&c.SecretHash,
+		pq.Array(&c.RedirectURIs),
+		pq.Array(&c.Scopes),
+		&c.CreatedAt,
+	); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (r *OAuthRepository) CreateClient(c *model.OAuthClient) error {
+	query := `INSERT INTO oauth_clients (id, name, secret_hash, redirect_uris, scopes) VALUES ($1, $2, $3, $4, $5) RETURNING created_at`
+	return r.db.QueryRow(
+		query,
+		c.ID,
+		c.Name,
+		c.SecretHash,
+		pq.Array(c.RedirectURIs),
+		pq.Array(c.Scopes),
+	).Scan(&c.CreatedAt)
+}
+
+func (r *OAuthRepository) FindClient(id string) (*model.OAuthClient, error) {
+	query := `SELECT ` + oauthClientColumns + ` FROM oauth_clients WHERE id = $1`
+	c, err := scanOAuthClient(r.db.QueryRow(query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, model.ErrOAuthClientNotFound
+		}
+		return nil, err
+	}
+	return c, nil
+}
+
+func (r *OAuthRepository) ListClients() ([]*model.OAuthClient, error) {
+	rows, err := r.db.Query(`SELECT ` + oauthClientColumns + ` FROM oauth_clients ORDER BY created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var clients []*model.OAuthClient
+	for rows.Next() {
+		c, err := scanOAuthClient(rows)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, c)
+	}
+	return clients, rows.Err()
+}
+
+// DeleteClient removes the client together with its consents and codes. It
+// reports false when there is no client with id.
+func (r *OAuthRepository) DeleteClient(id string) (bool, error) {
+	res, err := r.db.Exec(`DELETE FROM oauth_clients WHERE id = $1`, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+func (r *OAuthRepository) FindConsent(userID, clientID string) (*model.OAuthConsent, error) {
+	c := &model.OAuthConsent{}
+	query := `SELECT user_id, client_id, scopes, granted_at FROM oauth_consents WHERE user_id = $1 AND client_id = $2`
+	if err := r.db.QueryRow(query, userID, clientID).Scan(
+		&c.UserID,
+		&c.ClientID,
+		pq.Array(&c.Scopes),
+		&c.GrantedAt,
+	); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, model.ErrConsentNotFound
+		}
+		return nil, err
+	}
+	return c, nil
+}
+
+// SaveConsent stores the scopes the user allowed the client, replacing an
+// earlier consent.
+func (r *OAuthRepository) SaveConsent(c *model.OAuthConsent) error {
+	query := `INSERT INTO oauth_consents (user_id, client_id, scopes) VALUES ($1, $2, $3)
+	ON CONFLICT (user_id, client_id) DO UPDATE SET scopes = EXCLUDED.scopes, granted_at = NOW()
+	RETURNING granted_at`
+	return r.db.QueryRow(query, c.UserID, c.ClientID, pq.Array(c.Scopes)).Scan(&c.GrantedAt)
+}
+
+// ListConsents returns the consents of the user with the names of their
+// clients.
+func (r *OAuthRepository) ListConsents(userID string) ([]*model.OAuthConsent, error) {
+	query := `SELECT oauth_consents.user_id, oauth_consents.client_id, oauth_clients.name, oauth_consents.scopes, oauth_consents.granted_at
+		FROM oauth_consents JOIN oauth_clients ON oauth_clients.id = oauth_consents.client_id
+		WHERE oauth_consents.user_id = $1
+		ORDER BY oauth_consents.granted_at DESC`
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var consents []*model.OAuthConsent
+	for rows.Next() {
+		c := &model.OAuthConsent{}
+		if err := rows.Scan(&c.UserID, &c.ClientID, &c.ClientName, pq.Array(&c.Scopes), &c.GrantedAt); err != nil {
+			return nil, err
+		}
+		consents = append(consents, c)
+	}
+	return consents, rows.Err()
+}
+
+// DeleteConsent withdraws a consent and the unused codes issued under it. It
+// reports false when the user has not consented to the client.
+func (r *OAuthRepository) DeleteConsent(userID, clientID string) (bool, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`DELETE FROM oauth_consents WHERE user_id = $1 AND client_id = $2`, userID, clientID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if _, err := tx.Exec(`DELETE FROM oauth_authorization_codes WHERE user_id = $1 AND client_id = $2`, userID, clientID); err != nil {
+		return false, err
+	}
+	return n == 1, tx.Commit()
+}
+
+func (r *OAuthRepository) CreateAuthorizationCode(c *model.AuthorizationCode) error {
+	query := `INSERT INTO oauth_authorization_codes
+		(user_id, client_id, selector, code_hash, redirect_uri, scopes, code_challenge, nonce, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id`
+	return r.db.QueryRow(
+		query,
+		c.UserID,
+		c.ClientID,
+		c.Selector,
+		c.CodeHash,
+		c.RedirectURI,
+		pq.Array(c.Scopes),
+		c.CodeChallenge,
+		c.Nonce,
+		c.ExpiresAt,
+	).Scan(&c.ID)
+}
+
+// FindAuthorizationCode returns the unexpired code with selector, used or
+// not, so that a second use can be detected.
+func (r *OAuthRepository) FindAuthorizationCode(selector string) (*model.AuthorizationCode, error) {
+	c := &model.AuthorizationCode{}
+	var accessTokenID sql.NullString
+	query := `SELECT id, user_id, client_id, selector, code_hash, redirect_uri, scopes, code_challenge, nonce, expires_at, used_at, access_token_id
+		FROM oauth_authorization_codes WHERE selector = $1 AND expires_at > NOW()`
+	if err := r.db.QueryRow(query, selector).Scan(
+		&c.ID,
+		&c.UserID,
+		&c.ClientID,
+		&c.Selector,
+		&c.CodeHash,
+		&c.RedirectURI,
+		pq.Array(&c.Scopes),
+		&c.CodeChallenge,
+		&c.Nonce,
+		&c.ExpiresAt,
+		&c.UsedAt,
+		&accessTokenID,
+	); err != nil {
+		return nil, err
+	}
+	c.AccessTokenID = accessTokenID.String
+	return c, nil
+}
+
+// MarkAuthorizationCodeUsed consumes the code and remembers the access token
+// issued for it, so that the token can be revoked when the code is replayed.
+// It reports false when the code was already used.
+func (r *OAuthRepository) MarkAuthorizationCodeUsed(id, accessTokenID string) (bool, error) {
+	query := `UPDATE oauth_authorization_codes SET used_at = NOW(), access_token_id = $2 WHERE id = $1 AND used_at IS NULL`
+	res, err := r.db.Exec(query, id, accessTokenID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
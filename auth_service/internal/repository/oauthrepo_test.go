@@ -0,0 +1,134 @@
+package repository_test
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/model"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOAuthRepo(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating mock db: %v", err)
+	}
+	defer db.Close()
+
+	repo := repository.NewOAuthRepository(db)
+
+	userId := uuid.NewString()
+	clientId := "club-calendar"
+
+	t.Run("CreateClient success", func(t *testing.T) {
+		client := &model.OAuthClient{
+			ID:           clientId,
+			Name:         "Club calendar",
+			RedirectURIs: []string{"http://localhost:9000/callback"},
+			Scopes:       []string{model.ScopeOpenID, model.ScopeEmail},
+		}
+
+		mock.ExpectQuery(`INSERT INTO oauth_clients`).
+			WithArgs(clientId, "Club calendar", "", `{"http://localhost:9000/callback"}`, `{"openid","email"}`).
+			WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(time.Now()))
+
+		assert.NoError(t, repo.CreateClient(client))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("FindClient", func(t *testing.T) {
+		rows := sqlmock.NewRows([]string{"id", "name", "secret_hash", "redirect_uris", "scopes", "created_at"}).
+			AddRow(clientId, "Club calendar", "", "{http://localhost:9000/callback}", "{openid,email}", time.Now())
+		mock.ExpectQuery(`SELECT (.+) FROM oauth_clients WHERE id = \$1`).WithArgs(clientId).WillReturnRows(rows)
+
+		client, err := repo.FindClient(clientId)
+		assert.NoError(t, err)
+		assert.True(t, client.Public())
+		assert.Equal(t, []string{"http://localhost:9000/callback"}, client.RedirectURIs)
+
+		mock.ExpectQuery(`SELECT (.+) FROM oauth_clients`).WithArgs("missing").WillReturnError(sql.ErrNoRows)
+		_, err = repo.FindClient("missing")
+		assert.ErrorIs(t, err, model.ErrOAuthClientNotFound)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("SaveConsent replaces the scopes", func(t *testing.T) {
+		mock.ExpectQuery(`INSERT INTO oauth_consents (.+) ON CONFLICT \(user_id, client_id\) DO UPDATE SET scopes = EXCLUDED.scopes`).
+			WithArgs(userId, clientId, `{"openid","email"}`).
+			WillReturnRows(sqlmock.NewRows([]string{"granted_at"}).AddRow(time.Now()))
+
+		err := repo.SaveConsent(&model.OAuthConsent{UserID: userId, ClientID: clientId, Scopes: []string{"openid", "email"}})
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("FindConsent not found", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT user_id, client_id, scopes, granted_at FROM oauth_consents`).
+			WithArgs(userId, "other").WillReturnError(sql.ErrNoRows)
+
+		_, err := repo.FindConsent(userId, "other")
+		assert.ErrorIs(t, err, model.ErrConsentNotFound)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("DeleteConsent removes unused codes", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(`DELETE FROM oauth_consents WHERE user_id = \$1 AND client_id = \$2`).
+			WithArgs(userId, clientId).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`DELETE FROM oauth_authorization_codes WHERE user_id = \$1 AND client_id = \$2`).
+			WithArgs(userId, clientId).WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectCommit()
+
+		deleted, err := repo.DeleteConsent(userId, clientId)
+		assert.NoError(t, err)
+		assert.True(t, deleted)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("authorization code round trip", func(t *testing.T) {
+		exp := time.Now().Add(time.Minute)
+		code := &model.AuthorizationCode{
+			UserID:        userId,
+			ClientID:      clientId,
+			Selector:      "sel",
+			CodeHash:      "hash",
+			RedirectURI:   "http://localhost:9000/callback",
+			Scopes:        []string{"openid"},
+			CodeChallenge: "challenge",
+			Nonce:         "n-0S6_WzA2Mj",
+			ExpiresAt:     exp,
+		}
+		mock.ExpectQuery(`INSERT INTO oauth_authorization_codes`).
+			WithArgs(userId, clientId, "sel", "hash", "http://localhost:9000/callback", `{"openid"}`, "challenge", "n-0S6_WzA2Mj", exp).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("code-1"))
+		assert.NoError(t, repo.CreateAuthorizationCode(code))
+		assert.Equal(t, "code-1", code.ID)
+
+		rows := sqlmock.NewRows([]string{"id", "user_id", "client_id", "selector", "code_hash", "redirect_uri", "scopes", "code_challenge", "nonce", "expires_at", "used_at", "access_token_id"}).
+			AddRow("code-1", userId, clientId, "sel", "hash", "http://localhost:9000/callback", "{openid}", "challenge", "n-0S6_WzA2Mj", exp, nil, nil)
+		mock.ExpectQuery(`SELECT (.+) FROM oauth_authorization_codes WHERE selector = \$1 AND expires_at > NOW\(\)`).
+			WithArgs("sel").WillReturnRows(rows)
+		found, err := repo.FindAuthorizationCode("sel")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"openid"}, found.Scopes)
+		assert.Empty(t, found.AccessTokenID)
+
+		mock.ExpectExec(`UPDATE oauth_authorization_codes SET used_at = NOW\(\), access_token_id = \$2 WHERE id = \$1 AND used_at IS NULL`).
+			WithArgs("code-1", "jti-1").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`UPDATE oauth_authorization_codes SET used_at`).
+			WithArgs("code-1", "jti-2").WillReturnResult(sqlmock.NewResult(0, 0))
+
+		used, err := repo.MarkAuthorizationCodeUsed("code-1", "jti-1")
+		assert.NoError(t, err)
+		assert.True(t, used)
+		used, err = repo.MarkAuthorizationCodeUsed("code-1", "jti-2")
+		assert.NoError(t, err)
+		assert.False(t, used)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
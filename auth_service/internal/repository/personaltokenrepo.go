@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/model"
+)
+
+type PersonalTokenRepository struct {
+	db *sql.DB
+}
+
+func NewPersonalTokenRepository(db *sql.DB) *PersonalTokenRepository {
+	return &PersonalTokenRepository{
+		db: db,
+	}
+}
+
+const personalTokenColumns = `id, user_id, name, scopes, selector, token_hash, expires_at, last_used_at, created_at`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanPersonalToken(row rowScanner) (*model.PersonalAccessToken, error) {
+	t := &model.PersonalAccessToken{}
+	if err := row.Scan(
+		&t.ID,
+		&t.UserID,
+		&t.Name,
+		pq.Array(&t.Scopes),
+		&t.Selector,
+		&t.TokenHash,
+		&t.ExpiresAt,
+		&t.LastUsedAt,
+		&t.CreatedAt,
+	); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (r *PersonalTokenRepository) CreatePersonalToken(t *model.PersonalAccessToken) error {
+	query := `INSERT INTO personal_access_tokens (user_id, name, scopes, selector, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at`
+
+	return r.db.QueryRow(
+		query,
+		t.UserID,
+		t.Name,
+		pq.Array(t.Scopes),
+		t.Selector,
+		t.TokenHash,
+		t.ExpiresAt,
+	).Scan(&t.ID, &t.CreatedAt)
+}
+
+// FindPersonalToken returns the unexpired token with selector.
+func (r *PersonalTokenRepository) FindPersonalToken(selector string) (*model.PersonalAccessToken, error) {
+	query := `SELECT ` + personalTokenColumns + ` FROM personal_access_tokens
+		WHERE selector = $1 AND (expires_at IS NULL OR expires_at > NOW())`
+	t, err := scanPersonalToken(r.db.QueryRow(query, selector))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("invalid personal access token")
+		}
+		return nil, err
+	}
+	return t, nil
+}
+
+// ListPersonalTokens returns all tokens of the user, expired ones included,
+// newest first.
+func (r *PersonalTokenRepository) ListPersonalTokens(userID string) ([]*model.PersonalAccessToken, error) {
+	query := `SELECT ` + personalTokenColumns + ` FROM personal_access_tokens WHERE user_id = $1 ORDER BY created_at DESC`
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []*model.PersonalAccessToken
+	for rows.Next() {
+		t, err := scanPersonalToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+func (r *PersonalTokenRepository) CountPersonalTokens(userID string) (int, error) {
+	var n int
+	query := `SELECT COUNT(*) FROM personal_access_tokens WHERE user_id = $1`
+	err := r.db.QueryRow(query, userID).Scan(&n)
+	return n, err
+}
+
+// DeletePersonalToken removes a token of the user. It reports false when the
+// user has no token with id.
+func (r *PersonalTokenRepository) DeletePersonalToken(userID, id string) (bool, error) {
+	res, err := r.db.Exec(`DELETE FROM personal_access_tokens WHERE user_id = $1 AND id = $2`, userID, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// TouchPersonalToken records a use of the token. Uses within a minute of the
+// recorded one are not written, so scripts calling in a loop do not cause a
+// write per request.
+func (r *PersonalTokenRepository) TouchPersonalToken(id string) error {
+	query := `UPDATE personal_access_tokens SET last_used_at = NOW()
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')`
+	_, err := r.db.Exec(query, id)
+	return err
+}
@@ -0,0 +1,113 @@
+package repository_test
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/model"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPersonalTokenRepo(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating mock db: %v", err)
+	}
+	defer db.Close()
+
+	repo := repository.NewPersonalTokenRepository(db)
+
+	id := uuid.NewString()
+	userId := uuid.NewString()
+	columns := []string{"id", "user_id", "name", "scopes", "selector", "token_hash", "expires_at", "last_used_at", "created_at"}
+
+	t.Run("CreatePersonalToken success", func(t *testing.T) {
+		token := &model.PersonalAccessToken{
+			UserID:    userId,
+			Name:      "backup script",
+			Scopes:    []string{model.ScopeEventsRead, model.ScopeEventsWrite},
+			Selector:  "selector123",
+			TokenHash: "123hash",
+		}
+
+		mock.ExpectQuery(`INSERT INTO personal_access_tokens`).
+			WithArgs(userId, "backup script", "{\"events:read\",\"events:write\"}", "selector123", "123hash", nil).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(id, time.Now()))
+
+		err := repo.CreatePersonalToken(token)
+		assert.NoError(t, err)
+		assert.Equal(t, id, token.ID)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("FindPersonalToken skips expired tokens", func(t *testing.T) {
+		exp := time.Now().Add(time.Hour)
+		rows := sqlmock.NewRows(columns).
+			AddRow(id, userId, "backup script", "{events:read}", "selector123", "123hash", exp, nil, time.Now())
+		mock.ExpectQuery(`SELECT (.+) FROM personal_access_tokens
+		WHERE selector = \$1 AND \(expires_at IS NULL OR expires_at > NOW\(\)\)`).
+			WithArgs("selector123").WillReturnRows(rows)
+
+		token, err := repo.FindPersonalToken("selector123")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{model.ScopeEventsRead}, token.Scopes)
+		assert.Equal(t, exp, *token.ExpiresAt)
+		assert.Nil(t, token.LastUsedAt)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("FindPersonalToken not found", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT (.+) FROM personal_access_tokens`).
+			WithArgs("missing").WillReturnError(sql.ErrNoRows)
+
+		token, err := repo.FindPersonalToken("missing")
+		assert.Error(t, err)
+		assert.Nil(t, token)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("ListPersonalTokens", func(t *testing.T) {
+		used := time.Now().Add(-time.Hour)
+		rows := sqlmock.NewRows(columns).
+			AddRow(id, userId, "backup script", "{events:read}", "s1", "h1", nil, used, time.Now()).
+			AddRow(uuid.NewString(), userId, "calendar sync", "{events:read,events:write}", "s2", "h2", nil, nil, time.Now())
+		mock.ExpectQuery(`SELECT (.+) FROM personal_access_tokens WHERE user_id = \$1 ORDER BY created_at DESC`).
+			WithArgs(userId).WillReturnRows(rows)
+
+		tokens, err := repo.ListPersonalTokens(userId)
+		assert.NoError(t, err)
+		if assert.Len(t, tokens, 2) {
+			assert.Equal(t, used, *tokens[0].LastUsedAt)
+			assert.Equal(t, []string{model.ScopeEventsRead, model.ScopeEventsWrite}, tokens[1].Scopes)
+		}
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("DeletePersonalToken is scoped to the user", func(t *testing.T) {
+		mock.ExpectExec(`DELETE FROM personal_access_tokens WHERE user_id = \$1 AND id = \$2`).
+			WithArgs(userId, id).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`DELETE FROM personal_access_tokens`).
+			WithArgs("other-user", id).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		deleted, err := repo.DeletePersonalToken(userId, id)
+		assert.NoError(t, err)
+		assert.True(t, deleted)
+
+		deleted, err = repo.DeletePersonalToken("other-user", id)
+		assert.NoError(t, err)
+		assert.False(t, deleted)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("TouchPersonalToken", func(t *testing.T) {
+		mock.ExpectExec(`UPDATE personal_access_tokens SET last_used_at = NOW\(\)`).
+			WithArgs(id).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		assert.NoError(t, repo.TouchPersonalToken(id))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/throttle"
+)
+
+// ThrottleRepository stores login failure counters in Postgres so that they
+// are shared by every replica of the auth service.
+type ThrottleRepository struct {
+	db *sql.DB
+}
+
+func NewThrottleRepository(db *sql.DB) *ThrottleRepository {
+	return &ThrottleRepository{
+		db: db,
+	}
+}
+
+func (r *ThrottleRepository) Get(key string) (throttle.Entry, error) {
+	var e throttle.Entry
+	query := `SELECT failures, last_failure FROM login_failures WHERE key = $1`
+	if err := r.db.QueryRow(query, key).Scan(&e.Failures, &e.LastFailure); err != nil {
+		if err == sql.ErrNoRows {
+			return throttle.Entry{}, nil
+		}
+		return throttle.Entry{}, err
+	}
+	return e, nil
+}
+
+func (r *ThrottleRepository) RecordFailure(key string, now time.Time, window time.Duration) (throttle.Entry, error) {
+	query := `INSERT INTO login_failures (key, failures, last_failure) VALUES ($1, 1, $2)
+	ON CONFLICT (key) DO UPDATE SET
+		failures = CASE WHEN login_failures.last_failure < $3 THEN 1 ELSE login_failures.failures + 1 END,
+		last_failure = EXCLUDED.last_failure
+	RETURNING failures, last_failure`
+
+	var e throttle.Entry
+	err := r.db.QueryRow(query, key, now, now.Add(-window)).Scan(&e.Failures, &e.LastFailure)
+	return e, err
+}
+
+func (r *ThrottleRepository) Reset(key string) error {
+	query := `DELETE FROM login_failures WHERE key = $1`
+	_, err := r.db.Exec(query, key)
+	return err
+}
@@ -0,0 +1,51 @@
+package repository_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThrottleRepo(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating mock db: %v", err)
+	}
+	defer db.Close()
+
+	repo := repository.NewThrottleRepository(db)
+	now := time.Now()
+
+	t.Run("Get without failures", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT failures, last_failure FROM login_failures WHERE key = \$1`).
+			WithArgs("account:a@example.com").
+			WillReturnRows(sqlmock.NewRows([]string{"failures", "last_failure"}))
+
+		e, err := repo.Get("account:a@example.com")
+		assert.NoError(t, err)
+		assert.Zero(t, e.Failures)
+	})
+
+	t.Run("RecordFailure", func(t *testing.T) {
+		mock.ExpectQuery(`INSERT INTO login_failures`).
+			WithArgs("account:a@example.com", now, now.Add(-time.Hour)).
+			WillReturnRows(sqlmock.NewRows([]string{"failures", "last_failure"}).AddRow(3, now))
+
+		e, err := repo.RecordFailure("account:a@example.com", now, time.Hour)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, e.Failures)
+		assert.Equal(t, now, e.LastFailure)
+	})
+
+	t.Run("Reset", func(t *testing.T) {
+		mock.ExpectExec(`DELETE FROM login_failures WHERE key = \$1`).
+			WithArgs("account:a@example.com").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		assert.NoError(t, repo.Reset("account:a@example.com"))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
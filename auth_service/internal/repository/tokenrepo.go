@@ -3,6 +3,7 @@ package repository
 import (
 	"database/sql"
 	"errors"
+	"time"
 
 	"github.com/polyakovaa/grpcproxy/auth_service/internal/model"
 	"golang.org/x/crypto/bcrypt"
@@ -20,21 +21,35 @@ func NewTokenRepository(db *sql.DB) *TokenRepository {
 
 func (r *TokenRepository) CreateRefreshToken(token *model.RefreshToken) error {
 
-	query := `INSERT INTO refresh_tokens (user_id, token_hash, access_token_id, expires_at) VALUES ($1, $2, $3, $4)`
+	query := `INSERT INTO refresh_tokens (user_id, family_id, selector, token_hash, access_token_id, expires_at, created_at, last_used_at, user_agent, ip)
+		VALUES ($1, $2, $3, $4, $5, $6, COALESCE($7, NOW()), $8, $9, $10)`
+
+	var createdAt *time.Time
+	if !token.CreatedAt.IsZero() {
+		createdAt = &token.CreatedAt
+	}
 
 	_, err := r.db.Exec(
 		query,
 		token.UserID,
+		nullString(token.FamilyID),
+		token.Selector,
 		token.TokenHash,
 		token.AccessTokenID,
 		token.ExpiresAt,
+		createdAt,
+		token.LastUsedAt,
+		token.UserAgent,
+		token.IP,
 	)
 
 	return err
 }
 
+// FindByTokenHash checks rawToken against legacy bcrypt-hashed rows that were
+// issued before selectors existed.
 func (r *TokenRepository) FindByTokenHash(rawToken string) (*model.RefreshToken, error) {
-	rows, err := r.db.Query(`SELECT id, user_id, token_hash, expires_at FROM refresh_tokens WHERE expires_at > NOW()`)
+	rows, err := r.db.Query(`SELECT id, user_id, token_hash, expires_at FROM refresh_tokens WHERE selector IS NULL AND expires_at > NOW()`)
 	if err != nil {
 		return nil, err
 	}
@@ -53,8 +68,141 @@ func (r *TokenRepository) FindByTokenHash(rawToken string) (*model.RefreshToken,
 
 }
 
+func (r *TokenRepository) FindBySelector(selector string) (*model.RefreshToken, error) {
+	t := &model.RefreshToken{}
+	var familyID sql.NullString
+	query := `SELECT id, user_id, family_id, selector, token_hash, access_token_id, expires_at, rotated_at, created_at
+		FROM refresh_tokens WHERE selector = $1 AND expires_at > NOW()`
+	if err := r.db.QueryRow(query, selector).Scan(
+		&t.ID,
+		&t.UserID,
+		&familyID,
+		&t.Selector,
+		&t.TokenHash,
+		&t.AccessTokenID,
+		&t.ExpiresAt,
+		&t.RotatedAt,
+		&t.CreatedAt,
+	); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("invalid refresh token")
+		}
+		return nil, err
+	}
+	t.FamilyID = familyID.String
+	return t, nil
+}
+
 func (r *TokenRepository) DeleteByID(id string) error {
 	query := `DELETE FROM refresh_tokens WHERE id = $1`
 	_, err := r.db.Exec(query, id)
 	return err
 }
+
+// MarkRotated flags the token as used. It reports false when the token had
+// already been rotated, e.g. by a concurrent request with the same token.
+func (r *TokenRepository) MarkRotated(id string) (bool, error) {
+	res, err := r.db.Exec(`UPDATE refresh_tokens SET rotated_at = NOW() WHERE id = $1 AND rotated_at IS NULL`, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// DeleteFamily removes every token of a rotation family and returns the IDs of
+// the access tokens that were issued together with them.
+func (r *TokenRepository) DeleteFamily(familyID string) ([]string, error) {
+	return r.deleteReturningAccessIDs(`DELETE FROM refresh_tokens WHERE family_id = $1 RETURNING access_token_id`, familyID)
+}
+
+// DeleteByUserID removes every refresh token of the user and returns the IDs of
+// the access tokens that were issued together with them.
+func (r *TokenRepository) DeleteByUserID(userID string) ([]string, error) {
+	return r.deleteReturningAccessIDs(`DELETE FROM refresh_tokens WHERE user_id = $1 RETURNING access_token_id`, userID)
+}
+
+// ListSessions returns the live sessions of the user, most recently used
+// first. A session is identified by its family, or by the token itself for
+// legacy tokens without one.
+func (r *TokenRepository) ListSessions(userID string) ([]*model.Session, error) {
+	query := `SELECT COALESCE(family_id, id), user_id, access_token_id, created_at, last_used_at, expires_at, user_agent, ip
+		FROM refresh_tokens
+		WHERE user_id = $1 AND rotated_at IS NULL AND expires_at > NOW()
+		ORDER BY COALESCE(last_used_at, created_at) DESC`
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []*model.Session
+	for rows.Next() {
+		s := &model.Session{}
+		if err := rows.Scan(
+			&s.ID,
+			&s.UserID,
+			&s.AccessTokenID,
+			&s.CreatedAt,
+			&s.LastUsedAt,
+			&s.ExpiresAt,
+			&s.UserAgent,
+			&s.IP,
+		); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+// DeleteSession removes every token of one session of the user and returns
+// the IDs of the access tokens that were issued together with them. Sessions
+// of other users are left alone and give an empty result.
+func (r *TokenRepository) DeleteSession(userID, sessionID string) ([]string, error) {
+	return r.deleteReturningAccessIDs(`DELETE FROM refresh_tokens
+		WHERE user_id = $1 AND (family_id = $2 OR (family_id IS NULL AND id = $2))
+		RETURNING access_token_id`, userID, sessionID)
+}
+
+func (r *TokenRepository) deleteReturningAccessIDs(query string, args ...any) ([]string, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var accessIDs []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		accessIDs = append(accessIDs, id)
+	}
+	return accessIDs, rows.Err()
+}
+
+// RevokeAccessToken blocks tokenID until expiresAt, when the token expires on
+// its own. Entries that expired are dropped on the way.
+func (r *TokenRepository) RevokeAccessToken(tokenID string, expiresAt time.Time) error {
+	if _, err := r.db.Exec(`DELETE FROM revoked_access_tokens WHERE expires_at < NOW()`); err != nil {
+		return err
+	}
+
+	query := `INSERT INTO revoked_access_tokens (token_id, expires_at) VALUES ($1, $2) ON CONFLICT (token_id) DO NOTHING`
+	_, err := r.db.Exec(query, tokenID, expiresAt)
+	return err
+}
+
+func (r *TokenRepository) IsAccessTokenRevoked(tokenID string) (bool, error) {
+	var revoked bool
+	query := `SELECT EXISTS (SELECT 1 FROM revoked_access_tokens WHERE token_id = $1)`
+	if err := r.db.QueryRow(query, tokenID).Scan(&revoked); err != nil {
+		return false, err
+	}
+	return revoked, nil
+}
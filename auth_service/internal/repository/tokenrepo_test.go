@@ -1,6 +1,7 @@
 package repository_test
 
 import (
+	"database/sql"
 	"testing"
 	"time"
 
@@ -22,20 +23,30 @@ func TestTokenRepo(t *testing.T) {
 	repo := repository.NewTokenRepository(db)
 
 	userId := uuid.NewString()
+	familyId := uuid.NewString()
+	selector := "selector123"
 	tokenHash := "123hash"
 	accessId := uuid.NewString()
 	exp := time.Now().Add(24 * time.Hour)
+	created := time.Now().Add(-time.Hour)
 
 	t.Run("CreateRefreshToken success", func(t *testing.T) {
 
 		token := &model.RefreshToken{
 			UserID:        userId,
+			FamilyID:      familyId,
+			Selector:      selector,
 			TokenHash:     tokenHash,
 			AccessTokenID: accessId,
 			ExpiresAt:     exp,
+			CreatedAt:     created,
+			UserAgent:     "Mozilla/5.0",
+			IP:            "203.0.113.7",
 		}
 
-		mock.ExpectExec(`INSERT INTO refresh_tokens`).WithArgs(userId, tokenHash, accessId, exp).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(`INSERT INTO refresh_tokens`).
+			WithArgs(userId, familyId, selector, tokenHash, accessId, exp, &created, nil, "Mozilla/5.0", "203.0.113.7").
+			WillReturnResult(sqlmock.NewResult(1, 1))
 		err = repo.CreateRefreshToken(token)
 		assert.NoError(t, err)
 	})
@@ -49,7 +60,7 @@ func TestTokenRepo(t *testing.T) {
 			AddRow(1, "user1", string(hashedToken1), exp).
 			AddRow(2, userId, string(hashedToken2), exp)
 		mock.ExpectQuery(`SELECT id, user_id, token_hash, expires_at FROM refresh_tokens
-		 WHERE expires_at > NOW\(\)`).WillReturnRows(rows)
+		 WHERE selector IS NULL AND expires_at > NOW\(\)`).WillReturnRows(rows)
 		token, err := repo.FindByTokenHash(rawToken)
 
 		assert.NoError(t, err)
@@ -59,4 +70,108 @@ func TestTokenRepo(t *testing.T) {
 		assert.NoError(t, mock.ExpectationsWereMet())
 	})
 
+	t.Run("FindBySelector success", func(t *testing.T) {
+		rows := sqlmock.NewRows([]string{"id", "user_id", "family_id", "selector", "token_hash", "access_token_id", "expires_at", "rotated_at", "created_at"}).
+			AddRow("1", userId, familyId, selector, tokenHash, accessId, exp, nil, created)
+		mock.ExpectQuery(`SELECT id, user_id, family_id, selector, token_hash, access_token_id, expires_at, rotated_at, created_at FROM refresh_tokens
+		 WHERE selector = \$1 AND expires_at > NOW\(\)`).WithArgs(selector).WillReturnRows(rows)
+
+		token, err := repo.FindBySelector(selector)
+
+		assert.NoError(t, err)
+		assert.Equal(t, userId, token.UserID)
+		assert.Equal(t, tokenHash, token.TokenHash)
+		assert.Equal(t, accessId, token.AccessTokenID)
+		assert.Equal(t, familyId, token.FamilyID)
+		assert.Nil(t, token.RotatedAt)
+		assert.Equal(t, created, token.CreatedAt)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("FindBySelector not found", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT id, user_id, family_id, selector, token_hash, access_token_id, expires_at, rotated_at, created_at FROM refresh_tokens`).
+			WithArgs("missing").WillReturnError(sql.ErrNoRows)
+
+		token, err := repo.FindBySelector("missing")
+
+		assert.Error(t, err)
+		assert.Nil(t, token)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("MarkRotated only once", func(t *testing.T) {
+		mock.ExpectExec(`UPDATE refresh_tokens SET rotated_at = NOW\(\) WHERE id = \$1 AND rotated_at IS NULL`).
+			WithArgs("1").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`UPDATE refresh_tokens SET rotated_at`).
+			WithArgs("1").WillReturnResult(sqlmock.NewResult(0, 0))
+
+		rotated, err := repo.MarkRotated("1")
+		assert.NoError(t, err)
+		assert.True(t, rotated)
+
+		rotated, err = repo.MarkRotated("1")
+		assert.NoError(t, err)
+		assert.False(t, rotated)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("DeleteFamily returns access token ids", func(t *testing.T) {
+		rows := sqlmock.NewRows([]string{"access_token_id"}).AddRow("a1").AddRow("a2")
+		mock.ExpectQuery(`DELETE FROM refresh_tokens WHERE family_id = \$1 RETURNING access_token_id`).
+			WithArgs(familyId).WillReturnRows(rows)
+
+		ids, err := repo.DeleteFamily(familyId)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"a1", "a2"}, ids)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+	t.Run("ListSessions", func(t *testing.T) {
+		legacyId := uuid.NewString()
+		used := time.Now().Add(-time.Minute)
+		rows := sqlmock.NewRows([]string{"id", "user_id", "access_token_id", "created_at", "last_used_at", "expires_at", "user_agent", "ip"}).
+			AddRow(familyId, userId, accessId, created, used, exp, "Mozilla/5.0", "203.0.113.7").
+			AddRow(legacyId, userId, "a3", created, nil, exp, "", "")
+		mock.ExpectQuery(`SELECT COALESCE\(family_id, id\), user_id, access_token_id, created_at, last_used_at, expires_at, user_agent, ip
+		FROM refresh_tokens
+		WHERE user_id = \$1 AND rotated_at IS NULL AND expires_at > NOW\(\)`).
+			WithArgs(userId).WillReturnRows(rows)
+
+		sessions, err := repo.ListSessions(userId)
+		assert.NoError(t, err)
+		if assert.Len(t, sessions, 2) {
+			assert.Equal(t, familyId, sessions[0].ID)
+			assert.Equal(t, accessId, sessions[0].AccessTokenID)
+			assert.Equal(t, "203.0.113.7", sessions[0].IP)
+			assert.Equal(t, used, *sessions[0].LastUsedAt)
+			assert.Equal(t, legacyId, sessions[1].ID)
+			assert.Nil(t, sessions[1].LastUsedAt)
+		}
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("DeleteSession is scoped to the user", func(t *testing.T) {
+		rows := sqlmock.NewRows([]string{"access_token_id"}).AddRow("a1")
+		mock.ExpectQuery(`DELETE FROM refresh_tokens
+		WHERE user_id = \$1 AND \(family_id = \$2 OR \(family_id IS NULL AND id = \$2\)\)
+		RETURNING access_token_id`).
+			WithArgs(userId, familyId).WillReturnRows(rows)
+
+		ids, err := repo.DeleteSession(userId, familyId)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"a1"}, ids)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("RevokeAccessToken purges expired entries", func(t *testing.T) {
+		mock.ExpectExec(`DELETE FROM revoked_access_tokens WHERE expires_at < NOW\(\)`).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectExec(`INSERT INTO revoked_access_tokens`).
+			WithArgs(accessId, exp).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		assert.NoError(t, repo.RevokeAccessToken(accessId, exp))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
 }
@@ -2,8 +2,12 @@ package repository
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
+	"github.com/lib/pq"
 	"github.com/polyakovaa/grpcproxy/auth_service/internal/model"
 )
 
@@ -16,29 +20,70 @@ func NewUserRepository(db *sql.DB) *UserRepository {
 		db: db,
 	}
 }
+
+const userColumns = `id, user_name, email, password_hash, display_name, bio, email_verified, created_at, suspended_at,
+	EXISTS (SELECT 1 FROM user_totp WHERE user_totp.user_id = users.id AND confirmed_at IS NOT NULL),
+	ARRAY(SELECT role FROM user_roles WHERE user_roles.user_id = users.id ORDER BY role)`
+
+func scanUser(row rowScanner) (*model.User, error) {
+	u := &model.User{}
+	if err := row.Scan(
+		&u.ID,
+		&u.UserName,
+		&u.Email,
+		&u.PasswordHash,
+		&u.DisplayName,
+		&u.Bio,
+		&u.EmailVerified,
+		&u.CreatedAt,
+		&u.SuspendedAt,
+		&u.MFAEnabled,
+		pq.Array(&u.Roles),
+	); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// uniqueViolation turns a unique constraint violation on users into the
+// matching model error.
+func uniqueViolation(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		switch pqErr.Constraint {
+		case "users_user_name_key":
+			return model.ErrUserNameTaken
+		case "users_email_key":
+			return model.ErrEmailTaken
+		}
+	}
+	return err
+}
+
+// CreateUser stores the user together with the default member role.
 func (r *UserRepository) CreateUser(u *model.User) (*model.User, error) {
-	query := `INSERT INTO users (user_name, email, password_hash) VALUES ($1, $2, $3) RETURNING id`
+	query := `WITH created AS (
+		INSERT INTO users (user_name, email, password_hash) VALUES ($1, $2, $3) RETURNING id
+	)
+	INSERT INTO user_roles (user_id, role) SELECT id, $4 FROM created RETURNING user_id`
 
 	if err := r.db.QueryRow(
 		query,
 		u.UserName,
 		u.Email,
 		u.PasswordHash,
+		model.RoleMember,
 	).Scan(&u.ID); err != nil {
-		return nil, err
+		return nil, uniqueViolation(err)
 	}
+	u.Roles = []string{model.RoleMember}
 	return u, nil
 }
 
 func (r *UserRepository) FindByID(id string) (*model.User, error) {
-	u := &model.User{}
-	query := `SELECT id, user_name, email, password_hash FROM users WHERE id = $1`
-	if err := r.db.QueryRow(query, id).Scan(
-		&u.ID,
-		&u.UserName,
-		&u.Email,
-		&u.PasswordHash,
-	); err != nil {
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = $1`
+	u, err := scanUser(r.db.QueryRow(query, id))
+	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("user with id '%s' not found", id)
 		}
@@ -48,14 +93,9 @@ func (r *UserRepository) FindByID(id string) (*model.User, error) {
 }
 
 func (r *UserRepository) FindByEmail(email string) (*model.User, error) {
-	u := &model.User{}
-	query := `SELECT id, user_name, email, password_hash FROM users WHERE email = $1`
-	if err := r.db.QueryRow(query, email).Scan(
-		&u.ID,
-		&u.UserName,
-		&u.Email,
-		&u.PasswordHash,
-	); err != nil {
+	query := `SELECT ` + userColumns + ` FROM users WHERE lower(email) = lower($1)`
+	u, err := scanUser(r.db.QueryRow(query, email))
+	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("user with email '%s' not found", email)
 		}
@@ -63,3 +103,124 @@ func (r *UserRepository) FindByEmail(email string) (*model.User, error) {
 	}
 	return u, nil
 }
+
+// SearchUsers returns a page of the users matching f, oldest first, and the
+// number of all matching users.
+func (r *UserRepository) SearchUsers(f model.UserFilter) ([]*model.User, int, error) {
+	where := `WHERE $1 = '' OR user_name ILIKE '%' || $1 || '%' OR email ILIKE '%' || $1 || '%'`
+	pattern := likeEscaper.Replace(f.Query)
+
+	query := `SELECT ` + userColumns + ` FROM users ` + where + `
+		ORDER BY created_at, id
+		LIMIT $2 OFFSET $3`
+	rows, err := r.db.Query(query, pattern, f.Limit, f.Offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to search users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []*model.User
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	var total int
+	if err := r.db.QueryRow(`SELECT COUNT(*) FROM users `+where, pattern).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count users: %w", err)
+	}
+	return users, total, nil
+}
+
+// likeEscaper escapes the LIKE wildcards so that searches match literally.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// SetSuspended suspends the user at the given time, or lifts the suspension
+// when at is nil.
+func (r *UserRepository) SetSuspended(userID string, at *time.Time) error {
+	query := `UPDATE users SET suspended_at = $2 WHERE id = $1`
+	res, err := r.db.Exec(query, userID, at)
+	if err != nil {
+		return err
+	}
+	return expectUserRow(res, userID)
+}
+
+func (r *UserRepository) AddRole(userID, role string) error {
+	query := `INSERT INTO user_roles (user_id, role) VALUES ($1, $2) ON CONFLICT (user_id, role) DO NOTHING`
+	_, err := r.db.Exec(query, userID, role)
+	return err
+}
+
+func (r *UserRepository) RemoveRole(userID, role string) error {
+	query := `DELETE FROM user_roles WHERE user_id = $1 AND role = $2`
+	_, err := r.db.Exec(query, userID, role)
+	return err
+}
+
+func (r *UserRepository) UpdatePassword(userID, passwordHash string) error {
+	query := `UPDATE users SET password_hash = $2 WHERE id = $1`
+	res, err := r.db.Exec(query, userID, passwordHash)
+	if err != nil {
+		return err
+	}
+	return expectUserRow(res, userID)
+}
+
+func (r *UserRepository) MarkEmailVerified(userID string) error {
+	query := `UPDATE users SET email_verified = TRUE WHERE id = $1`
+	_, err := r.db.Exec(query, userID)
+	return err
+}
+
+// UpdateProfile changes the non-nil fields of p.
+func (r *UserRepository) UpdateProfile(userID string, p model.ProfileUpdate) error {
+	query := `UPDATE users SET
+		user_name = COALESCE($2, user_name),
+		display_name = COALESCE($3, display_name),
+		bio = COALESCE($4, bio)
+	WHERE id = $1`
+	res, err := r.db.Exec(query, userID, p.UserName, p.DisplayName, p.Bio)
+	if err != nil {
+		return uniqueViolation(err)
+	}
+	return expectUserRow(res, userID)
+}
+
+// UpdateEmail replaces the email address, which has to be verified again.
+func (r *UserRepository) UpdateEmail(userID, email string) error {
+	query := `UPDATE users SET email = $2, email_verified = FALSE WHERE id = $1`
+	res, err := r.db.Exec(query, userID, email)
+	if err != nil {
+		return uniqueViolation(err)
+	}
+	return expectUserRow(res, userID)
+}
+
+// DeleteUser removes the user. Tokens, roles and second factors go with it
+// through the foreign keys.
+func (r *UserRepository) DeleteUser(userID string) error {
+	query := `DELETE FROM users WHERE id = $1`
+	res, err := r.db.Exec(query, userID)
+	if err != nil {
+		return err
+	}
+	return expectUserRow(res, userID)
+}
+
+func expectUserRow(res sql.Result, userID string) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("user with id '%s' not found", userID)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package repository_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/model"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserRepo(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating mock db: %v", err)
+	}
+	defer db.Close()
+
+	repo := repository.NewUserRepository(db)
+	userId := uuid.NewString()
+
+	t.Run("UpdateProfile keeps unset fields", func(t *testing.T) {
+		bio := "Mostly science fiction."
+		mock.ExpectExec(`UPDATE users SET\s+user_name = COALESCE\(\$2, user_name\)`).
+			WithArgs(userId, nil, nil, bio).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		err := repo.UpdateProfile(userId, model.ProfileUpdate{Bio: &bio})
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("UpdateProfile reports a taken user name", func(t *testing.T) {
+		name := "taken"
+		mock.ExpectExec(`UPDATE users SET`).
+			WillReturnError(&pq.Error{Code: "23505", Constraint: "users_user_name_key"})
+
+		err := repo.UpdateProfile(userId, model.ProfileUpdate{UserName: &name})
+		assert.ErrorIs(t, err, model.ErrUserNameTaken)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("UpdateEmail resets verification", func(t *testing.T) {
+		mock.ExpectExec(`UPDATE users SET email = \$2, email_verified = FALSE WHERE id = \$1`).
+			WithArgs(userId, "new@example.com").WillReturnResult(sqlmock.NewResult(0, 1))
+
+		err := repo.UpdateEmail(userId, "new@example.com")
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("UpdateEmail reports a taken address", func(t *testing.T) {
+		mock.ExpectExec(`UPDATE users SET email`).
+			WillReturnError(&pq.Error{Code: "23505", Constraint: "users_email_key"})
+
+		err := repo.UpdateEmail(userId, "taken@example.com")
+		assert.ErrorIs(t, err, model.ErrEmailTaken)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("DeleteUser unknown user", func(t *testing.T) {
+		mock.ExpectExec(`DELETE FROM users WHERE id = \$1`).WithArgs(userId).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		err := repo.DeleteUser(userId)
+		assert.Error(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("SearchUsers matches wildcards literally", func(t *testing.T) {
+		suspendedAt := time.Now()
+		rows := sqlmock.NewRows([]string{"id", "user_name", "email", "password_hash", "display_name", "bio",
+			"email_verified", "created_at", "suspended_at", "mfa_enabled", "roles"}).
+			AddRow(userId, "100%_reader", "reader@example.com", "", "", "", true, time.Now(), suspendedAt, false, "{member}")
+		mock.ExpectQuery(`SELECT (.+) FROM users WHERE (.+) ILIKE (.+) ORDER BY created_at, id\s+LIMIT \$2 OFFSET \$3`).
+			WithArgs(`100\%\_`, 20, 40).WillReturnRows(rows)
+		mock.ExpectQuery(`SELECT COUNT\(\*\) FROM users WHERE`).WithArgs(`100\%\_`).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(41))
+
+		users, total, err := repo.SearchUsers(model.UserFilter{Query: "100%_", Limit: 20, Offset: 40})
+		assert.NoError(t, err)
+		assert.Equal(t, 41, total)
+		assert.True(t, users[0].Suspended())
+		assert.Equal(t, []string{model.RoleMember}, users[0].Roles)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("SetSuspended", func(t *testing.T) {
+		now := time.Now()
+		mock.ExpectExec(`UPDATE users SET suspended_at = \$2 WHERE id = \$1`).
+			WithArgs(userId, &now).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`UPDATE users SET suspended_at = \$2 WHERE id = \$1`).
+			WithArgs(userId, nil).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		assert.NoError(t, repo.SetSuspended(userId, &now))
+		assert.NoError(t, repo.SetSuspended(userId, nil))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/model"
+)
+
+// createActionToken issues a new token for purpose and invalidates the ones
+// issued to the user for the same purpose before.
+func (s *AuthService) createActionToken(userID, purpose string, ttl time.Duration) (string, error) {
+	if err := s.actionRepo.DeleteActionTokens(userID, purpose); err != nil {
+		return "", fmt.Errorf("failed to delete previous tokens: %w", err)
+	}
+
+	token, selector, verifierHash, err := generateSplitToken()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	err = s.actionRepo.CreateActionToken(&model.ActionToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		Selector:  selector,
+		TokenHash: verifierHash,
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to store token: %w", err)
+	}
+
+	return token, nil
+}
+
+// findActionToken checks rawToken without consuming it.
+func (s *AuthService) findActionToken(purpose, rawToken string) (*model.ActionToken, error) {
+	selector, verifier, ok := parseSplitToken(rawToken)
+	if !ok {
+		return nil, errors.New("malformed token")
+	}
+
+	t, err := s.actionRepo.FindActionToken(purpose, selector)
+	if err != nil {
+		return nil, err
+	}
+	if !verifierMatches(verifier, t.TokenHash) {
+		return nil, errors.New("token verifier mismatch")
+	}
+	if time.Now().After(t.ExpiresAt) {
+		return nil, errors.New("token expired")
+	}
+
+	return t, nil
+}
+
+// consumeActionToken checks rawToken and marks it as used, so that it cannot
+// be redeemed a second time.
+func (s *AuthService) consumeActionToken(purpose, rawToken string) (*model.ActionToken, error) {
+	t, err := s.findActionToken(purpose, rawToken)
+	if err != nil {
+		return nil, err
+	}
+
+	used, err := s.actionRepo.MarkActionTokenUsed(t.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume token: %w", err)
+	}
+	if !used {
+		return nil, errors.New("token already used")
+	}
+
+	return t, nil
+}
+
+// actionLink appends token to the query of base, the URL of the page that
+// redeems the token.
+func actionLink(base, token string) (string, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", fmt.Errorf("invalid link url: %w", err)
+	}
+	q := u.Query()
+	q.Set("token", token)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
@@ -0,0 +1,190 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/mail"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/model"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultUserPageSize = 20
+	maxUserPageSize     = 100
+)
+
+const forcedPasswordResetBody = `An administrator reset the password of your account %s. You have been signed out everywhere.
+
+Open the link below to choose a new password. It expires in %s and can only be used once.
+
+%s
+`
+
+// UserQuery selects the users listed by ListUsers. Query matches user names
+// and emails by substring.
+type UserQuery struct {
+	Query  string
+	Limit  int
+	Offset int
+}
+
+// ListUsers lets admins search users. It returns a page of users, oldest
+// first, and the number of all matching users. Limit defaults to 20 and is
+// capped at 100.
+func (s *AuthService) ListUsers(accessToken string, q UserQuery) ([]*model.User, int, error) {
+	if _, err := s.requireRole(accessToken, model.RoleAdmin); err != nil {
+		return nil, 0, err
+	}
+
+	limit := q.Limit
+	switch {
+	case limit < 0 || q.Offset < 0:
+		return nil, 0, status.Error(codes.InvalidArgument, "limit and offset must not be negative")
+	case limit == 0:
+		limit = defaultUserPageSize
+	case limit > maxUserPageSize:
+		limit = maxUserPageSize
+	}
+
+	users, total, err := s.userRepo.SearchUsers(model.UserFilter{
+		Query:  strings.TrimSpace(q.Query),
+		Limit:  limit,
+		Offset: q.Offset,
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list users: %w", err)
+	}
+	return users, total, nil
+}
+
+// managedUser checks that the caller is an admin and loads the user they
+// want to manage.
+func (s *AuthService) managedUser(accessToken, userID string) (caller, user *model.User, err error) {
+	caller, err = s.requireRole(accessToken, model.RoleAdmin)
+	if err != nil {
+		return nil, nil, err
+	}
+	user, err = s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, nil, status.Error(codes.NotFound, "user not found")
+	}
+	return caller, user, nil
+}
+
+// AdminGetUser returns any user to an admin.
+func (s *AuthService) AdminGetUser(accessToken, userID string) (*model.User, error) {
+	_, user, err := s.managedUser(accessToken, userID)
+	return user, err
+}
+
+// SuspendUser locks a user out and ends all of their sessions. Suspending a
+// suspended user changes nothing.
+func (s *AuthService) SuspendUser(accessToken, userID string) (*model.User, error) {
+	caller, user, err := s.managedUser(accessToken, userID)
+	if err != nil {
+		return nil, err
+	}
+	if caller.ID == user.ID {
+		return nil, status.Error(codes.FailedPrecondition, "admins cannot suspend themselves")
+	}
+	if user.Suspended() {
+		return user, nil
+	}
+
+	now := time.Now()
+	if err := s.userRepo.SetSuspended(user.ID, &now); err != nil {
+		return nil, fmt.Errorf("failed to suspend user: %w", err)
+	}
+	if err := s.revokeUserSessions(user.ID); err != nil {
+		return nil, err
+	}
+	s.auditAdminAction(caller.ID, user.ID, model.AuditUserSuspended)
+
+	user.SuspendedAt = &now
+	return user, nil
+}
+
+// UnsuspendUser lifts a suspension. The user has to sign in again.
+func (s *AuthService) UnsuspendUser(accessToken, userID string) (*model.User, error) {
+	caller, user, err := s.managedUser(accessToken, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.Suspended() {
+		return user, nil
+	}
+
+	if err := s.userRepo.SetSuspended(user.ID, nil); err != nil {
+		return nil, fmt.Errorf("failed to unsuspend user: %w", err)
+	}
+	s.auditAdminAction(caller.ID, user.ID, model.AuditUserUnsuspended)
+
+	user.SuspendedAt = nil
+	return user, nil
+}
+
+// ForcePasswordReset removes the password of a user, ends their sessions and
+// mails them a reset link. Until they choose a new password they can only
+// sign in through linked identity providers.
+func (s *AuthService) ForcePasswordReset(accessToken, userID string) error {
+	if s.actionRepo == nil || s.mailer == nil {
+		return status.Error(codes.Unimplemented, "password reset is not configured")
+	}
+	caller, user, err := s.managedUser(accessToken, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.userRepo.UpdatePassword(user.ID, ""); err != nil {
+		return fmt.Errorf("failed to remove password: %w", err)
+	}
+	if err := s.revokeUserSessions(user.ID); err != nil {
+		return err
+	}
+	s.auditAdminAction(caller.ID, user.ID, model.AuditPasswordResetForced)
+
+	token, err := s.createActionToken(user.ID, model.ActionPasswordReset, s.resetTTL)
+	if err != nil {
+		return fmt.Errorf("failed to create reset token: %w", err)
+	}
+	link, err := actionLink(s.resetURL, token)
+	if err != nil {
+		return err
+	}
+
+	err = s.mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Your password was reset",
+		Body:    fmt.Sprintf(forcedPasswordResetBody, user.UserName, s.resetTTL, link),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send reset mail: %w", err)
+	}
+	return nil
+}
+
+// AdminRevokeSessions ends every session of a user, e.g. after their
+// device was lost.
+func (s *AuthService) AdminRevokeSessions(accessToken, userID string) error {
+	caller, user, err := s.managedUser(accessToken, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.revokeUserSessions(user.ID); err != nil {
+		return err
+	}
+	s.auditAdminAction(caller.ID, user.ID, model.AuditSessionsRevoked)
+	return nil
+}
+
+// checkNotSuspended rejects users an admin suspended.
+func checkNotSuspended(user *model.User) error {
+	if user.Suspended() {
+		return status.Error(codes.PermissionDenied, "account is suspended")
+	}
+	return nil
+}
@@ -0,0 +1,240 @@
+package service_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/keys"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/model"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type adminFixture struct {
+	*testEnv
+	admin       *model.User
+	member      *model.User
+	adminToken  string
+	memberToken string
+}
+
+func newAdminFixture(t *testing.T, opts ...service.Option) *adminFixture {
+	f := &adminFixture{
+		testEnv: newTestService(opts...),
+		admin:   &model.User{ID: uuid.New().String(), Email: "admin@example.com", Roles: []string{model.RoleAdmin}},
+		member:  &model.User{ID: uuid.New().String(), UserName: "reader", Email: "reader@example.com", Roles: []string{model.RoleMember}},
+	}
+	f.adminToken = f.signIn(t, f.admin)
+	f.memberToken = f.signIn(t, f.member)
+	return f
+}
+
+func TestListUsers(t *testing.T) {
+	f := newAdminFixture(t)
+
+	t.Run("members are denied", func(t *testing.T) {
+		_, _, err := f.svc.ListUsers(f.memberToken, service.UserQuery{})
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+		f.urepo.AssertNotCalled(t, "SearchUsers", mock.Anything)
+	})
+
+	t.Run("searches", func(t *testing.T) {
+		f.urepo.On("SearchUsers", model.UserFilter{Query: "reader", Limit: 5, Offset: 10}).
+			Return([]*model.User{f.member}, 11, nil).Once()
+
+		users, total, err := f.svc.ListUsers(f.adminToken, service.UserQuery{Query: "  reader ", Limit: 5, Offset: 10})
+		require.NoError(t, err)
+		assert.Equal(t, []*model.User{f.member}, users)
+		assert.Equal(t, 11, total)
+	})
+
+	t.Run("default and maximum limit", func(t *testing.T) {
+		f.urepo.On("SearchUsers", model.UserFilter{Limit: 20}).Return(nil, 0, nil).Once()
+		f.urepo.On("SearchUsers", model.UserFilter{Limit: 100}).Return(nil, 0, nil).Once()
+
+		_, _, err := f.svc.ListUsers(f.adminToken, service.UserQuery{})
+		require.NoError(t, err)
+		_, _, err = f.svc.ListUsers(f.adminToken, service.UserQuery{Limit: 1000})
+		require.NoError(t, err)
+	})
+
+	t.Run("negative offset", func(t *testing.T) {
+		_, _, err := f.svc.ListUsers(f.adminToken, service.UserQuery{Offset: -1})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+}
+
+func TestSuspendUser(t *testing.T) {
+	f := newAdminFixture(t)
+
+	t.Run("members are denied", func(t *testing.T) {
+		_, err := f.svc.SuspendUser(f.memberToken, f.admin.ID)
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	})
+
+	t.Run("unknown user", func(t *testing.T) {
+		unknown := uuid.NewString()
+		f.urepo.On("FindByID", unknown).Return(nil, errors.New("not found"))
+		_, err := f.svc.SuspendUser(f.adminToken, unknown)
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	})
+
+	t.Run("admins cannot suspend themselves", func(t *testing.T) {
+		_, err := f.svc.SuspendUser(f.adminToken, f.admin.ID)
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	})
+
+	t.Run("suspends and signs out", func(t *testing.T) {
+		f.urepo.On("SetSuspended", f.member.ID, mock.AnythingOfType("*time.Time")).Return(nil).Once()
+		f.trepo.On("DeleteByUserID", f.member.ID).Return([]string{"a1"}, nil).Once()
+		f.trepo.On("RevokeAccessToken", "a1", mock.Anything).Return(nil).Once()
+
+		user, err := f.svc.SuspendUser(f.adminToken, f.member.ID)
+		require.NoError(t, err)
+		assert.True(t, user.Suspended())
+		f.arepo.AssertCalled(t, "CreateAuditEvent", &model.AuditEvent{
+			UserID:    f.member.ID,
+			ActorID:   f.admin.ID,
+			EventType: model.AuditUserSuspended,
+			Outcome:   model.AuditOutcomeSuccess,
+		})
+	})
+
+	t.Run("unsuspends", func(t *testing.T) {
+		f.urepo.On("SetSuspended", f.member.ID, (*time.Time)(nil)).Return(nil).Once()
+
+		user, err := f.svc.UnsuspendUser(f.adminToken, f.member.ID)
+		require.NoError(t, err)
+		assert.False(t, user.Suspended())
+	})
+
+	f.urepo.AssertExpectations(t)
+	f.trepo.AssertExpectations(t)
+}
+
+func TestSuspendedUserIsLockedOut(t *testing.T) {
+	f := newAdminFixture(t)
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct"), bcrypt.MinCost)
+	require.NoError(t, err)
+	f.member.PasswordHash = string(hash)
+	f.urepo.On("FindByEmail", f.member.Email).Return(f.member, nil)
+	f.urepo.On("UpdatePassword", f.member.ID, mock.Anything).Return(nil)
+
+	suspendedAt := time.Now()
+	f.member.SuspendedAt = &suspendedAt
+
+	t.Run("Login", func(t *testing.T) {
+		_, err := f.svc.Login(f.member.Email, "correct", model.ClientInfo{})
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+		f.arepo.AssertCalled(t, "CreateAuditEvent", &model.AuditEvent{
+			UserID:    f.member.ID,
+			EventType: model.AuditLoginFailed,
+			Outcome:   model.AuditOutcomeFailure,
+			Details:   "reason=suspended",
+		})
+	})
+
+	t.Run("ValidateToken", func(t *testing.T) {
+		_, _, ok := f.svc.ValidateAccessToken(f.memberToken)
+		assert.False(t, ok)
+	})
+
+	t.Run("issuing tokens", func(t *testing.T) {
+		_, err := f.svc.GenerateTokens(f.member.ID, model.ClientInfo{})
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	})
+
+	t.Run("RefreshToken", func(t *testing.T) {
+		stored := &model.RefreshToken{
+			ID:        uuid.NewString(),
+			UserID:    f.member.ID,
+			FamilyID:  uuid.NewString(),
+			TokenHash: sha256Hex("verifier"),
+			ExpiresAt: time.Now().Add(time.Hour),
+		}
+		f.trepo.On("FindBySelector", "selector").Return(stored, nil).Once()
+		f.trepo.On("MarkRotated", stored.ID).Return(true, nil).Once()
+
+		_, err := f.svc.RefreshToken("selector.verifier", model.ClientInfo{})
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	})
+}
+
+func TestSuspendedUserCannotExchangeAuthorizationCode(t *testing.T) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	key, err := keys.NewKey("k1", keys.AlgEdDSA, private)
+	require.NoError(t, err)
+	ks, err := keys.NewKeySet("k1", key)
+	require.NoError(t, err)
+
+	orepo := new(MockOAuthRepo)
+	f := newAdminFixture(t, service.WithSigningKeys(ks), service.WithOAuth(orepo, oauthIssuer, time.Minute))
+
+	verifier, challenge := pkcePair(t)
+	client := &model.OAuthClient{ID: "client-1", RedirectURIs: []string{"https://tracker.example.com/callback"}}
+	code := &model.AuthorizationCode{
+		ID:            uuid.NewString(),
+		ClientID:      client.ID,
+		UserID:        f.member.ID,
+		CodeHash:      sha256Hex("verifier"),
+		RedirectURI:   client.RedirectURIs[0],
+		CodeChallenge: challenge,
+		Scopes:        []string{model.ScopeOpenID},
+	}
+	orepo.On("FindClient", client.ID).Return(client, nil)
+	orepo.On("FindAuthorizationCode", "selector").Return(code, nil)
+	orepo.On("MarkAuthorizationCodeUsed", code.ID, mock.AnythingOfType("string")).Return(true, nil)
+
+	// Suspended after consenting, before the client redeems the code.
+	suspendedAt := time.Now()
+	f.member.SuspendedAt = &suspendedAt
+
+	tokens, err := f.svc.ExchangeAuthorizationCode(service.TokenRequest{
+		GrantType:    "authorization_code",
+		Code:         "selector.verifier",
+		RedirectURI:  code.RedirectURI,
+		ClientID:     client.ID,
+		CodeVerifier: verifier,
+	})
+	assert.Nil(t, tokens)
+	assert.Equal(t, service.OAuthInvalidGrant, oauthReason(t, err))
+}
+
+func TestForcePasswordReset(t *testing.T) {
+	t.Run("not configured", func(t *testing.T) {
+		f := newAdminFixture(t, service.WithMailer(nil))
+		err := f.svc.ForcePasswordReset(f.adminToken, f.member.ID)
+		assert.Equal(t, codes.Unimplemented, status.Code(err))
+	})
+
+	t.Run("removes the password and mails a link", func(t *testing.T) {
+		f := newAdminFixture(t, withPasswordReset)
+		f.urepo.On("UpdatePassword", f.member.ID, "").Return(nil).Once()
+		f.trepo.On("DeleteByUserID", f.member.ID).Return([]string{}, nil).Once()
+		f.actions.On("DeleteActionTokens", f.member.ID, model.ActionPasswordReset).Return(nil)
+		f.actions.On("CreateActionToken", mock.AnythingOfType("*model.ActionToken")).Return(nil)
+
+		require.NoError(t, f.svc.ForcePasswordReset(f.adminToken, f.member.ID))
+		require.Len(t, f.mailer.sent, 1)
+		assert.Equal(t, f.member.Email, f.mailer.sent[0].To)
+		assert.NotEmpty(t, tokenFromMail(t, f.mailer.sent[0]))
+		f.urepo.AssertExpectations(t)
+		f.arepo.AssertCalled(t, "CreateAuditEvent", &model.AuditEvent{
+			UserID:    f.member.ID,
+			ActorID:   f.admin.ID,
+			EventType: model.AuditPasswordResetForced,
+			Outcome:   model.AuditOutcomeSuccess,
+		})
+	})
+}
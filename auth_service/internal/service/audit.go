@@ -0,0 +1,196 @@
+package service
+
+import (
+	"encoding/base64"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/model"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 500
+)
+
+// Reasons recorded in the details of AuditLoginFailed events. Wrong current
+// passwords when changing account settings count as failed logins as well.
+const (
+	loginFailureUnknownEmail           = "unknown_email"
+	loginFailureInvalidPassword        = "invalid_password"
+	loginFailureInvalidCurrentPassword = "invalid_current_password"
+	loginFailureInvalidSecondFactor    = "invalid_second_factor"
+	loginFailureThrottled              = "throttled"
+	loginFailureSuspended              = "suspended"
+)
+
+// recordAudit writes e to the audit log, as a success unless an outcome is
+// set. Audit failures are logged and never fail the operation that is being
+// audited.
+func (s *AuthService) recordAudit(e *model.AuditEvent) {
+	if e.Outcome == "" {
+		e.Outcome = model.AuditOutcomeSuccess
+	}
+	if err := s.auditRepo.CreateAuditEvent(e); err != nil {
+		log.Printf("Failed to write audit event %s for user %s: %v", e.EventType, e.UserID, err)
+	}
+}
+
+// audit records eventType for an action userID took on their own account.
+func (s *AuthService) audit(userID, eventType string) {
+	s.recordAudit(&model.AuditEvent{
+		UserID:    userID,
+		ActorID:   userID,
+		EventType: eventType,
+	})
+}
+
+// auditUser is audit for a user loaded from an access token. Actions taken
+// with an impersonation token are attributed to the impersonating admin.
+func (s *AuthService) auditUser(user *model.User, eventType string) {
+	actorID := user.ID
+	if user.ImpersonatorID != "" {
+		actorID = user.ImpersonatorID
+	}
+	s.recordAudit(&model.AuditEvent{
+		UserID:    user.ID,
+		ActorID:   actorID,
+		EventType: eventType,
+	})
+}
+
+// auditClient is audit for actions whose client is known.
+func (s *AuthService) auditClient(userID, eventType string, client model.ClientInfo) {
+	s.recordAudit(&model.AuditEvent{
+		UserID:    userID,
+		ActorID:   userID,
+		EventType: eventType,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+	})
+}
+
+// auditAdminAction records eventType for an action adminID took on the
+// account of userID.
+func (s *AuthService) auditAdminAction(adminID, userID, eventType string) {
+	s.recordAudit(&model.AuditEvent{
+		UserID:    userID,
+		ActorID:   adminID,
+		EventType: eventType,
+	})
+}
+
+// auditLoginFailure records a rejected login. user is nil when no account
+// matches the email; the email is kept in the details then so that attempts
+// against unregistered addresses can be found as well.
+func (s *AuthService) auditLoginFailure(email string, user *model.User, client model.ClientInfo, reason string) {
+	e := &model.AuditEvent{
+		EventType: model.AuditLoginFailed,
+		Outcome:   model.AuditOutcomeFailure,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+		Details:   "reason=" + reason,
+	}
+	if user != nil {
+		e.UserID = user.ID
+	} else {
+		e.Details += " email=" + email
+	}
+	s.recordAudit(e)
+}
+
+// AuditQuery selects the audit events listed by ListAuditEvents. Zero fields
+// do not filter. Cursor is the NextCursor of the previous page.
+type AuditQuery struct {
+	UserID    string
+	EventType string
+	Since     time.Time
+	Until     time.Time
+	Cursor    string
+	Limit     int
+}
+
+// AuditPage is a page of audit events, newest first. NextCursor is empty on
+// the last page.
+type AuditPage struct {
+	Events     []*model.AuditEvent
+	NextCursor string
+}
+
+// ListAuditEvents lets admins page through the audit log. Limit defaults to
+// 50 and is capped at 500.
+func (s *AuthService) ListAuditEvents(accessToken string, q AuditQuery) (*AuditPage, error) {
+	if _, err := s.requireRole(accessToken, model.RoleAdmin); err != nil {
+		return nil, err
+	}
+
+	if !q.Since.IsZero() && !q.Until.IsZero() && !q.Since.Before(q.Until) {
+		return nil, status.Error(codes.InvalidArgument, "since must be before until")
+	}
+	limit := q.Limit
+	switch {
+	case limit < 0:
+		return nil, status.Error(codes.InvalidArgument, "limit must not be negative")
+	case limit == 0:
+		limit = defaultAuditPageSize
+	case limit > maxAuditPageSize:
+		limit = maxAuditPageSize
+	}
+
+	filter := model.AuditFilter{
+		UserID:    q.UserID,
+		EventType: q.EventType,
+		Since:     q.Since,
+		Until:     q.Until,
+		// One more event than requested tells whether there is a next page.
+		Limit: limit + 1,
+	}
+	if q.Cursor != "" {
+		after, err := decodeAuditCursor(q.Cursor)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid cursor")
+		}
+		filter.After = after
+	}
+
+	events, err := s.auditRepo.ListAuditEvents(filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit events: %w", err)
+	}
+
+	page := &AuditPage{Events: events}
+	if len(events) > limit {
+		page.Events = events[:limit]
+		last := page.Events[limit-1]
+		page.NextCursor = encodeAuditCursor(&model.AuditPosition{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+	return page, nil
+}
+
+// Cursors are opaque to clients. They hold the position of the last event
+// of a page as "<unix nanoseconds>.<event id>".
+func encodeAuditCursor(p *model.AuditPosition) string {
+	raw := strconv.FormatInt(p.CreatedAt.UnixNano(), 10) + "." + p.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeAuditCursor(cursor string) (*model.AuditPosition, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+	nanos, id, ok := strings.Cut(string(raw), ".")
+	if !ok || id == "" {
+		return nil, fmt.Errorf("malformed cursor %q", raw)
+	}
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &model.AuditPosition{CreatedAt: time.Unix(0, n).UTC(), ID: id}, nil
+}
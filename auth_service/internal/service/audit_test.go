@@ -0,0 +1,167 @@
+package service_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/model"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestLogin_Audit(t *testing.T) {
+	urepo := new(MockUserRepo)
+	arepo := new(MockAuditRepo)
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct"), bcrypt.MinCost)
+	require.NoError(t, err)
+	user := &model.User{ID: uuid.New().String(), Email: "reader@example.com", PasswordHash: string(hash)}
+	urepo.On("FindByEmail", user.Email).Return(user, nil)
+	urepo.On("FindByEmail", mock.Anything).Return(nil, errors.New("not found"))
+	urepo.On("UpdatePassword", user.ID, mock.Anything).Return(nil)
+	arepo.On("CreateAuditEvent", mock.AnythingOfType("*model.AuditEvent")).Return(nil)
+
+	svc := service.NewAuthService(urepo, new(MockTokenRepo), "secret", time.Minute*15, time.Hour*24,
+		service.WithAuditRepo(arepo),
+	)
+	client := model.ClientInfo{IP: "203.0.113.7", UserAgent: "curl/8.0"}
+
+	_, err = svc.Login(user.Email, "correct", client)
+	require.NoError(t, err)
+	_, err = svc.Login(user.Email, "wrong", client)
+	require.Error(t, err)
+	_, err = svc.Login("nobody@example.com", "wrong", client)
+	require.Error(t, err)
+
+	arepo.AssertCalled(t, "CreateAuditEvent", &model.AuditEvent{
+		UserID:    user.ID,
+		ActorID:   user.ID,
+		EventType: model.AuditLoginSucceeded,
+		Outcome:   model.AuditOutcomeSuccess,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+	})
+	arepo.AssertCalled(t, "CreateAuditEvent", &model.AuditEvent{
+		UserID:    user.ID,
+		EventType: model.AuditLoginFailed,
+		Outcome:   model.AuditOutcomeFailure,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+		Details:   "reason=invalid_password",
+	})
+	arepo.AssertCalled(t, "CreateAuditEvent", &model.AuditEvent{
+		EventType: model.AuditLoginFailed,
+		Outcome:   model.AuditOutcomeFailure,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+		Details:   "reason=unknown_email email=nobody@example.com",
+	})
+}
+
+func TestLogin_AuditWaitsForSecondFactor(t *testing.T) {
+	urepo := new(MockUserRepo)
+	arepo := new(MockAuditRepo)
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct"), bcrypt.MinCost)
+	require.NoError(t, err)
+	user := &model.User{ID: uuid.New().String(), Email: "reader@example.com", PasswordHash: string(hash), MFAEnabled: true}
+	urepo.On("FindByEmail", user.Email).Return(user, nil)
+	urepo.On("UpdatePassword", user.ID, mock.Anything).Return(nil)
+
+	svc := service.NewAuthService(urepo, new(MockTokenRepo), "secret", time.Minute*15, time.Hour*24,
+		service.WithAuditRepo(arepo),
+	)
+
+	_, err = svc.Login(user.Email, "correct", model.ClientInfo{})
+	require.NoError(t, err)
+	arepo.AssertNotCalled(t, "CreateAuditEvent", mock.Anything)
+}
+
+func TestListAuditEvents(t *testing.T) {
+	trepo := new(MockTokenRepo)
+	urepo := new(MockUserRepo)
+	arepo := new(MockAuditRepo)
+
+	admin := &model.User{ID: uuid.New().String(), Roles: []string{model.RoleAdmin}}
+	member := &model.User{ID: uuid.New().String(), Roles: []string{model.RoleMember}}
+	urepo.On("FindByID", admin.ID).Return(admin, nil)
+	urepo.On("FindByID", member.ID).Return(member, nil)
+	trepo.On("CreateRefreshToken", mock.AnythingOfType("*model.RefreshToken")).Return(nil)
+	trepo.On("IsAccessTokenRevoked", mock.Anything).Return(false, nil)
+
+	svc := service.NewAuthService(urepo, trepo, "secret", time.Minute*15, time.Hour*24, service.WithAuditRepo(arepo))
+	adminTokens, err := svc.GenerateTokens(admin.ID, model.ClientInfo{})
+	require.NoError(t, err)
+	memberTokens, err := svc.GenerateTokens(member.ID, model.ClientInfo{})
+	require.NoError(t, err)
+
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	events := make([]*model.AuditEvent, 3)
+	for i := range events {
+		events[i] = &model.AuditEvent{
+			ID:        fmt.Sprintf("audit-%d", i),
+			UserID:    member.ID,
+			EventType: model.AuditLoginSucceeded,
+			CreatedAt: now.Add(-time.Duration(i) * time.Minute),
+		}
+	}
+
+	t.Run("members are denied", func(t *testing.T) {
+		_, err := svc.ListAuditEvents(memberTokens.AccessToken, service.AuditQuery{})
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+		arepo.AssertNotCalled(t, "ListAuditEvents", mock.Anything)
+	})
+
+	t.Run("pages", func(t *testing.T) {
+		since := now.Add(-time.Hour)
+		arepo.On("ListAuditEvents", model.AuditFilter{
+			UserID: member.ID, EventType: model.AuditLoginSucceeded, Since: since, Limit: 3,
+		}).Return(events, nil).Once()
+
+		page, err := svc.ListAuditEvents(adminTokens.AccessToken, service.AuditQuery{
+			UserID: member.ID, EventType: model.AuditLoginSucceeded, Since: since, Limit: 2,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, events[:2], page.Events)
+		require.NotEmpty(t, page.NextCursor)
+
+		arepo.On("ListAuditEvents", model.AuditFilter{
+			Limit: 3,
+			After: &model.AuditPosition{CreatedAt: events[1].CreatedAt, ID: events[1].ID},
+		}).Return(events[2:], nil).Once()
+
+		page, err = svc.ListAuditEvents(adminTokens.AccessToken, service.AuditQuery{Cursor: page.NextCursor, Limit: 2})
+		require.NoError(t, err)
+		assert.Equal(t, events[2:], page.Events)
+		assert.Empty(t, page.NextCursor, "last page")
+	})
+
+	t.Run("default and maximum limit", func(t *testing.T) {
+		arepo.On("ListAuditEvents", model.AuditFilter{Limit: 51}).Return(nil, nil).Once()
+		arepo.On("ListAuditEvents", model.AuditFilter{Limit: 501}).Return(nil, nil).Once()
+
+		_, err := svc.ListAuditEvents(adminTokens.AccessToken, service.AuditQuery{})
+		require.NoError(t, err)
+		_, err = svc.ListAuditEvents(adminTokens.AccessToken, service.AuditQuery{Limit: 10000})
+		require.NoError(t, err)
+	})
+
+	t.Run("invalid queries", func(t *testing.T) {
+		for _, q := range []service.AuditQuery{
+			{Cursor: "not a cursor"},
+			{Limit: -1},
+			{Since: now, Until: now.Add(-time.Hour)},
+		} {
+			_, err := svc.ListAuditEvents(adminTokens.AccessToken, q)
+			assert.Equal(t, codes.InvalidArgument, status.Code(err), q)
+		}
+	})
+}
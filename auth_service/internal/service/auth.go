@@ -1,17 +1,19 @@
 package service
 
 import (
-	"crypto/rand"
-	"encoding/base64"
 	"errors"
 	"fmt"
 	"log"
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/keys"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/mail"
 	"github.com/polyakovaa/grpcproxy/auth_service/internal/model"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/oidc"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/password"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/throttle"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/validation"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -19,20 +21,139 @@ import (
 type AuthService struct {
 	userRepo   UserRepo
 	tokenRepo  TokenRepo
+	auditRepo  AuditRepo
+	keys       *keys.KeySet
 	jwtSecret  string
 	accessTTL  time.Duration
 	refreshTTL time.Duration
+
+	// secretAcceptedUntil ends the window in which tokens signed with
+	// jwtSecret stay valid after switching to keys.
+	secretAcceptedUntil time.Time
+
+	issuer             string
+	audience           string
+	leeway             time.Duration
+	acceptLegacyClaims bool
+
+	actionRepo ActionTokenRepo
+	mailer     mail.Mailer
+	resetTTL   time.Duration
+	resetURL   string
+
+	verificationTTL      time.Duration
+	verificationURL      string
+	verificationCooldown time.Duration
+
+	magicLinkTTL time.Duration
+	magicLinkURL string
+
+	accountLimiter *throttle.Limiter
+	ipLimiter      *throttle.Limiter
+
+	mfaRepo         MFARepo
+	mfaIssuer       string
+	mfaChallengeTTL time.Duration
+
+	hasher PasswordHasher
+	policy *validation.Policy
+
+	personalTokenRepo PersonalTokenRepo
+
+	oauthRepo    OAuthRepo
+	oauthIssuer  string
+	oauthCodeTTL time.Duration
+
+	identityRepo       IdentityRepo
+	identityProviders  []*oidc.Provider
+	federationStateTTL time.Duration
+
+	impersonationTTL time.Duration
 }
 
 type UserRepo interface {
 	CreateUser(u *model.User) (*model.User, error)
 	FindByID(id string) (*model.User, error)
 	FindByEmail(email string) (*model.User, error)
+	AddRole(userID, role string) error
+	RemoveRole(userID, role string) error
+	UpdatePassword(userID, passwordHash string) error
+	MarkEmailVerified(userID string) error
+	UpdateProfile(userID string, p model.ProfileUpdate) error
+	UpdateEmail(userID, email string) error
+	DeleteUser(userID string) error
+	SearchUsers(f model.UserFilter) ([]*model.User, int, error)
+	SetSuspended(userID string, at *time.Time) error
 }
 type TokenRepo interface {
 	CreateRefreshToken(rt *model.RefreshToken) error
 	FindByTokenHash(token string) (*model.RefreshToken, error)
+	FindBySelector(selector string) (*model.RefreshToken, error)
 	DeleteByID(id string) error
+	DeleteByUserID(userID string) ([]string, error)
+	RevokeAccessToken(tokenID string, expiresAt time.Time) error
+	IsAccessTokenRevoked(tokenID string) (bool, error)
+	MarkRotated(id string) (bool, error)
+	DeleteFamily(familyID string) ([]string, error)
+	ListSessions(userID string) ([]*model.Session, error)
+	DeleteSession(userID, sessionID string) ([]string, error)
+}
+type AuditRepo interface {
+	CreateAuditEvent(e *model.AuditEvent) error
+	ListAuditEvents(f model.AuditFilter) ([]*model.AuditEvent, error)
+}
+type ActionTokenRepo interface {
+	CreateActionToken(t *model.ActionToken) error
+	FindActionToken(purpose, selector string) (*model.ActionToken, error)
+	MarkActionTokenUsed(id string) (bool, error)
+	// ReleaseActionToken undoes MarkActionTokenUsed.
+	ReleaseActionToken(id string) error
+	DeleteActionTokens(userID, purpose string) error
+	LastActionTokenAt(userID, purpose string) (time.Time, error)
+}
+
+// PasswordHasher creates password hashes and checks passwords against them.
+// needsRehash reports a matching hash that should be replaced because it was
+// created with a weaker algorithm or outdated parameters.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Verify(password, hash string) (ok, needsRehash bool, err error)
+}
+type MFARepo interface {
+	SaveTOTPSecret(userID, secret string) error
+	FindTOTP(userID string) (*model.TOTP, error)
+	ConfirmTOTP(userID string, step int64, recoveryCodeHashes []string) error
+	UseTOTPStep(userID string, step int64) (bool, error)
+	UseRecoveryCode(userID, codeHash string) (bool, error)
+	DeleteMFA(userID string) error
+}
+type PersonalTokenRepo interface {
+	CreatePersonalToken(t *model.PersonalAccessToken) error
+	FindPersonalToken(selector string) (*model.PersonalAccessToken, error)
+	ListPersonalTokens(userID string) ([]*model.PersonalAccessToken, error)
+	CountPersonalTokens(userID string) (int, error)
+	DeletePersonalToken(userID, id string) (bool, error)
+	TouchPersonalToken(id string) error
+}
+type OAuthRepo interface {
+	CreateClient(c *model.OAuthClient) error
+	FindClient(id string) (*model.OAuthClient, error)
+	ListClients() ([]*model.OAuthClient, error)
+	DeleteClient(id string) (bool, error)
+	FindConsent(userID, clientID string) (*model.OAuthConsent, error)
+	SaveConsent(c *model.OAuthConsent) error
+	ListConsents(userID string) ([]*model.OAuthConsent, error)
+	DeleteConsent(userID, clientID string) (bool, error)
+	CreateAuthorizationCode(c *model.AuthorizationCode) error
+	FindAuthorizationCode(selector string) (*model.AuthorizationCode, error)
+	MarkAuthorizationCodeUsed(id, accessTokenID string) (bool, error)
+}
+type IdentityRepo interface {
+	FindIdentity(provider, subject string) (*model.Identity, error)
+	CreateIdentity(i *model.Identity) error
+	TouchIdentity(provider, subject, email string) error
+	CreateLoginState(s *model.FederatedLoginState) error
+	ConsumeLoginState(selector string) (*model.FederatedLoginState, error)
 }
 
 func (s *AuthService) AccessTTL() time.Duration {
@@ -44,52 +165,73 @@ func NewAuthService(
 	tokenRepo TokenRepo,
 	secret string,
 	accessTTL, refreshTTL time.Duration,
+	opts ...Option,
 ) *AuthService {
-	return &AuthService{
+	s := &AuthService{
 		userRepo:   userRepo,
 		tokenRepo:  tokenRepo,
+		auditRepo:  nopAuditRepo{},
+		hasher:     password.DefaultHasher(),
+		policy:     validation.DefaultPolicy(),
 		jwtSecret:  secret,
 		accessTTL:  accessTTL,
 		refreshTTL: refreshTTL,
+
+		impersonationTTL: defaultImpersonationTTL,
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+	return s
 }
 
-func (s *AuthService) GenerateTokens(userID string) (*model.Token, error) {
-	_, err := s.userRepo.FindByID(userID)
+// GenerateTokens issues a token pair that starts a new session, i.e. a new
+// refresh token family. client is recorded for the session list.
+func (s *AuthService) GenerateTokens(userID string, client model.ClientInfo) (*model.Token, error) {
+	return s.issueTokens(userID, uuid.New().String(), client, nil)
+}
+
+// issueTokens stores a new refresh token in familyID. previous is the token
+// it replaces on rotation and nil for a new session.
+func (s *AuthService) issueTokens(userID, familyID string, client model.ClientInfo, previous *model.RefreshToken) (*model.Token, error) {
+	user, err := s.userRepo.FindByID(userID)
 	if err != nil {
 		return nil, fmt.Errorf("user not found: %w", err)
 	}
+	if err := checkNotSuspended(user); err != nil {
+		return nil, err
+	}
 
 	accessID := uuid.New().String()
 
-	claims := jwt.MapClaims{
-		"user_id":    userID,
-		"token_id":   accessID,
-		"expires_at": time.Now().Add(s.accessTTL).Unix(),
-	}
-
-	access := jwt.NewWithClaims(jwt.SigningMethodHS512, claims)
-	accessToken, err := access.SignedString([]byte(s.jwtSecret))
+	accessToken, err := s.signToken(s.newAccessClaims(userID, user.Roles, user.EmailVerified, accessID))
 	if err != nil {
 		log.Printf("Error signing access token for user %s: %v", userID, err)
 		return nil, err
 	}
 
-	b := make([]byte, 32)
-	rand.Read(b)
-	refreshID := base64.URLEncoding.EncodeToString(b)
-	hashedToken, err := bcrypt.GenerateFromPassword([]byte(refreshID), bcrypt.DefaultCost)
-
+	refreshToken, selector, verifierHash, err := generateSplitToken()
 	if err != nil {
-		return nil, fmt.Errorf("failed to hash token: %w", err)
+		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
 	}
 
-	err = s.tokenRepo.CreateRefreshToken(&model.RefreshToken{
+	now := time.Now()
+	rt := &model.RefreshToken{
 		UserID:        userID,
-		TokenHash:     string(hashedToken),
+		FamilyID:      familyID,
+		Selector:      selector,
+		TokenHash:     verifierHash,
 		AccessTokenID: accessID,
-		ExpiresAt:     time.Now().Add(s.refreshTTL),
-	})
+		ExpiresAt:     now.Add(s.refreshTTL),
+		CreatedAt:     now,
+		UserAgent:     client.UserAgent,
+		IP:            client.IP,
+	}
+	if previous != nil && !previous.CreatedAt.IsZero() {
+		rt.CreatedAt = previous.CreatedAt
+		rt.LastUsedAt = &now
+	}
+	err = s.tokenRepo.CreateRefreshToken(rt)
 	if err != nil {
 		log.Printf("Error storing refresh token for user %s: %v", userID, err)
 		return nil, err
@@ -97,51 +239,96 @@ func (s *AuthService) GenerateTokens(userID string) (*model.Token, error) {
 
 	return &model.Token{
 		AccessToken:  accessToken,
-		RefreshToken: refreshID,
+		RefreshToken: refreshToken,
 	}, nil
 }
 
 func (s *AuthService) ValidateAccessToken(tokenStr string) (*model.User, time.Time, bool) {
-	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-		return []byte(s.jwtSecret), nil
-	})
-
-	if err != nil || !token.Valid {
-		log.Printf("Invalid access token: %v", err)
+	user, claims, ok := s.checkAccessToken(tokenStr)
+	if claims == nil {
 		return nil, time.Time{}, false
 	}
+	return user, claims.ExpiresAt, ok
+}
+
+// AccessTokenInfo describes a valid access token. ClientID and Scopes are
+// only set for tokens issued to OAuth clients, ActorID only for impersonation
+// tokens.
+type AccessTokenInfo struct {
+	ExpiresAt time.Time
+	ClientID  string
+	Scopes    []string
+	ActorID   string
+}
 
-	claims, ok := token.Claims.(jwt.MapClaims)
+// InspectAccessToken is ValidateAccessToken for callers that also need to
+// know whether the token was delegated to an OAuth client.
+func (s *AuthService) InspectAccessToken(tokenStr string) (*model.User, *AccessTokenInfo, bool) {
+	user, claims, ok := s.checkAccessToken(tokenStr)
 	if !ok {
-		return nil, time.Time{}, false
+		return nil, nil, false
 	}
+	return user, &AccessTokenInfo{
+		ExpiresAt: claims.ExpiresAt,
+		ClientID:  claims.ClientID,
+		Scopes:    claims.Scopes,
+		ActorID:   claims.ActorID,
+	}, true
+}
 
-	userID, ok := claims["user_id"].(string)
-	if !ok {
-		return nil, time.Time{}, false
+// checkAccessToken verifies tokenStr, checks that it was not revoked and
+// loads its user. The claims are also returned for rejected tokens when they
+// could be parsed, e.g. to report the expiry of an expired token.
+func (s *AuthService) checkAccessToken(tokenStr string) (*model.User, *accessTokenClaims, bool) {
+	claims, err := s.parseAccessToken(tokenStr)
+	if err != nil {
+		log.Printf("Invalid access token: %v", err)
+		return nil, claims, false
 	}
 
-	exp := time.Unix(int64(claims["expires_at"].(float64)), 0)
-	if exp.Before(time.Now()) {
-		return nil, exp, false
+	if claims.TokenID != "" {
+		revoked, err := s.tokenRepo.IsAccessTokenRevoked(claims.TokenID)
+		if err != nil {
+			log.Printf("Failed to check revocation of token %s: %v", claims.TokenID, err)
+			return nil, claims, false
+		}
+		if revoked {
+			return nil, claims, false
+		}
 	}
 
-	user, err := s.userRepo.FindByID(userID)
-	if err != nil {
-		return nil, exp, false
+	user, err := s.userRepo.FindByID(claims.UserID)
+	if err != nil || user.Suspended() {
+		return nil, claims, false
 	}
 
-	return user, exp, true
+	if claims.ActorID != "" {
+		if !s.canImpersonate(claims.ActorID) {
+			log.Printf("Rejected impersonation token of %s for user %s", claims.ActorID, user.ID)
+			return nil, claims, false
+		}
+		log.Printf("Impersonated call: admin %s as user %s", claims.ActorID, user.ID)
+	}
+	user.ImpersonatorID = claims.ActorID
 
+	return user, claims, true
 }
 
-func (s *AuthService) RegisterUser(username, email, password string) (*model.User, error) {
+// RegisterUser creates an account. client is recorded in the audit log.
+func (s *AuthService) RegisterUser(username, email, password string, client model.ClientInfo) (*model.User, error) {
+	email, violations := validation.NormalizeEmail("email", email)
+	violations = append(violations, s.policy.CheckUsername("user_name", username)...)
+	violations = append(violations, s.policy.CheckPassword("password", password)...)
+	if len(violations) > 0 {
+		return nil, invalidFields(violations)
+	}
+
 	_, err := s.userRepo.FindByEmail(email)
 	if err == nil {
 		return nil, status.Error(codes.AlreadyExists, "user already exists")
 	}
 
-	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashed, err := s.hasher.Hash(password)
 	if err != nil {
 		return nil, fmt.Errorf("hash password: %w", err)
 	}
@@ -149,21 +336,31 @@ func (s *AuthService) RegisterUser(username, email, password string) (*model.Use
 	u := &model.User{
 		UserName:     username,
 		Email:        email,
-		PasswordHash: string(hashed),
+		PasswordHash: hashed,
 	}
 	user, err := s.userRepo.CreateUser(u)
 
 	if err != nil {
+		if conflict := conflictError(err); conflict != nil {
+			return nil, conflict
+		}
 		return nil, fmt.Errorf("failed to create user: %w", err)
 	}
+	s.auditClient(user.ID, model.AuditUserRegistered, client)
+
+	if s.emailVerificationEnabled() {
+		if err := s.sendVerificationEmail(user, verificationBody); err != nil {
+			log.Printf("Failed to send verification email to user %s: %v", user.ID, err)
+		}
+	}
 
 	return user, nil
 
 }
 
-func (s *AuthService) RefreshToken(oldRefreshToken string) (*model.Token, error) {
+func (s *AuthService) RefreshToken(oldRefreshToken string, client model.ClientInfo) (*model.Token, error) {
 
-	storedToken, err := s.tokenRepo.FindByTokenHash(oldRefreshToken)
+	storedToken, err := s.findRefreshToken(oldRefreshToken)
 	if err != nil {
 		return nil, fmt.Errorf("invalid refresh token: %w", err)
 	}
@@ -172,20 +369,227 @@ func (s *AuthService) RefreshToken(oldRefreshToken string) (*model.Token, error)
 		return nil, errors.New("refresh token expired")
 	}
 
-	_ = s.tokenRepo.DeleteByID(storedToken.ID)
+	if storedToken.FamilyID == "" {
+		_ = s.tokenRepo.DeleteByID(storedToken.ID)
+		tokens, err := s.GenerateTokens(storedToken.UserID, client)
+		if err == nil {
+			s.auditClient(storedToken.UserID, model.AuditTokenRefreshed, client)
+		}
+		return tokens, err
+	}
+
+	if storedToken.RotatedAt != nil {
+		return nil, s.handleTokenReuse(storedToken, client)
+	}
+
+	rotated, err := s.tokenRepo.MarkRotated(storedToken.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+	if !rotated {
+		return nil, s.handleTokenReuse(storedToken, client)
+	}
+
+	tokens, err := s.issueTokens(storedToken.UserID, storedToken.FamilyID, client, storedToken)
+	if err != nil {
+		return nil, err
+	}
+	s.auditClient(storedToken.UserID, model.AuditTokenRefreshed, client)
+	return tokens, nil
+}
+
+// handleTokenReuse is called when a refresh token that was already rotated is
+// presented again. Either the legitimate client or an attacker holds a stale
+// copy, so the whole family is revoked and both parties have to log in again.
+func (s *AuthService) handleTokenReuse(storedToken *model.RefreshToken, client model.ClientInfo) error {
+	log.Printf("Refresh token reuse detected for user %s, family %s", storedToken.UserID, storedToken.FamilyID)
+
+	if err := s.revokeFamily(storedToken.FamilyID); err != nil {
+		log.Printf("Failed to revoke token family %s: %v", storedToken.FamilyID, err)
+	}
+
+	s.recordAudit(&model.AuditEvent{
+		UserID:    storedToken.UserID,
+		EventType: model.AuditRefreshTokenReuse,
+		Outcome:   model.AuditOutcomeFailure,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+		Details:   fmt.Sprintf("family_id=%s token_id=%s", storedToken.FamilyID, storedToken.ID),
+	})
+
+	return status.Error(codes.Unauthenticated, "refresh token reuse detected")
+}
+
+func (s *AuthService) revokeFamily(familyID string) error {
+	accessIDs, err := s.tokenRepo.DeleteFamily(familyID)
+	if err != nil {
+		return fmt.Errorf("failed to delete token family: %w", err)
+	}
+
+	for _, id := range accessIDs {
+		if err := s.revokeAccessToken(id); err != nil {
+			return fmt.Errorf("failed to revoke access token: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// findRefreshToken resolves a selector/verifier token with a single indexed
+// lookup. Tokens issued before the split format have no separator and are
+// still checked against the remaining legacy bcrypt rows until they expire.
+func (s *AuthService) findRefreshToken(rawToken string) (*model.RefreshToken, error) {
+	selector, verifier, ok := parseSplitToken(rawToken)
+	if !ok {
+		return s.tokenRepo.FindByTokenHash(rawToken)
+	}
+
+	storedToken, err := s.tokenRepo.FindBySelector(selector)
+	if err != nil {
+		return nil, err
+	}
 
-	return s.GenerateTokens(storedToken.UserID)
+	if !verifierMatches(verifier, storedToken.TokenHash) {
+		return nil, errors.New("invalid refresh token")
+	}
+
+	return storedToken, nil
 }
 
-func (s *AuthService) Login(email, password string) (*model.User, error) {
+func (s *AuthService) Login(email, password string, client model.ClientInfo) (*model.User, error) {
+	email = validation.FoldEmail(email)
+
+	if err := s.checkLoginThrottle(email, client); err != nil {
+		s.auditLoginFailure(email, nil, client, loginFailureThrottled)
+		return nil, err
+	}
+
 	user, err := s.userRepo.FindByEmail(email)
 	if err != nil {
-		return nil, errors.New("invalid email or password")
+		s.recordLoginFailure(email, nil, client, loginFailureUnknownEmail)
+		return nil, status.Error(codes.Unauthenticated, "invalid email or password")
 	}
 
-	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+	ok, needsRehash, err := s.hasher.Verify(password, user.PasswordHash)
+	if err != nil {
+		log.Printf("Failed to verify password of user %s: %v", user.ID, err)
+	}
+	if !ok {
+		s.recordLoginFailure(email, user, client, loginFailureInvalidPassword)
 		return nil, status.Error(codes.Unauthenticated, "invalid email or password")
 	}
 
+	// With MFA the login only succeeds with the second factor, and only then
+	// is the throttle reset. Otherwise knowing the password would undo every
+	// wrong code.
+	if !user.MFAEnabled {
+		s.resetLoginThrottle(email)
+	}
+	if err := checkNotSuspended(user); err != nil {
+		s.auditLoginFailure(email, user, client, loginFailureSuspended)
+		return nil, err
+	}
+	if !user.MFAEnabled {
+		s.auditClient(user.ID, model.AuditLoginSucceeded, client)
+	}
+
+	if needsRehash {
+		s.rehashPassword(user, password)
+	}
+
 	return user, nil
 }
+
+// rehashPassword upgrades the stored hash after a successful login. Failing
+// to do so is not fatal, the old hash keeps working until the next login.
+func (s *AuthService) rehashPassword(user *model.User, password string) {
+	hashed, err := s.hasher.Hash(password)
+	if err != nil {
+		log.Printf("Failed to rehash password of user %s: %v", user.ID, err)
+		return
+	}
+	if err := s.userRepo.UpdatePassword(user.ID, hashed); err != nil {
+		log.Printf("Failed to store rehashed password of user %s: %v", user.ID, err)
+		return
+	}
+	user.PasswordHash = hashed
+}
+
+func (s *AuthService) revokeAccessToken(tokenID string) error {
+	if tokenID == "" {
+		return nil
+	}
+	return s.tokenRepo.RevokeAccessToken(tokenID, time.Now().Add(s.accessTTL))
+}
+
+// Logout ends the session behind refreshToken and revokes the access token
+// issued together with it. accessToken is optional and is revoked as well
+// when it is still valid.
+func (s *AuthService) Logout(refreshToken, accessToken string) error {
+	revoked := false
+
+	if refreshToken != "" {
+		storedToken, err := s.findRefreshToken(refreshToken)
+		if err == nil {
+			if err := s.revokeSession(storedToken); err != nil {
+				return err
+			}
+			revoked = true
+		}
+	}
+
+	if accessToken != "" {
+		claims, err := s.parseAccessToken(accessToken)
+		if err == nil {
+			if err := s.revokeAccessToken(claims.TokenID); err != nil {
+				return fmt.Errorf("failed to revoke access token: %w", err)
+			}
+			revoked = true
+		}
+	}
+
+	if !revoked {
+		return status.Error(codes.Unauthenticated, "invalid token")
+	}
+
+	return nil
+}
+
+func (s *AuthService) revokeSession(storedToken *model.RefreshToken) error {
+	if storedToken.FamilyID != "" {
+		return s.revokeFamily(storedToken.FamilyID)
+	}
+
+	if err := s.revokeAccessToken(storedToken.AccessTokenID); err != nil {
+		return fmt.Errorf("failed to revoke access token: %w", err)
+	}
+	if err := s.tokenRepo.DeleteByID(storedToken.ID); err != nil {
+		return fmt.Errorf("failed to delete refresh token: %w", err)
+	}
+	return nil
+}
+
+// LogoutAll revokes every session of the user that owns accessToken.
+func (s *AuthService) LogoutAll(accessToken string) error {
+	user, err := s.authenticateOwner(accessToken, "logout_all")
+	if err != nil {
+		return err
+	}
+
+	return s.revokeUserSessions(user.ID)
+}
+
+func (s *AuthService) revokeUserSessions(userID string) error {
+	accessIDs, err := s.tokenRepo.DeleteByUserID(userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete refresh tokens: %w", err)
+	}
+
+	for _, id := range accessIDs {
+		if err := s.revokeAccessToken(id); err != nil {
+			return fmt.Errorf("failed to revoke access token: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -1,15 +1,31 @@
 package service_test
 
 import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"regexp"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/keys"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/mail"
 	"github.com/polyakovaa/grpcproxy/auth_service/internal/model"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/password"
 	"github.com/polyakovaa/grpcproxy/auth_service/internal/service"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type MockTokenRepo struct {
@@ -20,6 +36,23 @@ type MockUserRepo struct {
 	mock.Mock
 }
 
+type MockAuditRepo struct {
+	mock.Mock
+}
+
+func (m *MockAuditRepo) CreateAuditEvent(e *model.AuditEvent) error {
+	args := m.Called(e)
+	return args.Error(0)
+}
+
+func (m *MockAuditRepo) ListAuditEvents(f model.AuditFilter) ([]*model.AuditEvent, error) {
+	args := m.Called(f)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*model.AuditEvent), args.Error(1)
+}
+
 func (m *MockTokenRepo) CreateRefreshToken(rt *model.RefreshToken) error {
 	args := m.Called(rt)
 	return args.Error(0)
@@ -29,11 +62,66 @@ func (m *MockTokenRepo) FindByTokenHash(token string) (*model.RefreshToken, erro
 	return nil, nil
 }
 
+func (m *MockTokenRepo) FindBySelector(selector string) (*model.RefreshToken, error) {
+	args := m.Called(selector)
+	if args.Get(0) != nil {
+		return args.Get(0).(*model.RefreshToken), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
 func (m *MockTokenRepo) DeleteByID(id string) error {
 	args := m.Called(id)
 	return args.Error(0)
 }
 
+func (m *MockTokenRepo) DeleteByUserID(userID string) ([]string, error) {
+	args := m.Called(userID)
+	if args.Get(0) != nil {
+		return args.Get(0).([]string), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockTokenRepo) RevokeAccessToken(tokenID string, expiresAt time.Time) error {
+	args := m.Called(tokenID, expiresAt)
+	return args.Error(0)
+}
+
+func (m *MockTokenRepo) IsAccessTokenRevoked(tokenID string) (bool, error) {
+	args := m.Called(tokenID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockTokenRepo) MarkRotated(id string) (bool, error) {
+	args := m.Called(id)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockTokenRepo) DeleteFamily(familyID string) ([]string, error) {
+	args := m.Called(familyID)
+	if args.Get(0) != nil {
+		return args.Get(0).([]string), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockTokenRepo) ListSessions(userID string) ([]*model.Session, error) {
+	args := m.Called(userID)
+	if args.Get(0) != nil {
+		return args.Get(0).([]*model.Session), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockTokenRepo) DeleteSession(userID, sessionID string) ([]string, error) {
+	args := m.Called(userID, sessionID)
+	if args.Get(0) != nil {
+		return args.Get(0).([]string), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
 func (m *MockUserRepo) FindByID(id string) (*model.User, error) {
 	args := m.Called(id)
 	if args.Get(0) != nil {
@@ -50,9 +138,160 @@ func (m *MockUserRepo) FindByEmail(email string) (*model.User, error) {
 	return nil, args.Error(1)
 }
 
+func (m *MockUserRepo) AddRole(userID, role string) error {
+	args := m.Called(userID, role)
+	return args.Error(0)
+}
+
+func (m *MockUserRepo) RemoveRole(userID, role string) error {
+	args := m.Called(userID, role)
+	return args.Error(0)
+}
+
+func (m *MockUserRepo) UpdatePassword(userID, passwordHash string) error {
+	args := m.Called(userID, passwordHash)
+	return args.Error(0)
+}
+
+func (m *MockUserRepo) MarkEmailVerified(userID string) error {
+	args := m.Called(userID)
+	return args.Error(0)
+}
+
+func (m *MockUserRepo) UpdateProfile(userID string, p model.ProfileUpdate) error {
+	args := m.Called(userID, p)
+	return args.Error(0)
+}
+
+func (m *MockUserRepo) UpdateEmail(userID, email string) error {
+	args := m.Called(userID, email)
+	return args.Error(0)
+}
+
+func (m *MockUserRepo) DeleteUser(userID string) error {
+	args := m.Called(userID)
+	return args.Error(0)
+}
+
+func (m *MockUserRepo) SearchUsers(f model.UserFilter) ([]*model.User, int, error) {
+	args := m.Called(f)
+	users, _ := args.Get(0).([]*model.User)
+	return users, args.Int(1), args.Error(2)
+}
+
+func (m *MockUserRepo) SetSuspended(userID string, at *time.Time) error {
+	args := m.Called(userID, at)
+	return args.Error(0)
+}
+
 func (m *MockUserRepo) CreateUser(user *model.User) (*model.User, error) {
 	args := m.Called(user)
-	return nil, args.Error(0)
+	if err := args.Error(0); err != nil {
+		return nil, err
+	}
+	user.ID = uuid.New().String()
+	return user, nil
+}
+
+type MockActionTokenRepo struct {
+	mock.Mock
+}
+
+func (m *MockActionTokenRepo) CreateActionToken(t *model.ActionToken) error {
+	args := m.Called(t)
+	return args.Error(0)
+}
+
+func (m *MockActionTokenRepo) FindActionToken(purpose, selector string) (*model.ActionToken, error) {
+	args := m.Called(purpose, selector)
+	if args.Get(0) != nil {
+		return args.Get(0).(*model.ActionToken), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockActionTokenRepo) MarkActionTokenUsed(id string) (bool, error) {
+	args := m.Called(id)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockActionTokenRepo) ReleaseActionToken(id string) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *MockActionTokenRepo) DeleteActionTokens(userID, purpose string) error {
+	args := m.Called(userID, purpose)
+	return args.Error(0)
+}
+
+func (m *MockActionTokenRepo) LastActionTokenAt(userID, purpose string) (time.Time, error) {
+	args := m.Called(userID, purpose)
+	return args.Get(0).(time.Time), args.Error(1)
+}
+
+type recordingMailer struct {
+	sent []mail.Message
+}
+
+func (m *recordingMailer) Send(msg mail.Message) error {
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+var linkPattern = regexp.MustCompile(`https?://\S+`)
+
+func tokenFromMail(t *testing.T, msg mail.Message) string {
+	link := linkPattern.FindString(msg.Body)
+	require.NotEmpty(t, link, "mail contains no link")
+	u, err := url.Parse(link)
+	require.NoError(t, err)
+	return u.Query().Get("token")
+}
+
+// testEnv is an AuthService on mocks, see newTestService.
+type testEnv struct {
+	svc     *service.AuthService
+	urepo   *MockUserRepo
+	trepo   *MockTokenRepo
+	arepo   *MockAuditRepo
+	actions *MockActionTokenRepo
+	mailer  *recordingMailer
+}
+
+// newTestService builds an AuthService on fresh mocks with the audit log,
+// action tokens and mailer wired in. opts are applied on top and may replace
+// them. Storing refresh tokens, revocation checks and audit writes are
+// expected; all other calls are up to the test.
+func newTestService(opts ...service.Option) *testEnv {
+	e := &testEnv{
+		urepo:   new(MockUserRepo),
+		trepo:   new(MockTokenRepo),
+		arepo:   new(MockAuditRepo),
+		actions: new(MockActionTokenRepo),
+		mailer:  &recordingMailer{},
+	}
+	e.trepo.On("CreateRefreshToken", mock.AnythingOfType("*model.RefreshToken")).Return(nil)
+	e.trepo.On("IsAccessTokenRevoked", mock.Anything).Return(false, nil)
+	e.arepo.On("CreateAuditEvent", mock.AnythingOfType("*model.AuditEvent")).Return(nil)
+
+	opts = append([]service.Option{
+		service.WithAuditRepo(e.arepo),
+		service.WithActionTokenRepo(e.actions),
+		service.WithMailer(e.mailer),
+	}, opts...)
+	e.svc = service.NewAuthService(e.urepo, e.trepo, "secret", time.Minute*15, time.Hour*24, opts...)
+	return e
+}
+
+// signIn makes user known to the user repository and returns an access token
+// for them.
+func (e *testEnv) signIn(t *testing.T, user *model.User) string {
+	t.Helper()
+	e.urepo.On("FindByID", user.ID).Return(user, nil)
+	tokens, err := e.svc.GenerateTokens(user.ID, model.ClientInfo{})
+	require.NoError(t, err)
+	return tokens.AccessToken
 }
 
 func TestGenerateTokens_Success(t *testing.T) {
@@ -65,7 +304,7 @@ func TestGenerateTokens_Success(t *testing.T) {
 	svc := service.NewAuthService(urepo, trepo, "secret", time.Minute*15, time.Hour*24)
 
 	userID := uuid.New().String()
-	token, err := svc.GenerateTokens(userID)
+	token, err := svc.GenerateTokens(userID, model.ClientInfo{})
 
 	assert.NoError(t, err)
 	assert.NotEmpty(t, token.AccessToken)
@@ -74,6 +313,61 @@ func TestGenerateTokens_Success(t *testing.T) {
 
 }
 
+func TestGenerateTokens_SelectorVerifier(t *testing.T) {
+	trepo := new(MockTokenRepo)
+	urepo := new(MockUserRepo)
+
+	var stored *model.RefreshToken
+	urepo.On("FindByID", mock.Anything).Return(&model.User{ID: uuid.New().String()}, nil)
+	trepo.On("CreateRefreshToken", mock.AnythingOfType("*model.RefreshToken")).
+		Run(func(args mock.Arguments) { stored = args.Get(0).(*model.RefreshToken) }).
+		Return(nil)
+
+	svc := service.NewAuthService(urepo, trepo, "secret", time.Minute*15, time.Hour*24)
+	tokens, err := svc.GenerateTokens(uuid.New().String(), model.ClientInfo{})
+	assert.NoError(t, err)
+
+	selector, verifier, ok := strings.Cut(tokens.RefreshToken, ".")
+	assert.True(t, ok)
+	assert.Equal(t, selector, stored.Selector)
+	assert.NotContains(t, stored.TokenHash, verifier)
+}
+
+func TestRefreshToken_Selector(t *testing.T) {
+	trepo := new(MockTokenRepo)
+	urepo := new(MockUserRepo)
+
+	var stored *model.RefreshToken
+	userID := uuid.New().String()
+	urepo.On("FindByID", userID).Return(&model.User{ID: userID}, nil)
+	trepo.On("CreateRefreshToken", mock.AnythingOfType("*model.RefreshToken")).
+		Run(func(args mock.Arguments) { stored = args.Get(0).(*model.RefreshToken) }).
+		Return(nil)
+
+	svc := service.NewAuthService(urepo, trepo, "secret", time.Minute*15, time.Hour*24)
+	tokens, err := svc.GenerateTokens(userID, model.ClientInfo{})
+	assert.NoError(t, err)
+
+	row := *stored
+	row.ID = "row-1"
+	trepo.On("FindBySelector", row.Selector).Return(&row, nil)
+	trepo.On("MarkRotated", "row-1").Return(true, nil)
+
+	t.Run("wrong verifier", func(t *testing.T) {
+		_, err := svc.RefreshToken(row.Selector+".forged", model.ClientInfo{})
+		assert.Error(t, err)
+		trepo.AssertNotCalled(t, "MarkRotated", "row-1")
+	})
+
+	t.Run("valid token", func(t *testing.T) {
+		newTokens, err := svc.RefreshToken(tokens.RefreshToken, model.ClientInfo{})
+		assert.NoError(t, err)
+		assert.NotEqual(t, tokens.RefreshToken, newTokens.RefreshToken)
+		trepo.AssertCalled(t, "MarkRotated", "row-1")
+		assert.Equal(t, row.FamilyID, stored.FamilyID, "rotated token must stay in the family")
+	})
+}
+
 func TestGenerateTokens_JWTClaims(t *testing.T) {
 	trepo := new(MockTokenRepo)
 	urepo := new(MockUserRepo)
@@ -83,7 +377,7 @@ func TestGenerateTokens_JWTClaims(t *testing.T) {
 
 	svc := service.NewAuthService(urepo, trepo, "secret", time.Minute*15, time.Hour*24)
 	userID := "user-123"
-	tokens, err := svc.GenerateTokens(userID)
+	tokens, err := svc.GenerateTokens(userID, model.ClientInfo{})
 	assert.NoError(t, err)
 	parsed, err := jwt.Parse(tokens.AccessToken, func(token *jwt.Token) (interface{}, error) {
 		return []byte("secret"), nil
@@ -95,8 +389,12 @@ func TestGenerateTokens_JWTClaims(t *testing.T) {
 	claims, ok := parsed.Claims.(jwt.MapClaims)
 	assert.True(t, ok)
 
-	assert.Equal(t, userID, claims["user_id"])
-	assert.NotEmpty(t, claims["expires_at"])
+	assert.Equal(t, userID, claims["sub"])
+	assert.NotEmpty(t, claims["exp"])
+	assert.NotEmpty(t, claims["iat"])
+	assert.NotEmpty(t, claims["nbf"])
+	assert.NotEmpty(t, claims["jti"])
+	assert.NotContains(t, claims, "user_id")
 
 }
 
@@ -107,7 +405,7 @@ func TestValidateAccessToken_Expired(t *testing.T) {
 	urepo.On("FindByID", mock.Anything).Return(&model.User{ID: uuid.New().String()}, nil)
 	trepo.On("CreateRefreshToken", mock.AnythingOfType("*model.RefreshToken")).Return(nil)
 
-	svc := service.NewAuthService(urepo, trepo, "secret123", time.Minute*15, time.Hour*24)
+	svc := service.NewAuthService(urepo, trepo, "secret123", time.Minute*15, time.Hour*24, service.WithLegacyClaims(true))
 
 	claims := jwt.MapClaims{
 		"user_id":    uuid.New().String(),
@@ -144,3 +442,490 @@ func TestValidateAccessToken_InvalidSign(t *testing.T) {
 	assert.Nil(t, u, "invalid")
 
 }
+
+func TestLogout_RevokesLinkedAccessToken(t *testing.T) {
+	trepo := new(MockTokenRepo)
+	urepo := new(MockUserRepo)
+
+	var stored *model.RefreshToken
+	userID := uuid.New().String()
+	urepo.On("FindByID", userID).Return(&model.User{ID: userID}, nil)
+	trepo.On("CreateRefreshToken", mock.AnythingOfType("*model.RefreshToken")).
+		Run(func(args mock.Arguments) { stored = args.Get(0).(*model.RefreshToken) }).
+		Return(nil)
+
+	svc := service.NewAuthService(urepo, trepo, "secret", time.Minute*15, time.Hour*24)
+	tokens, err := svc.GenerateTokens(userID, model.ClientInfo{})
+	assert.NoError(t, err)
+
+	row := *stored
+	row.ID = "row-1"
+	trepo.On("FindBySelector", row.Selector).Return(&row, nil)
+	trepo.On("DeleteFamily", row.FamilyID).Return([]string{row.AccessTokenID}, nil)
+	trepo.On("RevokeAccessToken", row.AccessTokenID, mock.AnythingOfType("time.Time")).Return(nil)
+
+	err = svc.Logout(tokens.RefreshToken, "")
+	assert.NoError(t, err)
+	trepo.AssertCalled(t, "DeleteFamily", row.FamilyID)
+	trepo.AssertCalled(t, "RevokeAccessToken", row.AccessTokenID, mock.AnythingOfType("time.Time"))
+
+	trepo.On("IsAccessTokenRevoked", row.AccessTokenID).Return(true, nil)
+	u, _, ok := svc.ValidateAccessToken(tokens.AccessToken)
+	assert.False(t, ok, "revoked token must be rejected")
+	assert.Nil(t, u)
+}
+
+func TestLogout_InvalidTokens(t *testing.T) {
+	trepo := new(MockTokenRepo)
+	urepo := new(MockUserRepo)
+	svc := service.NewAuthService(urepo, trepo, "secret", time.Minute*15, time.Hour*24)
+
+	trepo.On("FindBySelector", "unknown").Return(nil, errors.New("invalid refresh token"))
+
+	err := svc.Logout("unknown.verifier", "not-a-jwt")
+	assert.Error(t, err)
+	trepo.AssertNotCalled(t, "RevokeAccessToken", mock.Anything, mock.Anything)
+}
+
+func TestLogoutAll(t *testing.T) {
+	trepo := new(MockTokenRepo)
+	urepo := new(MockUserRepo)
+
+	userID := uuid.New().String()
+	urepo.On("FindByID", userID).Return(&model.User{ID: userID}, nil)
+	trepo.On("CreateRefreshToken", mock.AnythingOfType("*model.RefreshToken")).Return(nil)
+	trepo.On("IsAccessTokenRevoked", mock.Anything).Return(false, nil)
+
+	svc := service.NewAuthService(urepo, trepo, "secret", time.Minute*15, time.Hour*24)
+	tokens, err := svc.GenerateTokens(userID, model.ClientInfo{})
+	assert.NoError(t, err)
+
+	trepo.On("DeleteByUserID", userID).Return([]string{"access-1", "access-2"}, nil)
+	trepo.On("RevokeAccessToken", mock.Anything, mock.AnythingOfType("time.Time")).Return(nil)
+
+	err = svc.LogoutAll(tokens.AccessToken)
+	assert.NoError(t, err)
+	trepo.AssertCalled(t, "RevokeAccessToken", "access-1", mock.AnythingOfType("time.Time"))
+	trepo.AssertCalled(t, "RevokeAccessToken", "access-2", mock.AnythingOfType("time.Time"))
+}
+
+func TestRefreshToken_ReuseRevokesFamily(t *testing.T) {
+	trepo := new(MockTokenRepo)
+	urepo := new(MockUserRepo)
+	arepo := new(MockAuditRepo)
+
+	var stored *model.RefreshToken
+	userID := uuid.New().String()
+	urepo.On("FindByID", userID).Return(&model.User{ID: userID}, nil)
+	trepo.On("CreateRefreshToken", mock.AnythingOfType("*model.RefreshToken")).
+		Run(func(args mock.Arguments) { stored = args.Get(0).(*model.RefreshToken) }).
+		Return(nil)
+
+	svc := service.NewAuthService(urepo, trepo, "secret", time.Minute*15, time.Hour*24, service.WithAuditRepo(arepo))
+	tokens, err := svc.GenerateTokens(userID, model.ClientInfo{})
+	assert.NoError(t, err)
+
+	rotatedAt := time.Now().Add(-time.Minute)
+	row := *stored
+	row.ID = "row-1"
+	row.RotatedAt = &rotatedAt
+
+	trepo.On("FindBySelector", row.Selector).Return(&row, nil)
+	trepo.On("DeleteFamily", row.FamilyID).Return([]string{"access-1", "access-2"}, nil)
+	trepo.On("RevokeAccessToken", mock.Anything, mock.AnythingOfType("time.Time")).Return(nil)
+	arepo.On("CreateAuditEvent", mock.MatchedBy(func(e *model.AuditEvent) bool {
+		return e.UserID == userID && e.EventType == model.AuditRefreshTokenReuse
+	})).Return(nil)
+
+	_, err = svc.RefreshToken(tokens.RefreshToken, model.ClientInfo{})
+
+	st, ok := status.FromError(err)
+	assert.True(t, ok)
+	assert.Equal(t, codes.Unauthenticated, st.Code())
+	trepo.AssertNotCalled(t, "MarkRotated", mock.Anything)
+	trepo.AssertCalled(t, "DeleteFamily", row.FamilyID)
+	trepo.AssertCalled(t, "RevokeAccessToken", "access-1", mock.AnythingOfType("time.Time"))
+	trepo.AssertCalled(t, "RevokeAccessToken", "access-2", mock.AnythingOfType("time.Time"))
+	arepo.AssertExpectations(t)
+}
+
+func TestRefreshToken_ConcurrentRotationIsReuse(t *testing.T) {
+	trepo := new(MockTokenRepo)
+	urepo := new(MockUserRepo)
+	arepo := new(MockAuditRepo)
+
+	verifierHash := sha256.Sum256([]byte("verifier"))
+	row := &model.RefreshToken{
+		ID:        "row-1",
+		UserID:    uuid.New().String(),
+		FamilyID:  uuid.New().String(),
+		Selector:  "selector",
+		TokenHash: hex.EncodeToString(verifierHash[:]),
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+	trepo.On("FindBySelector", "selector").Return(row, nil)
+	trepo.On("MarkRotated", "row-1").Return(false, nil)
+	trepo.On("DeleteFamily", row.FamilyID).Return([]string{}, nil)
+	arepo.On("CreateAuditEvent", mock.AnythingOfType("*model.AuditEvent")).Return(nil)
+
+	svc := service.NewAuthService(urepo, trepo, "secret", time.Minute*15, time.Hour*24, service.WithAuditRepo(arepo))
+
+	_, err := svc.RefreshToken("selector.verifier", model.ClientInfo{})
+
+	assert.Error(t, err)
+	trepo.AssertCalled(t, "DeleteFamily", row.FamilyID)
+	arepo.AssertCalled(t, "CreateAuditEvent", mock.AnythingOfType("*model.AuditEvent"))
+	urepo.AssertNotCalled(t, "FindByID", mock.Anything)
+}
+
+func TestSigningKeys_Rotation(t *testing.T) {
+	trepo := new(MockTokenRepo)
+	urepo := new(MockUserRepo)
+
+	userID := uuid.New().String()
+	urepo.On("FindByID", userID).Return(&model.User{ID: userID}, nil)
+	trepo.On("CreateRefreshToken", mock.AnythingOfType("*model.RefreshToken")).Return(nil)
+	trepo.On("IsAccessTokenRevoked", mock.Anything).Return(false, nil)
+
+	_, oldPriv, _ := ed25519.GenerateKey(rand.Reader)
+	oldKey, err := keys.NewKey("old", keys.AlgEdDSA, oldPriv)
+	assert.NoError(t, err)
+	rsaPriv, _ := rsa.GenerateKey(rand.Reader, 2048)
+	newKey, err := keys.NewKey("new", keys.AlgRS256, rsaPriv)
+	assert.NoError(t, err)
+
+	before, _ := keys.NewKeySet("old", oldKey)
+	svc := service.NewAuthService(urepo, trepo, "", time.Minute*15, time.Hour*24, service.WithSigningKeys(before))
+	oldTokens, err := svc.GenerateTokens(userID, model.ClientInfo{})
+	assert.NoError(t, err)
+
+	parsed, _, err := jwt.NewParser().ParseUnverified(oldTokens.AccessToken, jwt.MapClaims{})
+	assert.NoError(t, err)
+	assert.Equal(t, "old", parsed.Header["kid"])
+	assert.Equal(t, "EdDSA", parsed.Method.Alg())
+
+	after, _ := keys.NewKeySet("new", newKey, &keys.Key{ID: "old", Algorithm: keys.AlgEdDSA, Public: oldPriv.Public()})
+	rotated := service.NewAuthService(urepo, trepo, "", time.Minute*15, time.Hour*24, service.WithSigningKeys(after))
+
+	newTokens, err := rotated.GenerateTokens(userID, model.ClientInfo{})
+	assert.NoError(t, err)
+
+	_, _, ok := rotated.ValidateAccessToken(oldTokens.AccessToken)
+	assert.True(t, ok, "token signed by the previous key must stay valid")
+	_, _, ok = rotated.ValidateAccessToken(newTokens.AccessToken)
+	assert.True(t, ok)
+	_, _, ok = svc.ValidateAccessToken(newTokens.AccessToken)
+	assert.False(t, ok, "unknown kid must be rejected")
+
+	assert.Len(t, rotated.JWKS(), 2)
+}
+
+func TestSigningKeys_RejectsSharedSecretWithoutSecret(t *testing.T) {
+	trepo := new(MockTokenRepo)
+	urepo := new(MockUserRepo)
+
+	_, priv, _ := ed25519.GenerateKey(rand.Reader)
+	key, _ := keys.NewKey("k1", keys.AlgEdDSA, priv)
+	ks, _ := keys.NewKeySet("k1", key)
+	svc := service.NewAuthService(urepo, trepo, "", time.Minute*15, time.Hour*24, service.WithSigningKeys(ks))
+
+	claims := jwt.MapClaims{
+		"user_id":    uuid.New().String(),
+		"token_id":   uuid.New().String(),
+		"expires_at": time.Now().Add(time.Hour).Unix(),
+	}
+	tokenStr, _ := jwt.NewWithClaims(jwt.SigningMethodHS512, claims).SignedString([]byte(""))
+
+	_, _, ok := svc.ValidateAccessToken(tokenStr)
+	assert.False(t, ok)
+}
+
+func TestSigningKeys_SharedSecretWindow(t *testing.T) {
+	userID := uuid.New().String()
+	urepo := new(MockUserRepo)
+	urepo.On("FindByID", userID).Return(&model.User{ID: userID}, nil)
+	trepo := new(MockTokenRepo)
+	trepo.On("CreateRefreshToken", mock.AnythingOfType("*model.RefreshToken")).Return(nil)
+	trepo.On("IsAccessTokenRevoked", mock.Anything).Return(false, nil)
+
+	legacy := service.NewAuthService(urepo, trepo, "secret", time.Minute*15, time.Hour*24)
+	tokens, err := legacy.GenerateTokens(userID, model.ClientInfo{})
+	require.NoError(t, err)
+
+	_, priv, _ := ed25519.GenerateKey(rand.Reader)
+	key, _ := keys.NewKey("k1", keys.AlgEdDSA, priv)
+	ks, _ := keys.NewKeySet("k1", key)
+
+	t.Run("accepted within the window", func(t *testing.T) {
+		svc := service.NewAuthService(urepo, trepo, "secret", time.Minute*15, time.Hour*24,
+			service.WithSigningKeys(ks),
+			service.WithSharedSecretUntil(time.Now().Add(time.Minute)),
+		)
+		_, _, ok := svc.ValidateAccessToken(tokens.AccessToken)
+		assert.True(t, ok)
+
+		fresh, err := svc.GenerateTokens(userID, model.ClientInfo{})
+		require.NoError(t, err)
+		parsed, _, err := jwt.NewParser().ParseUnverified(fresh.AccessToken, jwt.MapClaims{})
+		require.NoError(t, err)
+		assert.Equal(t, "EdDSA", parsed.Method.Alg(), "new tokens are signed with the key")
+	})
+
+	t.Run("rejected after the window", func(t *testing.T) {
+		svc := service.NewAuthService(urepo, trepo, "secret", time.Minute*15, time.Hour*24,
+			service.WithSigningKeys(ks),
+			service.WithSharedSecretUntil(time.Now().Add(-time.Minute)),
+		)
+		_, _, ok := svc.ValidateAccessToken(tokens.AccessToken)
+		assert.False(t, ok)
+	})
+
+	t.Run("rejected without a window", func(t *testing.T) {
+		svc := service.NewAuthService(urepo, trepo, "secret", time.Minute*15, time.Hour*24, service.WithSigningKeys(ks))
+		_, _, ok := svc.ValidateAccessToken(tokens.AccessToken)
+		assert.False(t, ok)
+	})
+}
+
+func TestValidateAccessToken_RegisteredClaims(t *testing.T) {
+	trepo := new(MockTokenRepo)
+	urepo := new(MockUserRepo)
+
+	userID := uuid.New().String()
+	urepo.On("FindByID", userID).Return(&model.User{ID: userID}, nil)
+	trepo.On("CreateRefreshToken", mock.AnythingOfType("*model.RefreshToken")).Return(nil)
+	trepo.On("IsAccessTokenRevoked", mock.Anything).Return(false, nil)
+
+	svc := service.NewAuthService(urepo, trepo, "secret", time.Minute*15, time.Hour*24,
+		service.WithTokenClaims("reading-club", "gateway", 30*time.Second))
+
+	sign := func(claims jwt.Claims, method jwt.SigningMethod) string {
+		tokenStr, err := jwt.NewWithClaims(method, claims).SignedString([]byte("secret"))
+		assert.NoError(t, err)
+		return tokenStr
+	}
+	claims := func(mutate func(c *jwt.RegisteredClaims)) jwt.RegisteredClaims {
+		now := time.Now()
+		c := jwt.RegisteredClaims{
+			Issuer:    "reading-club",
+			Audience:  jwt.ClaimStrings{"gateway"},
+			Subject:   userID,
+			ID:        uuid.New().String(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+		}
+		if mutate != nil {
+			mutate(&c)
+		}
+		return c
+	}
+
+	t.Run("generated token is valid", func(t *testing.T) {
+		tokens, err := svc.GenerateTokens(userID, model.ClientInfo{})
+		assert.NoError(t, err)
+		u, _, ok := svc.ValidateAccessToken(tokens.AccessToken)
+		assert.True(t, ok)
+		assert.Equal(t, userID, u.ID)
+	})
+
+	t.Run("wrong issuer", func(t *testing.T) {
+		tok := sign(claims(func(c *jwt.RegisteredClaims) { c.Issuer = "someone-else" }), jwt.SigningMethodHS512)
+		_, _, ok := svc.ValidateAccessToken(tok)
+		assert.False(t, ok)
+	})
+
+	t.Run("wrong audience", func(t *testing.T) {
+		tok := sign(claims(func(c *jwt.RegisteredClaims) { c.Audience = jwt.ClaimStrings{"other"} }), jwt.SigningMethodHS512)
+		_, _, ok := svc.ValidateAccessToken(tok)
+		assert.False(t, ok)
+	})
+
+	t.Run("algorithm is pinned", func(t *testing.T) {
+		tok := sign(claims(nil), jwt.SigningMethodHS256)
+		_, _, ok := svc.ValidateAccessToken(tok)
+		assert.False(t, ok)
+	})
+
+	t.Run("expired within leeway", func(t *testing.T) {
+		tok := sign(claims(func(c *jwt.RegisteredClaims) {
+			c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-10 * time.Second))
+		}), jwt.SigningMethodHS512)
+		_, _, ok := svc.ValidateAccessToken(tok)
+		assert.True(t, ok)
+	})
+
+	t.Run("expired beyond leeway", func(t *testing.T) {
+		expired := time.Now().Add(-time.Minute).Truncate(time.Second)
+		tok := sign(claims(func(c *jwt.RegisteredClaims) {
+			c.ExpiresAt = jwt.NewNumericDate(expired)
+		}), jwt.SigningMethodHS512)
+		_, exp, ok := svc.ValidateAccessToken(tok)
+		assert.False(t, ok)
+		assert.True(t, exp.Equal(expired))
+	})
+
+	t.Run("not yet valid", func(t *testing.T) {
+		tok := sign(claims(func(c *jwt.RegisteredClaims) {
+			c.NotBefore = jwt.NewNumericDate(time.Now().Add(time.Hour))
+		}), jwt.SigningMethodHS512)
+		_, _, ok := svc.ValidateAccessToken(tok)
+		assert.False(t, ok)
+	})
+
+	t.Run("legacy shape rejected outside migration window", func(t *testing.T) {
+		tok := sign(jwt.MapClaims{
+			"user_id":    userID,
+			"token_id":   uuid.New().String(),
+			"expires_at": time.Now().Add(time.Hour).Unix(),
+		}, jwt.SigningMethodHS512)
+		_, _, ok := svc.ValidateAccessToken(tok)
+		assert.False(t, ok)
+	})
+}
+
+func TestValidateAccessToken_LegacyMigrationWindow(t *testing.T) {
+	trepo := new(MockTokenRepo)
+	urepo := new(MockUserRepo)
+
+	userID := uuid.New().String()
+	urepo.On("FindByID", userID).Return(&model.User{ID: userID}, nil)
+	trepo.On("CreateRefreshToken", mock.AnythingOfType("*model.RefreshToken")).Return(nil)
+	trepo.On("IsAccessTokenRevoked", mock.Anything).Return(false, nil)
+
+	svc := service.NewAuthService(urepo, trepo, "secret", time.Minute*15, time.Hour*24, service.WithLegacyClaims(true))
+
+	legacy, err := jwt.NewWithClaims(jwt.SigningMethodHS512, jwt.MapClaims{
+		"user_id":    userID,
+		"token_id":   uuid.New().String(),
+		"expires_at": time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte("secret"))
+	assert.NoError(t, err)
+
+	u, _, ok := svc.ValidateAccessToken(legacy)
+	assert.True(t, ok, "legacy claims must be accepted during the migration window")
+	assert.Equal(t, userID, u.ID)
+
+	noExpiry, _ := jwt.NewWithClaims(jwt.SigningMethodHS512, jwt.MapClaims{
+		"user_id": userID,
+	}).SignedString([]byte("secret"))
+	assert.NotPanics(t, func() {
+		_, _, ok = svc.ValidateAccessToken(noExpiry)
+	})
+	assert.False(t, ok)
+
+	tokens, err := svc.GenerateTokens(userID, model.ClientInfo{})
+	assert.NoError(t, err)
+	parsed, _, err := jwt.NewParser().ParseUnverified(tokens.AccessToken, jwt.MapClaims{})
+	assert.NoError(t, err)
+	claims := parsed.Claims.(jwt.MapClaims)
+	assert.Equal(t, userID, claims["sub"])
+	assert.Equal(t, userID, claims["user_id"], "new tokens carry both shapes during the window")
+}
+
+func TestRoles(t *testing.T) {
+	trepo := new(MockTokenRepo)
+	urepo := new(MockUserRepo)
+
+	admin := &model.User{ID: uuid.New().String(), Roles: []string{model.RoleAdmin, model.RoleMember}}
+	member := &model.User{ID: uuid.New().String(), Roles: []string{model.RoleMember}}
+	urepo.On("FindByID", admin.ID).Return(admin, nil)
+	urepo.On("FindByID", member.ID).Return(member, nil)
+	urepo.On("FindByID", mock.Anything).Return(nil, errors.New("not found"))
+	trepo.On("CreateRefreshToken", mock.AnythingOfType("*model.RefreshToken")).Return(nil)
+	trepo.On("IsAccessTokenRevoked", mock.Anything).Return(false, nil)
+
+	svc := service.NewAuthService(urepo, trepo, "secret", time.Minute*15, time.Hour*24)
+
+	adminTokens, err := svc.GenerateTokens(admin.ID, model.ClientInfo{})
+	assert.NoError(t, err)
+	memberTokens, err := svc.GenerateTokens(member.ID, model.ClientInfo{})
+	assert.NoError(t, err)
+
+	t.Run("roles are embedded in claims", func(t *testing.T) {
+		parsed, _, err := jwt.NewParser().ParseUnverified(adminTokens.AccessToken, jwt.MapClaims{})
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, []interface{}{"admin", "member"}, parsed.Claims.(jwt.MapClaims)["roles"])
+	})
+
+	t.Run("member cannot grant", func(t *testing.T) {
+		_, err := svc.GrantRole(memberTokens.AccessToken, member.ID, model.RoleAdmin)
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+		urepo.AssertNotCalled(t, "AddRole", mock.Anything, mock.Anything)
+	})
+
+	t.Run("unknown role", func(t *testing.T) {
+		_, err := svc.GrantRole(adminTokens.AccessToken, member.ID, "superuser")
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("unknown user", func(t *testing.T) {
+		_, err := svc.GrantRole(adminTokens.AccessToken, uuid.New().String(), model.RoleOrganizer)
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	})
+
+	t.Run("admin grants and revokes", func(t *testing.T) {
+		urepo.On("AddRole", member.ID, model.RoleOrganizer).Return(nil)
+		urepo.On("RemoveRole", member.ID, model.RoleOrganizer).Return(nil)
+
+		_, err := svc.GrantRole(adminTokens.AccessToken, member.ID, model.RoleOrganizer)
+		assert.NoError(t, err)
+		_, err = svc.RevokeRole(adminTokens.AccessToken, member.ID, model.RoleOrganizer)
+		assert.NoError(t, err)
+
+		urepo.AssertCalled(t, "AddRole", member.ID, model.RoleOrganizer)
+		urepo.AssertCalled(t, "RemoveRole", member.ID, model.RoleOrganizer)
+	})
+
+	t.Run("admin cannot drop own admin role", func(t *testing.T) {
+		_, err := svc.RevokeRole(adminTokens.AccessToken, admin.ID, model.RoleAdmin)
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	})
+}
+
+func TestLogin_RehashesLegacyBcrypt(t *testing.T) {
+	urepo := new(MockUserRepo)
+	hasher, err := password.NewHasher(password.AlgArgon2id, password.Argon2Params{Memory: 1024, Iterations: 1, Parallelism: 1}, 0)
+	require.NoError(t, err)
+	svc := service.NewAuthService(urepo, new(MockTokenRepo), "secret", time.Minute*15, time.Hour*24,
+		service.WithPasswordHasher(hasher),
+	)
+
+	legacy, err := bcrypt.GenerateFromPassword([]byte("correct"), bcrypt.MinCost)
+	require.NoError(t, err)
+	user := &model.User{ID: uuid.New().String(), Email: "reader@example.com", PasswordHash: string(legacy)}
+	urepo.On("FindByEmail", user.Email).Return(user, nil)
+
+	var stored string
+	urepo.On("UpdatePassword", user.ID, mock.AnythingOfType("string")).
+		Run(func(args mock.Arguments) { stored = args.String(1) }).
+		Return(nil).Once()
+
+	_, err = svc.Login(user.Email, "correct", model.ClientInfo{})
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(stored, "$argon2id$"), stored)
+
+	ok, rehash, err := hasher.Verify("correct", stored)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.False(t, rehash)
+
+	// The upgraded hash is current, so the next login leaves it alone.
+	_, err = svc.Login(user.Email, "correct", model.ClientInfo{})
+	require.NoError(t, err)
+	urepo.AssertNumberOfCalls(t, "UpdatePassword", 1)
+}
+
+func TestLogin_WrongPasswordDoesNotRehash(t *testing.T) {
+	urepo := new(MockUserRepo)
+	svc := service.NewAuthService(urepo, new(MockTokenRepo), "secret", time.Minute*15, time.Hour*24)
+
+	legacy, err := bcrypt.GenerateFromPassword([]byte("correct"), bcrypt.MinCost)
+	require.NoError(t, err)
+	user := &model.User{ID: uuid.New().String(), Email: "reader@example.com", PasswordHash: string(legacy)}
+	urepo.On("FindByEmail", user.Email).Return(user, nil)
+
+	_, err = svc.Login(user.Email, "wrong", model.ClientInfo{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	urepo.AssertNotCalled(t, "UpdatePassword", mock.Anything, mock.Anything)
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/mail"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/model"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const verificationBody = `Welcome to the reading club, %s!
+
+Please confirm your email address by opening the link below. It expires in %s.
+
+%s
+`
+
+const emailChangeBody = `Hello %s,
+
+you changed the email address of your reading club account to this one.
+Please confirm it by opening the link below. It expires in %s.
+
+%s
+`
+
+func (s *AuthService) emailVerificationEnabled() bool {
+	return s.actionRepo != nil && s.mailer != nil && s.verificationURL != ""
+}
+
+// sendVerificationEmail mails a verification link to user.Email. body is
+// formatted with the user name, the link lifetime and the link.
+func (s *AuthService) sendVerificationEmail(user *model.User, body string) error {
+	token, err := s.createActionToken(user.ID, model.ActionEmailVerification, s.verificationTTL)
+	if err != nil {
+		return fmt.Errorf("failed to create verification token: %w", err)
+	}
+	link, err := actionLink(s.verificationURL, token)
+	if err != nil {
+		return err
+	}
+
+	err = s.mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Confirm your email address",
+		Body:    fmt.Sprintf(body, user.UserName, s.verificationTTL, link),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send verification mail: %w", err)
+	}
+	return nil
+}
+
+// VerifyEmail marks the address of the token owner as verified. Access
+// tokens issued before carry email_verified=false until they are refreshed.
+func (s *AuthService) VerifyEmail(token string) (*model.User, error) {
+	if !s.emailVerificationEnabled() {
+		return nil, status.Error(codes.Unimplemented, "email verification is not configured")
+	}
+
+	t, err := s.consumeActionToken(model.ActionEmailVerification, token)
+	if err != nil {
+		log.Printf("Rejected email verification token: %v", err)
+		return nil, status.Error(codes.InvalidArgument, "invalid or expired verification token")
+	}
+
+	if err := s.userRepo.MarkEmailVerified(t.UserID); err != nil {
+		return nil, fmt.Errorf("failed to verify email: %w", err)
+	}
+
+	s.audit(t.UserID, model.AuditEmailVerified)
+
+	return s.userRepo.FindByID(t.UserID)
+}
+
+// ResendVerificationEmail mails a new verification link to the caller. The
+// previous link stops working. Requests within the cooldown are refused.
+func (s *AuthService) ResendVerificationEmail(accessToken string) error {
+	if !s.emailVerificationEnabled() {
+		return status.Error(codes.Unimplemented, "email verification is not configured")
+	}
+
+	user, err := s.authenticate(accessToken)
+	if err != nil {
+		return err
+	}
+	if user.EmailVerified {
+		return status.Error(codes.FailedPrecondition, "email address is already verified")
+	}
+
+	last, err := s.actionRepo.LastActionTokenAt(user.ID, model.ActionEmailVerification)
+	if err != nil {
+		return fmt.Errorf("failed to check verification cooldown: %w", err)
+	}
+	if wait := s.verificationCooldown - time.Since(last); wait > 0 {
+		return retryLater("verification email was sent recently", wait)
+	}
+
+	return s.sendVerificationEmail(user, verificationBody)
+}
@@ -0,0 +1,106 @@
+package service_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/model"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var withEmailVerification = service.WithEmailVerification(24*time.Hour, "https://club.example.com/verify-email", time.Minute)
+
+func TestRegisterUser_InvalidEmail(t *testing.T) {
+	urepo := new(MockUserRepo)
+	svc := service.NewAuthService(urepo, new(MockTokenRepo), "secret", time.Minute*15, time.Hour*24)
+
+	for _, email := range []string{"", "not-an-email", "Reader <reader@example.com>", "reader@"} {
+		_, err := svc.RegisterUser("reader", email, "password", model.ClientInfo{})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), email)
+	}
+	urepo.AssertNotCalled(t, "CreateUser", mock.Anything)
+}
+
+func TestEmailVerification(t *testing.T) {
+	e := newTestService(withEmailVerification)
+	e.urepo.On("FindByEmail", "reader@example.com").Return(nil, assert.AnError)
+	e.urepo.On("CreateUser", mock.AnythingOfType("*model.User")).Return(nil)
+
+	var stored *model.ActionToken
+	e.actions.On("DeleteActionTokens", mock.Anything, model.ActionEmailVerification).Return(nil)
+	e.actions.On("CreateActionToken", mock.AnythingOfType("*model.ActionToken")).Run(func(args mock.Arguments) {
+		stored = args.Get(0).(*model.ActionToken)
+		stored.ID = uuid.New().String()
+		stored.CreatedAt = time.Now()
+	}).Return(nil)
+
+	registered, err := e.svc.RegisterUser("reader", "reader@example.com", "password", model.ClientInfo{})
+	require.NoError(t, err)
+	require.Len(t, e.mailer.sent, 1)
+	assert.Equal(t, "reader@example.com", e.mailer.sent[0].To)
+	assert.Equal(t, registered.ID, stored.UserID)
+
+	userID := registered.ID
+	access := e.signIn(t, registered)
+
+	t.Run("resend within cooldown", func(t *testing.T) {
+		e.actions.On("LastActionTokenAt", userID, model.ActionEmailVerification).Return(time.Now().Add(-10*time.Second), nil).Once()
+
+		err := e.svc.ResendVerificationEmail(access)
+		assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+		assert.Len(t, e.mailer.sent, 1)
+	})
+
+	t.Run("resend after cooldown", func(t *testing.T) {
+		e.actions.On("LastActionTokenAt", userID, model.ActionEmailVerification).Return(time.Now().Add(-2*time.Minute), nil).Once()
+
+		err := e.svc.ResendVerificationEmail(access)
+		require.NoError(t, err)
+		require.Len(t, e.mailer.sent, 2)
+	})
+
+	t.Run("verify", func(t *testing.T) {
+		token := tokenFromMail(t, e.mailer.sent[1])
+		selector, _, _ := strings.Cut(token, ".")
+		e.actions.On("FindActionToken", model.ActionEmailVerification, selector).Return(stored, nil)
+		e.actions.On("MarkActionTokenUsed", stored.ID).Return(true, nil)
+		e.urepo.On("MarkEmailVerified", userID).Return(nil)
+
+		user, err := e.svc.VerifyEmail(token)
+		require.NoError(t, err)
+		assert.Equal(t, userID, user.ID)
+		e.urepo.AssertCalled(t, "MarkEmailVerified", userID)
+	})
+
+	t.Run("verified users cannot resend", func(t *testing.T) {
+		registered.EmailVerified = true
+
+		err := e.svc.ResendVerificationEmail(access)
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	})
+}
+
+func TestGenerateTokens_EmailVerifiedClaim(t *testing.T) {
+	urepo := new(MockUserRepo)
+	trepo := new(MockTokenRepo)
+	userID := uuid.New().String()
+
+	urepo.On("FindByID", userID).Return(&model.User{ID: userID, EmailVerified: true}, nil)
+	trepo.On("CreateRefreshToken", mock.AnythingOfType("*model.RefreshToken")).Return(nil)
+
+	svc := service.NewAuthService(urepo, trepo, "secret", time.Minute*15, time.Hour*24)
+	tokens, err := svc.GenerateTokens(userID, model.ClientInfo{})
+	require.NoError(t, err)
+
+	parsed, _, err := jwt.NewParser().ParseUnverified(tokens.AccessToken, jwt.MapClaims{})
+	require.NoError(t, err)
+	assert.Equal(t, true, parsed.Claims.(jwt.MapClaims)["email_verified"])
+}
@@ -0,0 +1,225 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/model"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/oidc"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/validation"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxUserNameAttempts bounds how often a new federated user gets another
+// random suffix when the derived user name is taken.
+const maxUserNameAttempts = 5
+
+func (s *AuthService) federationConfigured() bool {
+	return s.identityRepo != nil && len(s.identityProviders) > 0
+}
+
+func (s *AuthService) identityProvider(id string) (*oidc.Provider, error) {
+	if !s.federationConfigured() {
+		return nil, status.Error(codes.Unimplemented, "federated login is not configured")
+	}
+	for _, p := range s.identityProviders {
+		if p.ID() == id {
+			return p, nil
+		}
+	}
+	return nil, status.Error(codes.NotFound, "unknown identity provider")
+}
+
+// IdentityProviders returns the configured upstream providers in the order
+// of the configuration.
+func (s *AuthService) IdentityProviders() []*oidc.Provider {
+	if !s.federationConfigured() {
+		return nil
+	}
+	return s.identityProviders
+}
+
+// StartFederatedLogin returns the URL to send the user agent to and the state
+// the provider will send back with it. The state is only good for one
+// CompleteFederatedLogin; the caller should bind it to the user agent, e.g.
+// with a cookie.
+func (s *AuthService) StartFederatedLogin(ctx context.Context, providerID string) (authURL, state string, err error) {
+	provider, err := s.identityProvider(providerID)
+	if err != nil {
+		return "", "", err
+	}
+
+	state, selector, stateHash, err := generateSplitToken()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate login state: %w", err)
+	}
+	nonce, err := randomString(16)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	codeVerifier, err := randomString(32)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate code verifier: %w", err)
+	}
+
+	authURL, err = provider.AuthCodeURL(ctx, state, nonce, pkceChallenge(codeVerifier))
+	if err != nil {
+		log.Printf("Identity provider %s unavailable: %v", providerID, err)
+		return "", "", status.Error(codes.Unavailable, "identity provider unavailable")
+	}
+
+	if err := s.identityRepo.CreateLoginState(&model.FederatedLoginState{
+		Selector:     selector,
+		StateHash:    stateHash,
+		Provider:     providerID,
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		ExpiresAt:    time.Now().Add(s.federationStateTTL),
+	}); err != nil {
+		return "", "", fmt.Errorf("failed to store login state: %w", err)
+	}
+
+	return authURL, state, nil
+}
+
+// CompleteFederatedLogin redeems the code the provider sent back with state
+// and returns the user it belongs to. Unknown accounts are linked to the
+// user with the same email if both sides verified it, otherwise a new user
+// without a password is created; such users can set one through the
+// password reset.
+func (s *AuthService) CompleteFederatedLogin(ctx context.Context, providerID, state, code string) (*model.User, error) {
+	provider, err := s.identityProvider(providerID)
+	if err != nil {
+		return nil, err
+	}
+
+	selector, verifier, ok := parseSplitToken(state)
+	if !ok || code == "" {
+		return nil, status.Error(codes.InvalidArgument, "invalid login state")
+	}
+	loginState, err := s.identityRepo.ConsumeLoginState(selector)
+	if err != nil || !verifierMatches(verifier, loginState.StateHash) || loginState.Provider != providerID {
+		return nil, status.Error(codes.InvalidArgument, "invalid or expired login state")
+	}
+
+	claims, err := provider.Exchange(ctx, code, loginState.CodeVerifier, loginState.Nonce)
+	if err != nil {
+		log.Printf("Federated login with %s failed: %v", providerID, err)
+		return nil, status.Error(codes.Unauthenticated, "login with identity provider failed")
+	}
+
+	user, err := s.federatedUser(providerID, claims)
+	if err != nil {
+		return nil, err
+	}
+	s.audit(user.ID, model.AuditFederatedLogin)
+	return user, nil
+}
+
+func (s *AuthService) federatedUser(providerID string, claims *oidc.Claims) (*model.User, error) {
+	identity, err := s.identityRepo.FindIdentity(providerID, claims.Subject)
+	if err == nil {
+		if err := s.identityRepo.TouchIdentity(providerID, claims.Subject, claims.Email); err != nil {
+			log.Printf("Failed to update identity of user %s: %v", identity.UserID, err)
+		}
+		return s.userRepo.FindByID(identity.UserID)
+	}
+	if !errors.Is(err, model.ErrIdentityNotFound) {
+		return nil, fmt.Errorf("failed to find identity: %w", err)
+	}
+
+	email, violations := validation.NormalizeEmail("email", claims.Email)
+	if len(violations) > 0 {
+		return nil, status.Error(codes.FailedPrecondition, "identity provider did not share a valid email address")
+	}
+
+	user, err := s.userRepo.FindByEmail(email)
+	if err == nil {
+		// Linking hands the account to whoever controls the upstream
+		// identity, so both sides must have proven they own the address.
+		if !claims.EmailVerified || !user.EmailVerified {
+			return nil, status.Error(codes.FailedPrecondition,
+				"an account with this email already exists; sign in with your password and verify your email first")
+		}
+	} else {
+		user, err = s.createFederatedUser(claims, email)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.identityRepo.CreateIdentity(&model.Identity{
+		Provider: providerID,
+		Subject:  claims.Subject,
+		UserID:   user.ID,
+		Email:    email,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to link identity: %w", err)
+	}
+	s.audit(user.ID, model.AuditIdentityLinked)
+	return user, nil
+}
+
+func (s *AuthService) createFederatedUser(claims *oidc.Claims, email string) (*model.User, error) {
+	base := s.federatedUserName(claims, email)
+	name := base
+	for attempt := 1; ; attempt++ {
+		user, err := s.userRepo.CreateUser(&model.User{UserName: name, Email: email})
+		if err == nil {
+			if claims.EmailVerified {
+				if err := s.userRepo.MarkEmailVerified(user.ID); err != nil {
+					return nil, fmt.Errorf("failed to mark email verified: %w", err)
+				}
+				user.EmailVerified = true
+			} else if s.emailVerificationEnabled() {
+				if err := s.sendVerificationEmail(user, verificationBody); err != nil {
+					log.Printf("Failed to send verification email to user %s: %v", user.ID, err)
+				}
+			}
+			return user, nil
+		}
+		if !errors.Is(err, model.ErrUserNameTaken) || attempt == maxUserNameAttempts {
+			if conflict := conflictError(err); conflict != nil {
+				return nil, conflict
+			}
+			return nil, fmt.Errorf("failed to create user: %w", err)
+		}
+
+		suffix, err := randomString(3)
+		if err != nil {
+			return nil, err
+		}
+		name = base + "-" + suffix
+	}
+}
+
+// federatedUserName derives a user name that passes the policy from the
+// preferred username or the local part of the email, leaving room for the
+// suffix createFederatedUser may append.
+func (s *AuthService) federatedUserName(claims *oidc.Claims, email string) string {
+	candidate := claims.PreferredUsername
+	if candidate == "" {
+		candidate, _, _ = strings.Cut(email, "@")
+	}
+
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '_', r == '-':
+			return r
+		}
+		return -1
+	}, candidate)
+	name = strings.TrimLeft(name, "._-")
+	if max := s.policy.UsernameMaxLength - 5; max > 0 && len(name) > max {
+		name = name[:max]
+	}
+	if len(s.policy.CheckUsername("user_name", name)) > 0 {
+		return "user"
+	}
+	return name
+}
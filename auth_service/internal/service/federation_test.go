@@ -0,0 +1,216 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/model"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/oidc"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/oidc/oidctest"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type MockIdentityRepo struct {
+	mock.Mock
+}
+
+func (m *MockIdentityRepo) FindIdentity(provider, subject string) (*model.Identity, error) {
+	args := m.Called(provider, subject)
+	if args.Get(0) != nil {
+		return args.Get(0).(*model.Identity), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockIdentityRepo) CreateIdentity(i *model.Identity) error {
+	args := m.Called(i)
+	return args.Error(0)
+}
+
+func (m *MockIdentityRepo) TouchIdentity(provider, subject, email string) error {
+	args := m.Called(provider, subject, email)
+	return args.Error(0)
+}
+
+func (m *MockIdentityRepo) CreateLoginState(s *model.FederatedLoginState) error {
+	args := m.Called(s)
+	return args.Error(0)
+}
+
+func (m *MockIdentityRepo) ConsumeLoginState(selector string) (*model.FederatedLoginState, error) {
+	args := m.Called(selector)
+	if args.Get(0) != nil {
+		return args.Get(0).(*model.FederatedLoginState), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+type federationFixture struct {
+	*testEnv
+	idp   *oidctest.Server
+	irepo *MockIdentityRepo
+}
+
+func newFederationFixture(t *testing.T) *federationFixture {
+	idp := oidctest.NewServer(t)
+	provider := oidc.New(oidc.Config{
+		ID:           "test",
+		Name:         "Test IdP",
+		IssuerURL:    idp.URL,
+		ClientID:     oidctest.ClientID,
+		ClientSecret: oidctest.ClientSecret,
+		RedirectURL:  "https://club.example.com/auth/oidc/test/callback",
+		Scopes:       []string{"email", "profile"},
+	}, idp.Client())
+
+	irepo := new(MockIdentityRepo)
+	e := newTestService(service.WithFederation(irepo, 10*time.Minute, provider))
+
+	// Pending logins are kept like the repository does: consuming one
+	// removes it.
+	states := map[string]*model.FederatedLoginState{}
+	irepo.On("CreateLoginState", mock.AnythingOfType("*model.FederatedLoginState")).Return(nil).Run(func(args mock.Arguments) {
+		s := args.Get(0).(*model.FederatedLoginState)
+		states[s.Selector] = s
+	})
+	consume := irepo.On("ConsumeLoginState", mock.Anything)
+	consume.Run(func(args mock.Arguments) {
+		s, ok := states[args.String(0)]
+		if !ok {
+			consume.ReturnArguments = mock.Arguments{nil, errors.New("invalid login state")}
+			return
+		}
+		delete(states, s.Selector)
+		consume.ReturnArguments = mock.Arguments{s, nil}
+	})
+
+	return &federationFixture{testEnv: e, idp: idp, irepo: irepo}
+}
+
+// login runs a federated login for the current user of the fake IdP.
+func (f *federationFixture) login(t *testing.T) (*model.User, error) {
+	ctx := context.Background()
+	authURL, state, err := f.svc.StartFederatedLogin(ctx, "test")
+	require.NoError(t, err)
+
+	code, returnedState := f.idp.Authorize(t, authURL)
+	require.Equal(t, state, returnedState)
+	return f.svc.CompleteFederatedLogin(ctx, "test", returnedState, code)
+}
+
+func TestFederatedLogin_KnownIdentity(t *testing.T) {
+	f := newFederationFixture(t)
+	f.idp.SetUser(oidctest.User{Subject: "42", Email: "reader@example.com", EmailVerified: true})
+
+	user := &model.User{ID: uuid.New().String(), UserName: "reader", Email: "reader@example.com"}
+	f.irepo.On("FindIdentity", "test", "42").Return(&model.Identity{Provider: "test", Subject: "42", UserID: user.ID}, nil)
+	f.irepo.On("TouchIdentity", "test", "42", "reader@example.com").Return(nil)
+	f.urepo.On("FindByID", user.ID).Return(user, nil)
+
+	got, err := f.login(t)
+	require.NoError(t, err)
+	assert.Equal(t, user, got)
+	f.irepo.AssertNotCalled(t, "CreateIdentity", mock.Anything)
+}
+
+func TestFederatedLogin_NewUser(t *testing.T) {
+	f := newFederationFixture(t)
+	f.idp.SetUser(oidctest.User{Subject: "42", Email: "Reader@Example.com", EmailVerified: true, PreferredUsername: "avid reader!"})
+
+	f.irepo.On("FindIdentity", "test", "42").Return(nil, model.ErrIdentityNotFound)
+	f.urepo.On("FindByEmail", "reader@example.com").Return(nil, errors.New("not found"))
+	f.urepo.On("CreateUser", mock.MatchedBy(func(u *model.User) bool {
+		return u.UserName == "avidreader"
+	})).Return(model.ErrUserNameTaken).Once()
+	f.urepo.On("CreateUser", mock.MatchedBy(func(u *model.User) bool {
+		return len(u.UserName) == len("avidreader-xxxx") && u.PasswordHash == "" && u.Email == "reader@example.com"
+	})).Return(nil).Once()
+	f.urepo.On("MarkEmailVerified", mock.Anything).Return(nil)
+	f.irepo.On("CreateIdentity", mock.MatchedBy(func(i *model.Identity) bool {
+		return i.Provider == "test" && i.Subject == "42" && i.UserID != ""
+	})).Return(nil)
+
+	user, err := f.login(t)
+	require.NoError(t, err)
+	assert.True(t, user.EmailVerified)
+	f.urepo.AssertExpectations(t)
+	f.irepo.AssertExpectations(t)
+}
+
+func TestFederatedLogin_LinksExistingEmail(t *testing.T) {
+	tests := []struct {
+		name          string
+		idpVerified   bool
+		localVerified bool
+		linked        bool
+	}{
+		{"both verified", true, true, true},
+		{"unverified upstream", false, true, false},
+		{"unverified locally", true, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFederationFixture(t)
+			f.idp.SetUser(oidctest.User{Subject: "42", Email: "reader@example.com", EmailVerified: tt.idpVerified})
+
+			user := &model.User{ID: uuid.New().String(), UserName: "reader", Email: "reader@example.com", EmailVerified: tt.localVerified}
+			f.irepo.On("FindIdentity", "test", "42").Return(nil, model.ErrIdentityNotFound)
+			f.urepo.On("FindByEmail", "reader@example.com").Return(user, nil)
+			f.irepo.On("CreateIdentity", mock.MatchedBy(func(i *model.Identity) bool {
+				return i.UserID == user.ID
+			})).Return(nil)
+
+			got, err := f.login(t)
+			if tt.linked {
+				require.NoError(t, err)
+				assert.Equal(t, user, got)
+				f.irepo.AssertCalled(t, "CreateIdentity", mock.Anything)
+				return
+			}
+			assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+			f.irepo.AssertNotCalled(t, "CreateIdentity", mock.Anything)
+			f.urepo.AssertNotCalled(t, "CreateUser", mock.Anything)
+		})
+	}
+}
+
+func TestFederatedLogin_State(t *testing.T) {
+	f := newFederationFixture(t)
+	f.idp.SetUser(oidctest.User{Subject: "42"})
+	ctx := context.Background()
+
+	authURL, state, err := f.svc.StartFederatedLogin(ctx, "test")
+	require.NoError(t, err)
+	code, _ := f.idp.Authorize(t, authURL)
+
+	t.Run("unknown provider", func(t *testing.T) {
+		_, err := f.svc.CompleteFederatedLogin(ctx, "other", state, code)
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	})
+
+	t.Run("forged verifier", func(t *testing.T) {
+		_, err := f.svc.CompleteFederatedLogin(ctx, "test", state+"x", code)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("state is consumed", func(t *testing.T) {
+		_, err := f.svc.CompleteFederatedLogin(ctx, "test", state, code)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+}
+
+func TestFederatedLogin_NotConfigured(t *testing.T) {
+	e := newTestService()
+
+	_, _, err := e.svc.StartFederatedLogin(context.Background(), "test")
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/model"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const defaultImpersonationTTL = 10 * time.Minute
+
+// Impersonation is an access token that lets the admin ActorID act as the
+// user UserID.
+type Impersonation struct {
+	AccessToken string
+	ExpiresAt   time.Time
+	UserID      string
+	ActorID     string
+}
+
+// Impersonate lets support staff see the app as userID. The access token it
+// issues names the calling admin in its act claim (RFC 8693 section 4.1). It
+// expires after the impersonation TTL and comes without a refresh token, so
+// it cannot be renewed. reason is kept in the audit log.
+func (s *AuthService) Impersonate(accessToken, userID, reason string, client model.ClientInfo) (*Impersonation, error) {
+	caller, user, err := s.managedUser(accessToken, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	reason = strings.TrimSpace(reason)
+	switch {
+	case reason == "":
+		return nil, status.Error(codes.InvalidArgument, "a reason is required")
+	case caller.ID == user.ID:
+		return nil, status.Error(codes.FailedPrecondition, "admins cannot impersonate themselves")
+	case user.HasRole(model.RoleAdmin):
+		return nil, status.Error(codes.PermissionDenied, "admins cannot be impersonated")
+	}
+	if err := checkNotSuspended(user); err != nil {
+		return nil, err
+	}
+
+	ttl := min(s.impersonationTTL, s.accessTTL)
+	claims := s.newAccessClaims(user.ID, user.Roles, user.EmailVerified, uuid.New().String())
+	expiresAt := claims.IssuedAt.Add(ttl)
+	claims.ExpiresAt = jwt.NewNumericDate(expiresAt)
+	if claims.LegacyExpiresAt != 0 {
+		claims.LegacyExpiresAt = expiresAt.Unix()
+	}
+	claims.Act = &actor{Subject: caller.ID}
+
+	token, err := s.signToken(claims)
+	if err != nil {
+		log.Printf("Error signing impersonation token for user %s: %v", user.ID, err)
+		return nil, err
+	}
+
+	s.recordAudit(&model.AuditEvent{
+		UserID:    user.ID,
+		ActorID:   caller.ID,
+		EventType: model.AuditImpersonationStarted,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+		Details:   "reason=" + reason,
+	})
+	log.Printf("Admin %s impersonates user %s until %s", caller.ID, user.ID, expiresAt.Format(time.RFC3339))
+
+	return &Impersonation{
+		AccessToken: token,
+		ExpiresAt:   expiresAt,
+		UserID:      user.ID,
+		ActorID:     caller.ID,
+	}, nil
+}
+
+// canImpersonate checks the actor of an impersonation token on every use, so
+// the token stops working as soon as the admin loses the role.
+func (s *AuthService) canImpersonate(actorID string) bool {
+	admin, err := s.userRepo.FindByID(actorID)
+	return err == nil && !admin.Suspended() && admin.HasRole(model.RoleAdmin)
+}
+
+// authenticateOwner is authenticate for operations only the account owner
+// may perform, like changing credentials or deleting the account. It refuses
+// impersonation tokens and records the attempt; operation names it in the
+// audit log.
+func (s *AuthService) authenticateOwner(accessToken, operation string) (*model.User, error) {
+	user, claims, err := s.authenticateClaims(accessToken)
+	if err != nil {
+		return nil, err
+	}
+	if claims.ActorID != "" {
+		s.recordAudit(&model.AuditEvent{
+			UserID:    user.ID,
+			ActorID:   claims.ActorID,
+			EventType: model.AuditImpersonationRefused,
+			Outcome:   model.AuditOutcomeFailure,
+			Details:   "operation=" + operation,
+		})
+		return nil, status.Error(codes.PermissionDenied, "not allowed while impersonating")
+	}
+	return user, nil
+}
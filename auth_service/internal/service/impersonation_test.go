@@ -0,0 +1,97 @@
+package service_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/model"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestImpersonate(t *testing.T) {
+	f := newAdminFixture(t, service.WithImpersonationTTL(5*time.Minute))
+	client := model.ClientInfo{IP: "203.0.113.7", UserAgent: "curl/8.0"}
+
+	t.Run("refused", func(t *testing.T) {
+		other := &model.User{ID: uuid.New().String(), Roles: []string{model.RoleAdmin}}
+		f.urepo.On("FindByID", other.ID).Return(other, nil)
+
+		for name, tc := range map[string]struct {
+			token, userID, reason string
+			code                  codes.Code
+		}{
+			"members":      {f.memberToken, f.admin.ID, "debugging", codes.PermissionDenied},
+			"no reason":    {f.adminToken, f.member.ID, "  ", codes.InvalidArgument},
+			"themselves":   {f.adminToken, f.admin.ID, "debugging", codes.FailedPrecondition},
+			"other admins": {f.adminToken, other.ID, "debugging", codes.PermissionDenied},
+		} {
+			_, err := f.svc.Impersonate(tc.token, tc.userID, tc.reason, client)
+			assert.Equal(t, tc.code, status.Code(err), name)
+		}
+	})
+
+	imp, err := f.svc.Impersonate(f.adminToken, f.member.ID, " ticket 42 ", client)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(5*time.Minute), imp.ExpiresAt, time.Minute)
+	assert.Equal(t, f.admin.ID, imp.ActorID)
+	f.trepo.AssertNumberOfCalls(t, "CreateRefreshToken", 2) // only the fixture logins
+	f.arepo.AssertCalled(t, "CreateAuditEvent", &model.AuditEvent{
+		UserID:    f.member.ID,
+		ActorID:   f.admin.ID,
+		EventType: model.AuditImpersonationStarted,
+		Outcome:   model.AuditOutcomeSuccess,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+		Details:   "reason=ticket 42",
+	})
+
+	t.Run("acts as the user", func(t *testing.T) {
+		user, info, ok := f.svc.InspectAccessToken(imp.AccessToken)
+		require.True(t, ok)
+		assert.Equal(t, f.member.ID, user.ID)
+		assert.Equal(t, f.admin.ID, info.ActorID)
+	})
+
+	t.Run("actions are attributed to the admin", func(t *testing.T) {
+		name := "Reader"
+		f.urepo.On("UpdateProfile", f.member.ID, mock.Anything).Return(nil).Once()
+
+		_, err := f.svc.UpdateProfile(imp.AccessToken, model.ProfileUpdate{DisplayName: &name})
+		require.NoError(t, err)
+		f.arepo.AssertCalled(t, "CreateAuditEvent", &model.AuditEvent{
+			UserID:    f.member.ID,
+			ActorID:   f.admin.ID,
+			EventType: model.AuditProfileUpdated,
+			Outcome:   model.AuditOutcomeSuccess,
+		})
+	})
+
+	t.Run("sensitive operations are refused", func(t *testing.T) {
+		_, _, err := f.svc.ChangePassword(imp.AccessToken, "current", "new-password", client)
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+		err = f.svc.DeleteAccount(imp.AccessToken, "current")
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+		f.arepo.AssertCalled(t, "CreateAuditEvent", &model.AuditEvent{
+			UserID:    f.member.ID,
+			ActorID:   f.admin.ID,
+			EventType: model.AuditImpersonationRefused,
+			Outcome:   model.AuditOutcomeFailure,
+			Details:   "operation=change_password",
+		})
+		f.urepo.AssertNotCalled(t, "UpdatePassword", mock.Anything, mock.Anything)
+		f.urepo.AssertNotCalled(t, "DeleteUser", mock.Anything)
+	})
+
+	t.Run("ends when the admin loses the role", func(t *testing.T) {
+		f.admin.Roles = []string{model.RoleMember}
+		_, _, ok := f.svc.ValidateAccessToken(imp.AccessToken)
+		assert.False(t, ok)
+	})
+}
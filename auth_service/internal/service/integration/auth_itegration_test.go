@@ -10,6 +10,7 @@ import (
 	"time"
 
 	_ "github.com/lib/pq"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/model"
 	"github.com/polyakovaa/grpcproxy/auth_service/internal/repository"
 	"github.com/polyakovaa/grpcproxy/auth_service/internal/service"
 	"github.com/stretchr/testify/assert"
@@ -85,16 +86,165 @@ func setupTestDBContainers(t *testing.T) *sql.DB {
 			user_name  TEXT NOT NULL UNIQUE,
 			email  TEXT NOT NULL UNIQUE,
 			password_hash  TEXT NOT NULL,
-			created_at TIMESTAMP DEFAULT NOW()
+			display_name TEXT NOT NULL DEFAULT '',
+			bio TEXT NOT NULL DEFAULT '',
+			email_verified BOOLEAN NOT NULL DEFAULT FALSE,
+			created_at TIMESTAMP DEFAULT NOW(),
+			suspended_at TIMESTAMP
 		);
 
 		CREATE TABLE IF NOT EXISTS refresh_tokens(
 			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
 			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			family_id UUID,
+			selector TEXT UNIQUE,
 			token_hash TEXT NOT NULL,
 			access_token_id TEXT NOT NULL,
+			expires_at TIMESTAMP NOT NULL,
+			rotated_at TIMESTAMP,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			last_used_at TIMESTAMP,
+			user_agent TEXT NOT NULL DEFAULT '',
+			ip TEXT NOT NULL DEFAULT ''
+		);
+
+		CREATE INDEX IF NOT EXISTS refresh_tokens_user_id_idx ON refresh_tokens(user_id);
+
+		CREATE TABLE IF NOT EXISTS revoked_access_tokens(
+			token_id TEXT PRIMARY KEY,
 			expires_at TIMESTAMP NOT NULL
-		);`)
+		);
+
+		CREATE INDEX IF NOT EXISTS revoked_access_tokens_expires_at_idx ON revoked_access_tokens(expires_at);
+
+		CREATE TABLE IF NOT EXISTS auth_audit(
+			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+			user_id UUID,
+			actor_id UUID,
+			event_type TEXT NOT NULL,
+			outcome TEXT NOT NULL DEFAULT 'success' CHECK (outcome IN ('success', 'failure')),
+			ip TEXT,
+			user_agent TEXT,
+			details TEXT,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW()
+		);
+
+		CREATE TABLE IF NOT EXISTS user_roles(
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			role TEXT NOT NULL CHECK (role IN ('member', 'organizer', 'admin')),
+			granted_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			PRIMARY KEY (user_id, role)
+		);
+
+		CREATE TABLE IF NOT EXISTS action_tokens(
+			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			purpose TEXT NOT NULL,
+			selector TEXT NOT NULL UNIQUE,
+			token_hash TEXT NOT NULL,
+			expires_at TIMESTAMP NOT NULL,
+			used_at TIMESTAMP,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW()
+		);
+
+		CREATE INDEX IF NOT EXISTS action_tokens_user_id_purpose_idx ON action_tokens(user_id, purpose);
+
+		CREATE TABLE IF NOT EXISTS login_failures(
+			key TEXT PRIMARY KEY,
+			failures INTEGER NOT NULL,
+			last_failure TIMESTAMP NOT NULL
+		);
+
+		CREATE TABLE IF NOT EXISTS user_totp(
+			user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+			secret TEXT NOT NULL,
+			confirmed_at TIMESTAMP,
+			last_used_step BIGINT,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW()
+		);
+
+		CREATE TABLE IF NOT EXISTS mfa_recovery_codes(
+			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			code_hash TEXT NOT NULL,
+			used_at TIMESTAMP,
+			UNIQUE (user_id, code_hash)
+		);
+
+		CREATE TABLE IF NOT EXISTS personal_access_tokens(
+			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			name TEXT NOT NULL,
+			scopes TEXT[] NOT NULL,
+			selector TEXT UNIQUE NOT NULL,
+			token_hash TEXT NOT NULL,
+			expires_at TIMESTAMP,
+			last_used_at TIMESTAMP,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW()
+		);
+
+		CREATE INDEX IF NOT EXISTS personal_access_tokens_user_id_idx ON personal_access_tokens(user_id);
+
+		CREATE TABLE IF NOT EXISTS oauth_clients(
+			id TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			secret_hash TEXT NOT NULL DEFAULT '',
+			redirect_uris TEXT[] NOT NULL,
+			scopes TEXT[] NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW()
+		);
+
+		CREATE TABLE IF NOT EXISTS oauth_consents(
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			client_id TEXT NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+			scopes TEXT[] NOT NULL,
+			granted_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			PRIMARY KEY (user_id, client_id)
+		);
+
+		CREATE TABLE IF NOT EXISTS oauth_authorization_codes(
+			id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			client_id TEXT NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+			selector TEXT UNIQUE NOT NULL,
+			code_hash TEXT NOT NULL,
+			redirect_uri TEXT NOT NULL,
+			scopes TEXT[] NOT NULL,
+			code_challenge TEXT NOT NULL,
+			nonce TEXT NOT NULL DEFAULT '',
+			expires_at TIMESTAMP NOT NULL,
+			used_at TIMESTAMP,
+			access_token_id TEXT,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW()
+		);
+
+		CREATE TABLE IF NOT EXISTS user_identities(
+			provider TEXT NOT NULL,
+			subject TEXT NOT NULL,
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			email TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			last_login_at TIMESTAMP,
+			PRIMARY KEY (provider, subject)
+		);
+
+		CREATE INDEX IF NOT EXISTS user_identities_user_id_idx ON user_identities(user_id);
+
+		CREATE TABLE IF NOT EXISTS federated_login_states(
+			selector TEXT PRIMARY KEY,
+			state_hash TEXT NOT NULL,
+			provider TEXT NOT NULL,
+			nonce TEXT NOT NULL,
+			code_verifier TEXT NOT NULL,
+			expires_at TIMESTAMP NOT NULL
+		);
+
+		CREATE INDEX IF NOT EXISTS auth_audit_created_at_idx ON auth_audit(created_at DESC, id DESC);
+		CREATE INDEX IF NOT EXISTS auth_audit_user_id_idx ON auth_audit(user_id, created_at DESC);
+
+		-- The audit log is append-only.
+		CREATE OR REPLACE RULE auth_audit_no_update AS ON UPDATE TO auth_audit DO INSTEAD NOTHING;
+		CREATE OR REPLACE RULE auth_audit_no_delete AS ON DELETE TO auth_audit DO INSTEAD NOTHING;`)
 
 	if err != nil {
 		t.Fatal(err)
@@ -120,24 +270,24 @@ func TestAuthService_RegisterAndLogin(t *testing.T) {
 		userName := "integr_test"
 		email := "user_test@example.com"
 		pass := "passwordhash123"
-		u, err := svc.RegisterUser(userName, email, pass)
+		u, err := svc.RegisterUser(userName, email, pass, model.ClientInfo{})
 		assert.NoError(t, err)
 		assert.NotNil(t, u)
 		assert.Equal(t, email, u.Email)
 		assert.Equal(t, userName, u.UserName)
 		assert.NotEmpty(t, u.ID)
 
-		_, err = svc.RegisterUser(userName, email, pass)
+		_, err = svc.RegisterUser(userName, email, pass, model.ClientInfo{})
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "already exists")
 
-		loggedInUser, err := svc.Login(email, pass)
+		loggedInUser, err := svc.Login(email, pass, model.ClientInfo{})
 		assert.NoError(t, err)
 		assert.NotNil(t, loggedInUser)
 		assert.Equal(t, u.ID, loggedInUser.ID)
 		assert.Equal(t, email, loggedInUser.Email)
 
-		_, err = svc.Login(email, "wrongpassword")
+		_, err = svc.Login(email, "wrongpassword", model.ClientInfo{})
 		assert.Error(t, err)
 
 	})
@@ -147,10 +297,10 @@ func TestAuthService_RegisterAndLogin(t *testing.T) {
 		email := "token_test@example.com"
 		pass := "passwordhash123"
 
-		user, err := svc.RegisterUser(userName, email, pass)
+		user, err := svc.RegisterUser(userName, email, pass, model.ClientInfo{})
 		require.NoError(t, err)
 
-		tokenPair, err := svc.GenerateTokens(user.ID)
+		tokenPair, err := svc.GenerateTokens(user.ID, model.ClientInfo{})
 		assert.NoError(t, err)
 		assert.NotEmpty(t, tokenPair.AccessToken)
 		assert.NotEmpty(t, tokenPair.RefreshToken)
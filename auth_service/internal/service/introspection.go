@@ -0,0 +1,150 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	tokenTypeAccessToken   = "access_token"
+	tokenTypeRefreshToken  = "refresh_token"
+	tokenTypePersonalToken = "personal_access_token"
+)
+
+// TokenIntrospection describes a token as in RFC 7662 section 2.2. Only
+// Active is set for tokens that are expired, revoked or unknown. Scopes is
+// empty for first-party tokens, which are not limited to scopes. ActorID is
+// the admin behind an impersonation token.
+type TokenIntrospection struct {
+	Active    bool
+	Subject   string
+	Username  string
+	ClientID  string
+	Scopes    []string
+	ExpiresAt *time.Time
+	TokenType string
+	ActorID   string
+}
+
+// isJWT tells access tokens apart from split tokens, which have a single
+// separator.
+func isJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// IntrospectToken reports whether token is active and whom it belongs to.
+// Resource servers call it with the credentials of a confidential client;
+// any token issued by the service can be introspected, whoever it was issued
+// to. The token_type_hint of RFC 7662 is not needed, as the token types can
+// be told apart by their format.
+func (s *AuthService) IntrospectToken(clientID, clientSecret, token string) (*TokenIntrospection, error) {
+	if !s.oauthConfigured() {
+		return nil, status.Error(codes.Unimplemented, "oauth is not configured")
+	}
+
+	client, err := s.authenticateClient(clientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+	if client.Public() {
+		return nil, oauthError(codes.Unauthenticated, OAuthInvalidClient, "public clients cannot introspect tokens")
+	}
+
+	switch {
+	case IsPersonalToken(token):
+		return s.introspectPersonalToken(token), nil
+	case isJWT(token):
+		return s.introspectAccessToken(token), nil
+	default:
+		return s.introspectRefreshToken(token), nil
+	}
+}
+
+func (s *AuthService) introspectAccessToken(token string) *TokenIntrospection {
+	user, info, ok := s.InspectAccessToken(token)
+	if !ok {
+		return &TokenIntrospection{}
+	}
+	return &TokenIntrospection{
+		Active:    true,
+		Subject:   user.ID,
+		Username:  user.UserName,
+		ClientID:  info.ClientID,
+		Scopes:    info.Scopes,
+		ExpiresAt: &info.ExpiresAt,
+		TokenType: tokenTypeAccessToken,
+		ActorID:   info.ActorID,
+	}
+}
+
+func (s *AuthService) introspectRefreshToken(token string) *TokenIntrospection {
+	if _, _, ok := parseSplitToken(token); !ok {
+		return &TokenIntrospection{}
+	}
+	rt, err := s.findRefreshToken(token)
+	if err != nil || rt.RotatedAt != nil || time.Now().After(rt.ExpiresAt) {
+		return &TokenIntrospection{}
+	}
+	user, err := s.userRepo.FindByID(rt.UserID)
+	if err != nil {
+		return &TokenIntrospection{}
+	}
+	return &TokenIntrospection{
+		Active:    true,
+		Subject:   user.ID,
+		Username:  user.UserName,
+		ExpiresAt: &rt.ExpiresAt,
+		TokenType: tokenTypeRefreshToken,
+	}
+}
+
+func (s *AuthService) introspectPersonalToken(token string) *TokenIntrospection {
+	user, pat, err := s.ValidatePersonalToken(token)
+	if err != nil || (pat.ExpiresAt != nil && time.Now().After(*pat.ExpiresAt)) {
+		return &TokenIntrospection{}
+	}
+	return &TokenIntrospection{
+		Active:    true,
+		Subject:   user.ID,
+		Username:  user.UserName,
+		Scopes:    pat.Scopes,
+		ExpiresAt: pat.ExpiresAt,
+		TokenType: tokenTypePersonalToken,
+	}
+}
+
+// RevokeToken revokes an access token the calling client obtained (RFC 7009).
+// Invalid and expired tokens are accepted silently, as the client has
+// nothing left to do about them. Refresh tokens and personal access tokens
+// are never issued to clients and cannot be revoked through this endpoint.
+func (s *AuthService) RevokeToken(clientID, clientSecret, token string) error {
+	if !s.oauthConfigured() {
+		return status.Error(codes.Unimplemented, "oauth is not configured")
+	}
+
+	client, err := s.authenticateClient(clientID, clientSecret)
+	if err != nil {
+		return err
+	}
+
+	if !isJWT(token) {
+		return oauthError(codes.InvalidArgument, OAuthUnsupportedTokenType, "only access tokens can be revoked")
+	}
+
+	claims, err := s.parseAccessToken(token)
+	if err != nil {
+		return nil
+	}
+	if claims.ClientID != client.ID {
+		return oauthError(codes.PermissionDenied, OAuthUnauthorizedClient, "the token was not issued to this client")
+	}
+
+	if err := s.revokeAccessToken(claims.TokenID); err != nil {
+		return fmt.Errorf("failed to revoke access token: %w", err)
+	}
+	return nil
+}
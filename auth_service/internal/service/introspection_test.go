@@ -0,0 +1,173 @@
+package service_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/model"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const clientSecret = "resource-server-secret"
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// confidentialClientToken makes the fixture client confidential and runs
+// the authorization code flow for it.
+func confidentialClientToken(t *testing.T, f *oauthFixture, scope string) string {
+	f.client.SecretHash = sha256Hex(clientSecret)
+	verifier, challenge := pkcePair(t)
+	req := service.AuthorizeRequest{
+		ResponseType:        "code",
+		ClientID:            f.client.ID,
+		RedirectURI:         f.client.RedirectURIs[0],
+		Scope:               scope,
+		CodeChallenge:       challenge,
+		CodeChallengeMethod: "S256",
+	}
+
+	var stored *model.AuthorizationCode
+	f.orepo.On("FindConsent", f.user.ID, f.client.ID).Return(nil, model.ErrConsentNotFound)
+	f.orepo.On("SaveConsent", mock.AnythingOfType("*model.OAuthConsent")).Return(nil)
+	f.orepo.On("CreateAuthorizationCode", mock.AnythingOfType("*model.AuthorizationCode")).Run(func(args mock.Arguments) {
+		stored = args.Get(0).(*model.AuthorizationCode)
+		stored.ID = uuid.New().String()
+	}).Return(nil)
+
+	redirect, err := f.svc.Authorize(f.access, req, true)
+	require.NoError(t, err)
+	u, err := url.Parse(redirect)
+	require.NoError(t, err)
+
+	f.orepo.On("FindAuthorizationCode", stored.Selector).Return(stored, nil)
+	f.orepo.On("MarkAuthorizationCodeUsed", stored.ID, mock.AnythingOfType("string")).Return(true, nil)
+
+	tokens, err := f.svc.ExchangeAuthorizationCode(service.TokenRequest{
+		GrantType:    "authorization_code",
+		Code:         u.Query().Get("code"),
+		RedirectURI:  req.RedirectURI,
+		ClientID:     f.client.ID,
+		ClientSecret: clientSecret,
+		CodeVerifier: verifier,
+	})
+	require.NoError(t, err)
+	return tokens.AccessToken
+}
+
+func TestIntrospectToken(t *testing.T) {
+	f := newOAuthFixture(t)
+	clientToken := confidentialClientToken(t, f, "openid events:read")
+
+	refreshTokens, err := f.svc.GenerateTokens(f.user.ID, model.ClientInfo{})
+	require.NoError(t, err)
+	selector, verifier, _ := strings.Cut(refreshTokens.RefreshToken, ".")
+	rt := &model.RefreshToken{
+		ID:        uuid.New().String(),
+		UserID:    f.user.ID,
+		Selector:  selector,
+		TokenHash: sha256Hex(verifier),
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+	f.trepo.On("FindBySelector", selector).Return(rt, nil)
+	f.trepo.On("FindBySelector", mock.Anything).Return(nil, assert.AnError)
+
+	t.Run("first-party access token", func(t *testing.T) {
+		got, err := f.svc.IntrospectToken(f.client.ID, clientSecret, f.access)
+		require.NoError(t, err)
+		assert.True(t, got.Active)
+		assert.Equal(t, f.user.ID, got.Subject)
+		assert.Empty(t, got.ClientID)
+		assert.Empty(t, got.Scopes)
+		assert.Equal(t, "access_token", got.TokenType)
+		assert.WithinDuration(t, time.Now().Add(15*time.Minute), *got.ExpiresAt, time.Minute)
+	})
+
+	t.Run("client access token", func(t *testing.T) {
+		got, err := f.svc.IntrospectToken(f.client.ID, clientSecret, clientToken)
+		require.NoError(t, err)
+		assert.True(t, got.Active)
+		assert.Equal(t, f.client.ID, got.ClientID)
+		assert.Equal(t, []string{"openid", "events:read"}, got.Scopes)
+	})
+
+	t.Run("refresh token", func(t *testing.T) {
+		got, err := f.svc.IntrospectToken(f.client.ID, clientSecret, refreshTokens.RefreshToken)
+		require.NoError(t, err)
+		assert.True(t, got.Active)
+		assert.Equal(t, f.user.ID, got.Subject)
+		assert.Equal(t, "refresh_token", got.TokenType)
+		assert.Equal(t, rt.ExpiresAt, *got.ExpiresAt)
+	})
+
+	t.Run("rotated refresh token", func(t *testing.T) {
+		now := time.Now()
+		rt.RotatedAt = &now
+		defer func() { rt.RotatedAt = nil }()
+
+		got, err := f.svc.IntrospectToken(f.client.ID, clientSecret, refreshTokens.RefreshToken)
+		require.NoError(t, err)
+		assert.Equal(t, &service.TokenIntrospection{}, got)
+	})
+
+	t.Run("unknown tokens are inactive", func(t *testing.T) {
+		for _, token := range []string{"", "garbage", "a.b", "a.b.c", service.PersonalTokenPrefix + "a.b"} {
+			got, err := f.svc.IntrospectToken(f.client.ID, clientSecret, token)
+			require.NoError(t, err)
+			assert.False(t, got.Active, token)
+		}
+	})
+
+	t.Run("wrong secret", func(t *testing.T) {
+		_, err := f.svc.IntrospectToken(f.client.ID, "guess", f.access)
+		assert.Equal(t, service.OAuthInvalidClient, oauthReason(t, err))
+	})
+
+	t.Run("public clients are rejected", func(t *testing.T) {
+		f.client.SecretHash = ""
+		defer func() { f.client.SecretHash = sha256Hex(clientSecret) }()
+
+		_, err := f.svc.IntrospectToken(f.client.ID, "", f.access)
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+		assert.Equal(t, service.OAuthInvalidClient, oauthReason(t, err))
+	})
+}
+
+func TestRevokeToken(t *testing.T) {
+	f := newOAuthFixture(t)
+	clientToken := confidentialClientToken(t, f, "openid")
+	f.trepo.On("RevokeAccessToken", mock.AnythingOfType("string"), mock.AnythingOfType("time.Time")).Return(nil)
+
+	t.Run("token of another client", func(t *testing.T) {
+		err := f.svc.RevokeToken(f.client.ID, clientSecret, f.access)
+		assert.Equal(t, service.OAuthUnauthorizedClient, oauthReason(t, err))
+		f.trepo.AssertNotCalled(t, "RevokeAccessToken", mock.Anything, mock.Anything)
+	})
+
+	t.Run("refresh token", func(t *testing.T) {
+		err := f.svc.RevokeToken(f.client.ID, clientSecret, "selector.verifier")
+		assert.Equal(t, service.OAuthUnsupportedTokenType, oauthReason(t, err))
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+		assert.NoError(t, f.svc.RevokeToken(f.client.ID, clientSecret, "a.b.c"))
+		f.trepo.AssertNotCalled(t, "RevokeAccessToken", mock.Anything, mock.Anything)
+	})
+
+	t.Run("own token", func(t *testing.T) {
+		require.NoError(t, f.svc.RevokeToken(f.client.ID, clientSecret, clientToken))
+		f.trepo.AssertNumberOfCalls(t, "RevokeAccessToken", 1)
+	})
+}
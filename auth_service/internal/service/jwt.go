@@ -0,0 +1,222 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/keys"
+)
+
+// accessClaims is the payload of an access token. The user_id, token_id and
+// expires_at claims are the pre-RFC 7519 shape; they are only written and
+// accepted while the legacy migration window is enabled.
+type accessClaims struct {
+	jwt.RegisteredClaims
+	Roles           []string `json:"roles,omitempty"`
+	EmailVerified   bool     `json:"email_verified"`
+	Scope           string   `json:"scope,omitempty"`
+	ClientID        string   `json:"client_id,omitempty"`
+	Act             *actor   `json:"act,omitempty"`
+	UserID          string   `json:"user_id,omitempty"`
+	TokenID         string   `json:"token_id,omitempty"`
+	LegacyExpiresAt int64    `json:"expires_at,omitempty"`
+}
+
+// actor is the act claim of RFC 8693 section 4.1. It names the admin who
+// acts as the subject of an impersonation token.
+type actor struct {
+	Subject string `json:"sub"`
+}
+
+// accessTokenClaims are the verified claims of an access token. ClientID and
+// Scopes are only set for tokens issued to OAuth clients, ActorID only for
+// impersonation tokens.
+type accessTokenClaims struct {
+	UserID    string
+	TokenID   string
+	ExpiresAt time.Time
+	ClientID  string
+	Scopes    []string
+	ActorID   string
+}
+
+func (s *AuthService) newAccessClaims(userID string, roles []string, emailVerified bool, accessID string) *accessClaims {
+	now := time.Now()
+	exp := now.Add(s.accessTTL)
+
+	claims := &accessClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.issuer,
+			Subject:   userID,
+			ExpiresAt: jwt.NewNumericDate(exp),
+			NotBefore: jwt.NewNumericDate(now),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        accessID,
+		},
+		Roles:         roles,
+		EmailVerified: emailVerified,
+	}
+	if s.audience != "" {
+		claims.Audience = jwt.ClaimStrings{s.audience}
+	}
+	if s.acceptLegacyClaims {
+		claims.UserID = userID
+		claims.TokenID = accessID
+		claims.LegacyExpiresAt = exp.Unix()
+	}
+
+	return claims
+}
+
+func (s *AuthService) signToken(claims jwt.Claims) (string, error) {
+	if s.keys == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS512, claims).SignedString([]byte(s.jwtSecret))
+	}
+
+	key := s.keys.Active()
+	token := jwt.NewWithClaims(key.SigningMethod(), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.Private)
+}
+
+// sharedSecretAccepted reports whether tokens signed with the shared secret
+// are valid. Once signing keys are configured that is only the case until
+// the end of the window set with WithSharedSecretUntil.
+func (s *AuthService) sharedSecretAccepted() bool {
+	if s.jwtSecret == "" {
+		return false
+	}
+	return s.keys == nil || time.Now().Before(s.secretAcceptedUntil)
+}
+
+// validMethods pins the accepted algorithms to the configured keys, so a
+// token cannot pick its own verification method through the alg header.
+func (s *AuthService) validMethods() []string {
+	var methods []string
+	if s.sharedSecretAccepted() {
+		methods = append(methods, jwt.SigningMethodHS512.Alg())
+	}
+	if s.keys != nil {
+		methods = append(methods, s.keys.Algorithms()...)
+	}
+	return methods
+}
+
+// verificationKey resolves the key for a token from its kid header. The
+// signing method of the token has to match the algorithm of that key.
+func (s *AuthService) verificationKey(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+		if !s.sharedSecretAccepted() {
+			return nil, errors.New("shared secret tokens are not accepted")
+		}
+		return []byte(s.jwtSecret), nil
+	}
+
+	if s.keys == nil {
+		return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	key, ok := s.keys.Get(kid)
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	if token.Method.Alg() != key.Algorithm {
+		return nil, fmt.Errorf("signing method %s does not match key %s", token.Method.Alg(), kid)
+	}
+	return key.Public, nil
+}
+
+// JWKS returns the public keys that access tokens may be signed with.
+func (s *AuthService) JWKS() []keys.JWK {
+	if s.keys == nil {
+		return nil
+	}
+	return s.keys.JWKS()
+}
+
+func (s *AuthService) strictParser() *jwt.Parser {
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(s.validMethods()),
+		jwt.WithLeeway(s.leeway),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	}
+	if s.issuer != "" {
+		opts = append(opts, jwt.WithIssuer(s.issuer))
+	}
+	if s.audience != "" {
+		opts = append(opts, jwt.WithAudience(s.audience))
+	}
+	return jwt.NewParser(opts...)
+}
+
+// parseAccessToken verifies tokenStr and returns its claims. For expired
+// tokens the claims are returned together with the error so callers can
+// report the expiry time.
+func (s *AuthService) parseAccessToken(tokenStr string) (*accessTokenClaims, error) {
+	claims := &accessClaims{}
+	_, err := s.strictParser().ParseWithClaims(tokenStr, claims, s.verificationKey)
+	if err == nil {
+		if claims.Subject == "" || claims.ID == "" {
+			return nil, errors.New("access token has no sub or jti")
+		}
+		parsed := &accessTokenClaims{
+			UserID:    claims.Subject,
+			TokenID:   claims.ID,
+			ExpiresAt: claims.ExpiresAt.Time,
+			ClientID:  claims.ClientID,
+			Scopes:    strings.Fields(claims.Scope),
+		}
+		if claims.Act != nil {
+			if claims.Act.Subject == "" {
+				return nil, errors.New("access token has an act claim without sub")
+			}
+			parsed.ActorID = claims.Act.Subject
+		}
+		return parsed, nil
+	}
+
+	if errors.Is(err, jwt.ErrTokenExpired) && claims.ExpiresAt != nil {
+		return &accessTokenClaims{
+			UserID:    claims.Subject,
+			TokenID:   claims.ID,
+			ExpiresAt: claims.ExpiresAt.Time,
+		}, fmt.Errorf("invalid access token: %w", err)
+	}
+
+	if s.acceptLegacyClaims && claims.Subject == "" {
+		return s.parseLegacyAccessToken(tokenStr)
+	}
+
+	return nil, fmt.Errorf("invalid access token: %w", err)
+}
+
+func (s *AuthService) parseLegacyAccessToken(tokenStr string) (*accessTokenClaims, error) {
+	claims := &accessClaims{}
+	parser := jwt.NewParser(jwt.WithValidMethods(s.validMethods()), jwt.WithLeeway(s.leeway))
+	if _, err := parser.ParseWithClaims(tokenStr, claims, s.verificationKey); err != nil {
+		return nil, fmt.Errorf("invalid access token: %w", err)
+	}
+
+	if claims.UserID == "" {
+		return nil, errors.New("access token has no user_id")
+	}
+	if claims.LegacyExpiresAt == 0 {
+		return nil, errors.New("access token has no expires_at")
+	}
+
+	parsed := &accessTokenClaims{
+		UserID:    claims.UserID,
+		TokenID:   claims.TokenID,
+		ExpiresAt: time.Unix(claims.LegacyExpiresAt, 0),
+	}
+	if time.Now().After(parsed.ExpiresAt.Add(s.leeway)) {
+		return parsed, fmt.Errorf("invalid access token: %w", jwt.ErrTokenExpired)
+	}
+
+	return parsed, nil
+}
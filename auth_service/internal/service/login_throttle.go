@@ -0,0 +1,105 @@
+package service
+
+import (
+	"log"
+	"math"
+	"time"
+
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/model"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/throttle"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/validation"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+type loginLimit struct {
+	limiter *throttle.Limiter
+	key     string
+}
+
+// loginLimits returns the counters a login attempt is charged to: the account
+// by its normalized email, whether or not it exists, and the client IP.
+func (s *AuthService) loginLimits(email string, client model.ClientInfo) []loginLimit {
+	var limits []loginLimit
+	if s.accountLimiter != nil {
+		limits = append(limits, loginLimit{s.accountLimiter, validation.FoldEmail(email)})
+	}
+	if s.ipLimiter != nil && client.IP != "" {
+		limits = append(limits, loginLimit{s.ipLimiter, client.IP})
+	}
+	return limits
+}
+
+// checkLoginThrottle refuses the attempt while the account or the client IP
+// is backing off or locked out. Store errors are logged and do not block the
+// login.
+func (s *AuthService) checkLoginThrottle(email string, client model.ClientInfo) error {
+	var wait time.Duration
+	for _, l := range s.loginLimits(email, client) {
+		w, err := l.limiter.Check(l.key)
+		if err != nil {
+			log.Printf("Failed to check login throttle: %v", err)
+			continue
+		}
+		wait = max(wait, w)
+	}
+
+	if wait > 0 {
+		return retryLater("too many failed login attempts", wait)
+	}
+	return nil
+}
+
+// recordLoginFailure audits a failed login for reason and counts it against
+// the login limits.
+func (s *AuthService) recordLoginFailure(email string, user *model.User, client model.ClientInfo, reason string) {
+	s.auditLoginFailure(email, user, client, reason)
+
+	for _, l := range s.loginLimits(email, client) {
+		locked, err := l.limiter.Fail(l.key)
+		if err != nil {
+			log.Printf("Failed to record login failure: %v", err)
+			continue
+		}
+		if !locked {
+			continue
+		}
+
+		log.Printf("Login locked out for %s", l.key)
+		if user != nil && l.limiter == s.accountLimiter {
+			s.recordAudit(&model.AuditEvent{
+				UserID:    user.ID,
+				EventType: model.AuditAccountLocked,
+				Outcome:   model.AuditOutcomeFailure,
+				IP:        client.IP,
+				UserAgent: client.UserAgent,
+			})
+		}
+	}
+}
+
+func (s *AuthService) resetLoginThrottle(email string) {
+	if s.accountLimiter == nil {
+		return
+	}
+	if err := s.accountLimiter.Succeed(validation.FoldEmail(email)); err != nil {
+		log.Printf("Failed to reset login throttle: %v", err)
+	}
+}
+
+// retryLater builds a ResourceExhausted error that tells the client through
+// RetryInfo when to try again.
+func retryLater(msg string, wait time.Duration) error {
+	seconds := int64(math.Ceil(wait.Seconds()))
+	st := status.Newf(codes.ResourceExhausted, "%s, try again in %d seconds", msg, seconds)
+
+	detailed, err := st.WithDetails(&errdetails.RetryInfo{
+		RetryDelay: durationpb.New(time.Duration(seconds) * time.Second),
+	})
+	if err != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
@@ -0,0 +1,120 @@
+package service_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/model"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/service"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/throttle"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// withLoginThrottle limits logins per account and per IP on a shared store.
+func withLoginThrottle(account, ip throttle.Policy) service.Option {
+	store := throttle.NewMemoryStore()
+	return service.WithLoginThrottle(
+		throttle.NewLimiter("account", store, account),
+		throttle.NewLimiter("ip", store, ip),
+	)
+}
+
+func retryDelay(t *testing.T, err error) time.Duration {
+	st, ok := status.FromError(err)
+	require.True(t, ok)
+	require.Equal(t, codes.ResourceExhausted, st.Code())
+	for _, d := range st.Details() {
+		if info, ok := d.(*errdetails.RetryInfo); ok {
+			return info.RetryDelay.AsDuration()
+		}
+	}
+	t.Fatal("no RetryInfo in error details")
+	return 0
+}
+
+func TestLogin_AccountLockout(t *testing.T) {
+	e := newTestService(withLoginThrottle(
+		throttle.Policy{FreeAttempts: 2, LockoutAfter: 3, LockoutDuration: 15 * time.Minute, Window: time.Hour},
+		throttle.Policy{Window: time.Hour},
+	))
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct"), bcrypt.MinCost)
+	require.NoError(t, err)
+	user := &model.User{ID: uuid.New().String(), Email: "reader@example.com", PasswordHash: string(hash)}
+	e.urepo.On("FindByEmail", user.Email).Return(user, nil)
+	client := model.ClientInfo{IP: "203.0.113.7"}
+
+	for i := 0; i < 3; i++ {
+		_, err := e.svc.Login(user.Email, "wrong", client)
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	}
+
+	_, err = e.svc.Login(user.Email, "correct", client)
+	assert.InDelta(t, 15*time.Minute, retryDelay(t, err), float64(time.Second))
+
+	_, err = e.svc.Login("READER@example.com ", "correct", model.ClientInfo{IP: "198.51.100.1"})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err), "the account is locked regardless of IP and case")
+
+	e.arepo.AssertCalled(t, "CreateAuditEvent", mock.MatchedBy(func(e *model.AuditEvent) bool {
+		return e.UserID == user.ID && e.EventType == model.AuditAccountLocked
+	}))
+}
+
+func TestLogin_SuccessResetsAccountCounter(t *testing.T) {
+	e := newTestService(withLoginThrottle(
+		throttle.Policy{FreeAttempts: 2, LockoutAfter: 3, LockoutDuration: time.Hour, Window: time.Hour},
+		throttle.Policy{Window: time.Hour},
+	))
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct"), bcrypt.MinCost)
+	require.NoError(t, err)
+	user := &model.User{ID: uuid.New().String(), Email: "reader@example.com", PasswordHash: string(hash)}
+	e.urepo.On("FindByEmail", user.Email).Return(user, nil)
+	e.urepo.On("UpdatePassword", user.ID, mock.Anything).Return(nil)
+
+	for i := 0; i < 2; i++ {
+		_, err := e.svc.Login(user.Email, "wrong", model.ClientInfo{})
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	}
+	_, err = e.svc.Login(user.Email, "correct", model.ClientInfo{})
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		_, err := e.svc.Login(user.Email, "wrong", model.ClientInfo{})
+		assert.Equal(t, codes.Unauthenticated, status.Code(err), "counter must start over after a success")
+	}
+}
+
+func TestLogin_IPBackoff(t *testing.T) {
+	e := newTestService(withLoginThrottle(
+		throttle.Policy{FreeAttempts: 100, Window: time.Hour},
+		throttle.Policy{FreeAttempts: 2, BaseDelay: 30 * time.Second, MaxDelay: time.Minute, Window: time.Hour},
+	))
+	e.urepo.On("FindByEmail", mock.Anything).Return(nil, errors.New("not found"))
+	client := model.ClientInfo{IP: "203.0.113.7"}
+
+	// Credential stuffing spreads attempts over many accounts.
+	for i := 0; i < 3; i++ {
+		_, err := e.svc.Login(uuid.New().String()+"@example.com", "password", client)
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	}
+
+	_, err := e.svc.Login("another@example.com", "password", client)
+	assert.InDelta(t, 30*time.Second, retryDelay(t, err), float64(time.Second))
+
+	_, err = e.svc.Login("another@example.com", "password", model.ClientInfo{IP: "198.51.100.1"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err), "other IPs are not affected")
+
+	e.arepo.AssertCalled(t, "CreateAuditEvent", mock.MatchedBy(func(e *model.AuditEvent) bool {
+		return e.EventType == model.AuditLoginFailed && e.IP == client.IP &&
+			e.Details == "reason=throttled email=another@example.com"
+	}))
+}
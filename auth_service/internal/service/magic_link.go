@@ -0,0 +1,112 @@
+package service
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/mail"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/model"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/validation"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const magicLinkBody = `Someone asked to sign in to your account %s.
+
+Open the link below to sign in. It expires in %s and can only be used once.
+
+%s
+
+If you did not ask for this, you can ignore this message.
+`
+
+func (s *AuthService) magicLinkEnabled() bool {
+	return s.actionRepo != nil && s.mailer != nil && s.magicLinkURL != ""
+}
+
+// RequestMagicLink mails a single-use login link to the owner of email.
+// Unknown and suspended addresses are not reported so the RPC cannot be used
+// to probe for accounts.
+func (s *AuthService) RequestMagicLink(email string) error {
+	if !s.magicLinkEnabled() {
+		return status.Error(codes.Unimplemented, "magic link login is not configured")
+	}
+	email = validation.FoldEmail(email)
+	if email == "" {
+		return status.Error(codes.InvalidArgument, "email is required")
+	}
+
+	user, err := s.userRepo.FindByEmail(email)
+	if err != nil {
+		log.Printf("Magic link requested for unknown email %s", email)
+		return nil
+	}
+	if user.Suspended() {
+		log.Printf("Magic link requested for suspended user %s", user.ID)
+		return nil
+	}
+
+	token, err := s.createActionToken(user.ID, model.ActionMagicLink, s.magicLinkTTL)
+	if err != nil {
+		return fmt.Errorf("failed to create magic link token: %w", err)
+	}
+	link, err := actionLink(s.magicLinkURL, token)
+	if err != nil {
+		return err
+	}
+
+	err = s.mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Your sign-in link",
+		Body:    fmt.Sprintf(magicLinkBody, user.UserName, s.magicLinkTTL, link),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send magic link mail: %w", err)
+	}
+
+	return nil
+}
+
+// ConsumeMagicLink signs in the owner of a login link. Like Login it only
+// checks the first factor; users with MFA still have to pass a challenge.
+// Following the link proves control of the address, so it is marked verified.
+func (s *AuthService) ConsumeMagicLink(token string, client model.ClientInfo) (*model.User, error) {
+	if !s.magicLinkEnabled() {
+		return nil, status.Error(codes.Unimplemented, "magic link login is not configured")
+	}
+
+	t, err := s.consumeActionToken(model.ActionMagicLink, token)
+	if err != nil {
+		log.Printf("Rejected magic link token: %v", err)
+		return nil, status.Error(codes.InvalidArgument, "invalid or expired login link")
+	}
+
+	user, err := s.userRepo.FindByID(t.UserID)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, "user not found")
+	}
+	if err := checkNotSuspended(user); err != nil {
+		s.auditLoginFailure(user.Email, user, client, loginFailureSuspended)
+		return nil, err
+	}
+
+	if !user.EmailVerified {
+		if err := s.userRepo.MarkEmailVerified(user.ID); err != nil {
+			return nil, fmt.Errorf("failed to mark email verified: %w", err)
+		}
+		user.EmailVerified = true
+	}
+
+	if !user.MFAEnabled {
+		s.recordAudit(&model.AuditEvent{
+			UserID:    user.ID,
+			ActorID:   user.ID,
+			EventType: model.AuditLoginSucceeded,
+			IP:        client.IP,
+			UserAgent: client.UserAgent,
+			Details:   "method=magic_link",
+		})
+	}
+
+	return user, nil
+}
@@ -0,0 +1,113 @@
+package service_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/model"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var withMagicLink = service.WithMagicLink(15*time.Minute, "https://club.example.com/magic-link")
+
+func TestRequestMagicLink_NotConfigured(t *testing.T) {
+	e := newTestService()
+
+	err := e.svc.RequestMagicLink("reader@example.com")
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+}
+
+func TestRequestMagicLink_UnknownOrSuspended(t *testing.T) {
+	e := newTestService(withMagicLink)
+
+	suspendedAt := time.Now()
+	suspended := &model.User{ID: uuid.New().String(), Email: "gone@example.com", SuspendedAt: &suspendedAt}
+	e.urepo.On("FindByEmail", "nobody@example.com").Return(nil, errors.New("not found"))
+	e.urepo.On("FindByEmail", suspended.Email).Return(suspended, nil)
+
+	assert.NoError(t, e.svc.RequestMagicLink("nobody@example.com"))
+	assert.NoError(t, e.svc.RequestMagicLink(suspended.Email))
+
+	assert.Empty(t, e.mailer.sent)
+	e.actions.AssertNotCalled(t, "CreateActionToken", mock.Anything)
+}
+
+func TestMagicLink(t *testing.T) {
+	e := newTestService(withMagicLink)
+
+	user := &model.User{ID: uuid.New().String(), UserName: "reader", Email: "reader@example.com"}
+	e.urepo.On("FindByEmail", user.Email).Return(user, nil)
+	e.urepo.On("FindByID", user.ID).Return(user, nil)
+	e.urepo.On("MarkEmailVerified", user.ID).Return(nil).Once()
+
+	var stored *model.ActionToken
+	e.actions.On("DeleteActionTokens", user.ID, model.ActionMagicLink).Return(nil)
+	e.actions.On("CreateActionToken", mock.AnythingOfType("*model.ActionToken")).Run(func(args mock.Arguments) {
+		stored = args.Get(0).(*model.ActionToken)
+		stored.ID = uuid.New().String()
+	}).Return(nil)
+
+	require.NoError(t, e.svc.RequestMagicLink(" Reader@Example.com "))
+
+	require.Len(t, e.mailer.sent, 1)
+	assert.Equal(t, user.Email, e.mailer.sent[0].To)
+	assert.Equal(t, model.ActionMagicLink, stored.Purpose)
+	assert.WithinDuration(t, time.Now().Add(15*time.Minute), stored.ExpiresAt, time.Minute)
+
+	token := tokenFromMail(t, e.mailer.sent[0])
+	selector, _, ok := strings.Cut(token, ".")
+	require.True(t, ok)
+	e.actions.On("FindActionToken", model.ActionMagicLink, selector).Return(stored, nil)
+
+	client := model.ClientInfo{IP: "203.0.113.7", UserAgent: "test"}
+
+	t.Run("signs in and verifies the email", func(t *testing.T) {
+		e.actions.On("MarkActionTokenUsed", stored.ID).Return(true, nil).Once()
+
+		got, err := e.svc.ConsumeMagicLink(token, client)
+		require.NoError(t, err)
+		assert.Equal(t, user.ID, got.ID)
+		assert.True(t, got.EmailVerified)
+		e.arepo.AssertCalled(t, "CreateAuditEvent", &model.AuditEvent{
+			UserID:    user.ID,
+			ActorID:   user.ID,
+			EventType: model.AuditLoginSucceeded,
+			Outcome:   model.AuditOutcomeSuccess,
+			IP:        client.IP,
+			UserAgent: client.UserAgent,
+			Details:   "method=magic_link",
+		})
+	})
+
+	t.Run("link is single use", func(t *testing.T) {
+		e.actions.On("MarkActionTokenUsed", stored.ID).Return(false, nil).Once()
+
+		_, err := e.svc.ConsumeMagicLink(token, client)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("wrong verifier", func(t *testing.T) {
+		_, err := e.svc.ConsumeMagicLink(selector+".forged", client)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("suspended users are refused", func(t *testing.T) {
+		e.actions.On("MarkActionTokenUsed", stored.ID).Return(true, nil).Once()
+		suspendedAt := time.Now()
+		user.SuspendedAt = &suspendedAt
+		defer func() { user.SuspendedAt = nil }()
+
+		_, err := e.svc.ConsumeMagicLink(token, client)
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	})
+
+	e.urepo.AssertExpectations(t)
+}
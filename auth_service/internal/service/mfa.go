@@ -0,0 +1,247 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/model"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/totp"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// totpSkew is the number of 30 second steps a code may be off by.
+	totpSkew          = 1
+	recoveryCodeCount = 10
+)
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func (s *AuthService) mfaConfigured() bool {
+	return s.mfaRepo != nil && s.actionRepo != nil
+}
+
+// EnrollTOTP creates a new secret for the caller. It has no effect on login
+// until it is confirmed with ConfirmTOTP.
+func (s *AuthService) EnrollTOTP(accessToken string) (secret, uri string, err error) {
+	if !s.mfaConfigured() {
+		return "", "", status.Error(codes.Unimplemented, "two-factor authentication is not configured")
+	}
+
+	user, err := s.authenticateOwner(accessToken, "enroll_totp")
+	if err != nil {
+		return "", "", err
+	}
+	if user.MFAEnabled {
+		return "", "", status.Error(codes.FailedPrecondition, "two-factor authentication is already enabled")
+	}
+
+	secret, err = totp.GenerateSecret()
+	if err != nil {
+		return "", "", err
+	}
+	if err := s.mfaRepo.SaveTOTPSecret(user.ID, secret); err != nil {
+		return "", "", fmt.Errorf("failed to save totp secret: %w", err)
+	}
+
+	return secret, totp.URI(s.mfaIssuer, user.Email, secret), nil
+}
+
+// ConfirmTOTP enables two-factor authentication once the caller proves their
+// authenticator produces valid codes, and returns fresh recovery codes. The
+// codes are only stored hashed and cannot be shown again.
+func (s *AuthService) ConfirmTOTP(accessToken, code string) ([]string, error) {
+	if !s.mfaConfigured() {
+		return nil, status.Error(codes.Unimplemented, "two-factor authentication is not configured")
+	}
+
+	user, err := s.authenticateOwner(accessToken, "confirm_totp")
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := s.mfaRepo.FindTOTP(user.ID)
+	if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, "two-factor enrollment has not been started")
+	}
+	if t.ConfirmedAt != nil {
+		return nil, status.Error(codes.FailedPrecondition, "two-factor authentication is already enabled")
+	}
+
+	step, ok := totp.Validate(t.Secret, strings.TrimSpace(code), time.Now(), totpSkew)
+	if !ok {
+		return nil, status.Error(codes.InvalidArgument, "invalid code")
+	}
+
+	recoveryCodes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.mfaRepo.ConfirmTOTP(user.ID, step, hashes); err != nil {
+		return nil, fmt.Errorf("failed to confirm totp: %w", err)
+	}
+	s.audit(user.ID, model.AuditMFAEnabled)
+
+	return recoveryCodes, nil
+}
+
+// DisableTOTP turns two-factor authentication off. It takes a current code
+// or a recovery code so a stolen access token alone is not enough. Wrong
+// codes count against the login throttle like in VerifySecondFactor.
+func (s *AuthService) DisableTOTP(accessToken, code string) error {
+	if !s.mfaConfigured() {
+		return status.Error(codes.Unimplemented, "two-factor authentication is not configured")
+	}
+
+	user, err := s.authenticateOwner(accessToken, "disable_totp")
+	if err != nil {
+		return err
+	}
+	if !user.MFAEnabled {
+		return status.Error(codes.FailedPrecondition, "two-factor authentication is not enabled")
+	}
+
+	if err := s.checkLoginThrottle(user.Email, model.ClientInfo{}); err != nil {
+		return err
+	}
+	ok, err := s.checkSecondFactor(user, code)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		s.recordLoginFailure(user.Email, user, model.ClientInfo{}, loginFailureInvalidSecondFactor)
+		return status.Error(codes.InvalidArgument, "invalid code")
+	}
+	s.resetLoginThrottle(user.Email)
+
+	if err := s.mfaRepo.DeleteMFA(user.ID); err != nil {
+		return fmt.Errorf("failed to disable totp: %w", err)
+	}
+	s.audit(user.ID, model.AuditMFADisabled)
+
+	return nil
+}
+
+// CreateMFAChallenge is called instead of issuing tokens when a user with
+// two-factor authentication passed the password check.
+func (s *AuthService) CreateMFAChallenge(userID string) (string, error) {
+	if !s.mfaConfigured() {
+		return "", status.Error(codes.Unimplemented, "two-factor authentication is not configured")
+	}
+	return s.createActionToken(userID, model.ActionMFAChallenge, s.mfaChallengeTTL)
+}
+
+// VerifySecondFactor completes a login started with a password. Wrong codes
+// count as failed logins, so guessing is throttled like guessing passwords.
+// The challenge stays valid after a wrong code until it expires. It is claimed
+// before the code is checked, so a replayed challenge cannot spend a TOTP step
+// or recovery code, and released again if the code is wrong.
+func (s *AuthService) VerifySecondFactor(challenge, code string, client model.ClientInfo) (*model.User, error) {
+	if !s.mfaConfigured() {
+		return nil, status.Error(codes.Unimplemented, "two-factor authentication is not configured")
+	}
+
+	t, err := s.findActionToken(model.ActionMFAChallenge, challenge)
+	if err != nil {
+		log.Printf("Rejected mfa challenge: %v", err)
+		return nil, status.Error(codes.Unauthenticated, "invalid or expired challenge")
+	}
+
+	user, err := s.userRepo.FindByID(t.UserID)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "invalid or expired challenge")
+	}
+
+	if err := s.checkLoginThrottle(user.Email, client); err != nil {
+		s.auditLoginFailure(user.Email, user, client, loginFailureThrottled)
+		return nil, err
+	}
+
+	used, err := s.actionRepo.MarkActionTokenUsed(t.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume challenge: %w", err)
+	}
+	if !used {
+		return nil, status.Error(codes.Unauthenticated, "invalid or expired challenge")
+	}
+
+	ok, err := s.checkSecondFactor(user, code)
+	if err != nil {
+		s.releaseChallenge(t.ID)
+		return nil, err
+	}
+	if !ok {
+		s.releaseChallenge(t.ID)
+		s.recordLoginFailure(user.Email, user, client, loginFailureInvalidSecondFactor)
+		return nil, status.Error(codes.Unauthenticated, "invalid code")
+	}
+
+	s.resetLoginThrottle(user.Email)
+	if err := checkNotSuspended(user); err != nil {
+		s.auditLoginFailure(user.Email, user, client, loginFailureSuspended)
+		return nil, err
+	}
+	s.auditClient(user.ID, model.AuditLoginSucceeded, client)
+
+	return user, nil
+}
+
+// releaseChallenge makes a challenge claimed by VerifySecondFactor usable
+// again. If that fails the user has to log in with their password again.
+func (s *AuthService) releaseChallenge(id string) {
+	if err := s.actionRepo.ReleaseActionToken(id); err != nil {
+		log.Printf("Failed to release mfa challenge %s: %v", id, err)
+	}
+}
+
+// checkSecondFactor accepts a TOTP code that was not used before or an
+// unused recovery code.
+func (s *AuthService) checkSecondFactor(user *model.User, code string) (bool, error) {
+	code = strings.TrimSpace(code)
+
+	t, err := s.mfaRepo.FindTOTP(user.ID)
+	if err != nil || t.ConfirmedAt == nil {
+		return false, nil
+	}
+
+	if step, ok := totp.Validate(t.Secret, code, time.Now(), totpSkew); ok {
+		fresh, err := s.mfaRepo.UseTOTPStep(user.ID, step)
+		if err != nil {
+			return false, fmt.Errorf("failed to record totp use: %w", err)
+		}
+		return fresh, nil
+	}
+
+	used, err := s.mfaRepo.UseRecoveryCode(user.ID, hashVerifier(normalizeRecoveryCode(code)))
+	if err != nil {
+		return false, fmt.Errorf("failed to use recovery code: %w", err)
+	}
+	if used {
+		s.audit(user.ID, model.AuditRecoveryCodeUsed)
+	}
+	return used, nil
+}
+
+// generateRecoveryCodes returns codes formatted as xxxxx-xxxxx together with
+// the hashes to store.
+func generateRecoveryCodes() (plain, hashes []string, err error) {
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 10)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, fmt.Errorf("failed to read random bytes: %w", err)
+		}
+		raw := strings.ToLower(recoveryCodeEncoding.EncodeToString(b))[:10]
+		plain = append(plain, raw[:5]+"-"+raw[5:])
+		hashes = append(hashes, hashVerifier(raw))
+	}
+	return plain, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
@@ -0,0 +1,297 @@
+package service_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/model"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/service"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/throttle"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/totp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type MockMFARepo struct {
+	mock.Mock
+}
+
+func (m *MockMFARepo) SaveTOTPSecret(userID, secret string) error {
+	args := m.Called(userID, secret)
+	return args.Error(0)
+}
+
+func (m *MockMFARepo) FindTOTP(userID string) (*model.TOTP, error) {
+	args := m.Called(userID)
+	if args.Get(0) != nil {
+		return args.Get(0).(*model.TOTP), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockMFARepo) ConfirmTOTP(userID string, step int64, recoveryCodeHashes []string) error {
+	args := m.Called(userID, step, recoveryCodeHashes)
+	return args.Error(0)
+}
+
+func (m *MockMFARepo) UseTOTPStep(userID string, step int64) (bool, error) {
+	args := m.Called(userID, step)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockMFARepo) UseRecoveryCode(userID, codeHash string) (bool, error) {
+	args := m.Called(userID, codeHash)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockMFARepo) DeleteMFA(userID string) error {
+	args := m.Called(userID)
+	return args.Error(0)
+}
+
+func TestTOTPEnrollment(t *testing.T) {
+	urepo := new(MockUserRepo)
+	trepo := new(MockTokenRepo)
+	mrepo := new(MockMFARepo)
+
+	user := &model.User{ID: uuid.New().String(), Email: "organizer@example.com"}
+	urepo.On("FindByID", user.ID).Return(user, nil)
+	trepo.On("CreateRefreshToken", mock.AnythingOfType("*model.RefreshToken")).Return(nil)
+	trepo.On("IsAccessTokenRevoked", mock.Anything).Return(false, nil)
+
+	svc := service.NewAuthService(urepo, trepo, "secret", time.Minute*15, time.Hour*24,
+		service.WithActionTokenRepo(new(MockActionTokenRepo)),
+		service.WithMFA(mrepo, "Reading Club", 5*time.Minute),
+	)
+	tokens, err := svc.GenerateTokens(user.ID, model.ClientInfo{})
+	require.NoError(t, err)
+
+	var secret string
+	mrepo.On("SaveTOTPSecret", user.ID, mock.AnythingOfType("string")).Run(func(args mock.Arguments) {
+		secret = args.String(1)
+	}).Return(nil)
+
+	gotSecret, uri, err := svc.EnrollTOTP(tokens.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, secret, gotSecret)
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/"))
+	assert.Contains(t, uri, "secret="+secret)
+
+	mrepo.On("FindTOTP", user.ID).Return(&model.TOTP{UserID: user.ID, Secret: secret}, nil)
+
+	t.Run("wrong code", func(t *testing.T) {
+		_, err := svc.ConfirmTOTP(tokens.AccessToken, "000000")
+		if status.Code(err) != codes.InvalidArgument {
+			// 000000 may be the current code once in a million runs.
+			t.Skip("000000 happened to be valid")
+		}
+		mrepo.AssertNotCalled(t, "ConfirmTOTP", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("confirm returns recovery codes", func(t *testing.T) {
+		var hashes []string
+		mrepo.On("ConfirmTOTP", user.ID, mock.AnythingOfType("int64"), mock.AnythingOfType("[]string")).Run(func(args mock.Arguments) {
+			hashes = args.Get(2).([]string)
+		}).Return(nil)
+
+		code, err := totp.Code(secret, totp.Step(time.Now()))
+		require.NoError(t, err)
+
+		recoveryCodes, err := svc.ConfirmTOTP(tokens.AccessToken, code)
+		require.NoError(t, err)
+		assert.Len(t, recoveryCodes, 10)
+		assert.Len(t, hashes, 10)
+		for i, rc := range recoveryCodes {
+			assert.Regexp(t, `^[a-z2-7]{5}-[a-z2-7]{5}$`, rc)
+			assert.NotContains(t, hashes[i], strings.ReplaceAll(rc, "-", ""))
+		}
+	})
+
+	t.Run("enabled users cannot enroll again", func(t *testing.T) {
+		user.MFAEnabled = true
+		defer func() { user.MFAEnabled = false }()
+
+		_, _, err := svc.EnrollTOTP(tokens.AccessToken)
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	})
+}
+
+func TestVerifySecondFactor(t *testing.T) {
+	urepo := new(MockUserRepo)
+	mrepo := new(MockMFARepo)
+	arepo := new(MockActionTokenRepo)
+
+	secret, err := totp.GenerateSecret()
+	require.NoError(t, err)
+	confirmed := time.Now()
+	user := &model.User{ID: uuid.New().String(), Email: "organizer@example.com", MFAEnabled: true}
+	urepo.On("FindByID", user.ID).Return(user, nil)
+	mrepo.On("FindTOTP", user.ID).Return(&model.TOTP{UserID: user.ID, Secret: secret, ConfirmedAt: &confirmed}, nil)
+
+	var challenge *model.ActionToken
+	arepo.On("DeleteActionTokens", user.ID, model.ActionMFAChallenge).Return(nil)
+	arepo.On("CreateActionToken", mock.AnythingOfType("*model.ActionToken")).Run(func(args mock.Arguments) {
+		challenge = args.Get(0).(*model.ActionToken)
+		challenge.ID = uuid.New().String()
+	}).Return(nil)
+
+	svc := service.NewAuthService(urepo, new(MockTokenRepo), "secret", time.Minute*15, time.Hour*24,
+		service.WithActionTokenRepo(arepo),
+		service.WithMFA(mrepo, "Reading Club", 5*time.Minute),
+		service.WithLoginThrottle(
+			throttle.NewLimiter("account", throttle.NewMemoryStore(), throttle.Policy{FreeAttempts: 5, LockoutAfter: 5, LockoutDuration: time.Hour, Window: time.Hour}),
+			nil,
+		),
+	)
+
+	mfaToken, err := svc.CreateMFAChallenge(user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.ActionMFAChallenge, challenge.Purpose)
+	assert.WithinDuration(t, time.Now().Add(5*time.Minute), challenge.ExpiresAt, time.Minute)
+
+	selector, _, _ := strings.Cut(mfaToken, ".")
+	arepo.On("FindActionToken", model.ActionMFAChallenge, selector).Return(challenge, nil)
+
+	code, err := totp.Code(secret, totp.Step(time.Now()))
+	require.NoError(t, err)
+	step := totp.Step(time.Now())
+
+	t.Run("invalid challenge", func(t *testing.T) {
+		_, err := svc.VerifySecondFactor(selector+".forged", code, model.ClientInfo{})
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	})
+
+	t.Run("wrong code keeps challenge", func(t *testing.T) {
+		arepo.On("MarkActionTokenUsed", challenge.ID).Return(true, nil).Once()
+		arepo.On("ReleaseActionToken", challenge.ID).Return(nil).Once()
+		mrepo.On("UseRecoveryCode", user.ID, mock.AnythingOfType("string")).Return(false, nil).Once()
+
+		_, err := svc.VerifySecondFactor(mfaToken, "not-a-code", model.ClientInfo{})
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+		arepo.AssertCalled(t, "ReleaseActionToken", challenge.ID)
+	})
+
+	t.Run("used challenge spends no code", func(t *testing.T) {
+		arepo.On("MarkActionTokenUsed", challenge.ID).Return(false, nil).Once()
+
+		_, err := svc.VerifySecondFactor(mfaToken, "ABCDE-FGHIJ", model.ClientInfo{})
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+		mrepo.AssertNumberOfCalls(t, "UseRecoveryCode", 1)
+	})
+
+	t.Run("valid code", func(t *testing.T) {
+		mrepo.On("UseTOTPStep", user.ID, step).Return(true, nil).Once()
+		arepo.On("MarkActionTokenUsed", challenge.ID).Return(true, nil).Once()
+
+		got, err := svc.VerifySecondFactor(mfaToken, code, model.ClientInfo{})
+		require.NoError(t, err)
+		assert.Equal(t, user.ID, got.ID)
+	})
+
+	t.Run("replayed code", func(t *testing.T) {
+		arepo.On("MarkActionTokenUsed", challenge.ID).Return(true, nil).Once()
+		arepo.On("ReleaseActionToken", challenge.ID).Return(nil).Once()
+		mrepo.On("UseTOTPStep", user.ID, step).Return(false, nil).Once()
+
+		_, err := svc.VerifySecondFactor(mfaToken, code, model.ClientInfo{})
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	})
+
+	t.Run("recovery code", func(t *testing.T) {
+		mrepo.On("UseRecoveryCode", user.ID, mock.AnythingOfType("string")).Return(true, nil).Once()
+		arepo.On("MarkActionTokenUsed", challenge.ID).Return(true, nil).Once()
+
+		_, err := svc.VerifySecondFactor(mfaToken, "ABCDE-FGHIJ", model.ClientInfo{})
+		require.NoError(t, err)
+	})
+
+	t.Run("wrong codes are throttled", func(t *testing.T) {
+		arepo.On("MarkActionTokenUsed", challenge.ID).Return(true, nil)
+		arepo.On("ReleaseActionToken", challenge.ID).Return(nil)
+		mrepo.On("UseRecoveryCode", user.ID, mock.AnythingOfType("string")).Return(false, nil)
+
+		for i := 0; i < 5; i++ {
+			_, err := svc.VerifySecondFactor(mfaToken, "wrong", model.ClientInfo{})
+			assert.Equal(t, codes.Unauthenticated, status.Code(err))
+		}
+		_, err := svc.VerifySecondFactor(mfaToken, code, model.ClientInfo{})
+		assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	})
+}
+
+func TestLogin_PasswordDoesNotResetSecondFactorThrottle(t *testing.T) {
+	mrepo := new(MockMFARepo)
+	e := newTestService(
+		service.WithMFA(mrepo, "Reading Club", 5*time.Minute),
+		withLoginThrottle(
+			throttle.Policy{FreeAttempts: 2, LockoutAfter: 3, LockoutDuration: 15 * time.Minute, Window: time.Hour},
+			throttle.Policy{Window: time.Hour},
+		),
+	)
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct"), bcrypt.MinCost)
+	require.NoError(t, err)
+	user := &model.User{ID: uuid.New().String(), Email: "organizer@example.com", PasswordHash: string(hash), MFAEnabled: true}
+	e.urepo.On("FindByEmail", user.Email).Return(user, nil)
+	e.urepo.On("FindByID", user.ID).Return(user, nil)
+	e.urepo.On("UpdatePassword", user.ID, mock.Anything).Return(nil)
+	confirmed := time.Now()
+	mrepo.On("FindTOTP", user.ID).Return(&model.TOTP{UserID: user.ID, Secret: "JBSWY3DPEHPK3PXP", ConfirmedAt: &confirmed}, nil)
+	mrepo.On("UseRecoveryCode", user.ID, mock.AnythingOfType("string")).Return(false, nil)
+
+	challenge := &model.ActionToken{}
+	e.actions.On("DeleteActionTokens", user.ID, model.ActionMFAChallenge).Return(nil)
+	e.actions.On("CreateActionToken", mock.AnythingOfType("*model.ActionToken")).Run(func(args mock.Arguments) {
+		*challenge = *args.Get(0).(*model.ActionToken)
+		challenge.ID = uuid.New().String()
+	}).Return(nil)
+	e.actions.On("FindActionToken", model.ActionMFAChallenge, mock.Anything).Return(challenge, nil)
+	e.actions.On("MarkActionTokenUsed", mock.Anything).Return(true, nil)
+	e.actions.On("ReleaseActionToken", mock.Anything).Return(nil)
+
+	for i := 0; i < 3; i++ {
+		_, err := e.svc.Login(user.Email, "correct", model.ClientInfo{})
+		require.NoError(t, err)
+		mfaToken, err := e.svc.CreateMFAChallenge(user.ID)
+		require.NoError(t, err)
+
+		_, err = e.svc.VerifySecondFactor(mfaToken, "wrong", model.ClientInfo{})
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	}
+
+	_, err = e.svc.Login(user.Email, "correct", model.ClientInfo{})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+}
+
+func TestDisableTOTP(t *testing.T) {
+	mrepo := new(MockMFARepo)
+	e := newTestService(
+		service.WithMFA(mrepo, "Reading Club", 5*time.Minute),
+		withLoginThrottle(
+			throttle.Policy{FreeAttempts: 2, LockoutAfter: 3, LockoutDuration: 15 * time.Minute, Window: time.Hour},
+			throttle.Policy{Window: time.Hour},
+		),
+	)
+
+	user := &model.User{ID: uuid.New().String(), Email: "organizer@example.com", MFAEnabled: true}
+	access := e.signIn(t, user)
+	confirmed := time.Now()
+	mrepo.On("FindTOTP", user.ID).Return(&model.TOTP{UserID: user.ID, Secret: "JBSWY3DPEHPK3PXP", ConfirmedAt: &confirmed}, nil)
+	mrepo.On("UseRecoveryCode", user.ID, mock.AnythingOfType("string")).Return(false, nil)
+
+	for i := 0; i < 3; i++ {
+		err := e.svc.DisableTOTP(access, "wrong")
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+
+	err := e.svc.DisableTOTP(access, "wrong")
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err), "guessing codes is throttled")
+	mrepo.AssertNumberOfCalls(t, "UseRecoveryCode", 3)
+	mrepo.AssertNotCalled(t, "DeleteMFA", mock.Anything)
+}
@@ -0,0 +1,553 @@
+package service
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/model"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// OAuth error codes of RFC 6749. They are attached to gRPC errors as the
+// reason of an ErrorInfo detail, see oauthError.
+const (
+	OAuthInvalidRequest          = "invalid_request"
+	OAuthInvalidClient           = "invalid_client"
+	OAuthInvalidGrant            = "invalid_grant"
+	OAuthInvalidScope            = "invalid_scope"
+	OAuthAccessDenied            = "access_denied"
+	OAuthUnsupportedGrantType    = "unsupported_grant_type"
+	OAuthUnsupportedResponseType = "unsupported_response_type"
+	OAuthInsufficientScope       = "insufficient_scope"
+	OAuthUnauthorizedClient      = "unauthorized_client"
+	OAuthUnsupportedTokenType    = "unsupported_token_type"
+
+	// OAuthErrorDomain is the domain of the ErrorInfo details.
+	OAuthErrorDomain = "oauth2"
+)
+
+const (
+	grantTypeAuthorizationCode = "authorization_code"
+	responseTypeCode           = "code"
+	codeChallengeMethodS256    = "S256"
+)
+
+// oauthError builds a gRPC error whose ErrorInfo reason is the OAuth error
+// code, so the gateway can answer in the format clients expect.
+func oauthError(code codes.Code, reason, description string) error {
+	st := status.New(code, description)
+	detailed, err := st.WithDetails(&errdetails.ErrorInfo{Reason: reason, Domain: OAuthErrorDomain})
+	if err != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
+
+func (s *AuthService) oauthConfigured() bool {
+	return s.oauthRepo != nil && s.keys != nil
+}
+
+// AuthorizeRequest holds the parameters of an authorization request
+// (RFC 6749 section 4.1.1, RFC 7636 and OpenID Connect Core section 3.1.2.1).
+type AuthorizeRequest struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+// AuthorizationInfo is what the consent screen shows about a valid
+// authorization request.
+type AuthorizationInfo struct {
+	Client      *model.OAuthClient
+	RedirectURI string
+	Scopes      []string
+	// ConsentGiven reports an earlier consent of the user that covers all
+	// requested scopes, so the screen can be skipped.
+	ConsentGiven bool
+}
+
+// authorizeError is an invalid authorization request whose client and
+// redirect URI are known to be good, so it is reported to the client through
+// the redirect URI.
+type authorizeError struct {
+	reason      string
+	description string
+}
+
+// GetAuthorization checks an authorization request for the consent screen.
+func (s *AuthService) GetAuthorization(accessToken string, req AuthorizeRequest) (*AuthorizationInfo, error) {
+	if !s.oauthConfigured() {
+		return nil, status.Error(codes.Unimplemented, "oauth is not configured")
+	}
+
+	user, err := s.authenticate(accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	info, aerr, err := s.checkAuthorization(user.ID, req)
+	if err != nil {
+		return nil, err
+	}
+	if aerr != nil {
+		return nil, oauthError(codes.InvalidArgument, aerr.reason, aerr.description)
+	}
+	return info, nil
+}
+
+// Authorize answers an authorization request on behalf of the caller, who
+// approved or denied it on the consent screen. It returns the URL the user
+// agent has to be sent back to. Requests with an unknown client or redirect
+// URI fail instead, since there is no safe place to send the user to.
+func (s *AuthService) Authorize(accessToken string, req AuthorizeRequest, approve bool) (string, error) {
+	if !s.oauthConfigured() {
+		return "", status.Error(codes.Unimplemented, "oauth is not configured")
+	}
+
+	user, err := s.authenticateOwner(accessToken, "authorize_oauth_client")
+	if err != nil {
+		return "", err
+	}
+
+	info, aerr, err := s.checkAuthorization(user.ID, req)
+	if err != nil {
+		return "", err
+	}
+	if aerr != nil {
+		return s.authorizationRedirect(req.RedirectURI, req.State, url.Values{
+			"error":             {aerr.reason},
+			"error_description": {aerr.description},
+		})
+	}
+	if !approve {
+		return s.authorizationRedirect(info.RedirectURI, req.State, url.Values{
+			"error":             {OAuthAccessDenied},
+			"error_description": {"the user denied the request"},
+		})
+	}
+
+	if !info.ConsentGiven {
+		if err := s.grantConsent(user.ID, info.Client.ID, info.Scopes); err != nil {
+			return "", err
+		}
+	}
+
+	code, selector, verifierHash, err := generateSplitToken()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate authorization code: %w", err)
+	}
+	err = s.oauthRepo.CreateAuthorizationCode(&model.AuthorizationCode{
+		UserID:        user.ID,
+		ClientID:      info.Client.ID,
+		Selector:      selector,
+		CodeHash:      verifierHash,
+		RedirectURI:   info.RedirectURI,
+		Scopes:        info.Scopes,
+		CodeChallenge: req.CodeChallenge,
+		Nonce:         req.Nonce,
+		ExpiresAt:     time.Now().Add(s.oauthCodeTTL),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to store authorization code: %w", err)
+	}
+
+	return s.authorizationRedirect(info.RedirectURI, req.State, url.Values{"code": {code}})
+}
+
+// checkAuthorization validates req for userID. Problems with the client or
+// redirect URI are returned as err, all others as aerr.
+func (s *AuthService) checkAuthorization(userID string, req AuthorizeRequest) (info *AuthorizationInfo, aerr *authorizeError, err error) {
+	client, err := s.oauthRepo.FindClient(req.ClientID)
+	if err != nil {
+		if errors.Is(err, model.ErrOAuthClientNotFound) {
+			return nil, nil, oauthError(codes.InvalidArgument, OAuthInvalidRequest, "unknown client_id")
+		}
+		return nil, nil, fmt.Errorf("failed to find oauth client: %w", err)
+	}
+
+	redirectURI := req.RedirectURI
+	if redirectURI == "" && len(client.RedirectURIs) == 1 {
+		redirectURI = client.RedirectURIs[0]
+	}
+	if !slices.Contains(client.RedirectURIs, redirectURI) {
+		return nil, nil, oauthError(codes.InvalidArgument, OAuthInvalidRequest, "redirect_uri is not registered for the client")
+	}
+
+	if req.ResponseType != responseTypeCode {
+		return nil, &authorizeError{OAuthUnsupportedResponseType, "only the code response type is supported"}, nil
+	}
+	if req.CodeChallenge == "" {
+		return nil, &authorizeError{OAuthInvalidRequest, "code_challenge is required"}, nil
+	}
+	if req.CodeChallengeMethod != codeChallengeMethodS256 {
+		return nil, &authorizeError{OAuthInvalidRequest, "code_challenge_method must be S256"}, nil
+	}
+	if len(req.CodeChallenge) != 43 {
+		return nil, &authorizeError{OAuthInvalidRequest, "code_challenge is not a base64url encoded SHA-256 hash"}, nil
+	}
+
+	var scopes []string
+	for _, scope := range strings.Fields(req.Scope) {
+		if !slices.Contains(client.Scopes, scope) {
+			return nil, &authorizeError{OAuthInvalidScope, fmt.Sprintf("scope %q is not allowed for the client", scope)}, nil
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	if len(scopes) == 0 {
+		return nil, &authorizeError{OAuthInvalidScope, "scope is required"}, nil
+	}
+
+	info = &AuthorizationInfo{Client: client, RedirectURI: redirectURI, Scopes: scopes}
+
+	consent, err := s.oauthRepo.FindConsent(userID, client.ID)
+	switch {
+	case err == nil:
+		info.ConsentGiven = containsAll(consent.Scopes, scopes)
+	case !errors.Is(err, model.ErrConsentNotFound):
+		return nil, nil, fmt.Errorf("failed to find consent: %w", err)
+	}
+
+	return info, nil, nil
+}
+
+// grantConsent adds scopes to the consent of the user for the client.
+func (s *AuthService) grantConsent(userID, clientID string, scopes []string) error {
+	granted := slices.Clone(scopes)
+	consent, err := s.oauthRepo.FindConsent(userID, clientID)
+	switch {
+	case err == nil:
+		for _, scope := range consent.Scopes {
+			if !slices.Contains(granted, scope) {
+				granted = append(granted, scope)
+			}
+		}
+	case !errors.Is(err, model.ErrConsentNotFound):
+		return fmt.Errorf("failed to find consent: %w", err)
+	}
+
+	if err := s.oauthRepo.SaveConsent(&model.OAuthConsent{UserID: userID, ClientID: clientID, Scopes: granted}); err != nil {
+		return fmt.Errorf("failed to save consent: %w", err)
+	}
+	s.audit(userID, model.AuditOAuthConsentGranted)
+	return nil
+}
+
+// authorizationRedirect adds params, state and the issuer (RFC 9207) to the
+// query of redirectURI.
+func (s *AuthService) authorizationRedirect(redirectURI, state string, params url.Values) (string, error) {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return "", fmt.Errorf("invalid redirect uri: %w", err)
+	}
+
+	query := u.Query()
+	for k, v := range params {
+		query[k] = v
+	}
+	if state != "" {
+		query.Set("state", state)
+	}
+	query.Set("iss", s.oauthIssuer)
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
+
+func containsAll(have, want []string) bool {
+	for _, w := range want {
+		if !slices.Contains(have, w) {
+			return false
+		}
+	}
+	return true
+}
+
+// TokenRequest is an access token request of RFC 6749 section 4.1.3. The
+// client credentials may come from HTTP basic authentication or the form.
+type TokenRequest struct {
+	GrantType    string
+	Code         string
+	RedirectURI  string
+	ClientID     string
+	ClientSecret string
+	CodeVerifier string
+}
+
+// OAuthTokens is the answer to a token request. IDToken is only set when
+// the openid scope was granted.
+type OAuthTokens struct {
+	AccessToken string
+	IDToken     string
+	ExpiresIn   time.Duration
+	Scopes      []string
+}
+
+// ExchangeAuthorizationCode redeems an authorization code. A code can only be
+// redeemed once; presenting it again revokes the access token issued for it,
+// as it was most likely stolen.
+func (s *AuthService) ExchangeAuthorizationCode(req TokenRequest) (*OAuthTokens, error) {
+	if !s.oauthConfigured() {
+		return nil, status.Error(codes.Unimplemented, "oauth is not configured")
+	}
+
+	if req.GrantType != grantTypeAuthorizationCode {
+		return nil, oauthError(codes.InvalidArgument, OAuthUnsupportedGrantType, "only the authorization_code grant is supported")
+	}
+
+	client, err := s.authenticateClient(req.ClientID, req.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	invalidGrant := oauthError(codes.InvalidArgument, OAuthInvalidGrant, "invalid authorization code")
+
+	selector, verifier, ok := parseSplitToken(req.Code)
+	if !ok {
+		return nil, invalidGrant
+	}
+	code, err := s.oauthRepo.FindAuthorizationCode(selector)
+	if err != nil {
+		log.Printf("Rejected authorization code: %v", err)
+		return nil, invalidGrant
+	}
+	if !verifierMatches(verifier, code.CodeHash) || code.ClientID != client.ID {
+		return nil, invalidGrant
+	}
+	if code.UsedAt != nil {
+		s.revokeReplayedCode(code)
+		return nil, invalidGrant
+	}
+	if req.RedirectURI != code.RedirectURI {
+		return nil, oauthError(codes.InvalidArgument, OAuthInvalidGrant, "redirect_uri does not match the authorization request")
+	}
+	if !pkceMatches(req.CodeVerifier, code.CodeChallenge) {
+		return nil, oauthError(codes.InvalidArgument, OAuthInvalidGrant, "code_verifier does not match the code_challenge")
+	}
+
+	accessID := uuid.New().String()
+	used, err := s.oauthRepo.MarkAuthorizationCodeUsed(code.ID, accessID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume authorization code: %w", err)
+	}
+	if !used {
+		return nil, invalidGrant
+	}
+
+	user, err := s.userRepo.FindByID(code.UserID)
+	if err != nil {
+		return nil, invalidGrant
+	}
+	// The user may have been suspended after consenting.
+	if checkNotSuspended(user) != nil {
+		return nil, oauthError(codes.InvalidArgument, OAuthInvalidGrant, "account is suspended")
+	}
+
+	claims := s.newAccessClaims(user.ID, user.Roles, user.EmailVerified, accessID)
+	claims.Scope = strings.Join(code.Scopes, " ")
+	claims.ClientID = client.ID
+	accessToken, err := s.signToken(claims)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign access token: %w", err)
+	}
+
+	tokens := &OAuthTokens{
+		AccessToken: accessToken,
+		ExpiresIn:   s.accessTTL,
+		Scopes:      code.Scopes,
+	}
+	if slices.Contains(code.Scopes, model.ScopeOpenID) {
+		tokens.IDToken, err = s.signToken(s.newIDTokenClaims(user, client.ID, code.Nonce, code.Scopes))
+		if err != nil {
+			return nil, fmt.Errorf("failed to sign id token: %w", err)
+		}
+	}
+
+	return tokens, nil
+}
+
+// authenticateClient checks the credentials of a token request. Public
+// clients only identify themselves; PKCE binds their codes instead.
+func (s *AuthService) authenticateClient(clientID, secret string) (*model.OAuthClient, error) {
+	invalidClient := oauthError(codes.Unauthenticated, OAuthInvalidClient, "client authentication failed")
+
+	client, err := s.oauthRepo.FindClient(clientID)
+	if err != nil {
+		if errors.Is(err, model.ErrOAuthClientNotFound) {
+			return nil, invalidClient
+		}
+		return nil, fmt.Errorf("failed to find oauth client: %w", err)
+	}
+	if !client.Public() && !verifierMatches(secret, client.SecretHash) {
+		return nil, invalidClient
+	}
+	return client, nil
+}
+
+func (s *AuthService) revokeReplayedCode(code *model.AuthorizationCode) {
+	log.Printf("Authorization code %s of client %s was used twice", code.ID, code.ClientID)
+	if code.AccessTokenID == "" {
+		return
+	}
+	if err := s.revokeAccessToken(code.AccessTokenID); err != nil {
+		log.Printf("Failed to revoke access token of replayed authorization code %s: %v", code.ID, err)
+	}
+}
+
+// pkceMatches checks verifier against an S256 challenge (RFC 7636 section
+// 4.6).
+func pkceMatches(verifier, challenge string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(pkceChallenge(verifier)), []byte(challenge)) == 1
+}
+
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// idTokenClaims is the payload of an OpenID Connect ID token.
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	AuthorizedParty   string `json:"azp,omitempty"`
+	Nonce             string `json:"nonce,omitempty"`
+	Name              string `json:"name,omitempty"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+	Email             string `json:"email,omitempty"`
+	EmailVerified     *bool  `json:"email_verified,omitempty"`
+}
+
+func (s *AuthService) newIDTokenClaims(user *model.User, clientID, nonce string, scopes []string) *idTokenClaims {
+	now := time.Now()
+	info := userInfo(user, scopes)
+
+	claims := &idTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.oauthIssuer,
+			Subject:   user.ID,
+			Audience:  jwt.ClaimStrings{clientID},
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.accessTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+		AuthorizedParty: clientID,
+		Nonce:           nonce,
+		EmailVerified:   info.EmailVerified,
+	}
+	if info.Name != nil {
+		claims.Name = *info.Name
+		claims.PreferredUsername = *info.PreferredUsername
+	}
+	if info.Email != nil {
+		claims.Email = *info.Email
+	}
+	return claims
+}
+
+// UserInfo holds the claims about a user that a client was granted. Claims
+// of scopes that were not granted are nil.
+type UserInfo struct {
+	Subject           string
+	Name              *string
+	PreferredUsername *string
+	Email             *string
+	EmailVerified     *bool
+}
+
+func userInfo(user *model.User, scopes []string) *UserInfo {
+	info := &UserInfo{Subject: user.ID}
+	if slices.Contains(scopes, model.ScopeProfile) {
+		name := user.DisplayName
+		if name == "" {
+			name = user.UserName
+		}
+		info.Name = &name
+		info.PreferredUsername = &user.UserName
+	}
+	if slices.Contains(scopes, model.ScopeEmail) {
+		info.Email = &user.Email
+		info.EmailVerified = &user.EmailVerified
+	}
+	return info
+}
+
+// UserInfo answers the userinfo endpoint for an access token issued to an
+// OAuth client with the openid scope.
+func (s *AuthService) UserInfo(accessToken string) (*UserInfo, error) {
+	if !s.oauthConfigured() {
+		return nil, status.Error(codes.Unimplemented, "oauth is not configured")
+	}
+
+	user, claims, ok := s.checkAccessToken(accessToken)
+	if !ok || claims.ClientID == "" {
+		return nil, status.Error(codes.Unauthenticated, "invalid access token")
+	}
+	if !slices.Contains(claims.Scopes, model.ScopeOpenID) {
+		return nil, oauthError(codes.PermissionDenied, OAuthInsufficientScope, "the openid scope is required")
+	}
+
+	return userInfo(user, claims.Scopes), nil
+}
+
+// OpenIDConfiguration is the discovery document of OpenID Connect Discovery
+// section 3.
+type OpenIDConfiguration struct {
+	Issuer                            string
+	AuthorizationEndpoint             string
+	TokenEndpoint                     string
+	UserinfoEndpoint                  string
+	IntrospectionEndpoint             string
+	RevocationEndpoint                string
+	JWKSURI                           string
+	ScopesSupported                   []string
+	ResponseTypesSupported            []string
+	GrantTypesSupported               []string
+	SubjectTypesSupported             []string
+	IDTokenSigningAlgValuesSupported  []string
+	TokenEndpointAuthMethodsSupported []string
+	CodeChallengeMethodsSupported     []string
+	ClaimsSupported                   []string
+}
+
+func (s *AuthService) OpenIDConfiguration() (*OpenIDConfiguration, error) {
+	if !s.oauthConfigured() {
+		return nil, status.Error(codes.Unimplemented, "oauth is not configured")
+	}
+
+	return &OpenIDConfiguration{
+		Issuer:                            s.oauthIssuer,
+		AuthorizationEndpoint:             s.oauthIssuer + "/oauth/authorize",
+		TokenEndpoint:                     s.oauthIssuer + "/oauth/token",
+		UserinfoEndpoint:                  s.oauthIssuer + "/oauth/userinfo",
+		IntrospectionEndpoint:             s.oauthIssuer + "/oauth/introspect",
+		RevocationEndpoint:                s.oauthIssuer + "/oauth/revoke",
+		JWKSURI:                           s.oauthIssuer + "/.well-known/jwks.json",
+		ScopesSupported:                   model.OAuthScopes,
+		ResponseTypesSupported:            []string{responseTypeCode},
+		GrantTypesSupported:               []string{grantTypeAuthorizationCode},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  s.keys.Algorithms(),
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{codeChallengeMethodS256},
+		ClaimsSupported:                   []string{"sub", "name", "preferred_username", "email", "email_verified"},
+	}, nil
+}
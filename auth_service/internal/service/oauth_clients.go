@@ -0,0 +1,216 @@
+package service
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/model"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/validation"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const maxOAuthClientNameLength = 64
+
+// RegisterOAuthClient registers an application, admins only. Confidential
+// clients get a secret that is returned only here; public clients get none.
+func (s *AuthService) RegisterOAuthClient(accessToken, name string, redirectURIs, scopes []string, public bool) (*model.OAuthClient, string, error) {
+	if !s.oauthConfigured() {
+		return nil, "", status.Error(codes.Unimplemented, "oauth is not configured")
+	}
+
+	caller, err := s.requireRole(accessToken, model.RoleAdmin)
+	if err != nil {
+		return nil, "", err
+	}
+
+	name = strings.TrimSpace(name)
+	scopes, violations := checkOAuthClient(name, redirectURIs, scopes)
+	if len(violations) > 0 {
+		return nil, "", invalidFields(violations)
+	}
+
+	id, err := randomString(12)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate client id: %w", err)
+	}
+	client := &model.OAuthClient{
+		ID:           id,
+		Name:         name,
+		RedirectURIs: redirectURIs,
+		Scopes:       scopes,
+	}
+
+	var secret string
+	if !public {
+		secret, err = randomString(32)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to generate client secret: %w", err)
+		}
+		client.SecretHash = hashVerifier(secret)
+	}
+
+	if err := s.oauthRepo.CreateClient(client); err != nil {
+		return nil, "", fmt.Errorf("failed to store oauth client: %w", err)
+	}
+
+	s.audit(caller.ID, model.AuditOAuthClientRegistered)
+	return client, secret, nil
+}
+
+// checkOAuthClient validates the fields of a new client and returns the
+// scopes without duplicates.
+func checkOAuthClient(name string, redirectURIs, scopes []string) ([]string, []validation.Violation) {
+	var violations []validation.Violation
+
+	switch {
+	case name == "":
+		violations = append(violations, validation.Violation{Field: "name", Description: "name is required"})
+	case utf8.RuneCountInString(name) > maxOAuthClientNameLength:
+		violations = append(violations, validation.Violation{Field: "name", Description: fmt.Sprintf("name must be at most %d characters long", maxOAuthClientNameLength)})
+	case strings.IndexFunc(name, unicode.IsControl) >= 0:
+		violations = append(violations, validation.Violation{Field: "name", Description: "name must not contain control characters"})
+	}
+
+	if len(redirectURIs) == 0 {
+		violations = append(violations, validation.Violation{Field: "redirect_uris", Description: "at least one redirect uri is required"})
+	}
+	for _, uri := range redirectURIs {
+		if reason := checkRedirectURI(uri); reason != "" {
+			violations = append(violations, validation.Violation{Field: "redirect_uris", Description: fmt.Sprintf("%q %s", uri, reason)})
+		}
+	}
+
+	var unique []string
+	for _, scope := range scopes {
+		if !slices.Contains(model.OAuthScopes, scope) {
+			violations = append(violations, validation.Violation{Field: "scopes", Description: fmt.Sprintf("unknown scope %q", scope)})
+			continue
+		}
+		if !slices.Contains(unique, scope) {
+			unique = append(unique, scope)
+		}
+	}
+	if len(scopes) == 0 {
+		violations = append(violations, validation.Violation{Field: "scopes", Description: "at least one scope is required"})
+	}
+
+	return unique, violations
+}
+
+// checkRedirectURI returns why uri cannot be registered, or "" if it can.
+// Plain http is only allowed for loopback addresses, for native apps and
+// local development (RFC 8252 section 7.3).
+func checkRedirectURI(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || !u.IsAbs() || u.Host == "" {
+		return "is not an absolute url"
+	}
+	if u.Fragment != "" || strings.Contains(uri, "#") {
+		return "must not contain a fragment"
+	}
+	switch u.Scheme {
+	case "https":
+		return ""
+	case "http":
+		host := u.Hostname()
+		if host == "localhost" {
+			return ""
+		}
+		if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+			return ""
+		}
+		return "must use https"
+	default:
+		return "must use https"
+	}
+}
+
+// ListOAuthClients returns every registered client, admins only.
+func (s *AuthService) ListOAuthClients(accessToken string) ([]*model.OAuthClient, error) {
+	if !s.oauthConfigured() {
+		return nil, status.Error(codes.Unimplemented, "oauth is not configured")
+	}
+
+	if _, err := s.requireRole(accessToken, model.RoleAdmin); err != nil {
+		return nil, err
+	}
+
+	clients, err := s.oauthRepo.ListClients()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list oauth clients: %w", err)
+	}
+	return clients, nil
+}
+
+// DeleteOAuthClient removes a client together with its consents and
+// outstanding authorization codes, admins only.
+func (s *AuthService) DeleteOAuthClient(accessToken, clientID string) error {
+	if !s.oauthConfigured() {
+		return status.Error(codes.Unimplemented, "oauth is not configured")
+	}
+
+	caller, err := s.requireRole(accessToken, model.RoleAdmin)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := s.oauthRepo.DeleteClient(clientID)
+	if err != nil {
+		return fmt.Errorf("failed to delete oauth client: %w", err)
+	}
+	if !deleted {
+		return status.Error(codes.NotFound, "oauth client not found")
+	}
+
+	s.audit(caller.ID, model.AuditOAuthClientDeleted)
+	return nil
+}
+
+// ListOAuthConsents returns the applications the caller has authorized.
+func (s *AuthService) ListOAuthConsents(accessToken string) ([]*model.OAuthConsent, error) {
+	if !s.oauthConfigured() {
+		return nil, status.Error(codes.Unimplemented, "oauth is not configured")
+	}
+
+	user, err := s.authenticate(accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	consents, err := s.oauthRepo.ListConsents(user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list consents: %w", err)
+	}
+	return consents, nil
+}
+
+// RevokeOAuthConsent withdraws the caller's consent for a client, so the
+// next authorization request shows the consent screen again. Access tokens
+// already issued stay valid until they expire.
+func (s *AuthService) RevokeOAuthConsent(accessToken, clientID string) error {
+	if !s.oauthConfigured() {
+		return status.Error(codes.Unimplemented, "oauth is not configured")
+	}
+
+	user, err := s.authenticate(accessToken)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := s.oauthRepo.DeleteConsent(user.ID, clientID)
+	if err != nil {
+		return fmt.Errorf("failed to delete consent: %w", err)
+	}
+	if !deleted {
+		return status.Error(codes.NotFound, "consent not found")
+	}
+
+	s.auditUser(user, model.AuditOAuthConsentRevoked)
+	return nil
+}
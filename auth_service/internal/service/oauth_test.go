@@ -0,0 +1,373 @@
+package service_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/keys"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/model"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type MockOAuthRepo struct {
+	mock.Mock
+}
+
+func (m *MockOAuthRepo) CreateClient(c *model.OAuthClient) error {
+	args := m.Called(c)
+	return args.Error(0)
+}
+
+func (m *MockOAuthRepo) FindClient(id string) (*model.OAuthClient, error) {
+	args := m.Called(id)
+	if args.Get(0) != nil {
+		return args.Get(0).(*model.OAuthClient), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockOAuthRepo) ListClients() ([]*model.OAuthClient, error) {
+	args := m.Called()
+	if args.Get(0) != nil {
+		return args.Get(0).([]*model.OAuthClient), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockOAuthRepo) DeleteClient(id string) (bool, error) {
+	args := m.Called(id)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockOAuthRepo) FindConsent(userID, clientID string) (*model.OAuthConsent, error) {
+	args := m.Called(userID, clientID)
+	if args.Get(0) != nil {
+		return args.Get(0).(*model.OAuthConsent), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockOAuthRepo) SaveConsent(c *model.OAuthConsent) error {
+	args := m.Called(c)
+	return args.Error(0)
+}
+
+func (m *MockOAuthRepo) ListConsents(userID string) ([]*model.OAuthConsent, error) {
+	args := m.Called(userID)
+	if args.Get(0) != nil {
+		return args.Get(0).([]*model.OAuthConsent), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockOAuthRepo) DeleteConsent(userID, clientID string) (bool, error) {
+	args := m.Called(userID, clientID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockOAuthRepo) CreateAuthorizationCode(c *model.AuthorizationCode) error {
+	args := m.Called(c)
+	return args.Error(0)
+}
+
+func (m *MockOAuthRepo) FindAuthorizationCode(selector string) (*model.AuthorizationCode, error) {
+	args := m.Called(selector)
+	if args.Get(0) != nil {
+		return args.Get(0).(*model.AuthorizationCode), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockOAuthRepo) MarkAuthorizationCodeUsed(id, accessTokenID string) (bool, error) {
+	args := m.Called(id, accessTokenID)
+	return args.Bool(0), args.Error(1)
+}
+
+const oauthIssuer = "https://auth.club.example.com"
+
+type oauthFixture struct {
+	*testEnv
+	orepo  *MockOAuthRepo
+	public ed25519.PublicKey
+	user   *model.User
+	client *model.OAuthClient
+	access string
+}
+
+func newOAuthFixture(t *testing.T) *oauthFixture {
+	orepo := new(MockOAuthRepo)
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	key, err := keys.NewKey("k1", keys.AlgEdDSA, private)
+	require.NoError(t, err)
+	ks, err := keys.NewKeySet("k1", key)
+	require.NoError(t, err)
+
+	f := &oauthFixture{
+		testEnv: newTestService(
+			service.WithSigningKeys(ks),
+			service.WithOAuth(orepo, oauthIssuer+"/", time.Minute),
+		),
+		orepo:  orepo,
+		public: public,
+		user: &model.User{
+			ID:            uuid.New().String(),
+			UserName:      "reader",
+			DisplayName:   "Avid Reader",
+			Email:         "reader@example.com",
+			EmailVerified: true,
+		},
+		client: &model.OAuthClient{
+			ID:           "client-1",
+			Name:         "Book Tracker",
+			RedirectURIs: []string{"https://tracker.example.com/callback"},
+			Scopes:       []string{model.ScopeOpenID, model.ScopeProfile, model.ScopeEmail, model.ScopeEventsRead},
+		},
+	}
+	orepo.On("FindClient", f.client.ID).Return(f.client, nil)
+	orepo.On("FindClient", mock.Anything).Return(nil, model.ErrOAuthClientNotFound)
+
+	f.access = f.signIn(t, f.user)
+	return f
+}
+
+func pkcePair(t *testing.T) (verifier, challenge string) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	require.NoError(t, err)
+	verifier = base64.RawURLEncoding.EncodeToString(b)
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func oauthReason(t *testing.T, err error) string {
+	st, ok := status.FromError(err)
+	require.True(t, ok, "not a status error: %v", err)
+	for _, d := range st.Details() {
+		if info, ok := d.(*errdetails.ErrorInfo); ok {
+			assert.Equal(t, service.OAuthErrorDomain, info.Domain)
+			return info.Reason
+		}
+	}
+	t.Fatalf("no ErrorInfo in %v", err)
+	return ""
+}
+
+func TestOAuth_AuthorizationCodeFlow(t *testing.T) {
+	f := newOAuthFixture(t)
+	verifier, challenge := pkcePair(t)
+
+	req := service.AuthorizeRequest{
+		ResponseType:        "code",
+		ClientID:            f.client.ID,
+		RedirectURI:         f.client.RedirectURIs[0],
+		Scope:               "openid email",
+		State:               "xyz",
+		Nonce:               "n-0S6",
+		CodeChallenge:       challenge,
+		CodeChallengeMethod: "S256",
+	}
+
+	f.orepo.On("FindConsent", f.user.ID, f.client.ID).Return(nil, model.ErrConsentNotFound).Times(3)
+
+	info, err := f.svc.GetAuthorization(f.access, req)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"openid", "email"}, info.Scopes)
+	assert.False(t, info.ConsentGiven)
+
+	var stored *model.AuthorizationCode
+	f.orepo.On("SaveConsent", mock.AnythingOfType("*model.OAuthConsent")).Return(nil)
+	f.orepo.On("CreateAuthorizationCode", mock.AnythingOfType("*model.AuthorizationCode")).Run(func(args mock.Arguments) {
+		stored = args.Get(0).(*model.AuthorizationCode)
+		stored.ID = uuid.New().String()
+	}).Return(nil)
+
+	redirect, err := f.svc.Authorize(f.access, req, true)
+	require.NoError(t, err)
+	u, err := url.Parse(redirect)
+	require.NoError(t, err)
+	assert.Equal(t, "tracker.example.com", u.Host)
+	assert.Equal(t, "xyz", u.Query().Get("state"))
+	assert.Equal(t, oauthIssuer, u.Query().Get("iss"))
+	code := u.Query().Get("code")
+	require.NotEmpty(t, code)
+	assert.Equal(t, challenge, stored.CodeChallenge)
+	f.orepo.AssertCalled(t, "SaveConsent", &model.OAuthConsent{UserID: f.user.ID, ClientID: f.client.ID, Scopes: []string{"openid", "email"}})
+
+	f.orepo.On("FindAuthorizationCode", stored.Selector).Return(stored, nil)
+	tokenReq := service.TokenRequest{
+		GrantType:    "authorization_code",
+		Code:         code,
+		RedirectURI:  req.RedirectURI,
+		ClientID:     f.client.ID,
+		CodeVerifier: verifier,
+	}
+
+	t.Run("wrong verifier", func(t *testing.T) {
+		_, other := pkcePair(t)
+		bad := tokenReq
+		bad.CodeVerifier = other
+		_, err := f.svc.ExchangeAuthorizationCode(bad)
+		assert.Equal(t, service.OAuthInvalidGrant, oauthReason(t, err))
+		f.orepo.AssertNotCalled(t, "MarkAuthorizationCodeUsed", mock.Anything, mock.Anything)
+	})
+
+	var tokens *service.OAuthTokens
+	t.Run("exchange", func(t *testing.T) {
+		f.orepo.On("MarkAuthorizationCodeUsed", stored.ID, mock.AnythingOfType("string")).Run(func(args mock.Arguments) {
+			now := time.Now()
+			stored.UsedAt = &now
+			stored.AccessTokenID = args.String(1)
+		}).Return(true, nil).Once()
+
+		tokens, err = f.svc.ExchangeAuthorizationCode(tokenReq)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"openid", "email"}, tokens.Scopes)
+
+		idToken, err := jwt.Parse(tokens.IDToken, func(*jwt.Token) (any, error) { return f.public, nil },
+			jwt.WithValidMethods([]string{"EdDSA"}),
+			jwt.WithIssuer(oauthIssuer),
+			jwt.WithAudience(f.client.ID),
+		)
+		require.NoError(t, err)
+		claims := idToken.Claims.(jwt.MapClaims)
+		assert.Equal(t, f.user.ID, claims["sub"])
+		assert.Equal(t, "n-0S6", claims["nonce"])
+		assert.Equal(t, f.user.Email, claims["email"])
+		assert.Equal(t, true, claims["email_verified"])
+		assert.NotContains(t, claims, "name", "profile scope was not granted")
+	})
+
+	t.Run("access token is limited to the client", func(t *testing.T) {
+		info, err := f.svc.UserInfo(tokens.AccessToken)
+		require.NoError(t, err)
+		assert.Equal(t, f.user.ID, info.Subject)
+		assert.Equal(t, f.user.Email, *info.Email)
+		assert.Nil(t, info.Name)
+
+		_, err = f.svc.ListOAuthConsents(tokens.AccessToken)
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	})
+
+	t.Run("replay revokes the access token", func(t *testing.T) {
+		f.trepo.On("RevokeAccessToken", stored.AccessTokenID, mock.AnythingOfType("time.Time")).Return(nil)
+
+		_, err := f.svc.ExchangeAuthorizationCode(tokenReq)
+		assert.Equal(t, service.OAuthInvalidGrant, oauthReason(t, err))
+		f.trepo.AssertCalled(t, "RevokeAccessToken", stored.AccessTokenID, mock.AnythingOfType("time.Time"))
+	})
+}
+
+func TestOAuth_AuthorizeErrors(t *testing.T) {
+	f := newOAuthFixture(t)
+	_, challenge := pkcePair(t)
+	f.orepo.On("FindConsent", f.user.ID, f.client.ID).Return(nil, model.ErrConsentNotFound)
+
+	valid := service.AuthorizeRequest{
+		ResponseType:        "code",
+		ClientID:            f.client.ID,
+		RedirectURI:         f.client.RedirectURIs[0],
+		Scope:               "openid",
+		State:               "xyz",
+		CodeChallenge:       challenge,
+		CodeChallengeMethod: "S256",
+	}
+
+	t.Run("unknown redirect uri is not followed", func(t *testing.T) {
+		req := valid
+		req.RedirectURI = "https://evil.example.com/callback"
+		_, err := f.svc.Authorize(f.access, req, true)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("unknown client is not followed", func(t *testing.T) {
+		req := valid
+		req.ClientID = "unknown"
+		_, err := f.svc.Authorize(f.access, req, true)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	tests := []struct {
+		name    string
+		mutate  func(r *service.AuthorizeRequest)
+		approve bool
+		want    string
+	}{
+		{"denied", func(*service.AuthorizeRequest) {}, false, service.OAuthAccessDenied},
+		{"missing pkce", func(r *service.AuthorizeRequest) { r.CodeChallenge = "" }, true, service.OAuthInvalidRequest},
+		{"plain pkce", func(r *service.AuthorizeRequest) { r.CodeChallengeMethod = "plain" }, true, service.OAuthInvalidRequest},
+		{"token response type", func(r *service.AuthorizeRequest) { r.ResponseType = "token" }, true, service.OAuthUnsupportedResponseType},
+		{"scope not allowed", func(r *service.AuthorizeRequest) { r.Scope = "openid events:write" }, true, service.OAuthInvalidScope},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := valid
+			tt.mutate(&req)
+			redirect, err := f.svc.Authorize(f.access, req, tt.approve)
+			require.NoError(t, err)
+			u, err := url.Parse(redirect)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, u.Query().Get("error"))
+			assert.Equal(t, "xyz", u.Query().Get("state"))
+			assert.Empty(t, u.Query().Get("code"))
+		})
+	}
+	f.orepo.AssertNotCalled(t, "CreateAuthorizationCode", mock.Anything)
+}
+
+func TestOAuth_ConfidentialClientAuthentication(t *testing.T) {
+	f := newOAuthFixture(t)
+	f.client.SecretHash = "not-the-hash-of-anything"
+
+	_, err := f.svc.ExchangeAuthorizationCode(service.TokenRequest{
+		GrantType:    "authorization_code",
+		Code:         "selector.verifier",
+		ClientID:     f.client.ID,
+		ClientSecret: "guess",
+	})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	assert.Equal(t, service.OAuthInvalidClient, oauthReason(t, err))
+	f.orepo.AssertNotCalled(t, "FindAuthorizationCode", mock.Anything)
+}
+
+func TestRegisterOAuthClient_Validation(t *testing.T) {
+	f := newOAuthFixture(t)
+	f.user.Roles = []string{model.RoleAdmin}
+
+	_, _, err := f.svc.RegisterOAuthClient(f.access, "Tracker",
+		[]string{"http://tracker.example.com/callback", "https://tracker.example.com/cb#frag"},
+		[]string{"openid", "admin"}, false)
+	violations := fieldViolations(t, err)
+	assert.Contains(t, violations, "redirect_uris")
+	assert.Contains(t, violations, "scopes")
+
+	f.orepo.On("CreateClient", mock.AnythingOfType("*model.OAuthClient")).Return(nil)
+	client, secret, err := f.svc.RegisterOAuthClient(f.access, "Tracker",
+		[]string{"https://tracker.example.com/callback", "http://127.0.0.1:8765/callback"},
+		[]string{"openid", "openid", "profile"}, false)
+	require.NoError(t, err)
+	assert.NotEmpty(t, client.ID)
+	assert.NotEmpty(t, secret)
+	assert.NotContains(t, client.SecretHash, secret)
+	assert.Equal(t, []string{"openid", "profile"}, client.Scopes)
+
+	public, secret, err := f.svc.RegisterOAuthClient(f.access, "Tracker app",
+		[]string{"http://localhost/callback"}, []string{"openid"}, true)
+	require.NoError(t, err)
+	assert.Empty(t, secret)
+	assert.True(t, public.Public())
+}
@@ -0,0 +1,180 @@
+package service
+
+import (
+	"strings"
+	"time"
+
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/keys"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/mail"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/model"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/oidc"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/throttle"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/validation"
+)
+
+// Option configures optional dependencies of AuthService.
+type Option func(*AuthService)
+
+func WithAuditRepo(repo AuditRepo) Option {
+	return func(s *AuthService) {
+		s.auditRepo = repo
+	}
+}
+
+// WithSigningKeys switches access tokens from the shared HS512 secret to the
+// active key of ks. Tokens signed with the secret are no longer accepted
+// unless WithSharedSecretUntil keeps them valid for a while.
+func WithSigningKeys(ks *keys.KeySet) Option {
+	return func(s *AuthService) {
+		s.keys = ks
+	}
+}
+
+// WithSharedSecretUntil keeps accepting tokens signed with the shared secret
+// until t after switching to signing keys, so sessions started before the
+// switch do not end at once. Set t no later than the last such token expires.
+func WithSharedSecretUntil(t time.Time) Option {
+	return func(s *AuthService) {
+		s.secretAcceptedUntil = t
+	}
+}
+
+// WithTokenClaims sets the iss and aud claims written to and required from
+// access tokens, and the clock skew tolerated when checking exp, nbf and iat.
+func WithTokenClaims(issuer, audience string, leeway time.Duration) Option {
+	return func(s *AuthService) {
+		s.issuer = issuer
+		s.audience = audience
+		s.leeway = leeway
+	}
+}
+
+// WithLegacyClaims keeps the user_id/token_id/expires_at claim shape working
+// during the migration to registered claims: new tokens carry both shapes and
+// tokens with only the old shape are still accepted.
+func WithLegacyClaims(accept bool) Option {
+	return func(s *AuthService) {
+		s.acceptLegacyClaims = accept
+	}
+}
+
+func WithActionTokenRepo(repo ActionTokenRepo) Option {
+	return func(s *AuthService) {
+		s.actionRepo = repo
+	}
+}
+
+func WithMailer(m mail.Mailer) Option {
+	return func(s *AuthService) {
+		s.mailer = m
+	}
+}
+
+// WithPasswordReset sets how long reset tokens stay valid and the URL of the
+// page the reset link points to. The token is added as the token parameter.
+func WithPasswordReset(ttl time.Duration, resetURL string) Option {
+	return func(s *AuthService) {
+		s.resetTTL = ttl
+		s.resetURL = resetURL
+	}
+}
+
+// WithEmailVerification enables verification mails on registration. ttl is
+// how long the link stays valid, verifyURL the page it points to and cooldown
+// the minimum time between two resend requests.
+func WithEmailVerification(ttl time.Duration, verifyURL string, cooldown time.Duration) Option {
+	return func(s *AuthService) {
+		s.verificationTTL = ttl
+		s.verificationURL = verifyURL
+		s.verificationCooldown = cooldown
+	}
+}
+
+// WithMagicLink enables passwordless login links. ttl is how long a link
+// stays valid and loginURL the page it points to.
+func WithMagicLink(ttl time.Duration, loginURL string) Option {
+	return func(s *AuthService) {
+		s.magicLinkTTL = ttl
+		s.magicLinkURL = loginURL
+	}
+}
+
+// WithLoginThrottle slows down repeated failed logins per account and per
+// client IP. Either limiter may be nil.
+func WithLoginThrottle(account, ip *throttle.Limiter) Option {
+	return func(s *AuthService) {
+		s.accountLimiter = account
+		s.ipLimiter = ip
+	}
+}
+
+// WithMFA enables TOTP two-factor authentication. issuer is the account
+// label shown in authenticator apps and challengeTTL how long a user has to
+// enter the code after the password was accepted.
+func WithMFA(repo MFARepo, issuer string, challengeTTL time.Duration) Option {
+	return func(s *AuthService) {
+		s.mfaRepo = repo
+		s.mfaIssuer = issuer
+		s.mfaChallengeTTL = challengeTTL
+	}
+}
+
+// WithPasswordHasher replaces the default argon2id hasher.
+func WithPasswordHasher(h PasswordHasher) Option {
+	return func(s *AuthService) {
+		s.hasher = h
+	}
+}
+
+// WithValidationPolicy replaces the default username and password rules.
+func WithValidationPolicy(p *validation.Policy) Option {
+	return func(s *AuthService) {
+		s.policy = p
+	}
+}
+
+// WithPersonalAccessTokens lets users create long-lived tokens for scripts
+// and integrations.
+func WithPersonalAccessTokens(repo PersonalTokenRepo) Option {
+	return func(s *AuthService) {
+		s.personalTokenRepo = repo
+	}
+}
+
+// WithOAuth turns the service into an OAuth 2.0 and OpenID Connect provider.
+// issuerURL is the public base URL of the gateway; it is the iss of ID tokens
+// and the base of the endpoints in the discovery document. codeTTL limits how
+// long an authorization code can be exchanged. ID tokens are signed with the
+// signing keys, so WithSigningKeys is required as well.
+func WithOAuth(repo OAuthRepo, issuerURL string, codeTTL time.Duration) Option {
+	return func(s *AuthService) {
+		s.oauthRepo = repo
+		s.oauthIssuer = strings.TrimRight(issuerURL, "/")
+		s.oauthCodeTTL = codeTTL
+	}
+}
+
+// WithFederation lets users sign in with accounts at upstream OpenID Connect
+// providers. stateTTL limits how long a user may take at the provider.
+func WithFederation(repo IdentityRepo, stateTTL time.Duration, providers ...*oidc.Provider) Option {
+	return func(s *AuthService) {
+		s.identityRepo = repo
+		s.federationStateTTL = stateTTL
+		s.identityProviders = providers
+	}
+}
+
+// WithImpersonationTTL sets how long impersonation tokens stay valid. They
+// never outlive a regular access token.
+func WithImpersonationTTL(ttl time.Duration) Option {
+	return func(s *AuthService) {
+		s.impersonationTTL = ttl
+	}
+}
+
+type nopAuditRepo struct{}
+
+func (nopAuditRepo) CreateAuditEvent(*model.AuditEvent) error { return nil }
+func (nopAuditRepo) ListAuditEvents(model.AuditFilter) ([]*model.AuditEvent, error) {
+	return nil, nil
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/mail"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/model"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/validation"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const passwordResetBody = `Someone asked to reset the password of your account %s.
+
+Open the link below to choose a new password. It expires in %s and can only be used once.
+
+%s
+
+If you did not ask for this, you can ignore this message.
+`
+
+// RequestPasswordReset mails a reset link to the owner of email. Unknown
+// addresses are not reported so the RPC cannot be used to probe for accounts.
+func (s *AuthService) RequestPasswordReset(email string) error {
+	if s.actionRepo == nil || s.mailer == nil {
+		return status.Error(codes.Unimplemented, "password reset is not configured")
+	}
+	email = validation.FoldEmail(email)
+	if email == "" {
+		return status.Error(codes.InvalidArgument, "email is required")
+	}
+
+	user, err := s.userRepo.FindByEmail(email)
+	if err != nil {
+		log.Printf("Password reset requested for unknown email %s", email)
+		return nil
+	}
+
+	token, err := s.createActionToken(user.ID, model.ActionPasswordReset, s.resetTTL)
+	if err != nil {
+		return fmt.Errorf("failed to create reset token: %w", err)
+	}
+	link, err := actionLink(s.resetURL, token)
+	if err != nil {
+		return err
+	}
+
+	err = s.mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body:    fmt.Sprintf(passwordResetBody, user.UserName, s.resetTTL, link),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send reset mail: %w", err)
+	}
+
+	return nil
+}
+
+// ResetPassword sets a new password for the owner of a reset token and ends
+// all of their sessions.
+func (s *AuthService) ResetPassword(token, newPassword string) error {
+	if s.actionRepo == nil {
+		return status.Error(codes.Unimplemented, "password reset is not configured")
+	}
+	if violations := s.policy.CheckPassword("new_password", newPassword); len(violations) > 0 {
+		return invalidFields(violations)
+	}
+
+	t, err := s.consumeActionToken(model.ActionPasswordReset, token)
+	if err != nil {
+		log.Printf("Rejected password reset token: %v", err)
+		return status.Error(codes.InvalidArgument, "invalid or expired reset token")
+	}
+
+	hashed, err := s.hasher.Hash(newPassword)
+	if err != nil {
+		return fmt.Errorf("hash password: %w", err)
+	}
+	if err := s.userRepo.UpdatePassword(t.UserID, hashed); err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+
+	if err := s.revokeUserSessions(t.UserID); err != nil {
+		return err
+	}
+
+	s.audit(t.UserID, model.AuditPasswordReset)
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package service_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/model"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var withPasswordReset = service.WithPasswordReset(time.Hour, "https://club.example.com/reset-password")
+
+func TestRequestPasswordReset_UnknownEmail(t *testing.T) {
+	e := newTestService(withPasswordReset)
+	e.urepo.On("FindByEmail", "nobody@example.com").Return(nil, errors.New("not found"))
+
+	err := e.svc.RequestPasswordReset("nobody@example.com")
+
+	assert.NoError(t, err)
+	assert.Empty(t, e.mailer.sent)
+	e.actions.AssertNotCalled(t, "CreateActionToken", mock.Anything)
+}
+
+func TestPasswordReset(t *testing.T) {
+	e := newTestService(withPasswordReset)
+
+	user := &model.User{ID: uuid.New().String(), UserName: "reader", Email: "reader@example.com"}
+	e.urepo.On("FindByEmail", user.Email).Return(user, nil)
+
+	var stored *model.ActionToken
+	e.actions.On("DeleteActionTokens", user.ID, model.ActionPasswordReset).Return(nil)
+	e.actions.On("CreateActionToken", mock.AnythingOfType("*model.ActionToken")).Run(func(args mock.Arguments) {
+		stored = args.Get(0).(*model.ActionToken)
+		stored.ID = uuid.New().String()
+	}).Return(nil)
+
+	require.NoError(t, e.svc.RequestPasswordReset(user.Email))
+
+	require.Len(t, e.mailer.sent, 1)
+	assert.Equal(t, user.Email, e.mailer.sent[0].To)
+	token := tokenFromMail(t, e.mailer.sent[0])
+	selector, verifier, ok := strings.Cut(token, ".")
+	require.True(t, ok)
+	assert.Equal(t, stored.Selector, selector)
+	assert.NotContains(t, stored.TokenHash, verifier)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), stored.ExpiresAt, time.Minute)
+
+	e.actions.On("FindActionToken", model.ActionPasswordReset, selector).Return(stored, nil)
+
+	t.Run("wrong verifier", func(t *testing.T) {
+		err := e.svc.ResetPassword(selector+".forged", "new-password")
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		e.actions.AssertNotCalled(t, "MarkActionTokenUsed", mock.Anything)
+	})
+
+	t.Run("reset revokes sessions", func(t *testing.T) {
+		e.actions.On("MarkActionTokenUsed", stored.ID).Return(true, nil).Once()
+		e.urepo.On("UpdatePassword", user.ID, mock.AnythingOfType("string")).Return(nil)
+		e.trepo.On("DeleteByUserID", user.ID).Return([]string{"access-1"}, nil)
+		e.trepo.On("RevokeAccessToken", "access-1", mock.AnythingOfType("time.Time")).Return(nil)
+
+		err := e.svc.ResetPassword(token, "new-password")
+		assert.NoError(t, err)
+
+		e.urepo.AssertCalled(t, "UpdatePassword", user.ID, mock.AnythingOfType("string"))
+		e.trepo.AssertCalled(t, "DeleteByUserID", user.ID)
+		e.trepo.AssertCalled(t, "RevokeAccessToken", "access-1", mock.AnythingOfType("time.Time"))
+	})
+
+	t.Run("token is single use", func(t *testing.T) {
+		e.actions.On("MarkActionTokenUsed", stored.ID).Return(false, nil).Once()
+
+		err := e.svc.ResetPassword(token, "another-password")
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		e.urepo.AssertNumberOfCalls(t, "UpdatePassword", 1)
+	})
+}
+
+func TestResetPassword_ExpiredToken(t *testing.T) {
+	e := newTestService(withPasswordReset)
+	e.actions.On("FindActionToken", model.ActionPasswordReset, "selector").Return(nil, errors.New("invalid action token"))
+
+	err := e.svc.ResetPassword("selector.verifier", "new-password")
+
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	e.urepo.AssertNotCalled(t, "UpdatePassword", mock.Anything, mock.Anything)
+}
@@ -0,0 +1,198 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/model"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/validation"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// PersonalTokenPrefix starts every personal access token, so that they can be
+// told apart from JWTs without a lookup and are easy to find by secret
+// scanners.
+const PersonalTokenPrefix = "rcpat_"
+
+const (
+	maxPersonalTokens          = 50
+	maxPersonalTokenNameLength = 64
+)
+
+// IsPersonalToken reports whether token looks like a personal access token.
+func IsPersonalToken(token string) bool {
+	return strings.HasPrefix(token, PersonalTokenPrefix)
+}
+
+func (s *AuthService) personalTokensConfigured() bool {
+	return s.personalTokenRepo != nil
+}
+
+// CreatePersonalToken issues a token for the caller limited to scopes. A nil
+// expiresAt creates a token that does not expire. The token is returned only
+// here; just its hash is stored.
+func (s *AuthService) CreatePersonalToken(accessToken, name string, scopes []string, expiresAt *time.Time) (string, *model.PersonalAccessToken, error) {
+	if !s.personalTokensConfigured() {
+		return "", nil, status.Error(codes.Unimplemented, "personal access tokens are not configured")
+	}
+
+	user, err := s.authenticateOwner(accessToken, "create_personal_token")
+	if err != nil {
+		return "", nil, err
+	}
+
+	name = strings.TrimSpace(name)
+	scopes, violations := checkPersonalToken(name, scopes, expiresAt)
+	if len(violations) > 0 {
+		return "", nil, invalidFields(violations)
+	}
+
+	count, err := s.personalTokenRepo.CountPersonalTokens(user.ID)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to count personal access tokens: %w", err)
+	}
+	if count >= maxPersonalTokens {
+		return "", nil, status.Errorf(codes.FailedPrecondition, "at most %d personal access tokens are allowed, revoke one first", maxPersonalTokens)
+	}
+
+	token, selector, verifierHash, err := generateSplitToken()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to generate personal access token: %w", err)
+	}
+
+	pat := &model.PersonalAccessToken{
+		UserID:    user.ID,
+		Name:      name,
+		Scopes:    scopes,
+		Selector:  selector,
+		TokenHash: verifierHash,
+		ExpiresAt: expiresAt,
+	}
+	if err := s.personalTokenRepo.CreatePersonalToken(pat); err != nil {
+		return "", nil, fmt.Errorf("failed to store personal access token: %w", err)
+	}
+
+	s.audit(user.ID, model.AuditPersonalTokenCreated)
+	return PersonalTokenPrefix + token, pat, nil
+}
+
+// checkPersonalToken validates the fields of a new token and returns the
+// scopes without duplicates.
+func checkPersonalToken(name string, scopes []string, expiresAt *time.Time) ([]string, []validation.Violation) {
+	var violations []validation.Violation
+
+	switch {
+	case name == "":
+		violations = append(violations, validation.Violation{Field: "name", Description: "name is required"})
+	case utf8.RuneCountInString(name) > maxPersonalTokenNameLength:
+		violations = append(violations, validation.Violation{Field: "name", Description: fmt.Sprintf("name must be at most %d characters long", maxPersonalTokenNameLength)})
+	case strings.IndexFunc(name, unicode.IsControl) >= 0:
+		violations = append(violations, validation.Violation{Field: "name", Description: "name must not contain control characters"})
+	}
+
+	var unique []string
+	for _, scope := range scopes {
+		if !slices.Contains(model.PersonalTokenScopes, scope) {
+			violations = append(violations, validation.Violation{Field: "scopes", Description: fmt.Sprintf("unknown scope %q", scope)})
+			continue
+		}
+		if !slices.Contains(unique, scope) {
+			unique = append(unique, scope)
+		}
+	}
+	if len(scopes) == 0 {
+		violations = append(violations, validation.Violation{Field: "scopes", Description: "at least one scope is required"})
+	}
+
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		violations = append(violations, validation.Violation{Field: "expires_at", Description: "expiry must be in the future"})
+	}
+
+	return unique, violations
+}
+
+// ListPersonalTokens returns the caller's tokens, expired ones included.
+func (s *AuthService) ListPersonalTokens(accessToken string) ([]*model.PersonalAccessToken, error) {
+	if !s.personalTokensConfigured() {
+		return nil, status.Error(codes.Unimplemented, "personal access tokens are not configured")
+	}
+
+	user, err := s.authenticate(accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := s.personalTokenRepo.ListPersonalTokens(user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list personal access tokens: %w", err)
+	}
+	return tokens, nil
+}
+
+// RevokePersonalToken deletes one of the caller's tokens. Tokens of other
+// users are reported as not found.
+func (s *AuthService) RevokePersonalToken(accessToken, tokenID string) error {
+	if !s.personalTokensConfigured() {
+		return status.Error(codes.Unimplemented, "personal access tokens are not configured")
+	}
+
+	user, err := s.authenticate(accessToken)
+	if err != nil {
+		return err
+	}
+
+	if _, err := uuid.Parse(tokenID); err != nil {
+		return status.Error(codes.NotFound, "personal access token not found")
+	}
+
+	deleted, err := s.personalTokenRepo.DeletePersonalToken(user.ID, tokenID)
+	if err != nil {
+		return fmt.Errorf("failed to delete personal access token: %w", err)
+	}
+	if !deleted {
+		return status.Error(codes.NotFound, "personal access token not found")
+	}
+
+	s.auditUser(user, model.AuditPersonalTokenRevoked)
+	return nil
+}
+
+// ValidatePersonalToken checks a personal access token and returns its owner
+// together with the stored token, whose scopes limit what it may be used for.
+func (s *AuthService) ValidatePersonalToken(rawToken string) (*model.User, *model.PersonalAccessToken, error) {
+	if !s.personalTokensConfigured() {
+		return nil, nil, status.Error(codes.Unauthenticated, "invalid token")
+	}
+
+	selector, verifier, ok := parseSplitToken(strings.TrimPrefix(rawToken, PersonalTokenPrefix))
+	if !ok || !IsPersonalToken(rawToken) {
+		return nil, nil, status.Error(codes.Unauthenticated, "invalid token")
+	}
+
+	pat, err := s.personalTokenRepo.FindPersonalToken(selector)
+	if err != nil {
+		log.Printf("Rejected personal access token: %v", err)
+		return nil, nil, status.Error(codes.Unauthenticated, "invalid token")
+	}
+	if !verifierMatches(verifier, pat.TokenHash) {
+		return nil, nil, status.Error(codes.Unauthenticated, "invalid token")
+	}
+
+	user, err := s.userRepo.FindByID(pat.UserID)
+	if err != nil || user.Suspended() {
+		return nil, nil, status.Error(codes.Unauthenticated, "invalid token")
+	}
+
+	if err := s.personalTokenRepo.TouchPersonalToken(pat.ID); err != nil {
+		log.Printf("Failed to record use of personal access token %s: %v", pat.ID, err)
+	}
+
+	return user, pat, nil
+}
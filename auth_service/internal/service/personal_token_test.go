@@ -0,0 +1,145 @@
+package service_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/model"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type MockPersonalTokenRepo struct {
+	mock.Mock
+}
+
+func (m *MockPersonalTokenRepo) CreatePersonalToken(t *model.PersonalAccessToken) error {
+	args := m.Called(t)
+	return args.Error(0)
+}
+
+func (m *MockPersonalTokenRepo) FindPersonalToken(selector string) (*model.PersonalAccessToken, error) {
+	args := m.Called(selector)
+	if args.Get(0) != nil {
+		return args.Get(0).(*model.PersonalAccessToken), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockPersonalTokenRepo) ListPersonalTokens(userID string) ([]*model.PersonalAccessToken, error) {
+	args := m.Called(userID)
+	if args.Get(0) != nil {
+		return args.Get(0).([]*model.PersonalAccessToken), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockPersonalTokenRepo) CountPersonalTokens(userID string) (int, error) {
+	args := m.Called(userID)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockPersonalTokenRepo) DeletePersonalToken(userID, id string) (bool, error) {
+	args := m.Called(userID, id)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockPersonalTokenRepo) TouchPersonalToken(id string) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func TestPersonalToken_CreateAndValidate(t *testing.T) {
+	prepo := new(MockPersonalTokenRepo)
+	f := newProfileFixture(t, service.WithPersonalAccessTokens(prepo))
+
+	var stored *model.PersonalAccessToken
+	prepo.On("CountPersonalTokens", f.user.ID).Return(0, nil)
+	prepo.On("CreatePersonalToken", mock.AnythingOfType("*model.PersonalAccessToken")).
+		Run(func(args mock.Arguments) {
+			stored = args.Get(0).(*model.PersonalAccessToken)
+			stored.ID = uuid.NewString()
+		}).Return(nil)
+
+	raw, pat, err := f.svc.CreatePersonalToken(f.access, " calendar sync ",
+		[]string{model.ScopeEventsRead, model.ScopeEventsRead}, nil)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(raw, service.PersonalTokenPrefix))
+	assert.Equal(t, "calendar sync", pat.Name)
+	assert.Equal(t, []string{model.ScopeEventsRead}, pat.Scopes)
+	assert.NotContains(t, raw, stored.TokenHash, "only the hash is stored")
+
+	prepo.On("FindPersonalToken", stored.Selector).Return(stored, nil)
+	prepo.On("TouchPersonalToken", stored.ID).Return(nil)
+
+	user, found, err := f.svc.ValidatePersonalToken(raw)
+	require.NoError(t, err)
+	assert.Equal(t, f.user.ID, user.ID)
+	assert.True(t, found.HasScope(model.ScopeEventsRead))
+	assert.False(t, found.HasScope(model.ScopeEventsWrite))
+	prepo.AssertCalled(t, "TouchPersonalToken", stored.ID)
+
+	_, _, err = f.svc.ValidatePersonalToken(raw + "x")
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	t.Run("cannot manage tokens with a personal token", func(t *testing.T) {
+		_, err := f.svc.ListPersonalTokens(raw)
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	})
+}
+
+func TestPersonalToken_InvalidFields(t *testing.T) {
+	prepo := new(MockPersonalTokenRepo)
+	f := newProfileFixture(t, service.WithPersonalAccessTokens(prepo))
+
+	past := time.Now().Add(-time.Hour)
+	_, _, err := f.svc.CreatePersonalToken(f.access, "", []string{"admin"}, &past)
+	violations := fieldViolations(t, err)
+	assert.Contains(t, violations, "name")
+	assert.Contains(t, violations, "scopes")
+	assert.Contains(t, violations, "expires_at")
+
+	_, _, err = f.svc.CreatePersonalToken(f.access, "script", nil, nil)
+	assert.Contains(t, fieldViolations(t, err), "scopes")
+
+	prepo.AssertNotCalled(t, "CreatePersonalToken", mock.Anything)
+}
+
+func TestPersonalToken_Limit(t *testing.T) {
+	prepo := new(MockPersonalTokenRepo)
+	f := newProfileFixture(t, service.WithPersonalAccessTokens(prepo))
+	prepo.On("CountPersonalTokens", f.user.ID).Return(50, nil)
+
+	_, _, err := f.svc.CreatePersonalToken(f.access, "one too many", []string{model.ScopeEventsRead}, nil)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+func TestRevokePersonalToken(t *testing.T) {
+	prepo := new(MockPersonalTokenRepo)
+	f := newProfileFixture(t, service.WithPersonalAccessTokens(prepo))
+	id := uuid.NewString()
+
+	prepo.On("DeletePersonalToken", f.user.ID, id).Return(true, nil).Once()
+	require.NoError(t, f.svc.RevokePersonalToken(f.access, id))
+
+	prepo.On("DeletePersonalToken", f.user.ID, id).Return(false, nil).Once()
+	assert.Equal(t, codes.NotFound, status.Code(f.svc.RevokePersonalToken(f.access, id)))
+
+	assert.Equal(t, codes.NotFound, status.Code(f.svc.RevokePersonalToken(f.access, "not-a-uuid")))
+}
+
+func TestPersonalToken_NotConfigured(t *testing.T) {
+	f := newProfileFixture(t)
+
+	_, _, err := f.svc.CreatePersonalToken(f.access, "script", []string{model.ScopeEventsRead}, nil)
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+
+	_, _, err = f.svc.ValidatePersonalToken(service.PersonalTokenPrefix + "a.b")
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
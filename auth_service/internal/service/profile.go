@@ -0,0 +1,201 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/mail"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/model"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/validation"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const emailChangedNoticeBody = `Hello %s,
+
+the email address of your reading club account was changed to %s.
+
+If you did not do this, reset your password and contact us.
+`
+
+// conflictError maps the unique constraint errors of the user repository to
+// AlreadyExists. Other errors give nil.
+func conflictError(err error) error {
+	if errors.Is(err, model.ErrUserNameTaken) || errors.Is(err, model.ErrEmailTaken) {
+		return status.Error(codes.AlreadyExists, err.Error())
+	}
+	return nil
+}
+
+// confirmPassword guards changes a stolen access token alone must not be
+// able to make. Wrong passwords count against the login throttle.
+func (s *AuthService) confirmPassword(user *model.User, password string) error {
+	if err := s.checkLoginThrottle(user.Email, model.ClientInfo{}); err != nil {
+		return err
+	}
+
+	ok, _, err := s.hasher.Verify(password, user.PasswordHash)
+	if err != nil {
+		log.Printf("Failed to verify password of user %s: %v", user.ID, err)
+	}
+	if !ok {
+		s.recordLoginFailure(user.Email, user, model.ClientInfo{}, loginFailureInvalidCurrentPassword)
+		return status.Error(codes.PermissionDenied, "current password is incorrect")
+	}
+
+	s.resetLoginThrottle(user.Email)
+	return nil
+}
+
+// GetUser returns the caller.
+func (s *AuthService) GetUser(accessToken string) (*model.User, error) {
+	return s.authenticate(accessToken)
+}
+
+// UpdateProfile changes the non-nil fields of p for the caller.
+func (s *AuthService) UpdateProfile(accessToken string, p model.ProfileUpdate) (*model.User, error) {
+	user, err := s.authenticate(accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	var violations []validation.Violation
+	if p.UserName != nil {
+		violations = append(violations, s.policy.CheckUsername("user_name", *p.UserName)...)
+	}
+	if p.DisplayName != nil {
+		trimmed := strings.TrimSpace(*p.DisplayName)
+		p.DisplayName = &trimmed
+		violations = append(violations, s.policy.CheckDisplayName("display_name", trimmed)...)
+	}
+	if p.Bio != nil {
+		violations = append(violations, s.policy.CheckBio("bio", *p.Bio)...)
+	}
+	if len(violations) > 0 {
+		return nil, invalidFields(violations)
+	}
+
+	if p.UserName == nil && p.DisplayName == nil && p.Bio == nil {
+		return user, nil
+	}
+
+	if err := s.userRepo.UpdateProfile(user.ID, p); err != nil {
+		if conflict := conflictError(err); conflict != nil {
+			return nil, conflict
+		}
+		return nil, fmt.Errorf("failed to update profile: %w", err)
+	}
+	s.auditUser(user, model.AuditProfileUpdated)
+
+	return s.userRepo.FindByID(user.ID)
+}
+
+// ChangeEmail moves the caller to a new address. The new address starts out
+// unverified and gets a verification link; the old one gets a notice.
+func (s *AuthService) ChangeEmail(accessToken, currentPassword, newEmail string) (*model.User, error) {
+	user, err := s.authenticateOwner(accessToken, "change_email")
+	if err != nil {
+		return nil, err
+	}
+
+	email, violations := validation.NormalizeEmail("new_email", newEmail)
+	if len(violations) > 0 {
+		return nil, invalidFields(violations)
+	}
+	if err := s.confirmPassword(user, currentPassword); err != nil {
+		return nil, err
+	}
+	if email == user.Email {
+		return user, nil
+	}
+
+	if err := s.userRepo.UpdateEmail(user.ID, email); err != nil {
+		if conflict := conflictError(err); conflict != nil {
+			return nil, conflict
+		}
+		return nil, fmt.Errorf("failed to update email: %w", err)
+	}
+	s.audit(user.ID, model.AuditEmailChanged)
+
+	oldEmail := user.Email
+	user.Email = email
+	user.EmailVerified = false
+
+	if s.mailer != nil {
+		err := s.mailer.Send(mail.Message{
+			To:      oldEmail,
+			Subject: "Your email address was changed",
+			Body:    fmt.Sprintf(emailChangedNoticeBody, user.UserName, email),
+		})
+		if err != nil {
+			log.Printf("Failed to notify user %s about the email change: %v", user.ID, err)
+		}
+	}
+	if s.emailVerificationEnabled() {
+		if err := s.sendVerificationEmail(user, emailChangeBody); err != nil {
+			log.Printf("Failed to send verification email to user %s: %v", user.ID, err)
+		}
+	}
+
+	return user, nil
+}
+
+// ChangePassword sets a new password for the caller and ends all of their
+// sessions. The caller gets a fresh token pair to stay signed in.
+func (s *AuthService) ChangePassword(accessToken, currentPassword, newPassword string, client model.ClientInfo) (*model.User, *model.Token, error) {
+	user, err := s.authenticateOwner(accessToken, "change_password")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if violations := s.policy.CheckPassword("new_password", newPassword); len(violations) > 0 {
+		return nil, nil, invalidFields(violations)
+	}
+	if err := s.confirmPassword(user, currentPassword); err != nil {
+		return nil, nil, err
+	}
+
+	hashed, err := s.hasher.Hash(newPassword)
+	if err != nil {
+		return nil, nil, fmt.Errorf("hash password: %w", err)
+	}
+	if err := s.userRepo.UpdatePassword(user.ID, hashed); err != nil {
+		return nil, nil, fmt.Errorf("failed to update password: %w", err)
+	}
+	s.auditClient(user.ID, model.AuditPasswordChanged, client)
+
+	if err := s.revokeUserSessions(user.ID); err != nil {
+		return nil, nil, err
+	}
+
+	tokens, err := s.GenerateTokens(user.ID, client)
+	if err != nil {
+		return nil, nil, err
+	}
+	return user, tokens, nil
+}
+
+// DeleteAccount removes the caller after checking their password. Access
+// tokens are revoked first since the revocation list does not reference
+// users.
+func (s *AuthService) DeleteAccount(accessToken, password string) error {
+	user, err := s.authenticateOwner(accessToken, "delete_account")
+	if err != nil {
+		return err
+	}
+	if err := s.confirmPassword(user, password); err != nil {
+		return err
+	}
+
+	if err := s.revokeUserSessions(user.ID); err != nil {
+		return err
+	}
+	if err := s.userRepo.DeleteUser(user.ID); err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+	s.audit(user.ID, model.AuditAccountDeleted)
+
+	return nil
+}
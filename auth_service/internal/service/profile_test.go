@@ -0,0 +1,148 @@
+package service_test
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/model"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/password"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type profileFixture struct {
+	*testEnv
+	user   *model.User
+	access string
+}
+
+func newProfileFixture(t *testing.T, opts ...service.Option) *profileFixture {
+	hasher, err := password.NewHasher(password.AlgArgon2id, password.Argon2Params{Memory: 1024, Iterations: 1, Parallelism: 1}, 0)
+	require.NoError(t, err)
+	hash, err := hasher.Hash("current-password")
+	require.NoError(t, err)
+
+	f := &profileFixture{
+		testEnv: newTestService(append([]service.Option{service.WithPasswordHasher(hasher)}, opts...)...),
+		user: &model.User{
+			ID:            uuid.New().String(),
+			UserName:      "reader",
+			Email:         "reader@example.com",
+			PasswordHash:  hash,
+			EmailVerified: true,
+		},
+	}
+	f.access = f.signIn(t, f.user)
+	return f
+}
+
+func strPtr(s string) *string { return &s }
+
+func TestGetUser(t *testing.T) {
+	f := newProfileFixture(t)
+
+	user, err := f.svc.GetUser(f.access)
+	require.NoError(t, err)
+	assert.Equal(t, f.user.ID, user.ID)
+
+	_, err = f.svc.GetUser("garbage")
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestUpdateProfile(t *testing.T) {
+	f := newProfileFixture(t)
+
+	t.Run("only given fields are changed", func(t *testing.T) {
+		f.urepo.On("UpdateProfile", f.user.ID, mock.MatchedBy(func(p model.ProfileUpdate) bool {
+			return p.UserName == nil && *p.DisplayName == "Anna K." && p.Bio == nil
+		})).Return(nil).Once()
+
+		_, err := f.svc.UpdateProfile(f.access, model.ProfileUpdate{DisplayName: strPtr("  Anna K. ")})
+		require.NoError(t, err)
+	})
+
+	t.Run("invalid fields", func(t *testing.T) {
+		_, err := f.svc.UpdateProfile(f.access, model.ProfileUpdate{UserName: strPtr("a b"), DisplayName: strPtr("x\ny")})
+		fields := fieldViolations(t, err)
+		assert.Contains(t, fields, "user_name")
+		assert.Contains(t, fields, "display_name")
+	})
+
+	t.Run("user name taken", func(t *testing.T) {
+		f.urepo.On("UpdateProfile", f.user.ID, mock.Anything).Return(model.ErrUserNameTaken).Once()
+
+		_, err := f.svc.UpdateProfile(f.access, model.ProfileUpdate{UserName: strPtr("someone")})
+		assert.Equal(t, codes.AlreadyExists, status.Code(err))
+	})
+}
+
+func TestChangeEmail(t *testing.T) {
+	f := newProfileFixture(t, withEmailVerification)
+	f.actions.On("DeleteActionTokens", f.user.ID, model.ActionEmailVerification).Return(nil)
+	f.actions.On("CreateActionToken", mock.AnythingOfType("*model.ActionToken")).Return(nil)
+
+	t.Run("wrong password", func(t *testing.T) {
+		_, err := f.svc.ChangeEmail(f.access, "wrong", "new@example.com")
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+		f.urepo.AssertNotCalled(t, "UpdateEmail", mock.Anything, mock.Anything)
+	})
+
+	t.Run("new address must be verified", func(t *testing.T) {
+		f.urepo.On("UpdateEmail", f.user.ID, "new@example.com").Return(nil).Once()
+
+		user, err := f.svc.ChangeEmail(f.access, "current-password", " New@Example.com")
+		require.NoError(t, err)
+		assert.Equal(t, "new@example.com", user.Email)
+		assert.False(t, user.EmailVerified)
+
+		require.Len(t, f.mailer.sent, 2)
+		assert.Equal(t, "reader@example.com", f.mailer.sent[0].To, "old address is notified")
+		assert.Equal(t, "new@example.com", f.mailer.sent[1].To)
+		assert.NotEmpty(t, tokenFromMail(t, f.mailer.sent[1]))
+	})
+}
+
+func TestChangePassword(t *testing.T) {
+	f := newProfileFixture(t)
+
+	t.Run("policy is checked", func(t *testing.T) {
+		_, _, err := f.svc.ChangePassword(f.access, "current-password", "short", model.ClientInfo{})
+		assert.Contains(t, fieldViolations(t, err), "new_password")
+	})
+
+	t.Run("wrong current password", func(t *testing.T) {
+		_, _, err := f.svc.ChangePassword(f.access, "wrong", "a new password", model.ClientInfo{})
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+		f.urepo.AssertNotCalled(t, "UpdatePassword", mock.Anything, mock.Anything)
+	})
+
+	t.Run("sessions are replaced", func(t *testing.T) {
+		f.urepo.On("UpdatePassword", f.user.ID, mock.AnythingOfType("string")).Return(nil).Once()
+		f.trepo.On("DeleteByUserID", f.user.ID).Return([]string{"old-access-id"}, nil).Once()
+		f.trepo.On("RevokeAccessToken", "old-access-id", mock.AnythingOfType("time.Time")).Return(nil).Once()
+
+		_, tokens, err := f.svc.ChangePassword(f.access, "current-password", "a new password", model.ClientInfo{})
+		require.NoError(t, err)
+		assert.NotEmpty(t, tokens.AccessToken)
+		assert.NotEmpty(t, tokens.RefreshToken)
+		f.trepo.AssertExpectations(t)
+	})
+}
+
+func TestDeleteAccount(t *testing.T) {
+	f := newProfileFixture(t)
+
+	err := f.svc.DeleteAccount(f.access, "wrong")
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	f.urepo.AssertNotCalled(t, "DeleteUser", mock.Anything)
+
+	f.trepo.On("DeleteByUserID", f.user.ID).Return([]string{}, nil).Once()
+	f.urepo.On("DeleteUser", f.user.ID).Return(nil).Once()
+
+	require.NoError(t, f.svc.DeleteAccount(f.access, "current-password"))
+	f.urepo.AssertExpectations(t)
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/model"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// authenticate resolves the caller of an RPC from its access token.
+func (s *AuthService) authenticate(accessToken string) (*model.User, error) {
+	user, _, err := s.authenticateClaims(accessToken)
+	return user, err
+}
+
+func (s *AuthService) authenticateClaims(accessToken string) (*model.User, *accessTokenClaims, error) {
+	user, claims, ok := s.checkAccessToken(accessToken)
+	// Tokens issued to OAuth clients only grant their scopes, never the
+	// account management calls that authenticate guards.
+	if !ok || claims.ClientID != "" {
+		return nil, nil, status.Error(codes.Unauthenticated, "invalid access token")
+	}
+	return user, claims, nil
+}
+
+func (s *AuthService) requireRole(accessToken, role string) (*model.User, error) {
+	caller, err := s.authenticate(accessToken)
+	if err != nil {
+		return nil, err
+	}
+	// Impersonation tokens never carry the privileges of a role, even if
+	// the impersonated user was granted one meanwhile.
+	if caller.ImpersonatorID != "" {
+		return nil, status.Error(codes.PermissionDenied, "not allowed while impersonating")
+	}
+	if !caller.HasRole(role) {
+		return nil, status.Errorf(codes.PermissionDenied, "%s role required", role)
+	}
+	return caller, nil
+}
+
+func (s *AuthService) GrantRole(accessToken, userID, role string) (*model.User, error) {
+	caller, err := s.requireRole(accessToken, model.RoleAdmin)
+	if err != nil {
+		return nil, err
+	}
+	if !model.IsValidRole(role) {
+		return nil, status.Errorf(codes.InvalidArgument, "unknown role %q", role)
+	}
+	if _, err := s.userRepo.FindByID(userID); err != nil {
+		return nil, status.Error(codes.NotFound, "user not found")
+	}
+
+	if err := s.userRepo.AddRole(userID, role); err != nil {
+		return nil, fmt.Errorf("failed to grant role: %w", err)
+	}
+	s.auditRoleChange(caller.ID, userID, model.AuditRoleGranted, role)
+
+	return s.userRepo.FindByID(userID)
+}
+
+func (s *AuthService) RevokeRole(accessToken, userID, role string) (*model.User, error) {
+	caller, err := s.requireRole(accessToken, model.RoleAdmin)
+	if err != nil {
+		return nil, err
+	}
+	if !model.IsValidRole(role) {
+		return nil, status.Errorf(codes.InvalidArgument, "unknown role %q", role)
+	}
+	if caller.ID == userID && role == model.RoleAdmin {
+		return nil, status.Error(codes.FailedPrecondition, "admins cannot revoke their own admin role")
+	}
+	if _, err := s.userRepo.FindByID(userID); err != nil {
+		return nil, status.Error(codes.NotFound, "user not found")
+	}
+
+	if err := s.userRepo.RemoveRole(userID, role); err != nil {
+		return nil, fmt.Errorf("failed to revoke role: %w", err)
+	}
+	s.auditRoleChange(caller.ID, userID, model.AuditRoleRevoked, role)
+
+	return s.userRepo.FindByID(userID)
+}
+
+func (s *AuthService) auditRoleChange(actorID, userID, eventType, role string) {
+	s.recordAudit(&model.AuditEvent{
+		UserID:    userID,
+		ActorID:   actorID,
+		EventType: eventType,
+		Details:   "role=" + role,
+	})
+}
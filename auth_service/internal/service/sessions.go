@@ -0,0 +1,61 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/model"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ListSessions returns the live sessions of the caller. The session the
+// access token was issued for is flagged as current.
+func (s *AuthService) ListSessions(accessToken string) ([]*model.Session, error) {
+	user, err := s.authenticate(accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := s.tokenRepo.ListSessions(user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	if claims, err := s.parseAccessToken(accessToken); err == nil {
+		for _, session := range sessions {
+			session.Current = session.AccessTokenID == claims.TokenID
+		}
+	}
+	return sessions, nil
+}
+
+// RevokeSession ends one session of the caller and revokes the access token
+// issued with it. Sessions of other users are reported as not found.
+func (s *AuthService) RevokeSession(accessToken, sessionID string) error {
+	user, err := s.authenticate(accessToken)
+	if err != nil {
+		return err
+	}
+
+	if _, err := uuid.Parse(sessionID); err != nil {
+		return status.Error(codes.NotFound, "session not found")
+	}
+
+	accessIDs, err := s.tokenRepo.DeleteSession(user.ID, sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	if len(accessIDs) == 0 {
+		return status.Error(codes.NotFound, "session not found")
+	}
+
+	for _, id := range accessIDs {
+		if err := s.revokeAccessToken(id); err != nil {
+			return fmt.Errorf("failed to revoke access token: %w", err)
+		}
+	}
+
+	s.auditUser(user, model.AuditSessionRevoked)
+	return nil
+}
@@ -0,0 +1,80 @@
+package service_test
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// issuedRefreshToken returns the refresh token stored by the fixture login.
+func issuedRefreshToken(t *testing.T, f *profileFixture) *model.RefreshToken {
+	for _, call := range f.trepo.Calls {
+		if call.Method == "CreateRefreshToken" {
+			return call.Arguments.Get(0).(*model.RefreshToken)
+		}
+	}
+	t.Fatal("no refresh token was stored")
+	return nil
+}
+
+func TestGenerateTokens_RecordsClient(t *testing.T) {
+	f := newProfileFixture(t)
+
+	_, err := f.svc.GenerateTokens(f.user.ID, model.ClientInfo{IP: "203.0.113.7", UserAgent: "Mozilla/5.0"})
+	require.NoError(t, err)
+
+	f.trepo.AssertCalled(t, "CreateRefreshToken", mock.MatchedBy(func(rt *model.RefreshToken) bool {
+		return rt.IP == "203.0.113.7" && rt.UserAgent == "Mozilla/5.0" && !rt.CreatedAt.IsZero() && rt.LastUsedAt == nil
+	}))
+}
+
+func TestListSessions_FlagsCurrent(t *testing.T) {
+	f := newProfileFixture(t)
+	current := issuedRefreshToken(t, f)
+
+	f.trepo.On("ListSessions", f.user.ID).Return([]*model.Session{
+		{ID: uuid.NewString(), AccessTokenID: uuid.NewString()},
+		{ID: current.FamilyID, AccessTokenID: current.AccessTokenID},
+	}, nil)
+
+	sessions, err := f.svc.ListSessions(f.access)
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+	assert.False(t, sessions[0].Current)
+	assert.True(t, sessions[1].Current)
+
+	_, err = f.svc.ListSessions("garbage")
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestRevokeSession(t *testing.T) {
+	f := newProfileFixture(t)
+	sessionID := uuid.NewString()
+
+	t.Run("revokes the access tokens of the session", func(t *testing.T) {
+		f.trepo.On("DeleteSession", f.user.ID, sessionID).Return([]string{"a1"}, nil).Once()
+		f.trepo.On("RevokeAccessToken", "a1", mock.Anything).Return(nil).Once()
+
+		require.NoError(t, f.svc.RevokeSession(f.access, sessionID))
+	})
+
+	t.Run("unknown or foreign session", func(t *testing.T) {
+		f.trepo.On("DeleteSession", f.user.ID, sessionID).Return([]string{}, nil).Once()
+
+		err := f.svc.RevokeSession(f.access, sessionID)
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	})
+
+	t.Run("malformed id", func(t *testing.T) {
+		err := f.svc.RevokeSession(f.access, "not-a-uuid")
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	})
+
+	f.trepo.AssertExpectations(t)
+}
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Split tokens have the form "<selector>.<verifier>". The selector is stored
+// in clear text and used as an indexed lookup key, the verifier is secret and
+// only its SHA-256 hash is persisted.
+const splitTokenSeparator = "."
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to read random bytes: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func generateSplitToken() (token, selector, verifierHash string, err error) {
+	selector, err = randomString(16)
+	if err != nil {
+		return "", "", "", err
+	}
+	verifier, err := randomString(32)
+	if err != nil {
+		return "", "", "", err
+	}
+	return selector + splitTokenSeparator + verifier, selector, hashVerifier(verifier), nil
+}
+
+func parseSplitToken(token string) (selector, verifier string, ok bool) {
+	selector, verifier, ok = strings.Cut(token, splitTokenSeparator)
+	if !ok || selector == "" || verifier == "" {
+		return "", "", false
+	}
+	return selector, verifier, true
+}
+
+func hashVerifier(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return hex.EncodeToString(sum[:])
+}
+
+func verifierMatches(verifier, storedHash string) bool {
+	return subtle.ConstantTimeCompare([]byte(hashVerifier(verifier)), []byte(storedHash)) == 1
+}
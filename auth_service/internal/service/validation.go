@@ -0,0 +1,29 @@
+package service
+
+import (
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/validation"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// invalidFields builds an InvalidArgument error that lists every violation
+// as a BadRequest field violation. The message is the first description so
+// that clients which ignore the details still get a useful error.
+func invalidFields(violations []validation.Violation) error {
+	st := status.New(codes.InvalidArgument, violations[0].Description)
+
+	br := &errdetails.BadRequest{}
+	for _, v := range violations {
+		br.FieldViolations = append(br.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       v.Field,
+			Description: v.Description,
+		})
+	}
+
+	detailed, err := st.WithDetails(br)
+	if err != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
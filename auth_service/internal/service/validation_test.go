@@ -0,0 +1,90 @@
+package service_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/model"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/service"
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/validation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func fieldViolations(t *testing.T, err error) map[string]string {
+	st, ok := status.FromError(err)
+	require.True(t, ok)
+	require.Equal(t, codes.InvalidArgument, st.Code())
+
+	fields := map[string]string{}
+	for _, d := range st.Details() {
+		if br, ok := d.(*errdetails.BadRequest); ok {
+			for _, v := range br.FieldViolations {
+				fields[v.Field] = v.Description
+			}
+		}
+	}
+	require.NotEmpty(t, fields, "no BadRequest field violations in error details")
+	return fields
+}
+
+func TestRegisterUser_FieldViolations(t *testing.T) {
+	urepo := new(MockUserRepo)
+	svc := service.NewAuthService(urepo, new(MockTokenRepo), "secret", time.Minute*15, time.Hour*24,
+		service.WithValidationPolicy(&validation.Policy{
+			PasswordMinLength:  10,
+			PasswordMinClasses: 3,
+			UsernameMinLength:  3,
+		}),
+	)
+
+	_, err := svc.RegisterUser("", "not-an-email", "short", model.ClientInfo{})
+	fields := fieldViolations(t, err)
+	assert.Contains(t, fields, "email")
+	assert.Contains(t, fields, "user_name")
+	assert.Contains(t, fields, "password")
+	urepo.AssertNotCalled(t, "CreateUser", mock.Anything)
+}
+
+func TestRegisterUser_NormalizesEmail(t *testing.T) {
+	urepo := new(MockUserRepo)
+	svc := service.NewAuthService(urepo, new(MockTokenRepo), "secret", time.Minute*15, time.Hour*24)
+
+	urepo.On("FindByEmail", "reader@example.com").Return(nil, assert.AnError)
+	urepo.On("CreateUser", mock.AnythingOfType("*model.User")).Return(nil)
+
+	user, err := svc.RegisterUser("reader", " Reader@Example.com", "long enough", model.ClientInfo{})
+	require.NoError(t, err)
+	assert.Equal(t, "reader@example.com", user.Email)
+}
+
+func TestRegisterUser_BreachedPassword(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	require.NoError(t, os.WriteFile(path, []byte("iloveyou123\n"), 0o600))
+	list, err := validation.LoadBreachedList(path)
+	require.NoError(t, err)
+
+	policy := validation.DefaultPolicy()
+	policy.Breached = list
+	urepo := new(MockUserRepo)
+	svc := service.NewAuthService(urepo, new(MockTokenRepo), "secret", time.Minute*15, time.Hour*24,
+		service.WithValidationPolicy(policy),
+	)
+
+	_, err = svc.RegisterUser("reader", "reader@example.com", "ILoveYou123", model.ClientInfo{})
+	assert.Contains(t, fieldViolations(t, err)["password"], "breach")
+}
+
+func TestResetPassword_PolicyCheckedBeforeToken(t *testing.T) {
+	e := newTestService(withPasswordReset)
+
+	err := e.svc.ResetPassword("selector.verifier", "short")
+	assert.Contains(t, fieldViolations(t, err), "new_password")
+	e.actions.AssertNotCalled(t, "FindActionToken", mock.Anything, mock.Anything)
+}
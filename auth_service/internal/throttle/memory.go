@@ -0,0 +1,70 @@
+package throttle
+
+import (
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often MemoryStore drops counters that have expired.
+const sweepInterval = time.Minute
+
+// MemoryStore keeps counters in process memory. Counters are lost on restart
+// and not shared between replicas.
+type MemoryStore struct {
+	mu        sync.Mutex
+	entries   map[string]memoryEntry
+	lastSweep time.Time
+}
+
+type memoryEntry struct {
+	Entry
+	window time.Duration
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: map[string]memoryEntry{}}
+}
+
+func (s *MemoryStore) Get(key string) (Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.entries[key].Entry, nil
+}
+
+func (s *MemoryStore) RecordFailure(key string, now time.Time, window time.Duration) (Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(now)
+
+	e := s.entries[key]
+	if now.Sub(e.LastFailure) > window {
+		e.Failures = 0
+	}
+	e.Failures++
+	e.LastFailure = now
+	e.window = window
+	s.entries[key] = e
+
+	return e.Entry, nil
+}
+
+func (s *MemoryStore) Reset(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	s.lastSweep = now
+
+	for key, e := range s.entries {
+		if now.Sub(e.LastFailure) > e.window {
+			delete(s.entries, key)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+// Package throttle slows down and eventually locks out clients that keep
+// failing an operation, such as logging in with a wrong password.
+package throttle
+
+import (
+	"time"
+)
+
+// Entry is the failure count of a key and the time of its last failure.
+type Entry struct {
+	Failures    int
+	LastFailure time.Time
+}
+
+// Store keeps failure counters. Implementations must make RecordFailure
+// atomic, since concurrent attempts for the same key are the common case
+// during an attack.
+type Store interface {
+	Get(key string) (Entry, error)
+	// RecordFailure increments the counter of key and returns the new
+	// entry. Counters whose last failure is older than window start over.
+	RecordFailure(key string, now time.Time, window time.Duration) (Entry, error)
+	Reset(key string) error
+}
+
+// Policy describes how failures of a single key are punished. The first
+// FreeAttempts failures have no effect, every further failure doubles the
+// delay before the next attempt starting at BaseDelay, and LockoutAfter
+// failures lock the key for LockoutDuration. Failures older than Window are
+// forgotten.
+type Policy struct {
+	FreeAttempts    int
+	BaseDelay       time.Duration
+	MaxDelay        time.Duration
+	LockoutAfter    int
+	LockoutDuration time.Duration
+	Window          time.Duration
+}
+
+// Wait returns how long a key with entry e has to wait at now before the
+// next attempt is allowed.
+func (p Policy) Wait(e Entry, now time.Time) time.Duration {
+	if e.Failures == 0 || now.Sub(e.LastFailure) > p.Window {
+		return 0
+	}
+
+	var delay time.Duration
+	switch {
+	case p.LockoutAfter > 0 && e.Failures >= p.LockoutAfter:
+		delay = p.LockoutDuration
+	case e.Failures > p.FreeAttempts:
+		delay = p.BaseDelay
+		for i := p.FreeAttempts + 1; i < e.Failures && delay < p.MaxDelay; i++ {
+			delay *= 2
+		}
+		if p.MaxDelay > 0 && delay > p.MaxDelay {
+			delay = p.MaxDelay
+		}
+	}
+
+	if wait := e.LastFailure.Add(delay).Sub(now); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// Limiter applies a Policy to the counters of a Store. Keys are prefixed with
+// the limiter name so several limiters can share one store.
+type Limiter struct {
+	name   string
+	store  Store
+	policy Policy
+	now    func() time.Time
+}
+
+func NewLimiter(name string, store Store, policy Policy) *Limiter {
+	return &Limiter{
+		name:   name,
+		store:  store,
+		policy: policy,
+		now:    time.Now,
+	}
+}
+
+func (l *Limiter) key(k string) string {
+	return l.name + ":" + k
+}
+
+// Check returns how long k has to wait before the next attempt.
+func (l *Limiter) Check(k string) (time.Duration, error) {
+	e, err := l.store.Get(l.key(k))
+	if err != nil {
+		return 0, err
+	}
+	return l.policy.Wait(e, l.now()), nil
+}
+
+// Fail records a failed attempt of k and reports whether it locked k out.
+func (l *Limiter) Fail(k string) (bool, error) {
+	e, err := l.store.RecordFailure(l.key(k), l.now(), l.policy.Window)
+	if err != nil {
+		return false, err
+	}
+	return l.policy.LockoutAfter > 0 && e.Failures == l.policy.LockoutAfter, nil
+}
+
+// Succeed forgets the failures of k.
+func (l *Limiter) Succeed(k string) error {
+	return l.store.Reset(l.key(k))
+}
@@ -0,0 +1,109 @@
+package throttle_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/throttle"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicyWait(t *testing.T) {
+	p := throttle.Policy{
+		FreeAttempts:    3,
+		BaseDelay:       time.Second,
+		MaxDelay:        8 * time.Second,
+		LockoutAfter:    10,
+		LockoutDuration: 15 * time.Minute,
+		Window:          time.Hour,
+	}
+	now := time.Now()
+
+	tests := []struct {
+		name     string
+		failures int
+		ago      time.Duration
+		want     time.Duration
+	}{
+		{"no failures", 0, 0, 0},
+		{"free attempts", 3, 0, 0},
+		{"first delay", 4, 0, time.Second},
+		{"doubled", 5, 0, 2 * time.Second},
+		{"capped", 9, 0, 8 * time.Second},
+		{"delay partly elapsed", 5, time.Second, time.Second},
+		{"delay elapsed", 5, 3 * time.Second, 0},
+		{"locked out", 10, time.Minute, 14 * time.Minute},
+		{"lockout elapsed", 12, 20 * time.Minute, 0},
+		{"outside window", 12, 2 * time.Hour, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := throttle.Entry{Failures: tt.failures, LastFailure: now.Add(-tt.ago)}
+			assert.Equal(t, tt.want, p.Wait(e, now))
+		})
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	s := throttle.NewMemoryStore()
+	now := time.Now()
+
+	e, err := s.RecordFailure("k", now, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, 1, e.Failures)
+
+	e, err = s.RecordFailure("k", now.Add(time.Second), time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, 2, e.Failures)
+
+	e, err = s.RecordFailure("k", now.Add(2*time.Minute), time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, 1, e.Failures, "failures outside the window start over")
+
+	require.NoError(t, s.Reset("k"))
+	e, err = s.Get("k")
+	require.NoError(t, err)
+	assert.Zero(t, e.Failures)
+}
+
+func TestLimiter(t *testing.T) {
+	store := throttle.NewMemoryStore()
+	l := throttle.NewLimiter("account", store, throttle.Policy{
+		FreeAttempts:    1,
+		BaseDelay:       time.Minute,
+		LockoutAfter:    3,
+		LockoutDuration: time.Hour,
+		Window:          time.Hour,
+	})
+	other := throttle.NewLimiter("ip", store, throttle.Policy{Window: time.Hour})
+
+	locked, err := l.Fail("a@example.com")
+	require.NoError(t, err)
+	assert.False(t, locked)
+	wait, err := l.Check("a@example.com")
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+
+	_, err = l.Fail("a@example.com")
+	require.NoError(t, err)
+	wait, err = l.Check("a@example.com")
+	require.NoError(t, err)
+	assert.InDelta(t, time.Minute, wait, float64(time.Second))
+
+	locked, err = l.Fail("a@example.com")
+	require.NoError(t, err)
+	assert.True(t, locked)
+	wait, err = l.Check("a@example.com")
+	require.NoError(t, err)
+	assert.InDelta(t, time.Hour, wait, float64(time.Second))
+
+	wait, err = other.Check("a@example.com")
+	require.NoError(t, err)
+	assert.Zero(t, wait, "limiters sharing a store must not share counters")
+
+	require.NoError(t, l.Succeed("a@example.com"))
+	wait, err = l.Check("a@example.com")
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+}
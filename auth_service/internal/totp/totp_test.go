@@ -0,0 +1,69 @@
+package totp_test
+
+import (
+	"encoding/base32"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/totp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rfcSecret is the SHA1 key of the RFC 6238 test vectors.
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestCode_RFC6238(t *testing.T) {
+	// The RFC lists 8 digit codes; the 6 digit codes are their last digits.
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		code, err := totp.Code(rfcSecret, totp.Step(time.Unix(tt.unix, 0)))
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, code, "t=%d", tt.unix)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := totp.GenerateSecret()
+	require.NoError(t, err)
+
+	now := time.Now()
+	code, err := totp.Code(secret, totp.Step(now))
+	require.NoError(t, err)
+
+	step, ok := totp.Validate(secret, code, now, 1)
+	assert.True(t, ok)
+	assert.Equal(t, totp.Step(now), step)
+
+	_, ok = totp.Validate(secret, code, now.Add(totp.Period), 1)
+	assert.True(t, ok, "previous step is within the skew")
+
+	_, ok = totp.Validate(secret, code, now.Add(3*totp.Period), 1)
+	assert.False(t, ok)
+
+	_, ok = totp.Validate(secret, "12345", now, 1)
+	assert.False(t, ok)
+}
+
+func TestURI(t *testing.T) {
+	uri := totp.URI("Reading Club", "reader@example.com", "SECRET")
+
+	u, err := url.Parse(uri)
+	require.NoError(t, err)
+	assert.Equal(t, "otpauth", u.Scheme)
+	assert.Equal(t, "totp", u.Host)
+	assert.Equal(t, "/Reading Club:reader@example.com", u.Path)
+	assert.Equal(t, "SECRET", u.Query().Get("secret"))
+	assert.Equal(t, "Reading Club", u.Query().Get("issuer"))
+}
@@ -0,0 +1,210 @@
+// Package validation checks the user supplied fields of accounts against a
+// configurable policy.
+package validation
+
+import (
+	"bufio"
+	"fmt"
+	"net/mail"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Violation describes why the value of a single request field was rejected.
+type Violation struct {
+	Field       string
+	Description string
+}
+
+// Policy holds the rules for account fields. Lengths count
+// characters, not bytes.
+type Policy struct {
+	PasswordMinLength int
+	PasswordMaxLength int
+	// PasswordMinClasses is how many of lower case letters, upper case
+	// letters, digits and other characters a password has to mix.
+	PasswordMinClasses int
+	// Breached rejects passwords known from public breaches. It may be nil.
+	Breached *BreachedList
+
+	UsernameMinLength int
+	UsernameMaxLength int
+
+	DisplayNameMaxLength int
+	BioMaxLength         int
+}
+
+// DefaultPolicy is used when no policy is configured.
+func DefaultPolicy() *Policy {
+	return &Policy{
+		PasswordMinLength:    8,
+		PasswordMaxLength:    128,
+		UsernameMinLength:    3,
+		UsernameMaxLength:    32,
+		DisplayNameMaxLength: 64,
+		BioMaxLength:         1000,
+	}
+}
+
+// FoldEmail returns the form of email that is stored and looked up.
+func FoldEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// NormalizeEmail folds email and checks that it is a bare address such as
+// user@example.com, without a display name or angle brackets.
+func NormalizeEmail(field, email string) (string, []Violation) {
+	folded := FoldEmail(email)
+	if folded == "" {
+		return "", []Violation{{field, "email is required"}}
+	}
+	addr, err := mail.ParseAddress(folded)
+	if err != nil || addr.Address != folded {
+		return "", []Violation{{field, "invalid email address"}}
+	}
+	return folded, nil
+}
+
+// CheckUsername allows letters, digits, '.', '_' and '-', starting with a
+// letter or digit.
+func (p *Policy) CheckUsername(field, name string) []Violation {
+	if name == "" {
+		return []Violation{{field, "username is required"}}
+	}
+
+	var violations []Violation
+	n := utf8.RuneCountInString(name)
+	if p.UsernameMinLength > 0 && n < p.UsernameMinLength {
+		violations = append(violations, Violation{field, fmt.Sprintf("username must be at least %d characters long", p.UsernameMinLength)})
+	}
+	if p.UsernameMaxLength > 0 && n > p.UsernameMaxLength {
+		violations = append(violations, Violation{field, fmt.Sprintf("username must be at most %d characters long", p.UsernameMaxLength)})
+	}
+
+	for i, r := range name {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			continue
+		}
+		if i == 0 {
+			violations = append(violations, Violation{field, "username must start with a letter or digit"})
+			break
+		}
+		if r != '.' && r != '_' && r != '-' {
+			violations = append(violations, Violation{field, "username may only contain letters, digits, '.', '_' and '-'"})
+			break
+		}
+	}
+
+	return violations
+}
+
+// CheckDisplayName rejects display names that are too long or contain
+// control characters.
+func (p *Policy) CheckDisplayName(field, name string) []Violation {
+	if p.DisplayNameMaxLength > 0 && utf8.RuneCountInString(name) > p.DisplayNameMaxLength {
+		return []Violation{{field, fmt.Sprintf("display name must be at most %d characters long", p.DisplayNameMaxLength)}}
+	}
+	if strings.IndexFunc(name, unicode.IsControl) >= 0 {
+		return []Violation{{field, "display name must not contain control characters"}}
+	}
+	return nil
+}
+
+func (p *Policy) CheckBio(field, bio string) []Violation {
+	if p.BioMaxLength > 0 && utf8.RuneCountInString(bio) > p.BioMaxLength {
+		return []Violation{{field, fmt.Sprintf("bio must be at most %d characters long", p.BioMaxLength)}}
+	}
+	return nil
+}
+
+// CheckPassword applies the password rules. Passwords on the breached list
+// are only reported when they pass the other rules, so users are not told
+// to fix a password they will have to replace anyway.
+func (p *Policy) CheckPassword(field, password string) []Violation {
+	if password == "" {
+		return []Violation{{field, "password is required"}}
+	}
+
+	var violations []Violation
+	n := utf8.RuneCountInString(password)
+	if p.PasswordMinLength > 0 && n < p.PasswordMinLength {
+		violations = append(violations, Violation{field, fmt.Sprintf("password must be at least %d characters long", p.PasswordMinLength)})
+	}
+	if p.PasswordMaxLength > 0 && n > p.PasswordMaxLength {
+		violations = append(violations, Violation{field, fmt.Sprintf("password must be at most %d characters long", p.PasswordMaxLength)})
+	}
+	if p.PasswordMinClasses > 0 && characterClasses(password) < p.PasswordMinClasses {
+		violations = append(violations, Violation{field, fmt.Sprintf(
+			"password must mix at least %d of lower case letters, upper case letters, digits and symbols", p.PasswordMinClasses)})
+	}
+
+	if len(violations) == 0 && p.Breached.Contains(password) {
+		violations = append(violations, Violation{field, "password appears in a known data breach, choose another one"})
+	}
+
+	return violations
+}
+
+func characterClasses(s string) int {
+	var lower, upper, digit, other int
+	for _, r := range s {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			other = 1
+		}
+	}
+	return lower + upper + digit + other
+}
+
+// BreachedList is a set of passwords known from public breaches. Entries are
+// compared case-insensitively.
+type BreachedList struct {
+	passwords map[string]struct{}
+}
+
+// LoadBreachedList reads one password per line. Empty lines and lines
+// starting with '#' are skipped.
+func LoadBreachedList(path string) (*BreachedList, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open breached password list: %w", err)
+	}
+	defer file.Close()
+
+	l := &BreachedList{passwords: map[string]struct{}{}}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		l.passwords[strings.ToLower(line)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read breached password list: %w", err)
+	}
+	return l, nil
+}
+
+func (l *BreachedList) Len() int {
+	if l == nil {
+		return 0
+	}
+	return len(l.passwords)
+}
+
+func (l *BreachedList) Contains(password string) bool {
+	if l == nil {
+		return false
+	}
+	_, ok := l.passwords[strings.ToLower(password)]
+	return ok
+}
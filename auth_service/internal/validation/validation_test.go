@@ -0,0 +1,79 @@
+package validation_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/polyakovaa/grpcproxy/auth_service/internal/validation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeEmail(t *testing.T) {
+	email, violations := validation.NormalizeEmail("email", "  Reader@Example.COM ")
+	assert.Empty(t, violations)
+	assert.Equal(t, "reader@example.com", email)
+
+	for _, bad := range []string{"", "not-an-email", "Reader <reader@example.com>", "reader@"} {
+		_, violations := validation.NormalizeEmail("email", bad)
+		require.Len(t, violations, 1, bad)
+		assert.Equal(t, "email", violations[0].Field)
+	}
+}
+
+func TestCheckUsername(t *testing.T) {
+	p := validation.DefaultPolicy()
+
+	for _, ok := range []string{"reader", "reader_42", "anna.k", "Jörg-M"} {
+		assert.Empty(t, p.CheckUsername("user_name", ok), ok)
+	}
+	for _, bad := range []string{"", "ab", "_reader", "reader!", "read er", strings.Repeat("a", 33)} {
+		assert.NotEmpty(t, p.CheckUsername("user_name", bad), bad)
+	}
+}
+
+func TestCheckPassword(t *testing.T) {
+	p := &validation.Policy{PasswordMinLength: 10, PasswordMaxLength: 20, PasswordMinClasses: 3}
+
+	assert.Empty(t, p.CheckPassword("password", "Reading-Club"))
+	assert.Len(t, p.CheckPassword("password", "short"), 2, "too short and too few classes")
+	assert.Len(t, p.CheckPassword("password", strings.Repeat("Ab1", 7)), 1)
+	assert.Len(t, p.CheckPassword("password", ""), 1)
+
+	// Characters count, not bytes.
+	assert.Empty(t, p.CheckPassword("password", "Ääääääää1x"))
+}
+
+func TestBreachedList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	require.NoError(t, os.WriteFile(path, []byte("# top passwords\nPassword123\n\nletmein1234\n"), 0o600))
+
+	list, err := validation.LoadBreachedList(path)
+	require.NoError(t, err)
+	assert.Equal(t, 2, list.Len())
+	assert.True(t, list.Contains("password123"))
+	assert.False(t, list.Contains("# top passwords"))
+
+	p := &validation.Policy{PasswordMinLength: 8, Breached: list}
+	violations := p.CheckPassword("new_password", "LetMeIn1234")
+	require.Len(t, violations, 1)
+	assert.Equal(t, "new_password", violations[0].Field)
+	assert.Contains(t, violations[0].Description, "breach")
+
+	var none *validation.BreachedList
+	assert.False(t, none.Contains("password123"))
+}
+
+func TestCheckProfile(t *testing.T) {
+	p := validation.DefaultPolicy()
+
+	assert.Empty(t, p.CheckDisplayName("display_name", "Anna K."))
+	assert.Empty(t, p.CheckDisplayName("display_name", ""))
+	assert.NotEmpty(t, p.CheckDisplayName("display_name", "Anna\nK."))
+	assert.NotEmpty(t, p.CheckDisplayName("display_name", strings.Repeat("a", 65)))
+
+	assert.Empty(t, p.CheckBio("bio", "Reads mostly\nscience fiction."))
+	assert.NotEmpty(t, p.CheckBio("bio", strings.Repeat("a", 1001)))
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/polyakovaa/grpcproxy/event_service/internal/repository"
 	"github.com/polyakovaa/grpcproxy/event_service/internal/service"
 	"github.com/polyakovaa/grpcproxy/gen/event"
+	"github.com/polyakovaa/grpcproxy/svcauth"
 
 	"google.golang.org/grpc"
 )
@@ -36,7 +37,12 @@ func main() {
 		log.Fatalf("Failed to listen: %v", err)
 	}
 
-	grpcServer := grpc.NewServer()
+	if cfg.ServiceAuth.Enforce && cfg.ServiceAuth.Secret == "" {
+		log.Fatalf("service_auth.enforce requires service_auth.secret")
+	}
+	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(
+		svcauth.UnaryServerInterceptor([]byte(cfg.ServiceAuth.Secret), cfg.ServiceAuth.Enforce),
+	))
 
 	event.RegisterEventServiceServer(grpcServer, eventHandler)
 
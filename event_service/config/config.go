@@ -9,9 +9,10 @@ import (
 )
 
 type EventServiceConfig struct {
-	Server   ServerConfig  `yaml:"server"`
-	Database DBConfig      `yaml:"database"`
-	Logging  LoggingConfig `yaml:"logging"`
+	Server      ServerConfig      `yaml:"server"`
+	Database    DBConfig          `yaml:"database"`
+	Logging     LoggingConfig     `yaml:"logging"`
+	ServiceAuth ServiceAuthConfig `yaml:"service_auth"`
 }
 
 type ServerConfig struct {
@@ -36,6 +37,14 @@ type DBConfig struct {
 	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
 }
 
+// ServiceAuthConfig holds the secret the gateway signs caller identities
+// with. Enforce rejects calls without a valid signature; while it is off,
+// unsigned calls may still name the user in the request.
+type ServiceAuthConfig struct {
+	Secret  string `yaml:"secret"`
+	Enforce bool   `yaml:"enforce"`
+}
+
 func LoadConfig(path string) (*EventServiceConfig, error) {
 	file, err := os.Open(path)
 	if err != nil {
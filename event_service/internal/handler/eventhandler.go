@@ -3,6 +3,8 @@ package handler
 import (
 	"context"
 
+	"github.com/polyakovaa/grpcproxy/event_service/internal/model"
+	"github.com/polyakovaa/grpcproxy/event_service/internal/policy"
 	"github.com/polyakovaa/grpcproxy/event_service/internal/service"
 	"github.com/polyakovaa/grpcproxy/gen/event"
 	"google.golang.org/grpc/codes"
@@ -20,19 +22,34 @@ func NewEventHandler(eventService *service.EventService) *EventHandler {
 	}
 }
 
+// statusError passes status errors of the service, e.g. denials, through and
+// reports everything else as internal.
+func statusError(err error, msg string) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	return status.Errorf(codes.Internal, "%s: %v", msg, err)
+}
+
+func eventResponse(e *model.Event) *event.EventResponse {
+	return &event.EventResponse{
+		EventId:     e.ID,
+		Title:       e.Title,
+		Description: e.Description,
+		Date:        e.Date,
+		OrganizerId: e.OrganizerID,
+		Cancelled:   e.Cancelled(),
+	}
+}
+
 func (h *EventHandler) CreateEvent(ctx context.Context, req *event.CreateEventRequest) (*event.EventResponse, error) {
-	createdEvent, err := h.eventService.CreateEvent(req.Title, req.Description, req.Date, req.OrganizerId)
+	caller := policy.FromContext(ctx, req.OrganizerId)
+	createdEvent, err := h.eventService.CreateEvent(caller, req.Title, req.Description, req.Date, req.OrganizerId)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "failed to create event: %v", err)
+		return nil, statusError(err, "failed to create event")
 	}
 
-	return &event.EventResponse{
-		EventId:     createdEvent.ID,
-		Title:       createdEvent.Title,
-		Description: createdEvent.Description,
-		Date:        createdEvent.Date,
-		OrganizerId: createdEvent.OrganizerID,
-	}, nil
+	return eventResponse(createdEvent), nil
 }
 
 func (h *EventHandler) GetEvent(ctx context.Context, req *event.GetEventRequest) (*event.EventResponse, error) {
@@ -41,19 +58,14 @@ func (h *EventHandler) GetEvent(ctx context.Context, req *event.GetEventRequest)
 		return nil, status.Errorf(codes.NotFound, "event not found: %v", err)
 	}
 
-	return &event.EventResponse{
-		EventId:     eventFound.ID,
-		Title:       eventFound.Title,
-		Description: eventFound.Description,
-		Date:        eventFound.Date,
-		OrganizerId: eventFound.OrganizerID,
-	}, nil
+	return eventResponse(eventFound), nil
 }
 
 func (h *EventHandler) JoinEvent(ctx context.Context, req *event.JoinEventRequest) (*event.JoinEventResponse, error) {
-	joinID, err := h.eventService.JoinEvent(req.EventId, req.UserId)
+	caller := policy.FromContext(ctx, req.UserId)
+	joinID, err := h.eventService.JoinEvent(caller, req.EventId, req.UserId)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "failed to join event: %v", err)
+		return nil, statusError(err, "failed to join event")
 	}
 
 	return &event.JoinEventResponse{
@@ -63,6 +75,27 @@ func (h *EventHandler) JoinEvent(ctx context.Context, req *event.JoinEventReques
 	}, nil
 }
 
+func (h *EventHandler) UpdateEvent(ctx context.Context, req *event.UpdateEventRequest) (*event.EventResponse, error) {
+	updated, err := h.eventService.UpdateEvent(policy.FromContext(ctx, ""), req.EventId, service.EventUpdate{
+		Title:       req.Title,
+		Description: req.Description,
+		Date:        req.Date,
+	})
+	if err != nil {
+		return nil, statusError(err, "failed to update event")
+	}
+
+	return eventResponse(updated), nil
+}
+
+func (h *EventHandler) CancelEvent(ctx context.Context, req *event.CancelEventRequest) (*event.CancelEventResponse, error) {
+	if err := h.eventService.CancelEvent(policy.FromContext(ctx, ""), req.EventId); err != nil {
+		return nil, statusError(err, "failed to cancel event")
+	}
+
+	return &event.CancelEventResponse{Success: true}, nil
+}
+
 func (h *EventHandler) ListEvents(ctx context.Context, req *event.ListEventsRequest) (*event.ListEventsResponse, error) {
 	eventsList, totalCount, err := h.eventService.GetEvents(req.Limit, req.Offset)
 	if err != nil {
@@ -71,14 +104,7 @@ func (h *EventHandler) ListEvents(ctx context.Context, req *event.ListEventsRequ
 	var events []*event.EventResponse
 
 	for _, evt := range eventsList {
-		e := &event.EventResponse{
-			EventId:     evt.ID,
-			Title:       evt.Title,
-			Description: evt.Description,
-			Date:        evt.Date,
-			OrganizerId: evt.OrganizerID,
-		}
-		events = append(events, e)
+		events = append(events, eventResponse(evt))
 	}
 	return &event.ListEventsResponse{
 		Events:     events,
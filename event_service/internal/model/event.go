@@ -1,11 +1,23 @@
 package model
 
+import (
+	"errors"
+	"time"
+)
+
+var ErrEventNotFound = errors.New("event not found")
+
 type Event struct {
-	ID          string `json:"id"`
-	Title       string `json:"title"`
-	Description string `json:"description"`
-	Date        string `json:"date"`
-	OrganizerID string `json:"organizer_id"`
+	ID          string     `json:"id"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Date        string     `json:"date"`
+	OrganizerID string     `json:"organizer_id"`
+	CancelledAt *time.Time `json:"cancelled_at,omitempty"`
+}
+
+func (e *Event) Cancelled() bool {
+	return e.CancelledAt != nil
 }
 
 type EventParticipant struct {
@@ -0,0 +1,113 @@
+// Package policy decides what the caller of an EventService RPC may do. The
+// caller is the user the gateway signed into the call metadata, see svcauth.
+package policy
+
+import (
+	"context"
+	"slices"
+
+	"github.com/polyakovaa/grpcproxy/event_service/internal/model"
+	"github.com/polyakovaa/grpcproxy/svcauth"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	RoleOrganizer = "organizer"
+	RoleAdmin     = "admin"
+
+	ScopeEventsWrite = "events:write"
+)
+
+// Caller is the user an RPC is made for. Unverified callers only exist while
+// service_auth.enforce is off: their user ID comes from the request and they
+// are trusted as before for creating and joining events, but may not change
+// existing events.
+type Caller struct {
+	UserID   string
+	Roles    []string
+	Scopes   []string
+	Verified bool
+}
+
+// FromContext returns the verified caller of ctx, or an unverified caller
+// with claimedUserID, the user ID named in the request.
+func FromContext(ctx context.Context, claimedUserID string) *Caller {
+	id, ok := svcauth.FromContext(ctx)
+	if !ok {
+		return &Caller{UserID: claimedUserID}
+	}
+	return &Caller{UserID: id.UserID, Roles: id.Roles, Scopes: id.Scopes, Verified: true}
+}
+
+func (c *Caller) HasRole(role string) bool {
+	return slices.Contains(c.Roles, role)
+}
+
+// hasScope reports whether the token of the caller was granted scope.
+// Session tokens carry no scopes and are not limited.
+func (c *Caller) hasScope(scope string) bool {
+	return c.Scopes == nil || slices.Contains(c.Scopes, scope)
+}
+
+// authenticated checks that a verified caller is a user and may write.
+func (c *Caller) authenticated() error {
+	if c.UserID == "" {
+		return status.Error(codes.Unauthenticated, "authentication required")
+	}
+	if !c.hasScope(ScopeEventsWrite) {
+		return status.Error(codes.PermissionDenied, "token lacks scope "+ScopeEventsWrite)
+	}
+	return nil
+}
+
+// CanCreate lets organizers and admins create events they organize
+// themselves. organizerID is the organizer named in the request; it may be
+// left empty, except by unverified callers, for whom it is the organizer.
+func CanCreate(c *Caller, organizerID string) error {
+	if !c.Verified {
+		if organizerID == "" {
+			return status.Error(codes.InvalidArgument, "organizer_id is required")
+		}
+		return nil
+	}
+	if err := c.authenticated(); err != nil {
+		return err
+	}
+	if organizerID != "" && organizerID != c.UserID {
+		return status.Error(codes.PermissionDenied, "events can only be created with yourself as organizer")
+	}
+	if !c.HasRole(RoleOrganizer) && !c.HasRole(RoleAdmin) {
+		return status.Error(codes.PermissionDenied, "only organizers can create events")
+	}
+	return nil
+}
+
+// CanJoin lets users join events as themselves only. userID is the user
+// named in the request; it may be left empty.
+func CanJoin(c *Caller, userID string) error {
+	if !c.Verified {
+		return nil
+	}
+	if err := c.authenticated(); err != nil {
+		return err
+	}
+	if userID != "" && userID != c.UserID {
+		return status.Error(codes.PermissionDenied, "users can only join events as themselves")
+	}
+	return nil
+}
+
+// CanModify lets the organizer of e and admins edit or cancel it.
+func CanModify(c *Caller, e *model.Event) error {
+	if !c.Verified {
+		return status.Error(codes.Unauthenticated, "changing events requires a signed caller identity")
+	}
+	if err := c.authenticated(); err != nil {
+		return err
+	}
+	if e.OrganizerID != c.UserID && !c.HasRole(RoleAdmin) {
+		return status.Error(codes.PermissionDenied, "only the organizer or an admin can change this event")
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package policy_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/polyakovaa/grpcproxy/event_service/internal/model"
+	"github.com/polyakovaa/grpcproxy/event_service/internal/policy"
+	"github.com/polyakovaa/grpcproxy/svcauth"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func caller(userID string, roles ...string) *policy.Caller {
+	ctx := svcauth.NewContext(context.Background(), svcauth.Identity{UserID: userID, Roles: roles})
+	return policy.FromContext(ctx, "")
+}
+
+func TestFromContext(t *testing.T) {
+	unverified := policy.FromContext(context.Background(), "claimed")
+	assert.Equal(t, &policy.Caller{UserID: "claimed"}, unverified)
+
+	verified := policy.FromContext(svcauth.NewContext(context.Background(), svcauth.Identity{UserID: "user-1"}), "claimed")
+	assert.Equal(t, "user-1", verified.UserID)
+	assert.True(t, verified.Verified)
+}
+
+func TestCanCreate(t *testing.T) {
+	tests := []struct {
+		name        string
+		caller      *policy.Caller
+		organizerID string
+		code        codes.Code
+	}{
+		{"organizer", caller("user-1", policy.RoleOrganizer), "", codes.OK},
+		{"organizer names themselves", caller("user-1", policy.RoleOrganizer), "user-1", codes.OK},
+		{"admin", caller("user-1", policy.RoleAdmin), "", codes.OK},
+		{"member", caller("user-1", "member"), "", codes.PermissionDenied},
+		{"on behalf of another user", caller("user-1", policy.RoleOrganizer), "user-2", codes.PermissionDenied},
+		{"anonymous", caller(""), "", codes.Unauthenticated},
+		{"read-only token", &policy.Caller{UserID: "user-1", Roles: []string{policy.RoleOrganizer}, Scopes: []string{"events:read"}, Verified: true}, "", codes.PermissionDenied},
+		{"unverified during rollout", &policy.Caller{UserID: "user-2"}, "user-2", codes.OK},
+		{"unverified without organizer", &policy.Caller{}, "", codes.InvalidArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.code, status.Code(policy.CanCreate(tt.caller, tt.organizerID)))
+		})
+	}
+}
+
+func TestCanJoin(t *testing.T) {
+	assert.NoError(t, policy.CanJoin(caller("user-1"), ""))
+	assert.NoError(t, policy.CanJoin(caller("user-1"), "user-1"))
+	assert.Equal(t, codes.PermissionDenied, status.Code(policy.CanJoin(caller("user-1"), "user-2")))
+	assert.Equal(t, codes.Unauthenticated, status.Code(policy.CanJoin(caller(""), "")))
+}
+
+func TestCanModify(t *testing.T) {
+	event := &model.Event{ID: "event-1", OrganizerID: "user-1"}
+
+	assert.NoError(t, policy.CanModify(caller("user-1", policy.RoleOrganizer), event))
+	assert.NoError(t, policy.CanModify(caller("user-2", policy.RoleAdmin), event))
+	assert.Equal(t, codes.PermissionDenied, status.Code(policy.CanModify(caller("user-2", policy.RoleOrganizer), event)))
+	assert.Equal(t, codes.Unauthenticated, status.Code(policy.CanModify(&policy.Caller{UserID: "user-1"}, event)),
+		"unverified callers cannot change events, even during rollout")
+}
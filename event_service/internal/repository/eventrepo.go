@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/polyakovaa/grpcproxy/event_service/internal/model"
 )
@@ -20,11 +21,12 @@ func NewEventRepository(db *sql.DB) *EventRepository {
 
 func (r *EventRepository) CreateEvent(event *model.Event) error {
 	query := `
-		INSERT INTO events (title, description, date, organizer_id)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO events (id, title, description, date, organizer_id)
+		VALUES ($1, $2, $3, $4, $5)
 	`
 
 	_, err := r.db.Exec(query,
+		event.ID,
 		event.Title,
 		event.Description,
 		event.Date,
@@ -54,7 +56,7 @@ func (r *EventRepository) AddParticipant(eventID, userID, joinID string) error {
 
 func (r *EventRepository) GetEventByID(eventID string) (*model.Event, error) {
 	query := `
-		SELECT id, title, description, date, organizer_id
+		SELECT id, title, description, date, organizer_id, cancelled_at
 		FROM events 
 		WHERE id = $1
 	`
@@ -66,10 +68,11 @@ func (r *EventRepository) GetEventByID(eventID string) (*model.Event, error) {
 		&event.Description,
 		&event.Date,
 		&event.OrganizerID,
+		&event.CancelledAt,
 	)
 
 	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("event not found: %s", eventID)
+		return nil, model.ErrEventNotFound
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get event: %w", err)
@@ -80,7 +83,7 @@ func (r *EventRepository) GetEventByID(eventID string) (*model.Event, error) {
 
 func (r *EventRepository) GetEvents(limit, offset int32) ([]*model.Event, int32, error) {
 	query := `
-		SELECT id, title, description, date, organizer_id
+		SELECT id, title, description, date, organizer_id, cancelled_at
 		FROM events  
 		LIMIT $1 OFFSET $2
 	`
@@ -100,6 +103,7 @@ func (r *EventRepository) GetEvents(limit, offset int32) ([]*model.Event, int32,
 			&event.Description,
 			&event.Date,
 			&event.OrganizerID,
+			&event.CancelledAt,
 		)
 		if err != nil {
 			return nil, 0, fmt.Errorf("failed to scan event: %w", err)
@@ -116,3 +120,38 @@ func (r *EventRepository) GetEvents(limit, offset int32) ([]*model.Event, int32,
 
 	return events, totalCount, nil
 }
+
+func (r *EventRepository) UpdateEvent(event *model.Event) error {
+	query := `
+		UPDATE events
+		SET title = $2, description = $3, date = $4
+		WHERE id = $1
+	`
+
+	result, err := r.db.Exec(query, event.ID, event.Title, event.Description, event.Date)
+	if err != nil {
+		return fmt.Errorf("failed to update event: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return model.ErrEventNotFound
+	}
+
+	return nil
+}
+
+// CancelEvent marks the event as cancelled. Events that were cancelled
+// before keep their original cancellation time.
+func (r *EventRepository) CancelEvent(eventID string, at time.Time) error {
+	query := `
+		UPDATE events
+		SET cancelled_at = $2
+		WHERE id = $1 AND cancelled_at IS NULL
+	`
+
+	_, err := r.db.Exec(query, eventID, at)
+	if err != nil {
+		return fmt.Errorf("failed to cancel event: %w", err)
+	}
+
+	return nil
+}
@@ -4,9 +4,13 @@ CREATE TABLE IF NOT EXISTS events (
     title TEXT NOT NULL,
     description TEXT,
     date TIMESTAMP NOT NULL,
-    organizer_id UUID NOT NULL
+    organizer_id UUID NOT NULL,
+    cancelled_at TIMESTAMP
 );
 
+-- Upgrade databases created before these columns existed.
+ALTER TABLE events ADD COLUMN IF NOT EXISTS cancelled_at TIMESTAMP;
+
 CREATE TABLE IF NOT EXISTS participants (
     id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
     event_id UUID NOT NULL REFERENCES events(id) ON DELETE CASCADE,
@@ -1,11 +1,15 @@
 package service
 
 import (
-	"fmt"
+	"errors"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/polyakovaa/grpcproxy/event_service/internal/model"
+	"github.com/polyakovaa/grpcproxy/event_service/internal/policy"
 	"github.com/polyakovaa/grpcproxy/event_service/internal/repository"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type EventService struct {
@@ -18,9 +22,40 @@ func NewEventService(eventRepo *repository.EventRepository) *EventService {
 	}
 }
 
-func (s *EventService) CreateEvent(title, description, date, organizerID string) (*model.Event, error) {
+// EventUpdate lists the fields of an event to change; nil fields are left
+// unchanged.
+type EventUpdate struct {
+	Title       *string
+	Description *string
+	Date        *string
+}
+
+// dateLayouts are the date formats accepted for events.
+var dateLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"}
+
+// checkDate rejects dates the database would fail to parse, so they are
+// reported to the caller instead of surfacing as an internal error.
+func checkDate(date string) error {
+	if date == "" {
+		return status.Error(codes.InvalidArgument, "date is required")
+	}
+	for _, layout := range dateLayouts {
+		if _, err := time.Parse(layout, date); err == nil {
+			return nil
+		}
+	}
+	return status.Error(codes.InvalidArgument, "date must be formatted as YYYY-MM-DD or RFC 3339")
+}
+
+func (s *EventService) CreateEvent(caller *policy.Caller, title, description, date, organizerID string) (*model.Event, error) {
+	if err := policy.CanCreate(caller, organizerID); err != nil {
+		return nil, err
+	}
 	if title == "" {
-		return nil, fmt.Errorf("title is required")
+		return nil, status.Error(codes.InvalidArgument, "title is required")
+	}
+	if err := checkDate(date); err != nil {
+		return nil, err
 	}
 
 	event := &model.Event{
@@ -28,7 +63,7 @@ func (s *EventService) CreateEvent(title, description, date, organizerID string)
 		Title:       title,
 		Description: description,
 		Date:        date,
-		OrganizerID: organizerID,
+		OrganizerID: caller.UserID,
 	}
 
 	err := s.eventRepo.CreateEvent(event)
@@ -49,14 +84,21 @@ func (s *EventService) GetEvent(eventID string) (*model.Event, error) {
 	return event, nil
 }
 
-func (s *EventService) JoinEvent(eventID, userID string) (string, error) {
-	_, err := s.GetEvent(eventID)
+func (s *EventService) JoinEvent(caller *policy.Caller, eventID, userID string) (string, error) {
+	if err := policy.CanJoin(caller, userID); err != nil {
+		return "", err
+	}
+
+	event, err := s.findEvent(eventID)
 	if err != nil {
-		return "", fmt.Errorf("event not found")
+		return "", err
+	}
+	if event.Cancelled() {
+		return "", status.Error(codes.FailedPrecondition, "event is cancelled")
 	}
 
 	joinID := uuid.NewString()
-	err = s.eventRepo.AddParticipant(eventID, userID, joinID)
+	err = s.eventRepo.AddParticipant(eventID, caller.UserID, joinID)
 	if err != nil {
 		return "", err
 	}
@@ -64,6 +106,54 @@ func (s *EventService) JoinEvent(eventID, userID string) (string, error) {
 	return joinID, nil
 }
 
+func (s *EventService) UpdateEvent(caller *policy.Caller, eventID string, update EventUpdate) (*model.Event, error) {
+	event, err := s.findEvent(eventID)
+	if err != nil {
+		return nil, err
+	}
+	if err := policy.CanModify(caller, event); err != nil {
+		return nil, err
+	}
+	if event.Cancelled() {
+		return nil, status.Error(codes.FailedPrecondition, "event is cancelled")
+	}
+
+	if update.Title != nil {
+		if *update.Title == "" {
+			return nil, status.Error(codes.InvalidArgument, "title is required")
+		}
+		event.Title = *update.Title
+	}
+	if update.Description != nil {
+		event.Description = *update.Description
+	}
+	if update.Date != nil {
+		if err := checkDate(*update.Date); err != nil {
+			return nil, err
+		}
+		event.Date = *update.Date
+	}
+
+	if err := s.eventRepo.UpdateEvent(event); err != nil {
+		return nil, err
+	}
+
+	return event, nil
+}
+
+// CancelEvent cancels the event. Cancelling it again is not an error.
+func (s *EventService) CancelEvent(caller *policy.Caller, eventID string) error {
+	event, err := s.findEvent(eventID)
+	if err != nil {
+		return err
+	}
+	if err := policy.CanModify(caller, event); err != nil {
+		return err
+	}
+
+	return s.eventRepo.CancelEvent(eventID, time.Now())
+}
+
 func (s *EventService) GetEvents(limit, offset int32) ([]*model.Event, int32, error) {
 	events, count, err := s.eventRepo.GetEvents(limit, offset)
 	if err != nil {
@@ -72,3 +162,11 @@ func (s *EventService) GetEvents(limit, offset int32) ([]*model.Event, int32, er
 
 	return events, count, nil
 }
+
+func (s *EventService) findEvent(eventID string) (*model.Event, error) {
+	event, err := s.eventRepo.GetEventByID(eventID)
+	if errors.Is(err, model.ErrEventNotFound) {
+		return nil, status.Error(codes.NotFound, "event not found")
+	}
+	return event, err
+}
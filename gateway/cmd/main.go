@@ -6,8 +6,11 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/polyakovaa/grpcproxy/gateway/config"
 	"github.com/polyakovaa/grpcproxy/gateway/internal/handler"
+	"github.com/polyakovaa/grpcproxy/gateway/internal/middleware"
+	"github.com/polyakovaa/grpcproxy/gateway/internal/ratelimit"
 	"github.com/polyakovaa/grpcproxy/gen/auth"
 	"github.com/polyakovaa/grpcproxy/gen/event"
+	"github.com/polyakovaa/grpcproxy/svcauth"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/connectivity"
 	"google.golang.org/grpc/credentials/insecure"
@@ -20,7 +23,14 @@ func main() {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
-	authClient, authConn, err := NewAuthClient(cfg.Services["auth"].Address)
+	var dialOpts []grpc.DialOption
+	if cfg.ServiceSecret != "" {
+		dialOpts = append(dialOpts, grpc.WithUnaryInterceptor(svcauth.UnaryClientInterceptor([]byte(cfg.ServiceSecret))))
+	} else {
+		log.Println("No service_secret configured, backend calls are not signed and carry no client IP")
+	}
+
+	authClient, authConn, err := NewAuthClient(cfg.Services["auth"].Address, dialOpts...)
 	if authConn != nil {
 		defer authConn.Close()
 	}
@@ -29,7 +39,7 @@ func main() {
 		log.Println("Error connecting Auth service")
 	}
 
-	eventClient, eventConn, err := NewEventClient(cfg.Services["event"].Address)
+	eventClient, eventConn, err := NewEventClient(cfg.Services["event"].Address, dialOpts...)
 	if eventConn != nil {
 		defer eventConn.Close()
 	}
@@ -39,6 +49,10 @@ func main() {
 	}
 
 	router := gin.Default()
+	if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		log.Fatalf("Invalid trusted proxies: %v", err)
+	}
+	router.Use(middleware.ClientMetadata())
 
 	router.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{
@@ -50,22 +64,122 @@ func main() {
 		})
 	})
 
-	authHandler := handler.NewAuthHandler(authClient)
-	eventHandler := handler.NewEventHandler(eventClient, authClient)
+	magicLinkLimit := cfg.Auth.MagicLinkRateLimit
+	resetLimit := cfg.Auth.PasswordResetRateLimit
+	authHandler := handler.NewAuthHandler(authClient,
+		ratelimit.New(magicLinkLimit.Requests, magicLinkLimit.Window),
+		ratelimit.New(resetLimit.Requests, resetLimit.Window),
+	)
+	eventHandler := handler.NewEventHandler(eventClient)
+	adminHandler := handler.NewAdminHandler(authClient)
+	userHandler := handler.NewUserHandler(authClient)
+	oauthHandler := handler.NewOAuthHandler(authClient, cfg.Auth.OAuthConsentURL)
+
+	authenticator := middleware.NewAuthenticator(
+		authClient,
+		middleware.NewJWKSCache(authClient, cfg.Auth.JWKSCacheTTL),
+		middleware.AuthConfig{
+			Issuer:          cfg.Auth.Issuer,
+			Audience:        cfg.Auth.Audience,
+			Leeway:          cfg.Auth.Leeway,
+			CheckRevocation: cfg.Auth.CheckRevocation,
+		},
+	)
+
+	router.GET("/.well-known/jwks.json", authHandler.JWKS)
+	router.GET("/.well-known/openid-configuration", oauthHandler.Discovery)
+
+	oauthGroup := router.Group("/oauth")
+	{
+		oauthGroup.GET("/authorize", oauthHandler.StartAuthorization)
+		oauthGroup.POST("/token", oauthHandler.Token)
+		oauthGroup.POST("/introspect", oauthHandler.Introspect)
+		oauthGroup.POST("/revoke", oauthHandler.Revoke)
+		oauthGroup.GET("/userinfo", oauthHandler.UserInfo)
+		oauthGroup.POST("/userinfo", oauthHandler.UserInfo)
+	}
+
+	consentGroup := router.Group("/oauth", authenticator.RequireAuth(), middleware.RejectPersonalTokens())
+	{
+		consentGroup.GET("/authorization", oauthHandler.GetAuthorization)
+		consentGroup.POST("/authorize", oauthHandler.Authorize)
+	}
 
 	authGroup := router.Group("/auth")
 	{
 		authGroup.POST("/register", authHandler.Register)
 		authGroup.POST("/login", authHandler.Login)
 		authGroup.POST("/refresh", authHandler.RefreshToken)
+		authGroup.POST("/logout", authHandler.Logout)
+		authGroup.POST("/logout-all", authHandler.LogoutAll)
+		authGroup.POST("/password/forgot", authHandler.ForgotPassword)
+		authGroup.POST("/password/reset", authHandler.ResetPassword)
+		authGroup.POST("/magic-link", authHandler.RequestMagicLink)
+		authGroup.POST("/magic-link/consume", authHandler.ConsumeMagicLink)
+		authGroup.POST("/email/verify", authHandler.VerifyEmail)
+		authGroup.POST("/email/resend", authHandler.ResendVerificationEmail)
+		authGroup.POST("/2fa/verify", authHandler.VerifySecondFactor)
+		authGroup.POST("/2fa/enroll", authHandler.EnrollTOTP)
+		authGroup.POST("/2fa/confirm", authHandler.ConfirmTOTP)
+		authGroup.POST("/2fa/disable", authHandler.DisableTOTP)
+		authGroup.GET("/oidc", authHandler.ListIdentityProviders)
+		authGroup.GET("/oidc/:provider", authHandler.StartFederatedLogin)
+		authGroup.GET("/oidc/:provider/callback", authHandler.FederatedCallback)
 	}
 
 	eventGroup := router.Group("/events")
 	{
 		eventGroup.GET("/listevents", eventHandler.GetEvents)
 		eventGroup.GET("/:id", eventHandler.GetEvent)
-		eventGroup.POST("/", eventHandler.CreateEvent)
-		eventGroup.POST("/:id/join", eventHandler.JoinEvent)
+	}
+
+	authedEventGroup := router.Group("/events", authenticator.RequireAuth())
+	{
+		createEvent := []gin.HandlerFunc{
+			middleware.RequireScope(middleware.ScopeEventsWrite),
+			middleware.RequireRole(middleware.RoleOrganizer, middleware.RoleAdmin),
+		}
+		if cfg.Auth.RequireVerifiedEmail {
+			createEvent = append(createEvent, middleware.RequireVerifiedEmail())
+		}
+		authedEventGroup.POST("/", append(createEvent, eventHandler.CreateEvent)...)
+		authedEventGroup.POST("/:id/join", middleware.RequireScope(middleware.ScopeEventsWrite), eventHandler.JoinEvent)
+		authedEventGroup.PATCH("/:id", middleware.RequireScope(middleware.ScopeEventsWrite), eventHandler.UpdateEvent)
+		authedEventGroup.POST("/:id/cancel", middleware.RequireScope(middleware.ScopeEventsWrite), eventHandler.CancelEvent)
+	}
+
+	userGroup := router.Group("/users/me", authenticator.RequireAuth(), middleware.RejectPersonalTokens())
+	{
+		userGroup.GET("", userHandler.GetMe)
+		userGroup.PATCH("", userHandler.UpdateMe)
+		userGroup.DELETE("", userHandler.DeleteMe)
+		userGroup.POST("/email", userHandler.ChangeEmail)
+		userGroup.POST("/password", userHandler.ChangePassword)
+		userGroup.GET("/sessions", userHandler.ListSessions)
+		userGroup.DELETE("/sessions/:id", userHandler.RevokeSession)
+		userGroup.GET("/tokens", userHandler.ListPersonalTokens)
+		userGroup.POST("/tokens", userHandler.CreatePersonalToken)
+		userGroup.DELETE("/tokens/:id", userHandler.RevokePersonalToken)
+		userGroup.GET("/apps", userHandler.ListApps)
+		userGroup.DELETE("/apps/:client_id", userHandler.RevokeApp)
+	}
+
+	adminGroup := router.Group("/admin", authenticator.RequireAuth(), middleware.RejectPersonalTokens(), middleware.RequireRole(middleware.RoleAdmin))
+	{
+		adminGroup.GET("/users", adminHandler.ListUsers)
+		adminGroup.GET("/users/:id", adminHandler.GetUser)
+		adminGroup.POST("/users/:id/suspend", adminHandler.SuspendUser)
+		adminGroup.DELETE("/users/:id/suspend", adminHandler.UnsuspendUser)
+		adminGroup.POST("/users/:id/password-reset", adminHandler.ForcePasswordReset)
+		adminGroup.DELETE("/users/:id/sessions", adminHandler.RevokeSessions)
+		adminGroup.POST("/users/:id/impersonate", adminHandler.Impersonate)
+		adminGroup.POST("/users/:id/roles", adminHandler.GrantRole)
+		adminGroup.DELETE("/users/:id/roles/:role", adminHandler.RevokeRole)
+		adminGroup.GET("/oauth/clients", adminHandler.ListOAuthClients)
+		adminGroup.POST("/oauth/clients", adminHandler.RegisterOAuthClient)
+		adminGroup.DELETE("/oauth/clients/:id", adminHandler.DeleteOAuthClient)
+		adminGroup.GET("/audit", adminHandler.ListAuditEvents)
+		adminGroup.GET("/audit/export", adminHandler.ExportAuditEvents)
 	}
 
 	log.Printf("Gateway running on :%s", cfg.Server.Port)
@@ -74,16 +188,16 @@ func main() {
 	}
 }
 
-func NewAuthClient(address string) (auth.AuthServiceClient, *grpc.ClientConn, error) {
-	conn, err := grpc.NewClient(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+func NewAuthClient(address string, opts ...grpc.DialOption) (auth.AuthServiceClient, *grpc.ClientConn, error) {
+	conn, err := grpc.NewClient(address, append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))...)
 	if err != nil {
 		return nil, nil, err
 	}
 	return auth.NewAuthServiceClient(conn), conn, nil
 }
 
-func NewEventClient(address string) (event.EventServiceClient, *grpc.ClientConn, error) {
-	conn, err := grpc.NewClient(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+func NewEventClient(address string, opts ...grpc.DialOption) (event.EventServiceClient, *grpc.ClientConn, error) {
+	conn, err := grpc.NewClient(address, append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))...)
 	if err != nil {
 		return nil, nil, err
 	}
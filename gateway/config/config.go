@@ -12,11 +12,18 @@ type GatewayConfig struct {
 	Server   ServerConfig             `yaml:"server"`
 	Services map[string]ServiceConfig `yaml:"services"`
 	Logging  LoggingConfig            `yaml:"logging"`
+	Auth     AuthConfig               `yaml:"auth"`
+	// ServiceSecret signs the identity of the user on every backend call.
+	// The backends have to be configured with the same secret.
+	ServiceSecret string `yaml:"service_secret"`
 }
 
 type ServerConfig struct {
 	Port    string        `yaml:"port"`
 	Timeout time.Duration `yaml:"timeout"`
+	// TrustedProxies lists the proxies whose X-Forwarded-For header is used
+	// to determine the client IP.
+	TrustedProxies []string `yaml:"trusted_proxies"`
 }
 
 type ServiceConfig struct {
@@ -28,6 +35,29 @@ type LoggingConfig struct {
 	Level string `yaml:"level"`
 }
 
+type AuthConfig struct {
+	Issuer          string        `yaml:"issuer"`
+	Audience        string        `yaml:"audience"`
+	Leeway          time.Duration `yaml:"leeway"`
+	JWKSCacheTTL    time.Duration `yaml:"jwks_cache_ttl"`
+	CheckRevocation bool          `yaml:"check_revocation"`
+
+	RequireVerifiedEmail bool `yaml:"require_verified_email"`
+	// OAuthConsentURL is the frontend page that signs the user in and asks
+	// for consent when an application starts an OAuth authorization.
+	OAuthConsentURL string `yaml:"oauth_consent_url"`
+	// MagicLinkRateLimit caps how many login links may be requested for one
+	// email address.
+	MagicLinkRateLimit RateLimitConfig `yaml:"magic_link_rate_limit"`
+	// PasswordResetRateLimit does the same for password reset links.
+	PasswordResetRateLimit RateLimitConfig `yaml:"password_reset_rate_limit"`
+}
+
+type RateLimitConfig struct {
+	Requests int           `yaml:"requests"`
+	Window   time.Duration `yaml:"window"`
+}
+
 func LoadConfig(path string) (*GatewayConfig, error) {
 	file, err := os.Open(path)
 	if err != nil {
@@ -66,6 +96,28 @@ func (c *GatewayConfig) Validate() error {
 		}
 	}
 
+	// Without an audience, tokens the auth service signs for other
+	// recipients, such as OAuth ID tokens, would be accepted as sessions.
+	if c.Auth.Audience == "" {
+		return fmt.Errorf("auth audience is required")
+	}
+
+	if c.Auth.JWKSCacheTTL == 0 {
+		c.Auth.JWKSCacheTTL = 5 * time.Minute
+	}
+	if c.Auth.MagicLinkRateLimit.Requests == 0 {
+		c.Auth.MagicLinkRateLimit.Requests = 3
+	}
+	if c.Auth.MagicLinkRateLimit.Window == 0 {
+		c.Auth.MagicLinkRateLimit.Window = 15 * time.Minute
+	}
+	if c.Auth.PasswordResetRateLimit.Requests == 0 {
+		c.Auth.PasswordResetRateLimit.Requests = 3
+	}
+	if c.Auth.PasswordResetRateLimit.Window == 0 {
+		c.Auth.PasswordResetRateLimit.Window = 15 * time.Minute
+	}
+
 	return nil
 }
 
@@ -0,0 +1,168 @@
+package handler
+
+import (
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/polyakovaa/grpcproxy/gateway/internal/middleware"
+	"github.com/polyakovaa/grpcproxy/gateway/internal/utils"
+	"github.com/polyakovaa/grpcproxy/gen/auth"
+)
+
+type AdminHandler struct {
+	authClient auth.AuthServiceClient
+}
+
+func NewAdminHandler(authClient auth.AuthServiceClient) *AdminHandler {
+	return &AdminHandler{authClient: authClient}
+}
+
+func (h *AdminHandler) GrantRole(c *gin.Context) {
+	if h.authClient == nil {
+		c.JSON(503, gin.H{"error": "Auth service unavailable"})
+		return
+	}
+
+	var request struct {
+		Role string `json:"role"`
+	}
+	if err := c.BindJSON(&request); err != nil || request.Role == "" {
+		c.JSON(400, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	accessToken, _ := middleware.BearerToken(c)
+	response, err := h.authClient.GrantRole(c.Request.Context(), &auth.RoleRequest{
+		AccessToken: accessToken,
+		UserId:      c.Param("id"),
+		Role:        request.Role,
+	})
+	if err != nil {
+		log.Printf("GrantRole error: %v", err)
+		utils.HandleGRPCError(c, err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"user_id": response.UserId,
+		"roles":   response.Roles,
+	})
+}
+
+func (h *AdminHandler) RevokeRole(c *gin.Context) {
+	if h.authClient == nil {
+		c.JSON(503, gin.H{"error": "Auth service unavailable"})
+		return
+	}
+
+	accessToken, _ := middleware.BearerToken(c)
+	response, err := h.authClient.RevokeRole(c.Request.Context(), &auth.RoleRequest{
+		AccessToken: accessToken,
+		UserId:      c.Param("id"),
+		Role:        c.Param("role"),
+	})
+	if err != nil {
+		log.Printf("RevokeRole error: %v", err)
+		utils.HandleGRPCError(c, err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"user_id": response.UserId,
+		"roles":   response.Roles,
+	})
+}
+
+func oauthClientJSON(cl *auth.OAuthClient) gin.H {
+	return gin.H{
+		"client_id":     cl.ClientId,
+		"name":          cl.Name,
+		"redirect_uris": cl.RedirectUris,
+		"scopes":        cl.Scopes,
+		"public":        cl.Public,
+		"created_at":    cl.CreatedAt.AsTime().Format(time.RFC3339),
+	}
+}
+
+func (h *AdminHandler) RegisterOAuthClient(c *gin.Context) {
+	if h.authClient == nil {
+		c.JSON(503, gin.H{"error": "Auth service unavailable"})
+		return
+	}
+
+	var request struct {
+		Name         string   `json:"name"`
+		RedirectURIs []string `json:"redirect_uris"`
+		Scopes       []string `json:"scopes"`
+		Public       bool     `json:"public"`
+	}
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	accessToken, _ := middleware.BearerToken(c)
+	response, err := h.authClient.RegisterOAuthClient(c.Request.Context(), &auth.RegisterOAuthClientRequest{
+		AccessToken:  accessToken,
+		Name:         request.Name,
+		RedirectUris: request.RedirectURIs,
+		Scopes:       request.Scopes,
+		Public:       request.Public,
+	})
+	if err != nil {
+		log.Printf("RegisterOAuthClient error: %v", err)
+		utils.HandleGRPCError(c, err)
+		return
+	}
+
+	body := oauthClientJSON(response.Client)
+	if response.ClientSecret != "" {
+		body["client_secret"] = response.ClientSecret
+	}
+	c.JSON(201, body)
+}
+
+func (h *AdminHandler) ListOAuthClients(c *gin.Context) {
+	if h.authClient == nil {
+		c.JSON(503, gin.H{"error": "Auth service unavailable"})
+		return
+	}
+
+	accessToken, _ := middleware.BearerToken(c)
+	response, err := h.authClient.ListOAuthClients(c.Request.Context(), &auth.ListOAuthClientsRequest{
+		AccessToken: accessToken,
+	})
+	if err != nil {
+		log.Printf("ListOAuthClients error: %v", err)
+		utils.HandleGRPCError(c, err)
+		return
+	}
+
+	clients := make([]gin.H, 0, len(response.Clients))
+	for _, cl := range response.Clients {
+		clients = append(clients, oauthClientJSON(cl))
+	}
+
+	c.JSON(200, gin.H{"clients": clients})
+}
+
+func (h *AdminHandler) DeleteOAuthClient(c *gin.Context) {
+	if h.authClient == nil {
+		c.JSON(503, gin.H{"error": "Auth service unavailable"})
+		return
+	}
+
+	accessToken, _ := middleware.BearerToken(c)
+	_, err := h.authClient.DeleteOAuthClient(c.Request.Context(), &auth.DeleteOAuthClientRequest{
+		AccessToken: accessToken,
+		ClientId:    c.Param("id"),
+	})
+	if err != nil {
+		log.Printf("DeleteOAuthClient error: %v", err)
+		utils.HandleGRPCError(c, err)
+		return
+	}
+
+	c.Status(204)
+}
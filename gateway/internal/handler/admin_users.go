@@ -0,0 +1,187 @@
+package handler
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/polyakovaa/grpcproxy/gateway/internal/middleware"
+	"github.com/polyakovaa/grpcproxy/gateway/internal/utils"
+	"github.com/polyakovaa/grpcproxy/gen/auth"
+)
+
+func (h *AdminHandler) ListUsers(c *gin.Context) {
+	if h.authClient == nil {
+		c.JSON(503, gin.H{"error": "Auth service unavailable"})
+		return
+	}
+
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.JSON(400, gin.H{"error": "invalid offset"})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 {
+		c.JSON(400, gin.H{"error": "invalid limit"})
+		return
+	}
+
+	accessToken, _ := middleware.BearerToken(c)
+	response, err := h.authClient.ListUsers(c.Request.Context(), &auth.ListUsersRequest{
+		AccessToken: accessToken,
+		Query:       c.Query("q"),
+		Limit:       int32(limit),
+		Offset:      int32(offset),
+	})
+	if err != nil {
+		log.Printf("ListUsers error: %v", err)
+		utils.HandleGRPCError(c, err)
+		return
+	}
+
+	users := make([]gin.H, 0, len(response.Users))
+	for _, u := range response.Users {
+		users = append(users, profileJSON(u))
+	}
+
+	c.JSON(200, gin.H{
+		"users":       users,
+		"total_count": response.TotalCount,
+	})
+}
+
+func (h *AdminHandler) GetUser(c *gin.Context) {
+	if h.authClient == nil {
+		c.JSON(503, gin.H{"error": "Auth service unavailable"})
+		return
+	}
+
+	accessToken, _ := middleware.BearerToken(c)
+	response, err := h.authClient.AdminGetUser(c.Request.Context(), &auth.AdminUserRequest{
+		AccessToken: accessToken,
+		UserId:      c.Param("id"),
+	})
+	if err != nil {
+		log.Printf("AdminGetUser error: %v", err)
+		utils.HandleGRPCError(c, err)
+		return
+	}
+
+	c.JSON(200, profileJSON(response))
+}
+
+func (h *AdminHandler) SuspendUser(c *gin.Context) {
+	if h.authClient == nil {
+		c.JSON(503, gin.H{"error": "Auth service unavailable"})
+		return
+	}
+
+	accessToken, _ := middleware.BearerToken(c)
+	response, err := h.authClient.SuspendUser(c.Request.Context(), &auth.AdminUserRequest{
+		AccessToken: accessToken,
+		UserId:      c.Param("id"),
+	})
+	if err != nil {
+		log.Printf("SuspendUser error: %v", err)
+		utils.HandleGRPCError(c, err)
+		return
+	}
+
+	c.JSON(200, profileJSON(response))
+}
+
+func (h *AdminHandler) UnsuspendUser(c *gin.Context) {
+	if h.authClient == nil {
+		c.JSON(503, gin.H{"error": "Auth service unavailable"})
+		return
+	}
+
+	accessToken, _ := middleware.BearerToken(c)
+	response, err := h.authClient.UnsuspendUser(c.Request.Context(), &auth.AdminUserRequest{
+		AccessToken: accessToken,
+		UserId:      c.Param("id"),
+	})
+	if err != nil {
+		log.Printf("UnsuspendUser error: %v", err)
+		utils.HandleGRPCError(c, err)
+		return
+	}
+
+	c.JSON(200, profileJSON(response))
+}
+
+func (h *AdminHandler) ForcePasswordReset(c *gin.Context) {
+	if h.authClient == nil {
+		c.JSON(503, gin.H{"error": "Auth service unavailable"})
+		return
+	}
+
+	accessToken, _ := middleware.BearerToken(c)
+	_, err := h.authClient.ForcePasswordReset(c.Request.Context(), &auth.AdminUserRequest{
+		AccessToken: accessToken,
+		UserId:      c.Param("id"),
+	})
+	if err != nil {
+		log.Printf("ForcePasswordReset error: %v", err)
+		utils.HandleGRPCError(c, err)
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "Password reset, the user was mailed a reset link"})
+}
+
+func (h *AdminHandler) RevokeSessions(c *gin.Context) {
+	if h.authClient == nil {
+		c.JSON(503, gin.H{"error": "Auth service unavailable"})
+		return
+	}
+
+	accessToken, _ := middleware.BearerToken(c)
+	_, err := h.authClient.AdminRevokeSessions(c.Request.Context(), &auth.AdminUserRequest{
+		AccessToken: accessToken,
+		UserId:      c.Param("id"),
+	})
+	if err != nil {
+		log.Printf("AdminRevokeSessions error: %v", err)
+		utils.HandleGRPCError(c, err)
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "All sessions revoked"})
+}
+
+func (h *AdminHandler) Impersonate(c *gin.Context) {
+	if h.authClient == nil {
+		c.JSON(503, gin.H{"error": "Auth service unavailable"})
+		return
+	}
+
+	var request struct {
+		Reason string `json:"reason"`
+	}
+	if err := c.BindJSON(&request); err != nil || request.Reason == "" {
+		c.JSON(400, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	accessToken, _ := middleware.BearerToken(c)
+	response, err := h.authClient.Impersonate(c.Request.Context(), &auth.ImpersonateRequest{
+		AccessToken: accessToken,
+		UserId:      c.Param("id"),
+		Reason:      request.Reason,
+	})
+	if err != nil {
+		log.Printf("Impersonate error: %v", err)
+		utils.HandleGRPCError(c, err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"access_token": response.AccessToken,
+		"expires_at":   response.ExpiresAt.AsTime().Format(time.RFC3339),
+		"user_id":      response.UserId,
+		"actor_id":     response.ActorId,
+	})
+}
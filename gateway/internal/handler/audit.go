@@ -0,0 +1,155 @@
+package handler
+
+import (
+	"encoding/json"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/polyakovaa/grpcproxy/gateway/internal/middleware"
+	"github.com/polyakovaa/grpcproxy/gateway/internal/utils"
+	"github.com/polyakovaa/grpcproxy/gen/auth"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// exportPageSize is the page size used to walk the audit log for exports,
+// the maximum the auth service allows.
+const exportPageSize = 500
+
+func auditEventJSON(e *auth.AuditEvent) gin.H {
+	return gin.H{
+		"id":         e.Id,
+		"user_id":    e.UserId,
+		"actor_id":   e.ActorId,
+		"event_type": e.EventType,
+		"outcome":    e.Outcome,
+		"ip":         e.Ip,
+		"user_agent": e.UserAgent,
+		"details":    e.Details,
+		"created_at": e.CreatedAt.AsTime().Format(time.RFC3339),
+	}
+}
+
+// auditRequest reads the filters shared by listing and export from the
+// query string.
+func auditRequest(c *gin.Context) (*auth.ListAuditEventsRequest, bool) {
+	accessToken, _ := middleware.BearerToken(c)
+	req := &auth.ListAuditEventsRequest{
+		AccessToken: accessToken,
+		UserId:      c.Query("user_id"),
+		EventType:   c.Query("event_type"),
+		Cursor:      c.Query("cursor"),
+	}
+
+	var err error
+	if req.Since, err = timeQuery(c, "since"); err != nil {
+		c.JSON(400, gin.H{"error": "invalid since"})
+		return nil, false
+	}
+	if req.Until, err = timeQuery(c, "until"); err != nil {
+		c.JSON(400, gin.H{"error": "invalid until"})
+		return nil, false
+	}
+
+	if v := c.Query("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			c.JSON(400, gin.H{"error": "invalid limit"})
+			return nil, false
+		}
+		req.Limit = int32(limit)
+	}
+
+	return req, true
+}
+
+// timeQuery parses the RFC 3339 time in query parameter name. It returns nil
+// when the parameter is missing.
+func timeQuery(c *gin.Context, name string) (*timestamppb.Timestamp, error) {
+	v := c.Query(name)
+	if v == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return nil, err
+	}
+	return timestamppb.New(t), nil
+}
+
+func (h *AdminHandler) ListAuditEvents(c *gin.Context) {
+	if h.authClient == nil {
+		c.JSON(503, gin.H{"error": "Auth service unavailable"})
+		return
+	}
+
+	req, ok := auditRequest(c)
+	if !ok {
+		return
+	}
+	response, err := h.authClient.ListAuditEvents(c.Request.Context(), req)
+	if err != nil {
+		log.Printf("ListAuditEvents error: %v", err)
+		utils.HandleGRPCError(c, err)
+		return
+	}
+
+	events := make([]gin.H, 0, len(response.Events))
+	for _, e := range response.Events {
+		events = append(events, auditEventJSON(e))
+	}
+
+	c.JSON(200, gin.H{
+		"events":      events,
+		"next_cursor": response.NextCursor,
+	})
+}
+
+// ExportAuditEvents streams every matching audit event as NDJSON, one event
+// per line. Errors after the first page can no longer change the status, so
+// they end the stream early and are only logged.
+func (h *AdminHandler) ExportAuditEvents(c *gin.Context) {
+	if h.authClient == nil {
+		c.JSON(503, gin.H{"error": "Auth service unavailable"})
+		return
+	}
+
+	req, ok := auditRequest(c)
+	if !ok {
+		return
+	}
+	req.Limit = exportPageSize
+
+	response, err := h.authClient.ListAuditEvents(c.Request.Context(), req)
+	if err != nil {
+		log.Printf("ExportAuditEvents error: %v", err)
+		utils.HandleGRPCError(c, err)
+		return
+	}
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Content-Disposition", `attachment; filename="audit.ndjson"`)
+	c.Status(200)
+
+	enc := json.NewEncoder(c.Writer)
+	for {
+		for _, e := range response.Events {
+			if err := enc.Encode(auditEventJSON(e)); err != nil {
+				log.Printf("ExportAuditEvents write error: %v", err)
+				return
+			}
+		}
+		c.Writer.Flush()
+
+		if response.NextCursor == "" {
+			return
+		}
+		req.Cursor = response.NextCursor
+		response, err = h.authClient.ListAuditEvents(c.Request.Context(), req)
+		if err != nil {
+			log.Printf("ExportAuditEvents error after %s: %v", req.Cursor, err)
+			return
+		}
+	}
+}
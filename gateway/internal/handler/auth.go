@@ -2,20 +2,45 @@ package handler
 
 import (
 	"log"
+	"math"
 	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/polyakovaa/grpcproxy/gateway/internal/middleware"
+	"github.com/polyakovaa/grpcproxy/gateway/internal/ratelimit"
 	"github.com/polyakovaa/grpcproxy/gateway/internal/utils"
 	"github.com/polyakovaa/grpcproxy/gen/auth"
 )
 
 type AuthHandler struct {
 	authClient auth.AuthServiceClient
+	// magicLinks and passwordResets limit mailed link requests per email
+	// address.
+	magicLinks     *ratelimit.Limiter
+	passwordResets *ratelimit.Limiter
 }
 
-func NewAuthHandler(authClient auth.AuthServiceClient) *AuthHandler {
-	return &AuthHandler{authClient: authClient}
+func NewAuthHandler(authClient auth.AuthServiceClient, magicLinks, passwordResets *ratelimit.Limiter) *AuthHandler {
+	return &AuthHandler{authClient: authClient, magicLinks: magicLinks, passwordResets: passwordResets}
+}
+
+// rateLimited counts a mailed link request for email against l and answers
+// 429 if the address used up its window. A nil limiter allows everything.
+func rateLimited(c *gin.Context, l *ratelimit.Limiter, email, message string) bool {
+	if l == nil {
+		return false
+	}
+	key := strings.ToLower(strings.TrimSpace(email))
+	ok, retryAfter := l.Allow(key, time.Now())
+	if ok {
+		return false
+	}
+	c.Header("Retry-After", strconv.FormatInt(int64(math.Ceil(retryAfter.Seconds())), 10))
+	c.JSON(429, gin.H{"error": message})
+	return true
 }
 
 func (h *AuthHandler) Register(c *gin.Context) {
@@ -46,7 +71,7 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
-	c.SetCookie("refresh_token", response.RefreshToken, int(response.ExpiresAt.AsTime().Unix()), "/", "", false, true)
+	setRefreshCookie(c, response.RefreshToken, response.ExpiresAt.AsTime())
 
 	c.JSON(201, gin.H{
 		"user_id":       response.UserId,
@@ -83,7 +108,16 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	c.SetCookie("refresh_token", response.RefreshToken, int(response.ExpiresAt.AsTime().Unix()), "/", "", false, true)
+	if response.MfaRequired {
+		c.JSON(200, gin.H{
+			"user_id":      response.UserId,
+			"mfa_required": true,
+			"mfa_token":    response.MfaToken,
+		})
+		return
+	}
+
+	setRefreshCookie(c, response.RefreshToken, response.ExpiresAt.AsTime())
 
 	c.JSON(200, gin.H{
 		"user_id":       response.UserId,
@@ -121,10 +155,429 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 		return
 	}
 
-	c.SetCookie("refresh_token", response.RefreshToken, int(response.ExpiresAt.AsTime().Unix()-time.Now().Unix()), "/", "", false, true)
+	setRefreshCookie(c, response.RefreshToken, response.ExpiresAt.AsTime())
 
 	c.JSON(200, gin.H{
 		"access_token": response.AccessToken,
 		"expires_at":   response.ExpiresAt.AsTime().Format(time.RFC3339),
 	})
 }
+
+func (h *AuthHandler) Logout(c *gin.Context) {
+	refreshToken, _ := c.Cookie("refresh_token")
+	// The client is signed out even if the auth service is unavailable or
+	// rejects the tokens.
+	clearRefreshCookie(c)
+
+	if h.authClient == nil {
+		c.JSON(503, gin.H{"error": "auth service unavailable"})
+		return
+	}
+
+	if refreshToken != "" {
+		var err error
+		refreshToken, err = url.QueryUnescape(refreshToken)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "invalid refresh token encoding"})
+			return
+		}
+	}
+
+	accessToken, _ := middleware.BearerToken(c)
+	if refreshToken == "" && accessToken == "" {
+		c.JSON(401, gin.H{"error": "refresh token or access token required"})
+		return
+	}
+
+	_, err := h.authClient.Logout(c.Request.Context(), &auth.LogoutRequest{
+		RefreshToken: refreshToken,
+		AccessToken:  accessToken,
+	})
+	if err != nil {
+		utils.HandleGRPCError(c, err)
+		log.Printf("Logout error: %v", err)
+		return
+	}
+
+	c.JSON(200, gin.H{"success": true})
+}
+
+func (h *AuthHandler) LogoutAll(c *gin.Context) {
+	if h.authClient == nil {
+		c.JSON(503, gin.H{"error": "auth service unavailable"})
+		return
+	}
+
+	accessToken, err := middleware.BearerToken(c)
+	if err != nil {
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	_, err = h.authClient.LogoutAll(c.Request.Context(), &auth.LogoutAllRequest{
+		AccessToken: accessToken,
+	})
+	if err != nil {
+		utils.HandleGRPCError(c, err)
+		log.Printf("LogoutAll error: %v", err)
+		return
+	}
+
+	clearRefreshCookie(c)
+	c.JSON(200, gin.H{"success": true})
+}
+
+func (h *AuthHandler) JWKS(c *gin.Context) {
+	if h.authClient == nil {
+		c.JSON(503, gin.H{"error": "auth service unavailable"})
+		return
+	}
+
+	response, err := h.authClient.GetJWKS(c.Request.Context(), &auth.GetJWKSRequest{})
+	if err != nil {
+		utils.HandleGRPCError(c, err)
+		log.Printf("GetJWKS error: %v", err)
+		return
+	}
+
+	keys := []gin.H{}
+	for _, k := range response.Keys {
+		key := gin.H{
+			"kty": k.Kty,
+			"kid": k.Kid,
+			"use": k.Use,
+			"alg": k.Alg,
+		}
+		switch k.Kty {
+		case "RSA":
+			key["n"] = k.N
+			key["e"] = k.E
+		case "OKP":
+			key["crv"] = k.Crv
+			key["x"] = k.X
+		}
+		keys = append(keys, key)
+	}
+
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(200, gin.H{"keys": keys})
+}
+
+func (h *AuthHandler) ForgotPassword(c *gin.Context) {
+	if h.authClient == nil {
+		c.JSON(503, gin.H{"error": "auth service unavailable"})
+		return
+	}
+
+	var request struct {
+		Email string `json:"email"`
+	}
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	if rateLimited(c, h.passwordResets, request.Email, "too many password resets requested, try again later") {
+		return
+	}
+
+	_, err := h.authClient.RequestPasswordReset(c.Request.Context(), &auth.RequestPasswordResetRequest{
+		Email: request.Email,
+	})
+	if err != nil {
+		utils.HandleGRPCError(c, err)
+		log.Printf("RequestPasswordReset error: %v", err)
+		return
+	}
+
+	c.JSON(202, gin.H{"message": "If the account exists, a password reset link has been sent"})
+}
+
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	if h.authClient == nil {
+		c.JSON(503, gin.H{"error": "auth service unavailable"})
+		return
+	}
+
+	var request struct {
+		Token       string `json:"token"`
+		NewPassword string `json:"new_password"`
+	}
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	_, err := h.authClient.ResetPassword(c.Request.Context(), &auth.ResetPasswordRequest{
+		Token:       request.Token,
+		NewPassword: request.NewPassword,
+	})
+	if err != nil {
+		utils.HandleGRPCError(c, err)
+		log.Printf("ResetPassword error: %v", err)
+		return
+	}
+
+	clearRefreshCookie(c)
+	c.JSON(200, gin.H{"success": true})
+}
+
+func (h *AuthHandler) RequestMagicLink(c *gin.Context) {
+	if h.authClient == nil {
+		c.JSON(503, gin.H{"error": "auth service unavailable"})
+		return
+	}
+
+	var request struct {
+		Email string `json:"email"`
+	}
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	if rateLimited(c, h.magicLinks, request.Email, "too many login links requested, try again later") {
+		return
+	}
+
+	_, err := h.authClient.RequestMagicLink(c.Request.Context(), &auth.RequestMagicLinkRequest{
+		Email: request.Email,
+	})
+	if err != nil {
+		utils.HandleGRPCError(c, err)
+		log.Printf("RequestMagicLink error: %v", err)
+		return
+	}
+
+	c.JSON(202, gin.H{"message": "If the account exists, a login link has been sent"})
+}
+
+func (h *AuthHandler) ConsumeMagicLink(c *gin.Context) {
+	if h.authClient == nil {
+		c.JSON(503, gin.H{"error": "auth service unavailable"})
+		return
+	}
+
+	var request struct {
+		Token string `json:"token"`
+	}
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	response, err := h.authClient.ConsumeMagicLink(c.Request.Context(), &auth.ConsumeMagicLinkRequest{
+		Token: request.Token,
+	})
+	if err != nil {
+		utils.HandleGRPCError(c, err)
+		log.Printf("ConsumeMagicLink error: %v", err)
+		return
+	}
+
+	if response.MfaRequired {
+		c.JSON(200, gin.H{
+			"user_id":      response.UserId,
+			"mfa_required": true,
+			"mfa_token":    response.MfaToken,
+		})
+		return
+	}
+
+	setRefreshCookie(c, response.RefreshToken, response.ExpiresAt.AsTime())
+
+	c.JSON(200, gin.H{
+		"user_id":       response.UserId,
+		"access_token":  response.AccessToken,
+		"expires_at":    response.ExpiresAt.AsTime().Format(time.RFC3339),
+		"refresh_token": response.RefreshToken,
+	})
+}
+
+func (h *AuthHandler) VerifyEmail(c *gin.Context) {
+	if h.authClient == nil {
+		c.JSON(503, gin.H{"error": "auth service unavailable"})
+		return
+	}
+
+	var request struct {
+		Token string `json:"token"`
+	}
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	response, err := h.authClient.VerifyEmail(c.Request.Context(), &auth.VerifyEmailRequest{
+		Token: request.Token,
+	})
+	if err != nil {
+		utils.HandleGRPCError(c, err)
+		log.Printf("VerifyEmail error: %v", err)
+		return
+	}
+
+	c.JSON(200, gin.H{"success": true, "user_id": response.UserId})
+}
+
+func (h *AuthHandler) ResendVerificationEmail(c *gin.Context) {
+	if h.authClient == nil {
+		c.JSON(503, gin.H{"error": "auth service unavailable"})
+		return
+	}
+
+	accessToken, err := middleware.BearerToken(c)
+	if err != nil {
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	_, err = h.authClient.ResendVerificationEmail(c.Request.Context(), &auth.ResendVerificationEmailRequest{
+		AccessToken: accessToken,
+	})
+	if err != nil {
+		utils.HandleGRPCError(c, err)
+		log.Printf("ResendVerificationEmail error: %v", err)
+		return
+	}
+
+	c.JSON(202, gin.H{"message": "Verification email sent"})
+}
+
+func (h *AuthHandler) VerifySecondFactor(c *gin.Context) {
+	if h.authClient == nil {
+		c.JSON(503, gin.H{"error": "auth service unavailable"})
+		return
+	}
+
+	var request struct {
+		MfaToken string `json:"mfa_token"`
+		Code     string `json:"code"`
+	}
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	response, err := h.authClient.VerifySecondFactor(c.Request.Context(), &auth.VerifySecondFactorRequest{
+		MfaToken: request.MfaToken,
+		Code:     request.Code,
+	})
+	if err != nil {
+		utils.HandleGRPCError(c, err)
+		log.Printf("VerifySecondFactor error: %v", err)
+		return
+	}
+
+	setRefreshCookie(c, response.RefreshToken, response.ExpiresAt.AsTime())
+
+	c.JSON(200, gin.H{
+		"user_id":       response.UserId,
+		"access_token":  response.AccessToken,
+		"expires_at":    response.ExpiresAt.AsTime().Format(time.RFC3339),
+		"refresh_token": response.RefreshToken,
+	})
+}
+
+func (h *AuthHandler) EnrollTOTP(c *gin.Context) {
+	if h.authClient == nil {
+		c.JSON(503, gin.H{"error": "auth service unavailable"})
+		return
+	}
+
+	accessToken, err := middleware.BearerToken(c)
+	if err != nil {
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	response, err := h.authClient.EnrollTOTP(c.Request.Context(), &auth.EnrollTOTPRequest{
+		AccessToken: accessToken,
+	})
+	if err != nil {
+		utils.HandleGRPCError(c, err)
+		log.Printf("EnrollTOTP error: %v", err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"secret":      response.Secret,
+		"otpauth_uri": response.OtpauthUri,
+	})
+}
+
+func (h *AuthHandler) ConfirmTOTP(c *gin.Context) {
+	if h.authClient == nil {
+		c.JSON(503, gin.H{"error": "auth service unavailable"})
+		return
+	}
+
+	accessToken, err := middleware.BearerToken(c)
+	if err != nil {
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var request struct {
+		Code string `json:"code"`
+	}
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	response, err := h.authClient.ConfirmTOTP(c.Request.Context(), &auth.TOTPCodeRequest{
+		AccessToken: accessToken,
+		Code:        request.Code,
+	})
+	if err != nil {
+		utils.HandleGRPCError(c, err)
+		log.Printf("ConfirmTOTP error: %v", err)
+		return
+	}
+
+	c.JSON(200, gin.H{"recovery_codes": response.RecoveryCodes})
+}
+
+func (h *AuthHandler) DisableTOTP(c *gin.Context) {
+	if h.authClient == nil {
+		c.JSON(503, gin.H{"error": "auth service unavailable"})
+		return
+	}
+
+	accessToken, err := middleware.BearerToken(c)
+	if err != nil {
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var request struct {
+		Code string `json:"code"`
+	}
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	_, err = h.authClient.DisableTOTP(c.Request.Context(), &auth.TOTPCodeRequest{
+		AccessToken: accessToken,
+		Code:        request.Code,
+	})
+	if err != nil {
+		utils.HandleGRPCError(c, err)
+		log.Printf("DisableTOTP error: %v", err)
+		return
+	}
+
+	c.JSON(200, gin.H{"enabled": false})
+}
+
+// setRefreshCookie stores a refresh token in a cookie that lives as long as
+// the token. MaxAge is relative, so the absolute expiry is converted.
+func setRefreshCookie(c *gin.Context, token string, expiresAt time.Time) {
+	c.SetCookie("refresh_token", token, int(expiresAt.Unix()-time.Now().Unix()), "/", "", false, true)
+}
+
+func clearRefreshCookie(c *gin.Context) {
+	c.SetCookie("refresh_token", "", -1, "/", "", false, true)
+}
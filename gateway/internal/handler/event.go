@@ -1,26 +1,32 @@
 package handler
 
 import (
-	"fmt"
 	"log"
 	"strconv"
-	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/polyakovaa/grpcproxy/gateway/internal/middleware"
 	"github.com/polyakovaa/grpcproxy/gateway/internal/utils"
-	"github.com/polyakovaa/grpcproxy/gen/auth"
 	"github.com/polyakovaa/grpcproxy/gen/event"
 )
 
 type EventHandler struct {
 	eventClient event.EventServiceClient
-	authClient  auth.AuthServiceClient
 }
 
-func NewEventHandler(eventClient event.EventServiceClient, authClient auth.AuthServiceClient) *EventHandler {
+func NewEventHandler(eventClient event.EventServiceClient) *EventHandler {
 	return &EventHandler{
 		eventClient: eventClient,
-		authClient:  authClient,
+	}
+}
+
+func eventJSON(e *event.EventResponse) gin.H {
+	return gin.H{
+		"id":          e.EventId,
+		"title":       e.Title,
+		"description": e.Description,
+		"date":        e.Date,
+		"cancelled":   e.Cancelled,
 	}
 }
 
@@ -40,11 +46,7 @@ func (h *EventHandler) CreateEvent(c *gin.Context) {
 		return
 	}
 
-	userID, err := h.getAuthenticatedUserID(c)
-	if err != nil {
-		c.JSON(401, gin.H{"error": "Unauthorized"})
-		return
-	}
+	userID := middleware.UserID(c)
 
 	response, err := h.eventClient.CreateEvent(c.Request.Context(), &event.CreateEventRequest{
 		Title:       request.Title,
@@ -58,12 +60,7 @@ func (h *EventHandler) CreateEvent(c *gin.Context) {
 		return
 	}
 
-	c.JSON(201, gin.H{
-		"id":          response.EventId,
-		"title":       response.Title,
-		"description": response.Description,
-		"date":        response.Date,
-	})
+	c.JSON(201, eventJSON(response))
 }
 
 func (h *EventHandler) GetEvent(c *gin.Context) {
@@ -84,13 +81,7 @@ func (h *EventHandler) GetEvent(c *gin.Context) {
 		return
 	}
 
-	c.JSON(200, gin.H{
-		"id":          response.EventId,
-		"title":       response.Title,
-		"description": response.Description,
-		"date":        response.Date,
-	})
-
+	c.JSON(200, eventJSON(response))
 }
 
 func (h *EventHandler) GetEvents(c *gin.Context) {
@@ -132,6 +123,7 @@ func (h *EventHandler) GetEvents(c *gin.Context) {
 			"description": e.Description,
 			"date":        e.Date,
 			"organizerId": e.OrganizerId,
+			"cancelled":   e.Cancelled,
 		})
 	}
 
@@ -150,12 +142,7 @@ func (h *EventHandler) JoinEvent(c *gin.Context) {
 
 	eventID := c.Param("id")
 
-	userID, err := h.getAuthenticatedUserID(c)
-
-	if err != nil {
-		c.JSON(401, gin.H{"error": "Unauthorized"})
-		return
-	}
+	userID := middleware.UserID(c)
 
 	response, err := h.eventClient.JoinEvent(c.Request.Context(), &event.JoinEventRequest{
 		EventId: eventID,
@@ -174,22 +161,52 @@ func (h *EventHandler) JoinEvent(c *gin.Context) {
 	})
 }
 
-func (h *EventHandler) getAuthenticatedUserID(c *gin.Context) (string, error) {
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		return "", fmt.Errorf("missing authorization header")
+func (h *EventHandler) UpdateEvent(c *gin.Context) {
+	if h.eventClient == nil {
+		c.JSON(503, gin.H{"error": "Event service unavailable"})
+		return
 	}
 
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	if tokenString == authHeader {
-		return "", fmt.Errorf("invalid authorization format")
+	// Pointers tell fields that were left out apart from fields set to "".
+	var request struct {
+		Title       *string `json:"title"`
+		Description *string `json:"description"`
+		Date        *string `json:"date"`
+	}
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	response, err := h.eventClient.UpdateEvent(c.Request.Context(), &event.UpdateEventRequest{
+		EventId:     c.Param("id"),
+		Title:       request.Title,
+		Description: request.Description,
+		Date:        request.Date,
+	})
+	if err != nil {
+		log.Printf("UpdateEvent error: %v", err)
+		utils.HandleGRPCError(c, err)
+		return
 	}
 
-	resp, err := h.authClient.ValidateToken(c.Request.Context(), &auth.ValidateTokenRequest{
-		Token: tokenString,
+	c.JSON(200, eventJSON(response))
+}
+
+func (h *EventHandler) CancelEvent(c *gin.Context) {
+	if h.eventClient == nil {
+		c.JSON(503, gin.H{"error": "Event service unavailable"})
+		return
+	}
+
+	response, err := h.eventClient.CancelEvent(c.Request.Context(), &event.CancelEventRequest{
+		EventId: c.Param("id"),
 	})
 	if err != nil {
-		return "", fmt.Errorf("invalid token: %v", err)
+		log.Printf("CancelEvent error: %v", err)
+		utils.HandleGRPCError(c, err)
+		return
 	}
-	return resp.UserId, nil
+
+	c.JSON(200, gin.H{"success": response.Success})
 }
@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/polyakovaa/grpcproxy/gateway/internal/utils"
+	"github.com/polyakovaa/grpcproxy/gen/auth"
+)
+
+const (
+	federationStateCookie = "oidc_state"
+	federationCookiePath  = "/auth/oidc"
+)
+
+func (h *AuthHandler) ListIdentityProviders(c *gin.Context) {
+	if h.authClient == nil {
+		c.JSON(503, gin.H{"error": "Auth service unavailable"})
+		return
+	}
+
+	response, err := h.authClient.ListIdentityProviders(c.Request.Context(), &auth.ListIdentityProvidersRequest{})
+	if err != nil {
+		log.Printf("ListIdentityProviders error: %v", err)
+		utils.HandleGRPCError(c, err)
+		return
+	}
+
+	providers := make([]gin.H, 0, len(response.Providers))
+	for _, p := range response.Providers {
+		providers = append(providers, gin.H{"id": p.Id, "name": p.Name})
+	}
+	c.JSON(200, gin.H{"providers": providers})
+}
+
+// StartFederatedLogin sends the user agent to the identity provider. The
+// state is also put into a cookie, so the callback only completes logins
+// started by the same browser.
+func (h *AuthHandler) StartFederatedLogin(c *gin.Context) {
+	if h.authClient == nil {
+		c.JSON(503, gin.H{"error": "Auth service unavailable"})
+		return
+	}
+
+	response, err := h.authClient.StartFederatedLogin(c.Request.Context(), &auth.StartFederatedLoginRequest{
+		Provider: c.Param("provider"),
+	})
+	if err != nil {
+		log.Printf("StartFederatedLogin error: %v", err)
+		utils.HandleGRPCError(c, err)
+		return
+	}
+
+	// Lax, so the cookie comes along when the provider redirects back.
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(federationStateCookie, response.State, int((10 * time.Minute).Seconds()), federationCookiePath, "", false, true)
+	c.Redirect(302, response.AuthorizationUrl)
+}
+
+// FederatedCallback is the redirect URL registered with the identity
+// providers. It answers like Login.
+func (h *AuthHandler) FederatedCallback(c *gin.Context) {
+	if h.authClient == nil {
+		c.JSON(503, gin.H{"error": "Auth service unavailable"})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	cookieState, _ := c.Cookie(federationStateCookie)
+	c.SetCookie(federationStateCookie, "", -1, federationCookiePath, "", false, true)
+
+	if errCode := c.Query("error"); errCode != "" {
+		log.Printf("Identity provider %s returned error %q: %s", c.Param("provider"), errCode, c.Query("error_description"))
+		c.JSON(401, gin.H{"error": "login was not completed at the identity provider"})
+		return
+	}
+
+	state := c.Query("state")
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(cookieState)) != 1 {
+		c.JSON(400, gin.H{"error": "invalid login state"})
+		return
+	}
+
+	response, err := h.authClient.CompleteFederatedLogin(c.Request.Context(), &auth.CompleteFederatedLoginRequest{
+		Provider: c.Param("provider"),
+		State:    state,
+		Code:     c.Query("code"),
+	})
+	if err != nil {
+		log.Printf("CompleteFederatedLogin error: %v", err)
+		utils.HandleGRPCError(c, err)
+		return
+	}
+
+	if response.MfaRequired {
+		c.JSON(200, gin.H{
+			"user_id":      response.UserId,
+			"mfa_required": true,
+			"mfa_token":    response.MfaToken,
+		})
+		return
+	}
+
+	setRefreshCookie(c, response.RefreshToken, response.ExpiresAt.AsTime())
+
+	c.JSON(200, gin.H{
+		"user_id":       response.UserId,
+		"access_token":  response.AccessToken,
+		"expires_at":    response.ExpiresAt.AsTime().Format(time.RFC3339),
+		"refresh_token": response.RefreshToken,
+	})
+}
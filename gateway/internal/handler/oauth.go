@@ -0,0 +1,397 @@
+package handler
+
+import (
+	"log"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/polyakovaa/grpcproxy/gateway/internal/middleware"
+	"github.com/polyakovaa/grpcproxy/gateway/internal/utils"
+	"github.com/polyakovaa/grpcproxy/gen/auth"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// OAuthHandler serves the OAuth 2.0 and OpenID Connect endpoints. The consent
+// screen is part of the frontend: authorization requests are forwarded to
+// consentURL, which shows GetAuthorization and answers through Authorize.
+type OAuthHandler struct {
+	authClient auth.AuthServiceClient
+	consentURL string
+}
+
+func NewOAuthHandler(authClient auth.AuthServiceClient, consentURL string) *OAuthHandler {
+	return &OAuthHandler{authClient: authClient, consentURL: consentURL}
+}
+
+func (h *OAuthHandler) Discovery(c *gin.Context) {
+	if h.authClient == nil {
+		c.JSON(503, gin.H{"error": "Auth service unavailable"})
+		return
+	}
+
+	cfg, err := h.authClient.GetOpenIDConfiguration(c.Request.Context(), &auth.GetOpenIDConfigurationRequest{})
+	if err != nil {
+		log.Printf("GetOpenIDConfiguration error: %v", err)
+		utils.HandleGRPCError(c, err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"issuer":                                cfg.Issuer,
+		"authorization_endpoint":                cfg.AuthorizationEndpoint,
+		"token_endpoint":                        cfg.TokenEndpoint,
+		"userinfo_endpoint":                     cfg.UserinfoEndpoint,
+		"jwks_uri":                              cfg.JwksUri,
+		"scopes_supported":                      cfg.ScopesSupported,
+		"response_types_supported":              cfg.ResponseTypesSupported,
+		"grant_types_supported":                 cfg.GrantTypesSupported,
+		"subject_types_supported":               cfg.SubjectTypesSupported,
+		"id_token_signing_alg_values_supported": cfg.IdTokenSigningAlgValuesSupported,
+		"token_endpoint_auth_methods_supported": cfg.TokenEndpointAuthMethodsSupported,
+		"code_challenge_methods_supported":      cfg.CodeChallengeMethodsSupported,
+		"claims_supported":                      cfg.ClaimsSupported,
+		"introspection_endpoint":                cfg.IntrospectionEndpoint,
+		"revocation_endpoint":                   cfg.RevocationEndpoint,
+	})
+}
+
+// StartAuthorization sends the user agent of an authorization request to the
+// consent screen, which signs the user in if needed.
+func (h *OAuthHandler) StartAuthorization(c *gin.Context) {
+	if h.consentURL == "" {
+		c.JSON(501, gin.H{"error": "OAuth is not configured"})
+		return
+	}
+
+	u, err := url.Parse(h.consentURL)
+	if err != nil {
+		log.Printf("Invalid OAuth consent URL: %v", err)
+		c.JSON(500, gin.H{"error": "internal server error"})
+		return
+	}
+	u.RawQuery = c.Request.URL.RawQuery
+	c.Redirect(302, u.String())
+}
+
+type authorizationParams struct {
+	ResponseType        string `form:"response_type" json:"response_type"`
+	ClientID            string `form:"client_id" json:"client_id"`
+	RedirectURI         string `form:"redirect_uri" json:"redirect_uri"`
+	Scope               string `form:"scope" json:"scope"`
+	State               string `form:"state" json:"state"`
+	Nonce               string `form:"nonce" json:"nonce"`
+	CodeChallenge       string `form:"code_challenge" json:"code_challenge"`
+	CodeChallengeMethod string `form:"code_challenge_method" json:"code_challenge_method"`
+}
+
+func (p authorizationParams) request(accessToken string) *auth.AuthorizationRequest {
+	return &auth.AuthorizationRequest{
+		AccessToken:         accessToken,
+		ResponseType:        p.ResponseType,
+		ClientId:            p.ClientID,
+		RedirectUri:         p.RedirectURI,
+		Scope:               p.Scope,
+		State:               p.State,
+		Nonce:               p.Nonce,
+		CodeChallenge:       p.CodeChallenge,
+		CodeChallengeMethod: p.CodeChallengeMethod,
+	}
+}
+
+// GetAuthorization describes the authorization request in the query string
+// for the consent screen.
+func (h *OAuthHandler) GetAuthorization(c *gin.Context) {
+	if h.authClient == nil {
+		c.JSON(503, gin.H{"error": "Auth service unavailable"})
+		return
+	}
+
+	var params authorizationParams
+	if err := c.BindQuery(&params); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	accessToken, _ := middleware.BearerToken(c)
+	response, err := h.authClient.GetAuthorization(c.Request.Context(), params.request(accessToken))
+	if err != nil {
+		log.Printf("GetAuthorization error: %v", err)
+		utils.HandleGRPCError(c, err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"client": gin.H{
+			"client_id": response.Client.ClientId,
+			"name":      response.Client.Name,
+		},
+		"redirect_uri":  response.RedirectUri,
+		"scopes":        response.Scopes,
+		"consent_given": response.ConsentGiven,
+	})
+}
+
+// Authorize records the decision of the user on the consent screen and
+// returns where to send the user agent next.
+func (h *OAuthHandler) Authorize(c *gin.Context) {
+	if h.authClient == nil {
+		c.JSON(503, gin.H{"error": "Auth service unavailable"})
+		return
+	}
+
+	var request struct {
+		authorizationParams
+		Approve bool `json:"approve"`
+	}
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	accessToken, _ := middleware.BearerToken(c)
+	req := request.request(accessToken)
+	req.Approve = request.Approve
+	response, err := h.authClient.Authorize(c.Request.Context(), req)
+	if err != nil {
+		log.Printf("Authorize error: %v", err)
+		utils.HandleGRPCError(c, err)
+		return
+	}
+
+	c.JSON(200, gin.H{"redirect_to": response.RedirectTo})
+}
+
+// Token is the token endpoint of RFC 6749 section 3.2. Clients authenticate
+// with HTTP basic authentication or client_id and client_secret in the form.
+func (h *OAuthHandler) Token(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+
+	if h.authClient == nil {
+		c.JSON(503, gin.H{"error": "temporarily_unavailable"})
+		return
+	}
+
+	form, clientID, clientSecret, basic, ok := clientRequest(c)
+	if !ok {
+		return
+	}
+
+	response, err := h.authClient.ExchangeToken(c.Request.Context(), &auth.OAuthTokenRequest{
+		GrantType:    form.Get("grant_type"),
+		Code:         form.Get("code"),
+		RedirectUri:  form.Get("redirect_uri"),
+		ClientId:     clientID,
+		ClientSecret: clientSecret,
+		CodeVerifier: form.Get("code_verifier"),
+	})
+	if err != nil {
+		log.Printf("ExchangeToken error: %v", err)
+		tokenError(c, err, basic)
+		return
+	}
+
+	body := gin.H{
+		"access_token": response.AccessToken,
+		"token_type":   response.TokenType,
+		"expires_in":   response.ExpiresIn,
+		"scope":        response.Scope,
+	}
+	if response.IdToken != "" {
+		body["id_token"] = response.IdToken
+	}
+	c.JSON(200, body)
+}
+
+// clientRequest parses the form of a request a client authenticates with
+// HTTP basic authentication or client_id and client_secret in the form. It
+// answers malformed requests itself and then reports !ok.
+func clientRequest(c *gin.Context) (form url.Values, clientID, clientSecret string, basic, ok bool) {
+	if err := c.Request.ParseForm(); err != nil {
+		c.JSON(400, gin.H{"error": "invalid_request", "error_description": "malformed form body"})
+		return nil, "", "", false, false
+	}
+	form = c.Request.PostForm
+
+	clientID, clientSecret = form.Get("client_id"), form.Get("client_secret")
+	user, pass, basic := c.Request.BasicAuth()
+	if basic {
+		if clientSecret != "" {
+			c.JSON(400, gin.H{"error": "invalid_request", "error_description": "use only one client authentication method"})
+			return nil, "", "", false, false
+		}
+		// The credentials are form encoded before they are put into the
+		// header (RFC 6749 section 2.3.1).
+		var err1, err2 error
+		clientID, err1 = url.QueryUnescape(user)
+		clientSecret, err2 = url.QueryUnescape(pass)
+		if err1 != nil || err2 != nil {
+			c.JSON(400, gin.H{"error": "invalid_request", "error_description": "malformed client credentials"})
+			return nil, "", "", false, false
+		}
+	}
+	return form, clientID, clientSecret, basic, true
+}
+
+// Introspect is the introspection endpoint of RFC 7662 for resource servers.
+// Tokens that are not active are answered with just active false.
+func (h *OAuthHandler) Introspect(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+
+	if h.authClient == nil {
+		c.JSON(503, gin.H{"error": "temporarily_unavailable"})
+		return
+	}
+
+	form, clientID, clientSecret, basic, ok := clientRequest(c)
+	if !ok {
+		return
+	}
+	if form.Get("token") == "" {
+		c.JSON(400, gin.H{"error": "invalid_request", "error_description": "token is required"})
+		return
+	}
+
+	response, err := h.authClient.IntrospectToken(c.Request.Context(), &auth.IntrospectTokenRequest{
+		ClientId:     clientID,
+		ClientSecret: clientSecret,
+		Token:        form.Get("token"),
+	})
+	if err != nil {
+		log.Printf("IntrospectToken error: %v", err)
+		tokenError(c, err, basic)
+		return
+	}
+
+	if !response.Active {
+		c.JSON(200, gin.H{"active": false})
+		return
+	}
+	body := gin.H{
+		"active":     true,
+		"sub":        response.Sub,
+		"username":   response.Username,
+		"token_type": response.TokenType,
+	}
+	if response.ActorId != "" {
+		body["act"] = gin.H{"sub": response.ActorId}
+	}
+	if response.ClientId != "" {
+		body["client_id"] = response.ClientId
+	}
+	if len(response.Scopes) > 0 {
+		body["scope"] = strings.Join(response.Scopes, " ")
+	}
+	if response.ExpiresAt != nil {
+		body["exp"] = response.ExpiresAt.AsTime().Unix()
+	}
+	c.JSON(200, body)
+}
+
+// Revoke is the revocation endpoint of RFC 7009. Clients can revoke the
+// access tokens they obtained; unknown tokens are answered with success.
+func (h *OAuthHandler) Revoke(c *gin.Context) {
+	if h.authClient == nil {
+		c.JSON(503, gin.H{"error": "temporarily_unavailable"})
+		return
+	}
+
+	form, clientID, clientSecret, basic, ok := clientRequest(c)
+	if !ok {
+		return
+	}
+	if form.Get("token") == "" {
+		c.JSON(400, gin.H{"error": "invalid_request", "error_description": "token is required"})
+		return
+	}
+
+	_, err := h.authClient.RevokeToken(c.Request.Context(), &auth.RevokeTokenRequest{
+		ClientId:     clientID,
+		ClientSecret: clientSecret,
+		Token:        form.Get("token"),
+	})
+	if err != nil {
+		log.Printf("RevokeToken error: %v", err)
+		tokenError(c, err, basic)
+		return
+	}
+
+	c.Status(200)
+}
+
+// tokenError answers a failed token request in the format of RFC 6749
+// section 5.2.
+func tokenError(c *gin.Context, err error, basic bool) {
+	code := utils.OAuthErrorCode(err)
+	if code == "" {
+		switch status.Code(err) {
+		case codes.Unimplemented:
+			c.JSON(501, gin.H{"error": "unsupported_grant_type", "error_description": "OAuth is not configured"})
+		case codes.Unavailable:
+			c.JSON(503, gin.H{"error": "temporarily_unavailable"})
+		default:
+			c.JSON(500, gin.H{"error": "server_error"})
+		}
+		return
+	}
+
+	httpStatus := 400
+	if code == "invalid_client" {
+		httpStatus = 401
+		if basic {
+			c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+		}
+	}
+	c.JSON(httpStatus, gin.H{"error": code, "error_description": status.Convert(err).Message()})
+}
+
+// UserInfo is the userinfo endpoint of OpenID Connect Core section 5.3. It
+// takes the access token a client received from Token.
+func (h *OAuthHandler) UserInfo(c *gin.Context) {
+	if h.authClient == nil {
+		c.JSON(503, gin.H{"error": "Auth service unavailable"})
+		return
+	}
+
+	accessToken, err := middleware.BearerToken(c)
+	if err != nil {
+		c.Header("WWW-Authenticate", `Bearer`)
+		c.JSON(401, gin.H{"error": "invalid_token"})
+		return
+	}
+
+	response, err := h.authClient.GetUserInfo(c.Request.Context(), &auth.GetUserInfoRequest{
+		AccessToken: accessToken,
+	})
+	if err != nil {
+		log.Printf("GetUserInfo error: %v", err)
+		switch status.Code(err) {
+		case codes.Unauthenticated:
+			c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+			c.JSON(401, gin.H{"error": "invalid_token"})
+		case codes.PermissionDenied:
+			c.Header("WWW-Authenticate", `Bearer error="insufficient_scope", scope="openid"`)
+			c.JSON(403, gin.H{"error": "insufficient_scope"})
+		default:
+			utils.HandleGRPCError(c, err)
+		}
+		return
+	}
+
+	body := gin.H{"sub": response.Sub}
+	if response.Name != nil {
+		body["name"] = *response.Name
+	}
+	if response.PreferredUsername != nil {
+		body["preferred_username"] = *response.PreferredUsername
+	}
+	if response.Email != nil {
+		body["email"] = *response.Email
+	}
+	if response.EmailVerified != nil {
+		body["email_verified"] = *response.EmailVerified
+	}
+	c.JSON(200, body)
+}
@@ -0,0 +1,392 @@
+package handler
+
+import (
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/polyakovaa/grpcproxy/gateway/internal/middleware"
+	"github.com/polyakovaa/grpcproxy/gateway/internal/utils"
+	"github.com/polyakovaa/grpcproxy/gen/auth"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type UserHandler struct {
+	authClient auth.AuthServiceClient
+}
+
+func NewUserHandler(authClient auth.AuthServiceClient) *UserHandler {
+	return &UserHandler{authClient: authClient}
+}
+
+func profileJSON(p *auth.UserProfile) gin.H {
+	profile := gin.H{
+		"user_id":        p.UserId,
+		"user_name":      p.UserName,
+		"email":          p.Email,
+		"email_verified": p.EmailVerified,
+		"display_name":   p.DisplayName,
+		"bio":            p.Bio,
+		"roles":          p.Roles,
+		"mfa_enabled":    p.MfaEnabled,
+		"created_at":     p.CreatedAt.AsTime().Format(time.RFC3339),
+	}
+	if p.SuspendedAt != nil {
+		profile["suspended_at"] = p.SuspendedAt.AsTime().Format(time.RFC3339)
+	}
+	return profile
+}
+
+func (h *UserHandler) GetMe(c *gin.Context) {
+	if h.authClient == nil {
+		c.JSON(503, gin.H{"error": "Auth service unavailable"})
+		return
+	}
+
+	accessToken, _ := middleware.BearerToken(c)
+	response, err := h.authClient.GetUser(c.Request.Context(), &auth.GetUserRequest{
+		AccessToken: accessToken,
+	})
+	if err != nil {
+		log.Printf("GetUser error: %v", err)
+		utils.HandleGRPCError(c, err)
+		return
+	}
+
+	c.JSON(200, profileJSON(response))
+}
+
+func (h *UserHandler) UpdateMe(c *gin.Context) {
+	if h.authClient == nil {
+		c.JSON(503, gin.H{"error": "Auth service unavailable"})
+		return
+	}
+
+	// Pointers tell fields that were left out apart from fields set to "".
+	var request struct {
+		UserName    *string `json:"user_name"`
+		DisplayName *string `json:"display_name"`
+		Bio         *string `json:"bio"`
+	}
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	accessToken, _ := middleware.BearerToken(c)
+	response, err := h.authClient.UpdateProfile(c.Request.Context(), &auth.UpdateProfileRequest{
+		AccessToken: accessToken,
+		UserName:    request.UserName,
+		DisplayName: request.DisplayName,
+		Bio:         request.Bio,
+	})
+	if err != nil {
+		log.Printf("UpdateProfile error: %v", err)
+		utils.HandleGRPCError(c, err)
+		return
+	}
+
+	c.JSON(200, profileJSON(response))
+}
+
+func (h *UserHandler) ChangeEmail(c *gin.Context) {
+	if h.authClient == nil {
+		c.JSON(503, gin.H{"error": "Auth service unavailable"})
+		return
+	}
+
+	var request struct {
+		CurrentPassword string `json:"current_password"`
+		NewEmail        string `json:"new_email"`
+	}
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	accessToken, _ := middleware.BearerToken(c)
+	response, err := h.authClient.ChangeEmail(c.Request.Context(), &auth.ChangeEmailRequest{
+		AccessToken:     accessToken,
+		CurrentPassword: request.CurrentPassword,
+		NewEmail:        request.NewEmail,
+	})
+	if err != nil {
+		log.Printf("ChangeEmail error: %v", err)
+		utils.HandleGRPCError(c, err)
+		return
+	}
+
+	c.JSON(200, profileJSON(response))
+}
+
+// ChangePassword ends every session of the user, including the current one,
+// and returns a fresh token pair for the caller.
+func (h *UserHandler) ChangePassword(c *gin.Context) {
+	if h.authClient == nil {
+		c.JSON(503, gin.H{"error": "Auth service unavailable"})
+		return
+	}
+
+	var request struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	accessToken, _ := middleware.BearerToken(c)
+	response, err := h.authClient.ChangePassword(c.Request.Context(), &auth.ChangePasswordRequest{
+		AccessToken:     accessToken,
+		CurrentPassword: request.CurrentPassword,
+		NewPassword:     request.NewPassword,
+	})
+	if err != nil {
+		log.Printf("ChangePassword error: %v", err)
+		utils.HandleGRPCError(c, err)
+		return
+	}
+
+	setRefreshCookie(c, response.RefreshToken, response.ExpiresAt.AsTime())
+
+	c.JSON(200, gin.H{
+		"user_id":       response.UserId,
+		"access_token":  response.AccessToken,
+		"expires_at":    response.ExpiresAt.AsTime().Format(time.RFC3339),
+		"refresh_token": response.RefreshToken,
+	})
+}
+
+func (h *UserHandler) DeleteMe(c *gin.Context) {
+	if h.authClient == nil {
+		c.JSON(503, gin.H{"error": "Auth service unavailable"})
+		return
+	}
+
+	var request struct {
+		Password string `json:"password"`
+	}
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	accessToken, _ := middleware.BearerToken(c)
+	_, err := h.authClient.DeleteAccount(c.Request.Context(), &auth.DeleteAccountRequest{
+		AccessToken: accessToken,
+		Password:    request.Password,
+	})
+	if err != nil {
+		log.Printf("DeleteAccount error: %v", err)
+		utils.HandleGRPCError(c, err)
+		return
+	}
+
+	clearRefreshCookie(c)
+	c.Status(204)
+}
+
+func (h *UserHandler) ListSessions(c *gin.Context) {
+	if h.authClient == nil {
+		c.JSON(503, gin.H{"error": "Auth service unavailable"})
+		return
+	}
+
+	accessToken, _ := middleware.BearerToken(c)
+	response, err := h.authClient.ListSessions(c.Request.Context(), &auth.ListSessionsRequest{
+		AccessToken: accessToken,
+	})
+	if err != nil {
+		log.Printf("ListSessions error: %v", err)
+		utils.HandleGRPCError(c, err)
+		return
+	}
+
+	sessions := make([]gin.H, 0, len(response.Sessions))
+	for _, s := range response.Sessions {
+		var lastUsedAt any
+		if s.LastUsedAt != nil {
+			lastUsedAt = s.LastUsedAt.AsTime().Format(time.RFC3339)
+		}
+		sessions = append(sessions, gin.H{
+			"id":           s.SessionId,
+			"created_at":   s.CreatedAt.AsTime().Format(time.RFC3339),
+			"last_used_at": lastUsedAt,
+			"expires_at":   s.ExpiresAt.AsTime().Format(time.RFC3339),
+			"user_agent":   s.UserAgent,
+			"ip":           s.Ip,
+			"current":      s.Current,
+		})
+	}
+
+	c.JSON(200, gin.H{"sessions": sessions})
+}
+
+func (h *UserHandler) RevokeSession(c *gin.Context) {
+	if h.authClient == nil {
+		c.JSON(503, gin.H{"error": "Auth service unavailable"})
+		return
+	}
+
+	accessToken, _ := middleware.BearerToken(c)
+	_, err := h.authClient.RevokeSession(c.Request.Context(), &auth.RevokeSessionRequest{
+		AccessToken: accessToken,
+		SessionId:   c.Param("id"),
+	})
+	if err != nil {
+		log.Printf("RevokeSession error: %v", err)
+		utils.HandleGRPCError(c, err)
+		return
+	}
+
+	c.Status(204)
+}
+
+func personalTokenJSON(t *auth.PersonalToken) gin.H {
+	var expiresAt, lastUsedAt any
+	if t.ExpiresAt != nil {
+		expiresAt = t.ExpiresAt.AsTime().Format(time.RFC3339)
+	}
+	if t.LastUsedAt != nil {
+		lastUsedAt = t.LastUsedAt.AsTime().Format(time.RFC3339)
+	}
+	return gin.H{
+		"id":           t.Id,
+		"name":         t.Name,
+		"scopes":       t.Scopes,
+		"expires_at":   expiresAt,
+		"last_used_at": lastUsedAt,
+		"created_at":   t.CreatedAt.AsTime().Format(time.RFC3339),
+	}
+}
+
+func (h *UserHandler) CreatePersonalToken(c *gin.Context) {
+	if h.authClient == nil {
+		c.JSON(503, gin.H{"error": "Auth service unavailable"})
+		return
+	}
+
+	var request struct {
+		Name      string     `json:"name"`
+		Scopes    []string   `json:"scopes"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	req := &auth.CreatePersonalTokenRequest{
+		Name:   request.Name,
+		Scopes: request.Scopes,
+	}
+	if request.ExpiresAt != nil {
+		req.ExpiresAt = timestamppb.New(*request.ExpiresAt)
+	}
+	req.AccessToken, _ = middleware.BearerToken(c)
+
+	response, err := h.authClient.CreatePersonalToken(c.Request.Context(), req)
+	if err != nil {
+		log.Printf("CreatePersonalToken error: %v", err)
+		utils.HandleGRPCError(c, err)
+		return
+	}
+
+	body := personalTokenJSON(response.PersonalToken)
+	body["token"] = response.Token
+	c.JSON(201, body)
+}
+
+func (h *UserHandler) ListPersonalTokens(c *gin.Context) {
+	if h.authClient == nil {
+		c.JSON(503, gin.H{"error": "Auth service unavailable"})
+		return
+	}
+
+	accessToken, _ := middleware.BearerToken(c)
+	response, err := h.authClient.ListPersonalTokens(c.Request.Context(), &auth.ListPersonalTokensRequest{
+		AccessToken: accessToken,
+	})
+	if err != nil {
+		log.Printf("ListPersonalTokens error: %v", err)
+		utils.HandleGRPCError(c, err)
+		return
+	}
+
+	tokens := make([]gin.H, 0, len(response.PersonalTokens))
+	for _, t := range response.PersonalTokens {
+		tokens = append(tokens, personalTokenJSON(t))
+	}
+
+	c.JSON(200, gin.H{"tokens": tokens})
+}
+
+func (h *UserHandler) RevokePersonalToken(c *gin.Context) {
+	if h.authClient == nil {
+		c.JSON(503, gin.H{"error": "Auth service unavailable"})
+		return
+	}
+
+	accessToken, _ := middleware.BearerToken(c)
+	_, err := h.authClient.RevokePersonalToken(c.Request.Context(), &auth.RevokePersonalTokenRequest{
+		AccessToken: accessToken,
+		TokenId:     c.Param("id"),
+	})
+	if err != nil {
+		log.Printf("RevokePersonalToken error: %v", err)
+		utils.HandleGRPCError(c, err)
+		return
+	}
+
+	c.Status(204)
+}
+
+func (h *UserHandler) ListApps(c *gin.Context) {
+	if h.authClient == nil {
+		c.JSON(503, gin.H{"error": "Auth service unavailable"})
+		return
+	}
+
+	accessToken, _ := middleware.BearerToken(c)
+	response, err := h.authClient.ListOAuthConsents(c.Request.Context(), &auth.ListOAuthConsentsRequest{
+		AccessToken: accessToken,
+	})
+	if err != nil {
+		log.Printf("ListOAuthConsents error: %v", err)
+		utils.HandleGRPCError(c, err)
+		return
+	}
+
+	apps := make([]gin.H, 0, len(response.Consents))
+	for _, consent := range response.Consents {
+		apps = append(apps, gin.H{
+			"client_id":  consent.ClientId,
+			"name":       consent.ClientName,
+			"scopes":     consent.Scopes,
+			"granted_at": consent.GrantedAt.AsTime().Format(time.RFC3339),
+		})
+	}
+
+	c.JSON(200, gin.H{"apps": apps})
+}
+
+func (h *UserHandler) RevokeApp(c *gin.Context) {
+	if h.authClient == nil {
+		c.JSON(503, gin.H{"error": "Auth service unavailable"})
+		return
+	}
+
+	accessToken, _ := middleware.BearerToken(c)
+	_, err := h.authClient.RevokeOAuthConsent(c.Request.Context(), &auth.RevokeOAuthConsentRequest{
+		AccessToken: accessToken,
+		ClientId:    c.Param("client_id"),
+	})
+	if err != nil {
+		log.Printf("RevokeOAuthConsent error: %v", err)
+		utils.HandleGRPCError(c, err)
+		return
+	}
+
+	c.Status(204)
+}
@@ -0,0 +1,373 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/polyakovaa/grpcproxy/gen/auth"
+	"github.com/polyakovaa/grpcproxy/svcauth"
+)
+
+const (
+	userIDKey   = "auth.user_id"
+	tokenIDKey  = "auth.token_id"
+	rolesKey    = "auth.roles"
+	verifiedKey = "auth.email_verified"
+	scopesKey   = "auth.scopes"
+	clientIDKey = "auth.client_id"
+	actorIDKey  = "auth.actor_id"
+)
+
+// PersonalTokenPrefix starts personal access tokens issued by the auth
+// service. They are opaque and always validated by the auth service.
+const PersonalTokenPrefix = "rcpat_"
+
+const (
+	RoleMember    = "member"
+	RoleOrganizer = "organizer"
+	RoleAdmin     = "admin"
+)
+
+// Scopes of personal access tokens and OAuth clients, see RequireScope.
+const (
+	ScopeEventsRead  = "events:read"
+	ScopeEventsWrite = "events:write"
+)
+
+type AuthConfig struct {
+	Issuer          string
+	Audience        string
+	Leeway          time.Duration
+	CheckRevocation bool
+}
+
+// Authenticator verifies bearer tokens for the routes that opt in through
+// RequireAuth. Tokens signed with the auth service keys are verified locally;
+// ValidateToken is only called to check for revocation. Tokens signed with
+// the shared secret cannot be verified here and are handed to ValidateToken.
+type Authenticator struct {
+	authClient auth.AuthServiceClient
+	keys       *JWKSCache
+	cfg        AuthConfig
+}
+
+func NewAuthenticator(authClient auth.AuthServiceClient, keys *JWKSCache, cfg AuthConfig) *Authenticator {
+	return &Authenticator{
+		authClient: authClient,
+		keys:       keys,
+		cfg:        cfg,
+	}
+}
+
+type identity struct {
+	UserID        string
+	TokenID       string
+	Roles         []string
+	EmailVerified bool
+	// Scopes limit what a personal access token or a token issued to an
+	// OAuth client may be used for. They are nil for session tokens, which
+	// are not limited.
+	Scopes []string
+	// ClientID is the OAuth client the token was issued to, if any.
+	ClientID string
+	// ActorID is the admin acting as the user with an impersonation token.
+	ActorID string
+}
+
+type tokenClaims struct {
+	jwt.RegisteredClaims
+	Roles         []string `json:"roles"`
+	EmailVerified bool     `json:"email_verified"`
+	Scope         string   `json:"scope"`
+	ClientID      string   `json:"client_id"`
+	Act           *struct {
+		Subject string `json:"sub"`
+	} `json:"act"`
+}
+
+func (a *Authenticator) RequireAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if a.authClient == nil {
+			c.AbortWithStatusJSON(503, gin.H{"error": "Auth service unavailable"})
+			return
+		}
+
+		tokenString, err := BearerToken(c)
+		if err != nil {
+			c.AbortWithStatusJSON(401, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		id, err := a.authenticate(c, tokenString)
+		if err != nil {
+			log.Printf("Authentication failed: %v", err)
+			c.AbortWithStatusJSON(401, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		c.Set(userIDKey, id.UserID)
+		c.Set(tokenIDKey, id.TokenID)
+		c.Set(rolesKey, id.Roles)
+		c.Set(verifiedKey, id.EmailVerified)
+		if id.Scopes != nil {
+			c.Set(scopesKey, id.Scopes)
+		}
+		if id.ClientID != "" {
+			c.Set(clientIDKey, id.ClientID)
+		}
+		if id.ActorID != "" {
+			c.Set(actorIDKey, id.ActorID)
+			log.Printf("Impersonated request %s %s: admin %s as user %s", c.Request.Method, c.Request.URL.Path, id.ActorID, id.UserID)
+		}
+		c.Request = c.Request.WithContext(svcauth.NewContext(c.Request.Context(), svcauth.Identity{
+			UserID:   id.UserID,
+			Roles:    id.Roles,
+			Scopes:   id.Scopes,
+			ClientID: id.ClientID,
+			ActorID:  id.ActorID,
+		}))
+		c.Next()
+	}
+}
+
+// RequireRole only lets requests through whose user has one of roles. It has
+// to run after RequireAuth.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, role := range roles {
+			if HasRole(c, role) {
+				c.Next()
+				return
+			}
+		}
+		c.AbortWithStatusJSON(403, gin.H{"error": "Forbidden"})
+	}
+}
+
+// RequireVerifiedEmail rejects users who have not confirmed their email
+// address yet. It has to run after RequireAuth.
+func RequireVerifiedEmail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !EmailVerified(c) {
+			c.AbortWithStatusJSON(403, gin.H{"error": "Email address not verified"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireScope lets session tokens through and personal access tokens or
+// OAuth client tokens that were granted scope. It has to run after
+// RequireAuth.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scopes, limited := c.Get(scopesKey)
+		if limited {
+			list, _ := scopes.([]string)
+			if !slices.Contains(list, scope) {
+				c.AbortWithStatusJSON(403, gin.H{"error": "Token lacks scope " + scope})
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// RejectPersonalTokens keeps personal access tokens and tokens issued to
+// OAuth clients away from account management. It has to run after
+// RequireAuth.
+func RejectPersonalTokens() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if ClientID(c) != "" {
+			c.AbortWithStatusJSON(403, gin.H{"error": "Tokens issued to applications cannot be used here"})
+			return
+		}
+		if PersonalToken(c) {
+			c.AbortWithStatusJSON(403, gin.H{"error": "Personal access tokens cannot be used here"})
+			return
+		}
+		c.Next()
+	}
+}
+
+func (a *Authenticator) authenticate(c *gin.Context, tokenString string) (*identity, error) {
+	if strings.HasPrefix(tokenString, PersonalTokenPrefix) {
+		id, err := a.validateRemotely(c, tokenString)
+		if err != nil {
+			return nil, err
+		}
+		if id.Scopes == nil {
+			return nil, errors.New("personal access token without scopes")
+		}
+		return id, nil
+	}
+
+	unverified, _, err := jwt.NewParser().ParseUnverified(tokenString, jwt.MapClaims{})
+	if err != nil {
+		return nil, fmt.Errorf("malformed token: %w", err)
+	}
+	if _, ok := unverified.Method.(*jwt.SigningMethodHMAC); ok {
+		return a.validateRemotely(c, tokenString)
+	}
+
+	id, err := a.verifyLocally(c, tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	if a.cfg.CheckRevocation {
+		remote, err := a.validateRemotely(c, tokenString)
+		if err != nil {
+			return nil, err
+		}
+		if remote.UserID != id.UserID || remote.ActorID != id.ActorID {
+			return nil, errors.New("token subject mismatch")
+		}
+		// The auth service knows about role changes and email verification
+		// that happened after the token was issued.
+		id.Roles = remote.Roles
+		id.EmailVerified = remote.EmailVerified
+	}
+
+	return id, nil
+}
+
+func (a *Authenticator) verifyLocally(c *gin.Context, tokenString string) (*identity, error) {
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}),
+		jwt.WithLeeway(a.cfg.Leeway),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	}
+	if a.cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(a.cfg.Issuer))
+	}
+	if a.cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(a.cfg.Audience))
+	}
+
+	claims := &tokenClaims{}
+	_, err := jwt.NewParser(opts...).ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		alg, key, err := a.keys.Key(c.Request.Context(), kid)
+		if err != nil {
+			return nil, err
+		}
+		if alg != token.Method.Alg() {
+			return nil, fmt.Errorf("signing method %s does not match key %s", token.Method.Alg(), kid)
+		}
+		return key, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid token: %w", err)
+	}
+	// Access tokens always carry a jti. ID tokens issued to OAuth clients are
+	// signed with the same keys but have none and must not pass as sessions.
+	if claims.Subject == "" || claims.ID == "" {
+		return nil, errors.New("token has no sub or jti")
+	}
+
+	id := &identity{
+		UserID:        claims.Subject,
+		TokenID:       claims.ID,
+		Roles:         claims.Roles,
+		EmailVerified: claims.EmailVerified,
+	}
+	if claims.Act != nil {
+		if claims.Act.Subject == "" {
+			return nil, errors.New("token has an act claim without subject")
+		}
+		id.ActorID = claims.Act.Subject
+	}
+	if claims.ClientID != "" {
+		id.ClientID = claims.ClientID
+		// Never nil, a client token without scopes must not be unlimited.
+		id.Scopes = append([]string{}, strings.Fields(claims.Scope)...)
+	}
+	return id, nil
+}
+
+func (a *Authenticator) validateRemotely(c *gin.Context, tokenString string) (*identity, error) {
+	resp, err := a.authClient.ValidateToken(c.Request.Context(), &auth.ValidateTokenRequest{
+		Token: tokenString,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("validate token: %w", err)
+	}
+	if !resp.Valid || resp.UserId == "" {
+		return nil, errors.New("token rejected by auth service")
+	}
+	id := &identity{UserID: resp.UserId, Roles: resp.Roles, EmailVerified: resp.EmailVerified, ActorID: resp.ActorId}
+	if resp.PersonalToken || resp.ClientId != "" {
+		id.ClientID = resp.ClientId
+		id.Scopes = resp.Scopes
+		if id.Scopes == nil {
+			id.Scopes = []string{}
+		}
+	}
+	return id, nil
+}
+
+// UserID returns the user authenticated by RequireAuth.
+func UserID(c *gin.Context) string {
+	return c.GetString(userIDKey)
+}
+
+// TokenID returns the jti of the access token authenticated by RequireAuth.
+func TokenID(c *gin.Context) string {
+	return c.GetString(tokenIDKey)
+}
+
+// PersonalToken reports whether the request was authenticated with a
+// personal access token.
+func PersonalToken(c *gin.Context) bool {
+	_, ok := c.Get(scopesKey)
+	return ok && ClientID(c) == ""
+}
+
+// ClientID returns the OAuth client the access token authenticated by
+// RequireAuth was issued to, or "" for tokens the user holds directly.
+func ClientID(c *gin.Context) string {
+	return c.GetString(clientIDKey)
+}
+
+// ActorID returns the admin impersonating the user authenticated by
+// RequireAuth, or "" for requests the user makes themselves.
+func ActorID(c *gin.Context) string {
+	return c.GetString(actorIDKey)
+}
+
+func EmailVerified(c *gin.Context) bool {
+	return c.GetBool(verifiedKey)
+}
+
+func HasRole(c *gin.Context, role string) bool {
+	roles, _ := c.Get(rolesKey)
+	list, _ := roles.([]string)
+	for _, r := range list {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+func BearerToken(c *gin.Context) (string, error) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		return "", fmt.Errorf("missing authorization header")
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	if tokenString == authHeader {
+		return "", fmt.Errorf("invalid authorization format")
+	}
+
+	return tokenString, nil
+}
@@ -0,0 +1,343 @@
+package middleware_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/polyakovaa/grpcproxy/gateway/internal/middleware"
+	"github.com/polyakovaa/grpcproxy/gen/auth"
+	"github.com/polyakovaa/grpcproxy/svcauth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+type fakeAuthClient struct {
+	auth.AuthServiceClient
+	jwks        *auth.JWKSResponse
+	jwksCalls   int
+	validate    *auth.UserResponse
+	validateErr error
+	validations int
+}
+
+func (f *fakeAuthClient) GetJWKS(ctx context.Context, in *auth.GetJWKSRequest, opts ...grpc.CallOption) (*auth.JWKSResponse, error) {
+	f.jwksCalls++
+	return f.jwks, nil
+}
+
+func (f *fakeAuthClient) ValidateToken(ctx context.Context, in *auth.ValidateTokenRequest, opts ...grpc.CallOption) (*auth.UserResponse, error) {
+	f.validations++
+	return f.validate, f.validateErr
+}
+
+func newRouter(a *middleware.Authenticator) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/me", a.RequireAuth(), func(c *gin.Context) {
+		c.JSON(200, gin.H{"user_id": middleware.UserID(c), "token_id": middleware.TokenID(c)})
+	})
+	return r
+}
+
+func do(r *gin.Engine, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/me", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestRequireAuth(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	client := &fakeAuthClient{
+		jwks: &auth.JWKSResponse{Keys: []*auth.JWK{{
+			Kty: "OKP", Kid: "k1", Use: "sig", Alg: "EdDSA", Crv: "Ed25519",
+			X: base64.RawURLEncoding.EncodeToString(pub),
+		}}},
+		validate: &auth.UserResponse{Valid: true, UserId: "user-1"},
+	}
+	cfg := middleware.AuthConfig{Issuer: "reading-club-auth", Audience: "reading-club"}
+
+	sign := func(mutate func(c *jwt.RegisteredClaims), kid string) string {
+		now := time.Now()
+		claims := jwt.RegisteredClaims{
+			Issuer:    "reading-club-auth",
+			Audience:  jwt.ClaimStrings{"reading-club"},
+			Subject:   "user-1",
+			ID:        "jti-1",
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+		}
+		if mutate != nil {
+			mutate(&claims)
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+		token.Header["kid"] = kid
+		s, err := token.SignedString(priv)
+		require.NoError(t, err)
+		return s
+	}
+
+	t.Run("valid token verified locally", func(t *testing.T) {
+		r := newRouter(middleware.NewAuthenticator(client, middleware.NewJWKSCache(client, time.Minute), cfg))
+		client.validations = 0
+
+		w := do(r, sign(nil, "k1"))
+		assert.Equal(t, 200, w.Code)
+		assert.JSONEq(t, `{"user_id":"user-1","token_id":"jti-1"}`, w.Body.String())
+		assert.Equal(t, 0, client.validations)
+
+		do(r, sign(nil, "k1"))
+		assert.Equal(t, 1, client.jwksCalls, "keys must be cached")
+	})
+
+	t.Run("identity is forwarded to backends", func(t *testing.T) {
+		a := middleware.NewAuthenticator(client, middleware.NewJWKSCache(client, time.Minute), cfg)
+		r := gin.New()
+		var forwarded svcauth.Identity
+		r.GET("/me", a.RequireAuth(), func(c *gin.Context) {
+			forwarded, _ = svcauth.FromContext(c.Request.Context())
+		})
+
+		assert.Equal(t, 200, do(r, sign(nil, "k1")).Code)
+		assert.Equal(t, "user-1", forwarded.UserID)
+	})
+
+	t.Run("missing header", func(t *testing.T) {
+		r := newRouter(middleware.NewAuthenticator(client, middleware.NewJWKSCache(client, time.Minute), cfg))
+		assert.Equal(t, 401, do(r, "").Code)
+	})
+
+	t.Run("wrong audience", func(t *testing.T) {
+		r := newRouter(middleware.NewAuthenticator(client, middleware.NewJWKSCache(client, time.Minute), cfg))
+		tok := sign(func(c *jwt.RegisteredClaims) { c.Audience = jwt.ClaimStrings{"other"} }, "k1")
+		assert.Equal(t, 401, do(r, tok).Code)
+	})
+
+	t.Run("token without jti", func(t *testing.T) {
+		r := newRouter(middleware.NewAuthenticator(client, middleware.NewJWKSCache(client, time.Minute), cfg))
+		tok := sign(func(c *jwt.RegisteredClaims) { c.ID = "" }, "k1")
+		assert.Equal(t, 401, do(r, tok).Code)
+	})
+
+	t.Run("unknown kid", func(t *testing.T) {
+		r := newRouter(middleware.NewAuthenticator(client, middleware.NewJWKSCache(client, time.Minute), cfg))
+		assert.Equal(t, 401, do(r, sign(nil, "k2")).Code)
+	})
+
+	t.Run("revoked token", func(t *testing.T) {
+		revCfg := cfg
+		revCfg.CheckRevocation = true
+		revoked := &fakeAuthClient{jwks: client.jwks, validate: &auth.UserResponse{Valid: false}}
+		r := newRouter(middleware.NewAuthenticator(revoked, middleware.NewJWKSCache(revoked, time.Minute), revCfg))
+
+		assert.Equal(t, 401, do(r, sign(nil, "k1")).Code)
+		assert.Equal(t, 1, revoked.validations)
+	})
+
+	t.Run("shared secret token is validated remotely", func(t *testing.T) {
+		hs, err := jwt.NewWithClaims(jwt.SigningMethodHS512, jwt.MapClaims{"sub": "user-1"}).SignedString([]byte("secret"))
+		require.NoError(t, err)
+
+		valid := &fakeAuthClient{validate: &auth.UserResponse{Valid: true, UserId: "user-1"}}
+		r := newRouter(middleware.NewAuthenticator(valid, middleware.NewJWKSCache(valid, time.Minute), cfg))
+		assert.Equal(t, 200, do(r, hs).Code)
+
+		invalid := &fakeAuthClient{validate: &auth.UserResponse{Valid: false}}
+		r = newRouter(middleware.NewAuthenticator(invalid, middleware.NewJWKSCache(invalid, time.Minute), cfg))
+		assert.Equal(t, 401, do(r, hs).Code, "Valid=false must not pass with an empty user id")
+	})
+}
+
+func TestRequireRole(t *testing.T) {
+	client := &fakeAuthClient{validate: &auth.UserResponse{Valid: true, UserId: "user-1", Roles: []string{"member"}}}
+	a := middleware.NewAuthenticator(client, middleware.NewJWKSCache(client, time.Minute), middleware.AuthConfig{})
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/me", a.RequireAuth(), middleware.RequireRole(middleware.RoleOrganizer, middleware.RoleAdmin), func(c *gin.Context) {
+		c.Status(204)
+	})
+
+	hs, err := jwt.NewWithClaims(jwt.SigningMethodHS512, jwt.MapClaims{"sub": "user-1"}).SignedString([]byte("secret"))
+	require.NoError(t, err)
+
+	assert.Equal(t, 403, do(r, hs).Code)
+
+	client.validate.Roles = []string{"member", "organizer"}
+	assert.Equal(t, 204, do(r, hs).Code)
+}
+
+func TestRequireVerifiedEmail(t *testing.T) {
+	client := &fakeAuthClient{validate: &auth.UserResponse{Valid: true, UserId: "user-1"}}
+	a := middleware.NewAuthenticator(client, middleware.NewJWKSCache(client, time.Minute), middleware.AuthConfig{})
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/me", a.RequireAuth(), middleware.RequireVerifiedEmail(), func(c *gin.Context) {
+		c.Status(204)
+	})
+
+	hs, err := jwt.NewWithClaims(jwt.SigningMethodHS512, jwt.MapClaims{"sub": "user-1"}).SignedString([]byte("secret"))
+	require.NoError(t, err)
+
+	assert.Equal(t, 403, do(r, hs).Code)
+
+	client.validate.EmailVerified = true
+	assert.Equal(t, 204, do(r, hs).Code)
+}
+
+func TestPersonalTokens(t *testing.T) {
+	client := &fakeAuthClient{validate: &auth.UserResponse{
+		Valid: true, UserId: "user-1", PersonalToken: true, Scopes: []string{middleware.ScopeEventsRead},
+	}}
+	a := middleware.NewAuthenticator(client, middleware.NewJWKSCache(client, time.Minute), middleware.AuthConfig{})
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/read", a.RequireAuth(), middleware.RequireScope(middleware.ScopeEventsRead), func(c *gin.Context) {
+		c.Status(204)
+	})
+	r.GET("/write", a.RequireAuth(), middleware.RequireScope(middleware.ScopeEventsWrite), func(c *gin.Context) {
+		c.Status(204)
+	})
+	r.GET("/account", a.RequireAuth(), middleware.RejectPersonalTokens(), func(c *gin.Context) {
+		c.Status(204)
+	})
+
+	get := func(path, token string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	pat := middleware.PersonalTokenPrefix + "selector.verifier"
+	assert.Equal(t, 204, get("/read", pat))
+	assert.Equal(t, 1, client.validations, "personal tokens are validated remotely")
+	assert.Equal(t, 403, get("/write", pat))
+	assert.Equal(t, 403, get("/account", pat))
+
+	t.Run("session tokens are not limited by scopes", func(t *testing.T) {
+		client.validate = &auth.UserResponse{Valid: true, UserId: "user-1"}
+		hs, err := jwt.NewWithClaims(jwt.SigningMethodHS512, jwt.MapClaims{"sub": "user-1"}).SignedString([]byte("secret"))
+		require.NoError(t, err)
+
+		assert.Equal(t, 204, get("/write", hs))
+		assert.Equal(t, 204, get("/account", hs))
+	})
+
+	t.Run("prefixed token the auth service does not know as personal", func(t *testing.T) {
+		client.validate = &auth.UserResponse{Valid: true, UserId: "user-1"}
+		assert.Equal(t, 401, get("/read", pat))
+	})
+}
+
+func TestOAuthClientTokens(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	client := &fakeAuthClient{
+		jwks: &auth.JWKSResponse{Keys: []*auth.JWK{{
+			Kty: "OKP", Kid: "k1", Use: "sig", Alg: "EdDSA", Crv: "Ed25519",
+			X: base64.RawURLEncoding.EncodeToString(pub),
+		}}},
+	}
+	a := middleware.NewAuthenticator(client, middleware.NewJWKSCache(client, time.Minute), middleware.AuthConfig{})
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/read", a.RequireAuth(), middleware.RequireScope(middleware.ScopeEventsRead), func(c *gin.Context) {
+		c.String(200, middleware.ClientID(c))
+	})
+	r.GET("/account", a.RequireAuth(), middleware.RejectPersonalTokens(), func(c *gin.Context) {
+		c.Status(204)
+	})
+
+	sign := func(scope string) string {
+		now := time.Now()
+		token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.MapClaims{
+			"sub":       "user-1",
+			"jti":       "jti-1",
+			"iat":       now.Unix(),
+			"exp":       now.Add(time.Minute).Unix(),
+			"client_id": "client-1",
+			"scope":     scope,
+		})
+		token.Header["kid"] = "k1"
+		s, err := token.SignedString(priv)
+		require.NoError(t, err)
+		return s
+	}
+	get := func(path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/read", sign("openid events:read"))
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "client-1", w.Body.String())
+	assert.Equal(t, 403, get("/account", sign("openid events:read")).Code)
+	assert.Equal(t, 403, get("/read", sign("openid")).Code)
+	assert.Equal(t, 403, get("/read", sign("")).Code, "a client token without scopes is not unlimited")
+}
+
+func TestImpersonationTokens(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	client := &fakeAuthClient{
+		jwks: &auth.JWKSResponse{Keys: []*auth.JWK{{
+			Kty: "OKP", Kid: "k1", Use: "sig", Alg: "EdDSA", Crv: "Ed25519",
+			X: base64.RawURLEncoding.EncodeToString(pub),
+		}}},
+	}
+	a := middleware.NewAuthenticator(client, middleware.NewJWKSCache(client, time.Minute), middleware.AuthConfig{})
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	var forwarded svcauth.Identity
+	r.GET("/me", a.RequireAuth(), func(c *gin.Context) {
+		forwarded, _ = svcauth.FromContext(c.Request.Context())
+		c.String(200, middleware.ActorID(c))
+	})
+
+	sign := func(act any) string {
+		now := time.Now()
+		token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.MapClaims{
+			"sub": "user-1",
+			"jti": "jti-1",
+			"iat": now.Unix(),
+			"exp": now.Add(time.Minute).Unix(),
+			"act": act,
+		})
+		token.Header["kid"] = "k1"
+		s, err := token.SignedString(priv)
+		require.NoError(t, err)
+		return s
+	}
+
+	w := do(r, sign(map[string]string{"sub": "admin-1"}))
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "admin-1", w.Body.String())
+	assert.Equal(t, "admin-1", forwarded.ActorID, "backends must see the actor")
+
+	assert.Equal(t, 401, do(r, sign(map[string]string{})).Code, "an act claim must name the actor")
+}
@@ -0,0 +1,21 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/polyakovaa/grpcproxy/svcauth"
+)
+
+// ClientMetadata forwards the client IP and user agent on every backend call
+// made with the request context. They are signed along with the user
+// identity, so backends can trust them. The IP is only taken from
+// X-Forwarded-For when the request came through a trusted proxy.
+func ClientMetadata() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := svcauth.NewClientContext(c.Request.Context(), svcauth.Client{
+			IP:        c.ClientIP(),
+			UserAgent: c.Request.UserAgent(),
+		})
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
@@ -0,0 +1,34 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/polyakovaa/grpcproxy/gateway/internal/middleware"
+	"github.com/polyakovaa/grpcproxy/svcauth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientMetadata(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	require.NoError(t, r.SetTrustedProxies(nil))
+
+	var client svcauth.Client
+	r.GET("/", middleware.ClientMetadata(), func(c *gin.Context) {
+		client, _ = svcauth.ClientFromContext(c.Request.Context())
+		c.Status(204)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "203.0.113.7:51234"
+	req.Header.Set("User-Agent", "test-agent")
+	req.Header.Set("X-Forwarded-For", "198.51.100.1")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, "203.0.113.7", client.IP, "untrusted X-Forwarded-For must be ignored")
+	assert.Equal(t, "test-agent", client.UserAgent)
+}
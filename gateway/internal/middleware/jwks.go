@@ -0,0 +1,137 @@
+package middleware
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/polyakovaa/grpcproxy/gen/auth"
+)
+
+// minRefreshInterval limits how often the keys are fetched, so tokens with
+// unknown kids or an unreachable auth service cannot flood the JWKS RPC.
+const minRefreshInterval = 10 * time.Second
+
+type jwksKey struct {
+	alg    string
+	public crypto.PublicKey
+}
+
+// JWKSCache keeps the public keys of the auth service in memory and refetches
+// them when they are older than ttl or when a token names an unknown kid.
+// Only one fetch runs at a time; requests that wait for it use its result.
+type JWKSCache struct {
+	client auth.AuthServiceClient
+	ttl    time.Duration
+
+	mu        sync.RWMutex
+	keys      map[string]jwksKey
+	fetchedAt time.Time
+
+	// fetchMu is held for the duration of a fetch. lastAttempt is guarded
+	// by it and also counts failed fetches.
+	fetchMu     sync.Mutex
+	lastAttempt time.Time
+}
+
+func NewJWKSCache(client auth.AuthServiceClient, ttl time.Duration) *JWKSCache {
+	return &JWKSCache{
+		client: client,
+		ttl:    ttl,
+		keys:   map[string]jwksKey{},
+	}
+}
+
+func (c *JWKSCache) Key(ctx context.Context, kid string) (string, crypto.PublicKey, error) {
+	requested := time.Now()
+
+	c.mu.RLock()
+	key, ok := c.keys[kid]
+	age := time.Since(c.fetchedAt)
+	c.mu.RUnlock()
+
+	if ok && age < c.ttl {
+		return key.alg, key.public, nil
+	}
+	if err := c.refresh(ctx, requested); err != nil {
+		if ok {
+			return key.alg, key.public, nil
+		}
+		return "", nil, err
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	key, ok = c.keys[kid]
+	if !ok {
+		return "", nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	return key.alg, key.public, nil
+}
+
+// refresh fetches the keys unless another request fetched them after
+// requested or the last attempt was less than minRefreshInterval ago.
+func (c *JWKSCache) refresh(ctx context.Context, requested time.Time) error {
+	c.fetchMu.Lock()
+	defer c.fetchMu.Unlock()
+
+	c.mu.RLock()
+	fetchedAt := c.fetchedAt
+	c.mu.RUnlock()
+	if fetchedAt.After(requested) || time.Since(c.lastAttempt) < minRefreshInterval {
+		return nil
+	}
+	c.lastAttempt = time.Now()
+
+	resp, err := c.client.GetJWKS(ctx, &auth.GetJWKSRequest{})
+	if err != nil {
+		return fmt.Errorf("failed to fetch jwks: %w", err)
+	}
+
+	keys := make(map[string]jwksKey, len(resp.Keys))
+	for _, k := range resp.Keys {
+		public, err := publicKeyFromJWK(k)
+		if err != nil {
+			return err
+		}
+		keys[k.Kid] = jwksKey{alg: k.Alg, public: public}
+	}
+
+	c.mu.Lock()
+	c.keys = keys
+	c.fetchedAt = time.Now()
+	c.mu.Unlock()
+
+	return nil
+}
+
+func publicKeyFromJWK(k *auth.JWK) (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: invalid modulus: %w", k.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: invalid exponent: %w", k.Kid, err)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("key %s: unsupported curve %q", k.Kid, k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("key %s: invalid Ed25519 key", k.Kid)
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("key %s: unsupported key type %q", k.Kid, k.Kty)
+}
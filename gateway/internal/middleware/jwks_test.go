@@ -0,0 +1,81 @@
+package middleware_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/polyakovaa/grpcproxy/gateway/internal/middleware"
+	"github.com/polyakovaa/grpcproxy/gen/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+// slowJWKSClient answers GetJWKS after a delay so concurrent lookups overlap.
+type slowJWKSClient struct {
+	auth.AuthServiceClient
+	jwks  *auth.JWKSResponse
+	err   error
+	calls atomic.Int32
+}
+
+func (f *slowJWKSClient) GetJWKS(ctx context.Context, in *auth.GetJWKSRequest, opts ...grpc.CallOption) (*auth.JWKSResponse, error) {
+	f.calls.Add(1)
+	time.Sleep(20 * time.Millisecond)
+	return f.jwks, f.err
+}
+
+func TestJWKSCache(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	jwks := &auth.JWKSResponse{Keys: []*auth.JWK{{
+		Kty: "OKP", Kid: "k1", Use: "sig", Alg: "EdDSA", Crv: "Ed25519",
+		X: base64.RawURLEncoding.EncodeToString(pub),
+	}}}
+
+	t.Run("concurrent lookups share one fetch", func(t *testing.T) {
+		client := &slowJWKSClient{jwks: jwks}
+		cache := middleware.NewJWKSCache(client, time.Minute)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, _, err := cache.Key(context.Background(), "k1")
+				assert.NoError(t, err)
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, int32(1), client.calls.Load())
+	})
+
+	t.Run("unknown kids do not refetch", func(t *testing.T) {
+		client := &slowJWKSClient{jwks: jwks}
+		cache := middleware.NewJWKSCache(client, time.Minute)
+
+		for i := 0; i < 5; i++ {
+			_, _, err := cache.Key(context.Background(), "k2")
+			assert.Error(t, err)
+		}
+		assert.Equal(t, int32(1), client.calls.Load())
+	})
+
+	t.Run("failed fetches are not retried at once", func(t *testing.T) {
+		client := &slowJWKSClient{err: errors.New("unavailable")}
+		cache := middleware.NewJWKSCache(client, time.Minute)
+
+		for i := 0; i < 5; i++ {
+			_, _, err := cache.Key(context.Background(), "k1")
+			assert.Error(t, err)
+		}
+		assert.Equal(t, int32(1), client.calls.Load())
+	})
+}
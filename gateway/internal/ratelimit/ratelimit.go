@@ -0,0 +1,70 @@
+// Package ratelimit caps how often a key, such as an email address, may be
+// used within a fixed window.
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often Limiter drops windows that have ended.
+const sweepInterval = time.Minute
+
+// Limiter allows Requests uses of a key per Window. Counters are kept in
+// process memory, so they are lost on restart and not shared between
+// replicas.
+type Limiter struct {
+	requests int
+	window   time.Duration
+
+	mu        sync.Mutex
+	windows   map[string]window
+	lastSweep time.Time
+}
+
+type window struct {
+	start time.Time
+	count int
+}
+
+func New(requests int, per time.Duration) *Limiter {
+	return &Limiter{
+		requests: requests,
+		window:   per,
+		windows:  map[string]window{},
+	}
+}
+
+// Allow counts a use of key at now. If the key used up its window it returns
+// false and how long until the window ends.
+func (l *Limiter) Allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+
+	w := l.windows[key]
+	if now.Sub(w.start) >= l.window {
+		w = window{start: now}
+	}
+	if w.count >= l.requests {
+		return false, w.start.Add(l.window).Sub(now)
+	}
+	w.count++
+	l.windows[key] = w
+
+	return true, 0
+}
+
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	for key, w := range l.windows {
+		if now.Sub(w.start) >= l.window {
+			delete(l.windows, key)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package ratelimit_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/polyakovaa/grpcproxy/gateway/internal/ratelimit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiter(t *testing.T) {
+	l := ratelimit.New(2, time.Minute)
+	now := time.Now()
+
+	ok, _ := l.Allow("a@example.com", now)
+	assert.True(t, ok)
+	ok, _ = l.Allow("a@example.com", now.Add(10*time.Second))
+	assert.True(t, ok)
+
+	ok, retryAfter := l.Allow("a@example.com", now.Add(20*time.Second))
+	assert.False(t, ok)
+	assert.Equal(t, 40*time.Second, retryAfter)
+
+	ok, _ = l.Allow("b@example.com", now.Add(20*time.Second))
+	assert.True(t, ok, "keys are limited separately")
+
+	ok, _ = l.Allow("a@example.com", now.Add(time.Minute))
+	assert.True(t, ok, "a new window starts once the previous one ended")
+}
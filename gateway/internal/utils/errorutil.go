@@ -1,7 +1,11 @@
 package utils
 
 import (
+	"math"
+	"strconv"
+
 	"github.com/gin-gonic/gin"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -12,12 +16,25 @@ func HandleGRPCError(c *gin.Context, err error) {
 		case codes.NotFound:
 			c.JSON(404, gin.H{"error": status.Message()})
 		case codes.InvalidArgument:
-			c.JSON(400, gin.H{"error": status.Message()})
+			body := gin.H{"error": status.Message()}
+			if fields := fieldViolations(status); len(fields) > 0 {
+				body["fields"] = fields
+			}
+			c.JSON(400, body)
 		case codes.Unauthenticated:
 			c.JSON(401, gin.H{"error": status.Message()})
 		case codes.AlreadyExists:
 			c.JSON(409, gin.H{"error": status.Message()})
-		
+		case codes.PermissionDenied:
+			c.JSON(403, gin.H{"error": status.Message()})
+		case codes.FailedPrecondition:
+			c.JSON(400, gin.H{"error": status.Message()})
+		case codes.ResourceExhausted:
+			setRetryAfter(c, status)
+			c.JSON(429, gin.H{"error": status.Message()})
+		case codes.Unimplemented:
+			c.JSON(501, gin.H{"error": status.Message()})
+
 		default:
 			c.JSON(500, gin.H{"error": "internal server error"})
 		}
@@ -25,3 +42,48 @@ func HandleGRPCError(c *gin.Context, err error) {
 	}
 	c.JSON(500, gin.H{"error": "internal server error"})
 }
+
+// setRetryAfter turns the RetryInfo detail of st into a Retry-After header.
+func setRetryAfter(c *gin.Context, st *status.Status) {
+	for _, d := range st.Details() {
+		if info, ok := d.(*errdetails.RetryInfo); ok && info.RetryDelay != nil {
+			seconds := int64(math.Ceil(info.RetryDelay.AsDuration().Seconds()))
+			c.Header("Retry-After", strconv.FormatInt(seconds, 10))
+			return
+		}
+	}
+}
+
+type fieldViolation struct {
+	Field       string `json:"field"`
+	Description string `json:"description"`
+}
+
+// fieldViolations lists the BadRequest details of st so clients can show
+// each problem next to the offending input.
+func fieldViolations(st *status.Status) []fieldViolation {
+	var fields []fieldViolation
+	for _, d := range st.Details() {
+		if br, ok := d.(*errdetails.BadRequest); ok {
+			for _, v := range br.FieldViolations {
+				fields = append(fields, fieldViolation{Field: v.Field, Description: v.Description})
+			}
+		}
+	}
+	return fields
+}
+
+// OAuthErrorCode returns the OAuth error code the auth service attached to
+// err, or "" if there is none.
+func OAuthErrorCode(err error) string {
+	st, ok := status.FromError(err)
+	if !ok {
+		return ""
+	}
+	for _, d := range st.Details() {
+		if info, ok := d.(*errdetails.ErrorInfo); ok && info.Domain == "oauth2" {
+			return info.Reason
+		}
+	}
+	return ""
+}
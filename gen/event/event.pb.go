@@ -192,6 +192,7 @@ type EventResponse struct {
 	Description   string                 `protobuf:"bytes,3,opt,name=description,proto3" json:"description,omitempty"`
 	Date          string                 `protobuf:"bytes,4,opt,name=date,proto3" json:"date,omitempty"`
 	OrganizerId   string                 `protobuf:"bytes,5,opt,name=organizer_id,json=organizerId,proto3" json:"organizer_id,omitempty"`
+	Cancelled     bool                   `protobuf:"varint,6,opt,name=cancelled,proto3" json:"cancelled,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -261,6 +262,13 @@ func (x *EventResponse) GetOrganizerId() string {
 	return ""
 }
 
+func (x *EventResponse) GetCancelled() bool {
+	if x != nil {
+		return x.Cancelled
+	}
+	return false
+}
+
 type JoinEventResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Success       bool                   `protobuf:"varint,1,opt,name=success,proto3" json:"success,omitempty"`
@@ -425,6 +433,163 @@ func (x *ListEventsResponse) GetTotalCount() int32 {
 	return 0
 }
 
+// Fields that are not set are left unchanged.
+type UpdateEventRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	EventId       string                 `protobuf:"bytes,1,opt,name=event_id,json=eventId,proto3" json:"event_id,omitempty"`
+	Title         *string                `protobuf:"bytes,2,opt,name=title,proto3,oneof" json:"title,omitempty"`
+	Description   *string                `protobuf:"bytes,3,opt,name=description,proto3,oneof" json:"description,omitempty"`
+	Date          *string                `protobuf:"bytes,4,opt,name=date,proto3,oneof" json:"date,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdateEventRequest) Reset() {
+	*x = UpdateEventRequest{}
+	mi := &file_proto_event_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateEventRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateEventRequest) ProtoMessage() {}
+
+func (x *UpdateEventRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_event_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateEventRequest.ProtoReflect.Descriptor instead.
+func (*UpdateEventRequest) Descriptor() ([]byte, []int) {
+	return file_proto_event_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *UpdateEventRequest) GetEventId() string {
+	if x != nil {
+		return x.EventId
+	}
+	return ""
+}
+
+func (x *UpdateEventRequest) GetTitle() string {
+	if x != nil && x.Title != nil {
+		return *x.Title
+	}
+	return ""
+}
+
+func (x *UpdateEventRequest) GetDescription() string {
+	if x != nil && x.Description != nil {
+		return *x.Description
+	}
+	return ""
+}
+
+func (x *UpdateEventRequest) GetDate() string {
+	if x != nil && x.Date != nil {
+		return *x.Date
+	}
+	return ""
+}
+
+type CancelEventRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	EventId       string                 `protobuf:"bytes,1,opt,name=event_id,json=eventId,proto3" json:"event_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CancelEventRequest) Reset() {
+	*x = CancelEventRequest{}
+	mi := &file_proto_event_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CancelEventRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CancelEventRequest) ProtoMessage() {}
+
+func (x *CancelEventRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_event_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CancelEventRequest.ProtoReflect.Descriptor instead.
+func (*CancelEventRequest) Descriptor() ([]byte, []int) {
+	return file_proto_event_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *CancelEventRequest) GetEventId() string {
+	if x != nil {
+		return x.EventId
+	}
+	return ""
+}
+
+type CancelEventResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Success       bool                   `protobuf:"varint,1,opt,name=success,proto3" json:"success,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CancelEventResponse) Reset() {
+	*x = CancelEventResponse{}
+	mi := &file_proto_event_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CancelEventResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CancelEventResponse) ProtoMessage() {}
+
+func (x *CancelEventResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_event_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CancelEventResponse.ProtoReflect.Descriptor instead.
+func (*CancelEventResponse) Descriptor() ([]byte, []int) {
+	return file_proto_event_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *CancelEventResponse) GetSuccess() bool {
+	if x != nil {
+		return x.Success
+	}
+	return false
+}
+
 var File_proto_event_proto protoreflect.FileDescriptor
 
 const file_proto_event_proto_rawDesc = "" +
@@ -439,13 +604,14 @@ const file_proto_event_proto_rawDesc = "" +
 	"\bevent_id\x18\x01 \x01(\tR\aeventId\"F\n" +
 	"\x10JoinEventRequest\x12\x19\n" +
 	"\bevent_id\x18\x01 \x01(\tR\aeventId\x12\x17\n" +
-	"\auser_id\x18\x02 \x01(\tR\x06userId\"\x99\x01\n" +
+	"\auser_id\x18\x02 \x01(\tR\x06userId\"\xb7\x01\n" +
 	"\rEventResponse\x12\x19\n" +
 	"\bevent_id\x18\x01 \x01(\tR\aeventId\x12\x14\n" +
 	"\x05title\x18\x02 \x01(\tR\x05title\x12 \n" +
 	"\vdescription\x18\x03 \x01(\tR\vdescription\x12\x12\n" +
 	"\x04date\x18\x04 \x01(\tR\x04date\x12!\n" +
-	"\forganizer_id\x18\x05 \x01(\tR\vorganizerId\"`\n" +
+	"\forganizer_id\x18\x05 \x01(\tR\vorganizerId\x12\x1c\n" +
+	"\tcancelled\x18\x06 \x01(\bR\tcancelled\"`\n" +
 	"\x11JoinEventResponse\x12\x18\n" +
 	"\asuccess\x18\x01 \x01(\bR\asuccess\x12\x18\n" +
 	"\amessage\x18\x02 \x01(\tR\amessage\x12\x17\n" +
@@ -456,13 +622,27 @@ const file_proto_event_proto_rawDesc = "" +
 	"\x12ListEventsResponse\x12,\n" +
 	"\x06events\x18\x01 \x03(\v2\x14.event.EventResponseR\x06events\x12\x1f\n" +
 	"\vtotal_count\x18\x02 \x01(\x05R\n" +
-	"totalCount2\x8b\x02\n" +
+	"totalCount\"\xad\x01\n" +
+	"\x12UpdateEventRequest\x12\x19\n" +
+	"\bevent_id\x18\x01 \x01(\tR\aeventId\x12\x19\n" +
+	"\x05title\x18\x02 \x01(\tH\x00R\x05title\x88\x01\x01\x12%\n" +
+	"\vdescription\x18\x03 \x01(\tH\x01R\vdescription\x88\x01\x01\x12\x17\n" +
+	"\x04date\x18\x04 \x01(\tH\x02R\x04date\x88\x01\x01B\b\n" +
+	"\x06_titleB\x0e\n" +
+	"\f_descriptionB\a\n" +
+	"\x05_date\"/\n" +
+	"\x12CancelEventRequest\x12\x19\n" +
+	"\bevent_id\x18\x01 \x01(\tR\aeventId\"/\n" +
+	"\x13CancelEventResponse\x12\x18\n" +
+	"\asuccess\x18\x01 \x01(\bR\asuccess2\x91\x03\n" +
 	"\fEventService\x12>\n" +
 	"\vCreateEvent\x12\x19.event.CreateEventRequest\x1a\x14.event.EventResponse\x128\n" +
 	"\bGetEvent\x12\x16.event.GetEventRequest\x1a\x14.event.EventResponse\x12>\n" +
 	"\tJoinEvent\x12\x17.event.JoinEventRequest\x1a\x18.event.JoinEventResponse\x12A\n" +
 	"\n" +
-	"ListEvents\x12\x18.event.ListEventsRequest\x1a\x19.event.ListEventsResponseB\vZ\tgen/eventb\x06proto3"
+	"ListEvents\x12\x18.event.ListEventsRequest\x1a\x19.event.ListEventsResponse\x12>\n" +
+	"\vUpdateEvent\x12\x19.event.UpdateEventRequest\x1a\x14.event.EventResponse\x12D\n" +
+	"\vCancelEvent\x12\x19.event.CancelEventRequest\x1a\x1a.event.CancelEventResponseB\vZ\tgen/eventb\x06proto3"
 
 var (
 	file_proto_event_proto_rawDescOnce sync.Once
@@ -476,15 +656,18 @@ func file_proto_event_proto_rawDescGZIP() []byte {
 	return file_proto_event_proto_rawDescData
 }
 
-var file_proto_event_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
+var file_proto_event_proto_msgTypes = make([]protoimpl.MessageInfo, 10)
 var file_proto_event_proto_goTypes = []any{
-	(*CreateEventRequest)(nil), // 0: event.CreateEventRequest
-	(*GetEventRequest)(nil),    // 1: event.GetEventRequest
-	(*JoinEventRequest)(nil),   // 2: event.JoinEventRequest
-	(*EventResponse)(nil),      // 3: event.EventResponse
-	(*JoinEventResponse)(nil),  // 4: event.JoinEventResponse
-	(*ListEventsRequest)(nil),  // 5: event.ListEventsRequest
-	(*ListEventsResponse)(nil), // 6: event.ListEventsResponse
+	(*CreateEventRequest)(nil),  // 0: event.CreateEventRequest
+	(*GetEventRequest)(nil),     // 1: event.GetEventRequest
+	(*JoinEventRequest)(nil),    // 2: event.JoinEventRequest
+	(*EventResponse)(nil),       // 3: event.EventResponse
+	(*JoinEventResponse)(nil),   // 4: event.JoinEventResponse
+	(*ListEventsRequest)(nil),   // 5: event.ListEventsRequest
+	(*ListEventsResponse)(nil),  // 6: event.ListEventsResponse
+	(*UpdateEventRequest)(nil),  // 7: event.UpdateEventRequest
+	(*CancelEventRequest)(nil),  // 8: event.CancelEventRequest
+	(*CancelEventResponse)(nil), // 9: event.CancelEventResponse
 }
 var file_proto_event_proto_depIdxs = []int32{
 	3, // 0: event.ListEventsResponse.events:type_name -> event.EventResponse
@@ -492,12 +675,16 @@ var file_proto_event_proto_depIdxs = []int32{
 	1, // 2: event.EventService.GetEvent:input_type -> event.GetEventRequest
 	2, // 3: event.EventService.JoinEvent:input_type -> event.JoinEventRequest
 	5, // 4: event.EventService.ListEvents:input_type -> event.ListEventsRequest
-	3, // 5: event.EventService.CreateEvent:output_type -> event.EventResponse
-	3, // 6: event.EventService.GetEvent:output_type -> event.EventResponse
-	4, // 7: event.EventService.JoinEvent:output_type -> event.JoinEventResponse
-	6, // 8: event.EventService.ListEvents:output_type -> event.ListEventsResponse
-	5, // [5:9] is the sub-list for method output_type
-	1, // [1:5] is the sub-list for method input_type
+	7, // 5: event.EventService.UpdateEvent:input_type -> event.UpdateEventRequest
+	8, // 6: event.EventService.CancelEvent:input_type -> event.CancelEventRequest
+	3, // 7: event.EventService.CreateEvent:output_type -> event.EventResponse
+	3, // 8: event.EventService.GetEvent:output_type -> event.EventResponse
+	4, // 9: event.EventService.JoinEvent:output_type -> event.JoinEventResponse
+	6, // 10: event.EventService.ListEvents:output_type -> event.ListEventsResponse
+	3, // 11: event.EventService.UpdateEvent:output_type -> event.EventResponse
+	9, // 12: event.EventService.CancelEvent:output_type -> event.CancelEventResponse
+	7, // [7:13] is the sub-list for method output_type
+	1, // [1:7] is the sub-list for method input_type
 	1, // [1:1] is the sub-list for extension type_name
 	1, // [1:1] is the sub-list for extension extendee
 	0, // [0:1] is the sub-list for field type_name
@@ -508,13 +695,14 @@ func file_proto_event_proto_init() {
 	if File_proto_event_proto != nil {
 		return
 	}
+	file_proto_event_proto_msgTypes[7].OneofWrappers = []any{}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_event_proto_rawDesc), len(file_proto_event_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   7,
+			NumMessages:   10,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
@@ -0,0 +1,198 @@
+// Package svcauth authenticates the gateway to the backend services. The
+// gateway signs the identity of the end user it verified, and the client the
+// request came from, into the metadata of every call; the backends verify
+// the signature and take both from it instead of from request fields.
+package svcauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// MetadataKey carries the signed identity.
+const MetadataKey = "x-identity"
+
+const (
+	issuer = "gateway"
+	// tokenTTL only has to cover one call; every call is signed anew.
+	tokenTTL = 30 * time.Second
+	leeway   = 5 * time.Second
+)
+
+// Identity is the end user a call is made for. A zero Identity stands for
+// an anonymous request, e.g. to list events. ActorID is set when an admin
+// impersonates the user.
+type Identity struct {
+	UserID   string
+	Roles    []string
+	Scopes   []string
+	ClientID string
+	ActorID  string
+}
+
+// Client is the end user client a call is made for, as seen by the gateway.
+type Client struct {
+	IP        string
+	UserAgent string
+}
+
+type claims struct {
+	jwt.RegisteredClaims
+	Roles     []string `json:"roles,omitempty"`
+	Scope     string   `json:"scope,omitempty"`
+	ClientID  string   `json:"client_id,omitempty"`
+	ActorID   string   `json:"actor_id,omitempty"`
+	ClientIP  string   `json:"client_ip,omitempty"`
+	UserAgent string   `json:"user_agent,omitempty"`
+	// Scoped tells an identity scoped to nothing from an unlimited one, as
+	// both have an empty scope.
+	Scoped bool `json:"scoped,omitempty"`
+}
+
+type contextKey struct{}
+
+type clientContextKey struct{}
+
+// NewContext returns a context that carries id, for the client interceptor
+// on the way out and for the handlers on the way in.
+func NewContext(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the identity of the context. ok is false on the
+// server side when the call was not verified, which only happens while
+// enforcement is off.
+func FromContext(ctx context.Context) (id Identity, ok bool) {
+	id, ok = ctx.Value(contextKey{}).(Identity)
+	return id, ok
+}
+
+// NewClientContext returns a context that carries the client c, see
+// NewContext.
+func NewClientContext(ctx context.Context, c Client) context.Context {
+	return context.WithValue(ctx, clientContextKey{}, c)
+}
+
+// ClientFromContext returns the client of the context. Like FromContext, ok
+// is false on the server side when the call was not verified.
+func ClientFromContext(ctx context.Context) (c Client, ok bool) {
+	c, ok = ctx.Value(clientContextKey{}).(Client)
+	return c, ok
+}
+
+// UnaryClientInterceptor signs the identity and client of the context, or an
+// anonymous identity, for the called method.
+func UnaryClientInterceptor(secret []byte) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		id, _ := FromContext(ctx)
+		client, _ := ClientFromContext(ctx)
+		token, err := sign(secret, method, id, client, time.Now())
+		if err != nil {
+			return status.Errorf(codes.Internal, "failed to sign identity: %v", err)
+		}
+		ctx = metadata.AppendToOutgoingContext(ctx, MetadataKey, token)
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// sign binds id to method, so a captured token cannot be replayed against
+// another method.
+func sign(secret []byte, method string, id Identity, client Client, now time.Time) (string, error) {
+	c := claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Subject:   id.UserID,
+			Audience:  jwt.ClaimStrings{method},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(tokenTTL)),
+		},
+		Roles:     id.Roles,
+		Scope:     strings.Join(id.Scopes, " "),
+		Scoped:    id.Scopes != nil,
+		ClientID:  id.ClientID,
+		ActorID:   id.ActorID,
+		ClientIP:  client.IP,
+		UserAgent: client.UserAgent,
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, c).SignedString(secret)
+}
+
+func verify(secret []byte, method, token string) (Identity, Client, error) {
+	c := &claims{}
+	_, err := jwt.ParseWithClaims(token, c, func(*jwt.Token) (any, error) { return secret, nil },
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(issuer),
+		jwt.WithAudience(method),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(leeway),
+	)
+	if err != nil {
+		return Identity{}, Client{}, err
+	}
+
+	id := Identity{UserID: c.Subject, Roles: c.Roles, ClientID: c.ClientID, ActorID: c.ActorID}
+	if c.Scoped || c.Scope != "" {
+		// Never nil, policies treat nil scopes as unlimited.
+		id.Scopes = append([]string{}, strings.Fields(c.Scope)...)
+	}
+	return id, Client{IP: c.ClientIP, UserAgent: c.UserAgent}, nil
+}
+
+// UnaryServerInterceptor verifies the identity of incoming calls and puts it
+// into the context. With enforce set, calls without a valid identity are
+// rejected. Without it, such calls are logged and let through unverified so
+// backends can be switched over before the gateway signs its calls.
+func UnaryServerInterceptor(secret []byte, enforce bool) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		id, client, err := identityFromMetadata(ctx, secret, info.FullMethod)
+		if err != nil {
+			if enforce {
+				log.Printf("Rejected call to %s: %v", info.FullMethod, err)
+				return nil, status.Error(codes.Unauthenticated, "invalid service credentials")
+			}
+			log.Printf("Unverified call to %s: %v", info.FullMethod, err)
+			return handler(ctx, req)
+		}
+		if id.ActorID != "" {
+			log.Printf("Impersonated call to %s: admin %s as user %s", info.FullMethod, id.ActorID, id.UserID)
+		}
+		return handler(NewClientContext(NewContext(ctx, id), client), req)
+	}
+}
+
+func identityFromMetadata(ctx context.Context, secret []byte, method string) (Identity, Client, error) {
+	if len(secret) == 0 {
+		return Identity{}, Client{}, errors.New("no service secret configured")
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(MetadataKey)
+	if len(values) != 1 {
+		return Identity{}, Client{}, fmt.Errorf("expected one %s metadata value, got %d", MetadataKey, len(values))
+	}
+	return verify(secret, method, values[0])
+}
+
+// UserID returns the user a call is made for. Verified calls take the user
+// from their identity and fail for anonymous identities; fallback, the user
+// ID from the request, is only used for unverified calls.
+func UserID(ctx context.Context, fallback string) (string, error) {
+	id, ok := FromContext(ctx)
+	if !ok {
+		return fallback, nil
+	}
+	if id.UserID == "" {
+		return "", status.Error(codes.Unauthenticated, "authentication required")
+	}
+	return id.UserID, nil
+}
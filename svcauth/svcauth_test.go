@@ -0,0 +1,130 @@
+package svcauth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const method = "/event.EventService/CreateEvent"
+
+var secret = []byte("0123456789abcdef0123456789abcdef")
+
+// outgoing runs the client interceptor and returns the metadata it sent.
+func outgoing(t *testing.T, ctx context.Context, key []byte) metadata.MD {
+	var sent metadata.MD
+	invoker := func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		sent, _ = metadata.FromOutgoingContext(ctx)
+		return nil
+	}
+	require.NoError(t, UnaryClientInterceptor(key)(ctx, method, nil, nil, nil, invoker))
+	return sent
+}
+
+// incoming runs the server interceptor and returns the context the handler
+// saw.
+func incoming(md metadata.MD, fullMethod string, enforce bool) (context.Context, error) {
+	var seen context.Context
+	handler := func(ctx context.Context, req any) (any, error) {
+		seen = ctx
+		return nil, nil
+	}
+	ctx := metadata.NewIncomingContext(context.Background(), md)
+	_, err := UnaryServerInterceptor(secret, enforce)(ctx, nil, &grpc.UnaryServerInfo{FullMethod: fullMethod}, handler)
+	return seen, err
+}
+
+func TestRoundTrip(t *testing.T) {
+	id := Identity{UserID: "user-1", Roles: []string{"member"}, Scopes: []string{"events:write"}, ClientID: "app", ActorID: "admin-1"}
+	client := Client{IP: "203.0.113.7", UserAgent: "test-agent"}
+	md := outgoing(t, NewClientContext(NewContext(context.Background(), id), client), secret)
+
+	ctx, err := incoming(md, method, true)
+	require.NoError(t, err)
+	got, ok := FromContext(ctx)
+	require.True(t, ok)
+	assert.Equal(t, id, got)
+	gotClient, ok := ClientFromContext(ctx)
+	require.True(t, ok)
+	assert.Equal(t, client, gotClient)
+
+	userID, err := UserID(ctx, "spoofed")
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", userID)
+}
+
+func TestEmptyScopes(t *testing.T) {
+	tests := []struct {
+		name   string
+		scopes []string
+	}{
+		{"unlimited", nil},
+		{"scoped to nothing", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			md := outgoing(t, NewContext(context.Background(), Identity{UserID: "user-1", Scopes: tt.scopes}), secret)
+
+			ctx, err := incoming(md, method, true)
+			require.NoError(t, err)
+			got, ok := FromContext(ctx)
+			require.True(t, ok)
+			assert.Equal(t, tt.scopes, got.Scopes)
+		})
+	}
+}
+
+func TestAnonymousIdentity(t *testing.T) {
+	md := outgoing(t, context.Background(), secret)
+
+	ctx, err := incoming(md, method, true)
+	require.NoError(t, err)
+	_, ok := FromContext(ctx)
+	assert.True(t, ok)
+
+	_, err = UserID(ctx, "spoofed")
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestRejectsInvalidIdentities(t *testing.T) {
+	valid := outgoing(t, NewContext(context.Background(), Identity{UserID: "user-1"}), secret)
+	expired, err := sign(secret, method, Identity{UserID: "user-1"}, Client{}, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		md     metadata.MD
+		method string
+	}{
+		{"missing", metadata.MD{}, method},
+		{"other method", valid, "/event.EventService/JoinEvent"},
+		{"wrong secret", outgoing(t, context.Background(), []byte("another-secret")), method},
+		{"expired", metadata.Pairs(MetadataKey, expired), method},
+		{"twice", metadata.Join(valid, valid), method},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := incoming(tt.md, tt.method, true)
+			assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+			ctx, err := incoming(tt.md, tt.method, false)
+			require.NoError(t, err, "calls are let through while enforcement is off")
+			_, ok := FromContext(ctx)
+			assert.False(t, ok)
+			_, ok = ClientFromContext(ctx)
+			assert.False(t, ok)
+
+			userID, err := UserID(ctx, "from-request")
+			require.NoError(t, err)
+			assert.Equal(t, "from-request", userID)
+		})
+	}
+}